@@ -0,0 +1,71 @@
+// Package apperrors is the error model of the API. Handlers and
+// repositories return an *Error for failures the client should know about,
+// HTTPErrorHandler turns every error into an RFC 7807 problem+json body.
+package apperrors
+
+import "net/http"
+
+// Error is a failure with the HTTP status it maps to and a machine readable
+// code, clients should switch on Code rather than on the message.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	// Fields explains which request fields are wrong and why
+	Fields map[string]string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, "bad_request", message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, "unauthorized", message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, "forbidden", message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, "not_found", message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, "conflict", message)
+}
+
+// PreconditionFailed is a conditional request, such as If-Match, whose
+// condition does not hold.
+func PreconditionFailed(message string) *Error {
+	return New(http.StatusPreconditionFailed, "precondition_failed", message)
+}
+
+// Validation is a well formed request with invalid values, fields maps the
+// name of each invalid field to the problem.
+func Validation(message string, fields map[string]string) *Error {
+	err := New(http.StatusUnprocessableEntity, "validation_failed", message)
+	err.Fields = fields
+	return err
+}
+
+// Internal hides err from the client, it is only logged.
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal", Message: "internal server error", Err: err}
+}
@@ -0,0 +1,92 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is the RFC 7807 body of every error response.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     string            `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// ProblemFor describes err. An *Error anywhere in the chain decides the
+// status, the detail is the message of the whole chain so wrapping adds
+// context. Errors echo raises (bad routes, jwt, binding) keep their status,
+// anything else is an internal error whose message is not shown.
+func ProblemFor(err error) Problem {
+	var (
+		appErr  *Error
+		httpErr *echo.HTTPError
+		p       Problem
+	)
+
+	switch {
+	case errors.As(err, &appErr):
+		p = Problem{Status: appErr.Status, Code: appErr.Code, Detail: err.Error(), Errors: appErr.Fields}
+		if appErr.Status >= http.StatusInternalServerError {
+			p.Detail = appErr.Message
+		}
+	case errors.As(err, &httpErr):
+		p = Problem{Status: httpErr.Code, Code: codeFor(httpErr.Code), Detail: fmt.Sprint(httpErr.Message)}
+	default:
+		internal := Internal(err)
+		p = Problem{Status: internal.Status, Code: internal.Code, Detail: internal.Message}
+	}
+
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	return p
+}
+
+// StatusCode is the status err is answered with.
+func StatusCode(err error) int {
+	return ProblemFor(err).Status
+}
+
+// "Not Found" becomes "not_found"
+func codeFor(status int) string {
+	switch status {
+	case http.StatusUnprocessableEntity:
+		return "validation_failed"
+	case http.StatusInternalServerError:
+		return "internal"
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// HTTPErrorHandler is installed as echo's error handler.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	p := ProblemFor(err)
+	p.Instance = c.Request().URL.Path
+
+	if p.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(p.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+		err = c.JSON(p.Status, p)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
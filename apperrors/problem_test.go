@@ -0,0 +1,64 @@
+package apperrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemFor(t *testing.T) {
+	notFound := NotFound("record not found")
+
+	testCase := []struct {
+		Name         string
+		Err          error
+		ExpectStatus int
+		ExpectCode   string
+		ExpectDetail string
+	}{
+		{"app error", Conflict("email already taken"), http.StatusConflict, "conflict", "email already taken"},
+		{"wrapped app error", fmt.Errorf("book 7: %w", notFound), http.StatusNotFound, "not_found", "book 7: record not found"},
+		{"echo error", echo.NewHTTPError(http.StatusMethodNotAllowed, "method not allowed"), http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed"},
+		{"unknown error is hidden", errors.New("dial tcp: connection refused"), http.StatusInternalServerError, "internal", "internal server error"},
+		{"internal error is hidden", Internal(errors.New("disk full")), http.StatusInternalServerError, "internal", "internal server error"},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			p := ProblemFor(val.Err)
+			assert.Equal(t, val.ExpectStatus, p.Status)
+			assert.Equal(t, val.ExpectCode, p.Code)
+			assert.Equal(t, val.ExpectDetail, p.Detail)
+			assert.Equal(t, http.StatusText(val.ExpectStatus), p.Title)
+		})
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/v1/books/1", nil)
+	w := httptest.NewRecorder()
+	ctx := echo.New().NewContext(r, w)
+
+	HTTPErrorHandler(Validation("invalid book", map[string]string{"title": "required"}), ctx)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, MIMEProblemJSON, w.Header().Get(echo.HeaderContentType))
+
+	var p Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, Problem{
+		Type:     "about:blank",
+		Title:    "Unprocessable Entity",
+		Status:   http.StatusUnprocessableEntity,
+		Detail:   "invalid book",
+		Instance: "/v1/books/1",
+		Code:     "validation_failed",
+		Errors:   map[string]string{"title": "required"},
+	}, p)
+}
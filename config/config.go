@@ -2,9 +2,13 @@ package config
 
 import (
 	"fmt"
+	"learn_testing/helpers"
+	"learn_testing/migrations"
 	"learn_testing/models"
 
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -12,38 +16,90 @@ var (
 	DB *gorm.DB
 )
 
-func Init() {
-	InitDB()
+func Init(cfg *AppConfig) {
+	InitPassword(cfg.Password)
+	InitDB(cfg.DB)
 	InitialMigrate()
+	InitAdmin(cfg.AdminEmail)
 }
 
-func InitDB() {
-	config := models.Config{
-		DB_Username: ViperEnvVariable("DB_USERNAME"),
-		DB_Password: ViperEnvVariable("DB_PASSWORD"),
-		DB_Port:     ViperEnvVariable("DB_PORT"),
-		DB_Host:     ViperEnvVariable("DB_HOST"),
-		DB_Name:     ViperEnvVariable("DB_NAME"),
+// configure password hashing
+func InitPassword(passwordConfig helpers.PasswordConfig) {
+	hasher, err := helpers.NewPasswordHasher(passwordConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	helpers.SetPasswordHasher(hasher)
+}
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Dialector returns the gorm dialector for the configured driver.
+func (config DBConfig) Dialector() (gorm.Dialector, error) {
+	switch config.Driver {
+	case DriverMySQL:
+		return mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			config.Username,
+			config.Password,
+			config.Host,
+			config.Port,
+			config.Name,
+		)), nil
+	case DriverPostgres:
+		return postgres.Open(fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s TimeZone=UTC",
+			config.Host,
+			config.Port,
+			config.Username,
+			config.Password,
+			config.Name,
+			config.SSLMode,
+		)), nil
+	case DriverSQLite:
+		// foreign keys are off by default in sqlite, and concurrent writers
+		// wait for the lock instead of failing right away. Transactions take
+		// the write lock when they begin, two that read before writing would
+		// otherwise deadlock and one of them fail.
+		return sqlite.Open(fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", config.Name)), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Driver)
 	}
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		config.DB_Username,
-		config.DB_Password,
-		config.DB_Host,
-		config.DB_Port,
-		config.DB_Name,
-	)
+}
 
-	var err error
+func InitDB(config DBConfig) {
+	dialector, err := config.Dialector()
+	if err != nil {
+		panic(err)
+	}
 
-	DB, err = gorm.Open(mysql.Open(connectionString), &gorm.Config{})
+	DB, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		panic(err)
 	}
 }
 
-// auto migrate with db
+// apply pending schema migrations, other instances starting at the same
+// time wait on the migration lock
 func InitialMigrate() {
-	DB.AutoMigrate(&models.Users{}, &models.Books{})
+	if _, err := migrations.New(DB).Up(); err != nil {
+		panic(err)
+	}
+}
+
+// promote the account named by ADMIN_EMAIL to admin, so a fresh install has
+// someone who can assign roles
+func InitAdmin(email string) {
+	if email == "" {
+		return
+	}
+
+	if err := DB.Model(&models.Users{}).Where("email = ?", helpers.NormalizeEmail(email)).Update("role", models.RoleAdmin).Error; err != nil {
+		panic(err)
+	}
 }
 
 // Test Func
@@ -1,26 +1,313 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"learn_testing/helpers"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-func ViperEnvVariable(key string) string {
+const DefaultLogFormat = "method=${method}, uri=${uri},  status=${status}, latency_human=${latency_human}\n"
 
-	viper.SetConfigFile(".env")
+// AppConfig is the whole service configuration, it is loaded once at startup
+// by Load and passed to whatever needs it.
+type AppConfig struct {
+	DB         DBConfig
+	JWT        JWTConfig
+	Server     ServerConfig
+	Log        LogConfig
+	Trash      TrashConfig
+	Lending    LendingConfig
+	Fines      FinesConfig
+	Password   helpers.PasswordConfig
+	AdminEmail string
+	// Args are the command-line arguments left after the flags, e.g.
+	// "migrate up"
+	Args []string
+}
+
+type DBConfig struct {
+	Driver   string
+	Username string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+	SSLMode  string
+}
+
+type JWTConfig struct {
+	Secret          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type ServerConfig struct {
+	Port string
+}
+
+type LogConfig struct {
+	Format string
+}
+
+// TrashConfig is how long soft deleted rows are kept and how often they
+// are purged, a zero PurgeInterval never purges.
+type TrashConfig struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// LendingConfig is how long books are lent for, how many books a user can
+// borrow at once, how long a held copy waits for its pickup and how often
+// the holds not picked up expire, a zero HoldExpiryInterval never expires
+// them.
+type LendingConfig struct {
+	LoanPeriod         time.Duration
+	MaxLoans           int
+	HoldPickupPeriod   time.Duration
+	HoldExpiryInterval time.Duration
+}
+
+// FinesConfig is the late fine of books whose category sets none, in minor
+// units of Currency, a zero Cap does not cap it. Every SweepInterval the
+// late returns of the last SweepWindow that were not fined are, a zero
+// SweepInterval never sweeps.
+type FinesConfig struct {
+	DailyRate     int64
+	Cap           int64
+	Currency      string
+	SweepWindow   time.Duration
+	SweepInterval time.Duration
+}
+
+// ValidationError lists every setting that is missing or can not be parsed.
+type ValidationError struct {
+	Missing []string
+	Invalid []string
+}
+
+func (e *ValidationError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing required settings: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		parts = append(parts, "invalid settings: "+strings.Join(e.Invalid, "; "))
+	}
+	return "config: " + strings.Join(parts, "; ")
+}
+
+// setting is a key as written in the .env file or the environment, with the
+// command-line flag overriding it.
+type setting struct {
+	key      string
+	flag     string
+	fallback string
+	required bool
+	usage    string
+}
+
+func settings() []setting {
+	password := helpers.DefaultPasswordConfig()
+
+	return []setting{
+		{"DB_DRIVER", "db-driver", DriverMySQL, true, "mysql, postgres or sqlite"},
+		{"DB_USERNAME", "db-username", "", false, "database user"},
+		{"DB_PASSWORD", "db-password", "", false, "database password"},
+		{"DB_HOST", "db-host", "", false, "database host"},
+		{"DB_PORT", "db-port", "", false, "database port, defaults to the driver's port"},
+		{"DB_NAME", "db-name", "", true, "database name, or file path for sqlite"},
+		{"DB_SSLMODE", "db-sslmode", "disable", false, "postgres sslmode"},
+		{"SECRET_KEY", "secret-key", "", true, "key used to sign jwt"},
+		{"ACCESS_TOKEN_TTL", "access-token-ttl", "1h", true, "lifetime of access tokens"},
+		{"REFRESH_TOKEN_TTL", "refresh-token-ttl", "720h", true, "lifetime of refresh tokens"},
+		{"PORT", "port", "8000", true, "http port"},
+		{"LOG_FORMAT", "log-format", DefaultLogFormat, false, "request log format"},
+		{"PASSWORD_ALGORITHM", "password-algorithm", password.Algorithm, true, "argon2id or bcrypt"},
+		{"ARGON2_MEMORY", "argon2-memory", fmt.Sprint(password.Argon2Memory), true, "argon2id memory in KiB"},
+		{"ARGON2_ITERATIONS", "argon2-iterations", fmt.Sprint(password.Argon2Iterations), true, "argon2id iterations"},
+		{"ARGON2_PARALLELISM", "argon2-parallelism", fmt.Sprint(password.Argon2Parallelism), true, "argon2id threads"},
+		{"BCRYPT_COST", "bcrypt-cost", fmt.Sprint(password.BcryptCost), true, "bcrypt cost"},
+		{"TRASH_RETENTION", "trash-retention", "720h", true, "how long deleted books and users can be restored"},
+		{"TRASH_PURGE_INTERVAL", "trash-purge-interval", "1h", true, "how often the trash is purged, 0 never"},
+		{"LOAN_PERIOD", "loan-period", "336h", true, "how long books are lent for"},
+		{"MAX_LOANS", "max-loans", "5", true, "how many books a user can borrow at once"},
+		{"HOLD_PICKUP_PERIOD", "hold-pickup-period", "72h", true, "how long a copy is held for pickup"},
+		{"HOLD_EXPIRY_INTERVAL", "hold-expiry-interval", "15m", true, "how often holds not picked up expire, 0 never"},
+		{"FINE_DAILY_RATE", "fine-daily-rate", "25", true, "late fine per day in minor units"},
+		{"FINE_CAP", "fine-cap", "2000", true, "most a late fine can be in minor units, 0 no cap"},
+		{"FINE_CURRENCY", "fine-currency", "USD", true, "currency of fines"},
+		{"FINE_SWEEP_WINDOW", "fine-sweep-window", "168h", true, "how far back late returns without a fine are fined"},
+		{"FINE_SWEEP_INTERVAL", "fine-sweep-interval", "1h", true, "how often late returns without a fine are fined, 0 never"},
+		{"ADMIN_EMAIL", "admin-email", "", false, "account promoted to admin at startup"},
+	}
+}
+
+// Load reads the configuration from, in increasing priority, defaults, the
+// config file (.env unless --config is given), environment variables and
+// command-line flags.
+func Load(args []string) (*AppConfig, error) {
+	v := viper.New()
+
+	flags := pflag.NewFlagSet("learn_testing", pflag.ContinueOnError)
+	configFile := flags.String("config", ".env", "configuration file")
+	for _, s := range settings() {
+		v.SetDefault(s.key, s.fallback)
+		flags.String(s.flag, s.fallback, s.usage)
+	}
 
-	err := viper.ReadInConfig()
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	for _, s := range settings() {
+		if err := v.BindPFlag(s.key, flags.Lookup(s.flag)); err != nil {
+			return nil, err
+		}
+		if err := v.BindEnv(s.key); err != nil {
+			return nil, err
+		}
+	}
 
+	v.SetConfigFile(*configFile)
+	if err := v.ReadInConfig(); err != nil {
+		// the default .env is optional, everything can come from the environment
+		if !errors.Is(err, fs.ErrNotExist) || flags.Changed("config") {
+			return nil, fmt.Errorf("config: reading %s: %w", *configFile, err)
+		}
+	}
+
+	cfg, err := fromViper(v)
 	if err != nil {
-		log.Fatalf("Error while reading config file %s", err)
+		return nil, err
+	}
+	cfg.Args = flags.Args()
+	return cfg, nil
+}
+
+func fromViper(v *viper.Viper) (*AppConfig, error) {
+	verr := &ValidationError{}
+
+	driver := v.GetString("DB_DRIVER")
+	for _, s := range settings() {
+		required := s.required
+		// a sqlite database is just a file
+		if (s.key == "DB_USERNAME" || s.key == "DB_HOST") && driver != DriverSQLite {
+			required = true
+		}
+		if required && strings.TrimSpace(v.GetString(s.key)) == "" {
+			verr.Missing = append(verr.Missing, s.key)
+		}
 	}
 
-	value, ok := viper.Get(key).(string)
+	port := v.GetString("DB_PORT")
+	switch driver {
+	case DriverMySQL:
+		if port == "" {
+			port = "3306"
+		}
+	case DriverPostgres:
+		if port == "" {
+			port = "5432"
+		}
+	case DriverSQLite:
+	default:
+		verr.Invalid = append(verr.Invalid, fmt.Sprintf("DB_DRIVER: unknown driver %q", driver))
+	}
+
+	duration := func(key string) time.Duration {
+		d, err := time.ParseDuration(v.GetString(key))
+		if err != nil && v.GetString(key) != "" {
+			verr.Invalid = append(verr.Invalid, fmt.Sprintf("%s: %v", key, err))
+		}
+		return d
+	}
+	number := func(key string, bitSize int) uint64 {
+		var n uint64
+		if _, err := fmt.Sscan(v.GetString(key), &n); err != nil && v.GetString(key) != "" {
+			verr.Invalid = append(verr.Invalid, fmt.Sprintf("%s: not a number", key))
+		} else if bitSize < 64 && n >= 1<<bitSize {
+			verr.Invalid = append(verr.Invalid, fmt.Sprintf("%s: out of range", key))
+		}
+		return n
+	}
+
+	password := helpers.DefaultPasswordConfig()
+	password.Algorithm = v.GetString("PASSWORD_ALGORITHM")
+	password.Argon2Memory = uint32(number("ARGON2_MEMORY", 32))
+	password.Argon2Iterations = uint32(number("ARGON2_ITERATIONS", 32))
+	password.Argon2Parallelism = uint8(number("ARGON2_PARALLELISM", 8))
+	password.BcryptCost = int(number("BCRYPT_COST", 8))
+
+	cfg := &AppConfig{
+		DB: DBConfig{
+			Driver:   driver,
+			Username: v.GetString("DB_USERNAME"),
+			Password: v.GetString("DB_PASSWORD"),
+			Host:     v.GetString("DB_HOST"),
+			Port:     port,
+			Name:     v.GetString("DB_NAME"),
+			SSLMode:  v.GetString("DB_SSLMODE"),
+		},
+		JWT: JWTConfig{
+			Secret:          v.GetString("SECRET_KEY"),
+			AccessTokenTTL:  duration("ACCESS_TOKEN_TTL"),
+			RefreshTokenTTL: duration("REFRESH_TOKEN_TTL"),
+		},
+		Server: ServerConfig{
+			Port: v.GetString("PORT"),
+		},
+		Log: LogConfig{
+			Format: v.GetString("LOG_FORMAT"),
+		},
+		Trash: TrashConfig{
+			Retention:     duration("TRASH_RETENTION"),
+			PurgeInterval: duration("TRASH_PURGE_INTERVAL"),
+		},
+		Lending: LendingConfig{
+			LoanPeriod:         duration("LOAN_PERIOD"),
+			MaxLoans:           int(number("MAX_LOANS", 16)),
+			HoldPickupPeriod:   duration("HOLD_PICKUP_PERIOD"),
+			HoldExpiryInterval: duration("HOLD_EXPIRY_INTERVAL"),
+		},
+		Fines: FinesConfig{
+			DailyRate:     int64(number("FINE_DAILY_RATE", 63)),
+			Cap:           int64(number("FINE_CAP", 63)),
+			Currency:      v.GetString("FINE_CURRENCY"),
+			SweepWindow:   duration("FINE_SWEEP_WINDOW"),
+			SweepInterval: duration("FINE_SWEEP_INTERVAL"),
+		},
+		Password:   password,
+		AdminEmail: v.GetString("ADMIN_EMAIL"),
+	}
 
-	if !ok {
-		log.Fatalf("Invalid type assertion")
+	if len(verr.Missing) == 0 && len(verr.Invalid) == 0 {
+		if _, err := helpers.NewPasswordHasher(password); err != nil {
+			verr.Invalid = append(verr.Invalid, "PASSWORD_ALGORITHM: "+err.Error())
+		}
 	}
 
-	return value
+	if len(verr.Missing) > 0 || len(verr.Invalid) > 0 {
+		return nil, verr
+	}
+	return cfg, nil
+}
+
+// LoadOrExit is Load for main, it prints the error and exits on failure.
+func LoadOrExit() *AppConfig {
+	cfg, err := Load(os.Args[1:])
+	if errors.Is(err, pflag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return cfg
 }
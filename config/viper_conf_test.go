@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadValidationListsEveryMissingSetting(t *testing.T) {
+	_, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.env")})
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.env")
+	assert.NoError(t, os.WriteFile(empty, nil, 0o600))
+
+	_, err = Load([]string{"--config", empty})
+
+	verr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"DB_USERNAME", "DB_HOST", "DB_NAME", "SECRET_KEY"}, verr.Missing)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.env")
+	assert.NoError(t, os.WriteFile(file, []byte(
+		"DB_USERNAME=root\nDB_HOST=localhost\nDB_NAME=learn\nSECRET_KEY=from-file\nPORT=9000\n",
+	), 0o600))
+
+	t.Setenv("SECRET_KEY", "from-env")
+	t.Setenv("ACCESS_TOKEN_TTL", "15m")
+
+	cfg, err := Load([]string{"--config", file, "--port", "9100"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "root", cfg.DB.Username)
+	assert.Equal(t, "3306", cfg.DB.Port)
+	assert.Equal(t, "from-env", cfg.JWT.Secret)
+	assert.Equal(t, 15*time.Minute, cfg.JWT.AccessTokenTTL)
+	assert.Equal(t, 720*time.Hour, cfg.JWT.RefreshTokenTTL)
+	assert.Equal(t, "9100", cfg.Server.Port)
+	assert.Equal(t, DefaultLogFormat, cfg.Log.Format)
+	assert.Equal(t, "argon2id", cfg.Password.Algorithm)
+	assert.Equal(t, TrashConfig{Retention: 720 * time.Hour, PurgeInterval: time.Hour}, cfg.Trash)
+	assert.Equal(t, LendingConfig{LoanPeriod: 336 * time.Hour, MaxLoans: 5, HoldPickupPeriod: 72 * time.Hour, HoldExpiryInterval: 15 * time.Minute}, cfg.Lending)
+	assert.Equal(t, FinesConfig{DailyRate: 25, Cap: 2000, Currency: "USD", SweepWindow: 168 * time.Hour, SweepInterval: time.Hour}, cfg.Fines)
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.env")
+	assert.NoError(t, os.WriteFile(file, []byte(
+		"DB_USERNAME=root\nDB_HOST=localhost\nDB_NAME=learn\nSECRET_KEY=secret\nACCESS_TOKEN_TTL=soon\nBCRYPT_COST=abc\n",
+	), 0o600))
+
+	_, err := Load([]string{"--config", file})
+
+	verr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Empty(t, verr.Missing)
+	assert.Len(t, verr.Invalid, 2)
+}
+
+func TestLoadDrivers(t *testing.T) {
+	testCase := []struct {
+		Name          string
+		File          string
+		ExpectPort    string
+		ExpectMissing []string
+		ExpectInvalid bool
+	}{
+		{
+			"sqlite needs no server",
+			"DB_DRIVER=sqlite\nDB_NAME=learn.db\nSECRET_KEY=secret\n",
+			"",
+			nil,
+			false,
+		},
+		{
+			"postgres default port",
+			"DB_DRIVER=postgres\nDB_USERNAME=root\nDB_HOST=localhost\nDB_NAME=learn\nSECRET_KEY=secret\n",
+			"5432",
+			nil,
+			false,
+		},
+		{
+			"postgres needs a server",
+			"DB_DRIVER=postgres\nDB_NAME=learn\nSECRET_KEY=secret\n",
+			"",
+			[]string{"DB_USERNAME", "DB_HOST"},
+			false,
+		},
+		{
+			"unknown driver",
+			"DB_DRIVER=oracle\nDB_USERNAME=root\nDB_HOST=localhost\nDB_NAME=learn\nSECRET_KEY=secret\n",
+			"",
+			nil,
+			true,
+		},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "app.env")
+			assert.NoError(t, os.WriteFile(file, []byte(val.File), 0o600))
+
+			cfg, err := Load([]string{"--config", file})
+			if val.ExpectMissing != nil || val.ExpectInvalid {
+				verr, ok := err.(*ValidationError)
+				assert.True(t, ok)
+				assert.Equal(t, val.ExpectMissing, verr.Missing)
+				assert.Equal(t, val.ExpectInvalid, len(verr.Invalid) > 0)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectPort, cfg.DB.Port)
+		})
+	}
+}
+
+func TestInitDBSQLite(t *testing.T) {
+	InitDB(DBConfig{Driver: DriverSQLite, Name: filepath.Join(t.TempDir(), "learn.db")})
+	InitialMigrate()
+
+	assert.True(t, DB.Migrator().HasTable("users"))
+	assert.True(t, DB.Migrator().HasTable("revoked_tokens"))
+}
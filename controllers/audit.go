@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const redacted = "[redacted]"
+
+// auditField is a field of a book or user as shown in the audit trail,
+// secret fields (tagged audit:"redact") are compared but never shown and
+// fields tagged audit:"-" are left out.
+type auditField struct {
+	value  interface{}
+	secret bool
+}
+
+func (f auditField) shown() interface{} {
+	if f.secret && f.value != nil {
+		return redacted
+	}
+	return f.value
+}
+
+// the fields of record under their json names, gorm.Model is left out
+func auditFields(record interface{}) map[string]auditField {
+	fields := map[string]auditField{}
+	if record == nil {
+		return fields
+	}
+
+	value := reflect.Indirect(reflect.ValueOf(record))
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" || field.Tag.Get("audit") == "-" {
+			continue
+		}
+		fields[name] = auditField{value.Field(i).Interface(), field.Tag.Get("audit") == "redact"}
+	}
+	return fields
+}
+
+// audit records a change of a book or user from before to after, either is
+// nil when the record did not exist. The actor is the userId claim of the
+// token, nil for anonymous requests such as sign up. Updates that changed
+// nothing are not recorded.
+func audit(c echo.Context, events repositories.AuditRepository, entity string, id uint, action string, before, after interface{}) error {
+	from, to := auditFields(before), auditFields(after)
+
+	changes := models.AuditChanges{}
+	for name, f := range from {
+		if t, ok := to[name]; !ok || !reflect.DeepEqual(f.value, t.value) {
+			changes[name] = models.AuditChange{From: f.shown(), To: to[name].shown()}
+		}
+	}
+	for name, t := range to {
+		if _, ok := from[name]; !ok {
+			changes[name] = models.AuditChange{To: t.shown()}
+		}
+	}
+	if action == models.AuditUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	var state models.AuditState
+	if after != nil {
+		state = models.AuditState{}
+		for name, f := range to {
+			state[name] = f.shown()
+		}
+	}
+
+	event := models.AuditEvents{
+		EntityType: entity,
+		EntityID:   id,
+		Action:     action,
+		Changes:    changes,
+		State:      state,
+	}
+	if actor, ok := m.CurrentUserID(c); ok {
+		actorID := uint(actor)
+		event.ActorID = &actorID
+	}
+	return events.Record(&event)
+}
+
+// the books of list by id, the trashed ones included
+func booksByID(list func(repositories.ListQuery) ([]models.Books, repositories.Page, error)) (map[uint]models.Books, error) {
+	books := map[uint]models.Books{}
+	for _, trashed := range []bool{false, true} {
+		query := repositories.ListQuery{Limit: repositories.MaxLimit, Trashed: trashed}
+		for {
+			page, meta, err := list(query)
+			if err != nil {
+				return nil, err
+			}
+			for _, book := range page {
+				books[book.ID] = book
+			}
+			if meta.Next == "" {
+				break
+			}
+			query.Cursor = meta.Next
+		}
+	}
+	return books, nil
+}
+
+// auditCredits records the books that renaming an author or a publisher
+// rewrote, from before to after the rename
+func auditCredits(c echo.Context, events repositories.AuditRepository, before, after map[uint]models.Books) error {
+	ids := make([]uint, 0, len(after))
+	for id := range after {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		if err := audit(c, events, models.AuditBook, id, models.AuditUpdate, before[id], after[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list the audit trail of a record, filtered by ?action=, exists tells
+// whether a record without any event is unknown
+func history(c echo.Context, events repositories.AuditRepository, entity string, id int, exists func() error, message string) error {
+	query, err := listQuery(c, "action")
+	if err != nil {
+		return err
+	}
+
+	trail, page, err := events.History(entity, uint(id), query)
+	if err != nil {
+		return err
+	}
+	if page.Total == 0 {
+		if err := exists(); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": message,
+		"history": trail,
+		"meta":    listMeta(c, query, page),
+	})
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuthorController struct {
+	Authors repositories.AuthorRepository
+	Books   repositories.BookRepository
+	Index   repositories.BookIndexer
+	Audit   repositories.AuditRepository
+}
+
+func NewAuthorController(authors repositories.AuthorRepository, books repositories.BookRepository, index repositories.BookIndexer, audit repositories.AuditRepository) *AuthorController {
+	return &AuthorController{Authors: authors, Books: books, Index: index, Audit: audit}
+}
+
+// get all authors
+func (ac *AuthorController) GetAuthorsController(c echo.Context) error {
+	query, err := listQuery(c, "name")
+	if err != nil {
+		return err
+	}
+
+	authors, page, err := ac.Authors.List(query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get all authors",
+		"authors": authors,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// get author by id
+func (ac *AuthorController) GetAuthorController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	author, err := ac.Authors.FindByID(id)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get author by id",
+		"author":  author,
+	})
+}
+
+// list the books of an author
+func (ac *AuthorController) GetAuthorBooksController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := ac.Authors.FindByID(id); err != nil {
+		return err
+	}
+
+	query, err := listQuery(c, "author", "publisher", "title")
+	if err != nil {
+		return err
+	}
+
+	books, page, err := ac.Books.ListByAuthor(id, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get books of author",
+		"books":   books,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// create new author
+func (ac *AuthorController) CreateAuthorController(c echo.Context) error {
+	author := models.Authors{}
+	if err := bindAndValidate(c, &author); err != nil {
+		return err
+	}
+
+	if err := ac.Authors.Create(&author); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success create new author",
+		"author":  author,
+	})
+}
+
+// update author by id
+func (ac *AuthorController) UpdateAuthorController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	author := models.Authors{}
+	if err := bindAndValidatePresent(c, &author); err != nil {
+		return err
+	}
+
+	// the books credit the author by its new name, each one audited
+	books := func(query repositories.ListQuery) ([]models.Books, repositories.Page, error) {
+		return ac.Books.ListByAuthor(id, query)
+	}
+	var credited map[uint]models.Books
+	if author.Name != "" {
+		if credited, err = booksByID(books); err != nil {
+			return err
+		}
+	}
+
+	if err := ac.Authors.Update(id, author); err != nil {
+		return err
+	}
+	if author.Name != "" {
+		if err := ac.Index.ReindexAuthor(id); err != nil {
+			return err
+		}
+		renamed, err := booksByID(books)
+		if err != nil {
+			return err
+		}
+		if err := auditCredits(c, ac.Audit, credited, renamed); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated author by id",
+	})
+}
+
+// delete author by id, authors still credited on a book can not be deleted
+func (ac *AuthorController) DeleteAuthorController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	// a book restored from the trash must not come back to a missing author
+	for _, trashed := range []bool{false, true} {
+		_, page, err := ac.Books.ListByAuthor(id, repositories.ListQuery{Limit: 1, Trashed: trashed})
+		if err != nil {
+			return err
+		}
+		if page.Total > 0 && trashed {
+			return apperrors.Conflict("the author is credited on books in the trash, restore and unlink them or purge them first")
+		}
+		if page.Total > 0 {
+			return apperrors.Conflict("the author is credited on books, unlink them first")
+		}
+	}
+
+	if err := ac.Authors.Delete(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted author by id",
+	})
+}
@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	ac := NewAuthorController(bc.Authors, bc.Books, bc.Search.(repositories.BookIndexer), bc.Audit)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, contentType string, body string, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, contentType)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		return w, handler(ctx)
+	}
+
+	for _, name := range []string{"Terry Pratchett", "Neil Gaiman"} {
+		_, err := call(ac.CreateAuthorController, echo.MIMEApplicationJSON, `{"name": "`+name+`"}`, "")
+		assert.NoError(t, err)
+	}
+	_, err := call(ac.CreateAuthorController, echo.MIMEApplicationJSON, `{"name": ""}`, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+
+	testCase := []struct {
+		Name             string
+		Body             string
+		ExpectStatusCode int
+	}{
+		{"linked authors", `{"title": "good omens", "author_ids": [2, 1]}`, http.StatusOK},
+		{"unknown author", `{"title": "x", "author_ids": [9]}`, http.StatusUnprocessableEntity},
+		{"author listed twice", `{"title": "x", "author_ids": [1, 1]}`, http.StatusUnprocessableEntity},
+		{"unknown publisher", `{"title": "x", "publisher_id": 9}`, http.StatusUnprocessableEntity},
+		{"one author", `{"title": "discworld", "author_ids": [1]}`, http.StatusOK},
+	}
+	for _, val := range testCase {
+		_, err := call(bc.CreateBookController, echo.MIMEApplicationJSON, val.Body, "")
+		if val.ExpectStatusCode == http.StatusOK {
+			assert.NoError(t, err, val.Name)
+			continue
+		}
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+	}
+
+	w, err := call(ac.GetAuthorBooksController, "", "", "1")
+	assert.NoError(t, err)
+	var response struct {
+		Books []models.Books `json:"books"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response.Books, 2)
+	assert.Equal(t, []uint{2, 1}, response.Books[0].AuthorIDs)
+
+	_, err = call(ac.GetAuthorBooksController, "", "", "9")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	// credited authors stay until the books let go of them
+	_, err = call(ac.DeleteAuthorController, "", "", "2")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	// so do the ones credited on books in the trash only
+	assert.NoError(t, bc.Books.Delete(1, 0))
+	_, err = call(ac.DeleteAuthorController, "", "", "2")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	assert.NoError(t, bc.Books.Restore(1))
+	_, err = call(bc.PatchBookController, mimeJSONPatch, `[{"op": "test", "path": "/author_ids/0", "value": 2}, {"op": "remove", "path": "/author_ids/0"}]`, "1")
+	assert.NoError(t, err)
+	_, err = call(ac.DeleteAuthorController, "", "", "2")
+	assert.NoError(t, err)
+	_, err = call(ac.GetAuthorController, "", "", "2")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	book, err := bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{1}, book.AuthorIDs)
+	assert.Equal(t, "Terry Pratchett", book.Author)
+
+	// a new name is credited on the books and found by search
+	_, err = call(ac.UpdateAuthorController, echo.MIMEApplicationJSON, `{"name": "Sir Terry Pratchett"}`, "1")
+	assert.NoError(t, err)
+	book, err = bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Sir Terry Pratchett", book.Author)
+	books, _, err := bc.Books.List(repositories.ListQuery{Filters: map[string]string{"author": "sir terry pratchett"}})
+	assert.NoError(t, err)
+	assert.Len(t, books, 2)
+	results, err := bc.Search.Search("sir", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// every book credited anew is audited
+	history, _, err := bc.Audit.History(models.AuditBook, 2, repositories.ListQuery{Sort: repositories.ParseSort("-id")})
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditChange{From: "Terry Pratchett", To: "Sir Terry Pratchett"}, history[0].Changes["author"])
+}
+
+func TestBookCreditedNames(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, contentType string, body string, id string) error {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, contentType)
+		ctx := e.NewContext(r, httptest.NewRecorder())
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		return handler(ctx)
+	}
+	assert.NoError(t, bc.Authors.Create(&models.Authors{Name: "Terry Pratchett"}))
+
+	testCase := []struct {
+		Name        string
+		Handler     echo.HandlerFunc
+		ContentType string
+		Body        string
+		Author      string
+		AuthorIDs   []uint
+		Publisher   string
+	}{
+		{"names link to the authors of the same key or new ones", bc.CreateBookController, echo.MIMEApplicationJSON,
+			`{"title": "good omens", "author": "terry  pratchett & Neil Gaiman", "publisher": "Gollancz"}`,
+			"Terry Pratchett; Neil Gaiman", []uint{1, 2}, "Gollancz"},
+		{"linked authors name the book", bc.UpdateBookController, echo.MIMEApplicationJSON,
+			`{"author_ids": [2]}`, "Neil Gaiman", []uint{2}, "Gollancz"},
+		{"a new name links again", bc.UpdateBookController, echo.MIMEApplicationJSON,
+			`{"author": "Terry Pratchett", "publisher": "gollancz"}`, "Terry Pratchett", []uint{1}, "Gollancz"},
+		{"a patch that unlinks clears the name", bc.PatchBookController, mimeMergePatch,
+			`{"author_ids": [], "publisher_id": null}`, "", []uint{}, ""},
+		{"a patch of the name links it", bc.PatchBookController, mimeMergePatch,
+			`{"author": "Neil Gaiman", "publisher": "Transworld"}`, "Neil Gaiman", []uint{2}, "Transworld"},
+	}
+	for _, val := range testCase {
+		assert.NoError(t, call(val.Handler, val.ContentType, val.Body, "1"), val.Name)
+		book, err := bc.Books.FindByID(1)
+		assert.NoError(t, err, val.Name)
+		assert.Equal(t, val.Author, book.Author, val.Name)
+		assert.Equal(t, val.AuthorIDs, book.AuthorIDs, val.Name)
+		assert.Equal(t, val.Publisher, book.Publisher, val.Name)
+	}
+
+	// a write that fails creates none of the names it links
+	assert.NoError(t, call(bc.CreateBookController, echo.MIMEApplicationJSON, `{"title": "cosmos", "isbn": "9780306406157"}`, ""))
+	err := call(bc.UpdateBookController, echo.MIMEApplicationJSON, `{"isbn": "9780306406157", "author": "Jane Austen", "publisher": "Penguin"}`, "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+
+	authors, _, err := bc.Authors.List(repositories.ListQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, authors, 2)
+	publishers, _, err := bc.Publishers.List(repositories.ListQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, publishers, 2)
+}
@@ -1,76 +1,508 @@
 package controllers
 
 import (
-	"learn_testing/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
 	"learn_testing/models"
+	"learn_testing/repositories"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 )
 
-// get all books
-func GetBooksController(c echo.Context) error {
-	var books []models.Books
+type BookController struct {
+	Books      repositories.BookRepository
+	Search     repositories.BookSearcher
+	Audit      repositories.AuditRepository
+	Authors    repositories.AuthorRepository
+	Publishers repositories.PublisherRepository
+	Categories repositories.CategoryRepository
+	Reviews    repositories.ReviewRepository
+}
+
+func NewBookController(books repositories.BookRepository, search repositories.BookSearcher, audit repositories.AuditRepository, authors repositories.AuthorRepository, publishers repositories.PublisherRepository, categories repositories.CategoryRepository, reviews repositories.ReviewRepository) *BookController {
+	return &BookController{Books: books, Search: search, Audit: audit, Authors: authors, Publishers: publishers, Categories: categories, Reviews: reviews}
+}
+
+// get all books, with ?facets=true the facets of every page
+func (bc *BookController) GetBooksController(c echo.Context) error {
+	query, err := listQuery(c, "author", "publisher", "title")
+	if err != nil {
+		return err
+	}
 
-	if err := config.DB.Find(&books).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	filter, err := bc.bookFilter(c)
+	if err != nil {
+		return err
 	}
-	return c.JSON(http.StatusOK, map[string]interface{}{
+
+	withFacets, err := facetsParam(c)
+	if err != nil {
+		return err
+	}
+
+	books, page, err := bc.Books.Filter(filter, query)
+	if err != nil {
+		return err
+	}
+
+	response := map[string]interface{}{
 		"message": "success get all books",
 		"books":   books,
+		"meta":    listMeta(c, query, page),
+	}
+	if withFacets {
+		facets, err := bc.Books.Facets(filter, query)
+		if err == nil {
+			err = bc.nameFacets(&facets)
+		}
+		if err != nil {
+			return err
+		}
+		response["facets"] = facets
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+func facetsParam(c echo.Context) (bool, error) {
+	value := c.QueryParam("facets")
+	if value == "" {
+		return false, nil
+	}
+	facets, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, apperrors.BadRequest("facets must be true or false")
+	}
+	return facets, nil
+}
+
+// ?category= selects the books of a category and of the categories below
+// it, every ?tag= must be on the book
+func (bc *BookController) bookFilter(c echo.Context) (repositories.BookFilter, error) {
+	var filter repositories.BookFilter
+
+	if value := c.QueryParam("category"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, apperrors.BadRequest("category must be a number")
+		}
+		if _, err := bc.Categories.FindByID(id); errors.Is(err, repositories.ErrNotFound) {
+			return filter, apperrors.BadRequest(fmt.Sprintf("category %d does not exist", id))
+		} else if err != nil {
+			return filter, err
+		}
+		categories, err := bc.Categories.FindAll()
+		if err != nil {
+			return filter, err
+		}
+		filter.CategoryIDs = subtree(categories, uint(id))
+	}
+
+	filter.Tags = normalizeTags(c.QueryParams()["tag"])
+	return filter, nil
+}
+
+// the repository counts categories and publishers by id, they are named
+// here with one lookup each
+func (bc *BookController) nameFacets(facets *models.BookFacets) error {
+	if len(facets.Categories) > 0 {
+		categories, err := bc.Categories.FindByIDs(facetIDs(facets.Categories))
+		if err != nil {
+			return err
+		}
+		names := map[uint]string{}
+		for _, category := range categories {
+			names[category.ID] = category.Name
+		}
+		nameFacets(facets.Categories, names)
+	}
+
+	if len(facets.Publishers) > 0 {
+		publishers, err := bc.Publishers.FindByIDs(facetIDs(facets.Publishers))
+		if err != nil {
+			return err
+		}
+		names := map[uint]string{}
+		for _, publisher := range publishers {
+			names[publisher.ID] = publisher.Name
+		}
+		nameFacets(facets.Publishers, names)
+	}
+	return nil
+}
+
+func facetIDs(counts []models.FacetCount) []uint {
+	ids := make([]uint, len(counts))
+	for i := range counts {
+		ids[i] = counts[i].ID
+	}
+	return ids
+}
+
+// values that no longer exist stay without a name
+func nameFacets(counts []models.FacetCount, names map[uint]string) {
+	for i := range counts {
+		counts[i].Name = names[counts[i].ID]
+	}
+}
+
+// list the deleted books that can still be restored
+func (bc *BookController) GetTrashedBooksController(c echo.Context) error {
+	query, err := listQuery(c, "author", "publisher", "title")
+	if err != nil {
+		return err
+	}
+	query.Trashed = true
+
+	filter, err := bc.bookFilter(c)
+	if err != nil {
+		return err
+	}
+
+	books, page, err := bc.Books.Filter(filter, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get trashed books",
+		"books":   books,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// full-text search on title, author and publisher
+func (bc *BookController) SearchBooksController(c echo.Context) error {
+	q := strings.TrimSpace(c.QueryParam("q"))
+	if q == "" {
+		return apperrors.BadRequest("q is required")
+	}
+
+	limit := repositories.DefaultLimit
+	if value := c.QueryParam("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			return apperrors.BadRequest("limit must be a positive number")
+		}
+		if limit > repositories.MaxLimit {
+			limit = repositories.MaxLimit
+		}
+	}
+
+	results, err := bc.Search.Search(q, limit)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success search books",
+		"results": results,
 	})
 }
 
 // get book by id
-func GetBookController(c echo.Context) error {
-	var book models.Books
+func (bc *BookController) GetBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	book, err := bc.Books.FindByID(id)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	if err := config.DB.Where("id = ?", id).Find(&book).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	return bc.getBook(c, book, "success get book by id")
+}
+
+// get book by its ISBN-10 or ISBN-13, hyphens allowed
+func (bc *BookController) GetBookByISBNController(c echo.Context) error {
+	isbn, ok := helpers.NormalizeISBN(c.Param("isbn"))
+	if !ok {
+		return apperrors.BadRequest("isbn must be a valid ISBN-10 or ISBN-13")
 	}
 
+	book, err := bc.Books.FindByISBN(isbn)
+
+	if err != nil {
+		return err
+	}
+
+	return bc.getBook(c, book, "success get book by isbn")
+}
+
+// the book with the summary of its reviews, the ETag of the book carries
+// its rating so a review makes a cached copy stale
+func (bc *BookController) getBook(c echo.Context, book models.Books, message string) error {
+	setETag(c, bookETag(book))
+	if notModified(c, bookETag(book)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	summary, err := bc.Reviews.Summary(int(book.ID))
+
+	if err != nil {
+		return err
+	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "success get book by id",
+		"message": message,
 		"book":    book,
+		"rating":  summary,
 	})
 }
 
+// books are stored with the ISBN-13 of their valid isbn and the ISBN-10
+// derived from it
+func setISBN(book *models.Books) {
+	isbn, _ := helpers.NormalizeISBN(string(book.ISBN))
+	book.ISBN = models.NullableString(isbn)
+	book.ISBN10, _ = helpers.ISBN10(isbn)
+}
+
+// tags are stored normalized, sorted and once, nil stays nil for updates
+// that leave the tags alone
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = helpers.NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// the authors, the publisher and the category a book links to must exist,
+// an author is credited once
+func (bc *BookController) checkLinks(book models.Books) error {
+	fields := map[string]string{}
+
+	seen := map[uint]bool{}
+	for _, id := range book.AuthorIDs {
+		if seen[id] {
+			fields["author_ids"] = fmt.Sprintf("author %d is listed twice", id)
+			break
+		}
+		seen[id] = true
+
+		_, err := bc.Authors.FindByID(int(id))
+		if errors.Is(err, repositories.ErrNotFound) {
+			fields["author_ids"] = fmt.Sprintf("author %d does not exist", id)
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if book.PublisherID != nil {
+		_, err := bc.Publishers.FindByID(int(*book.PublisherID))
+		if errors.Is(err, repositories.ErrNotFound) {
+			fields["publisher_id"] = fmt.Sprintf("publisher %d does not exist", *book.PublisherID)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if book.CategoryID != nil {
+		_, err := bc.Categories.FindByID(int(*book.CategoryID))
+		if errors.Is(err, repositories.ErrNotFound) {
+			fields["category_id"] = fmt.Sprintf("category %d does not exist", *book.CategoryID)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > 0 {
+		return apperrors.Validation("request is invalid", fields)
+	}
+	return nil
+}
+
+// reconcile keeps the credited names of a book in line with the authors
+// and publisher it links to. Links the write changed name the book, names
+// it changed alone are linked by the write to the authors or publisher of
+// the same helpers.NameKey, created along with the book when there is none,
+// and unlinking clears the name. before is the book as stored, nil for a
+// new book; partial writes leave out what they do not set.
+func (bc *BookController) reconcile(book *models.Books, before *models.Books, partial bool) error {
+	var stored models.Books
+	if before != nil {
+		stored = *before
+	}
+
+	var err error
+	renamed := book.Author != "" && book.Author != stored.Author
+	switch {
+	case book.AuthorIDs != nil && !sameIDs(book.AuthorIDs, stored.AuthorIDs):
+		book.Author, err = bc.creditAuthors(book.AuthorIDs)
+	case renamed:
+		linkAuthors(book)
+	case partial:
+	case len(book.AuthorIDs) > 0:
+		book.Author, err = bc.creditAuthors(book.AuthorIDs)
+	case len(stored.AuthorIDs) > 0:
+		book.Author = ""
+	case book.Author != "":
+		linkAuthors(book)
+	}
+	if err != nil {
+		return err
+	}
+
+	renamed = book.Publisher != "" && book.Publisher != stored.Publisher
+	var publisher models.Publishers
+	switch {
+	case book.PublisherID != nil && (stored.PublisherID == nil || *book.PublisherID != *stored.PublisherID):
+		publisher, err = bc.Publishers.FindByID(int(*book.PublisherID))
+	case renamed:
+		linkPublisher(book)
+		return nil
+	case partial:
+		return nil
+	case book.PublisherID != nil:
+		publisher, err = bc.Publishers.FindByID(int(*book.PublisherID))
+	case stored.PublisherID != nil:
+		book.Publisher = ""
+		return nil
+	case book.Publisher != "":
+		linkPublisher(book)
+		return nil
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	book.PublisherID, book.Publisher = &publisher.ID, publisher.Name
+	return nil
+}
+
+// the names of the authors ids, as credited on a book
+func (bc *BookController) creditAuthors(ids []uint) (string, error) {
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		author, err := bc.Authors.FindByID(int(id))
+		if err != nil {
+			return "", err
+		}
+		names[i] = author.Name
+	}
+	return helpers.JoinAuthors(names), nil
+}
+
+// link the book to the authors credited in its author, each once
+func linkAuthors(book *models.Books) {
+	book.AuthorIDs = nil
+	book.LinkAuthors = append([]string{}, helpers.SplitAuthors(book.Author)...)
+}
+
+// link the book to the publisher named in its publisher
+func linkPublisher(book *models.Books) {
+	book.PublisherID = nil
+	book.LinkPublisher = helpers.CleanName(book.Publisher)
+}
+
+func sameIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // create new book
-func CreateBookController(c echo.Context) error {
+func (bc *BookController) CreateBookController(c echo.Context) error {
 	book := models.Books{}
-	c.Bind(&book)
+	if err := bindAndValidate(c, &book); err != nil {
+		return err
+	}
+	setISBN(&book)
+	book.Tags = normalizeTags(book.Tags)
+	if err := bc.checkLinks(book); err != nil {
+		return err
+	}
+	if err := bc.reconcile(&book, nil, false); err != nil {
+		return err
+	}
+
+	if err := bc.Books.Create(&book); err != nil {
+		return err
+	}
 
-	if err := config.DB.Save(&book).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	if err := audit(c, bc.Audit, models.AuditBook, book.ID, models.AuditCreate, nil, book); err != nil {
+		return err
 	}
 
+	setETag(c, bookETag(book))
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success create new books",
 		"books":   book,
 	})
 }
 
-// delete book by id
-func DeleteBookController(c echo.Context) error {
-	var book []models.Books
+// delete book by id, it goes to the trash unless ?permanent=true. If-Match
+// is honored for books that are not in the trash yet.
+func (bc *BookController) DeleteBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
 
-	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return err
+	}
 
+	permanent, err := permanentDelete(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
+	}
+
+	// a book in the trash can still be purged
+	var (
+		before  interface{}
+		version uint
+	)
+	book, err := bc.Books.FindByID(id)
+	if err == nil {
+		before = book
+		if version, err = ifMatch(c, book.Version); err != nil {
+			return err
+		}
+	} else if !permanent || !errors.Is(err, repositories.ErrNotFound) {
+		return err
 	}
 
-	res := config.DB.Unscoped().Delete(&book, "id = ?", id)
+	action := models.AuditDelete
+	if permanent {
+		action = models.AuditPurge
+		err = bc.Books.Purge(id)
+	} else {
+		err = bc.Books.Delete(id, version)
+	}
+	if err != nil {
+		return err
+	}
 
-	if res.Error != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	if err := audit(c, bc.Audit, models.AuditBook, uint(id), action, before, nil); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -78,22 +510,222 @@ func DeleteBookController(c echo.Context) error {
 	})
 }
 
-// update book by id
-func UpdateBookController(c echo.Context) error {
+// restore a deleted book from the trash
+func (bc *BookController) RestoreBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if err := bc.Books.Restore(id); err != nil {
+		return err
+	}
+
+	book, err := bc.Books.FindByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := audit(c, bc.Audit, models.AuditBook, book.ID, models.AuditRestore, nil, book); err != nil {
+		return err
+	}
+
+	setETag(c, bookETag(book))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success restored book by id",
+		"book":    book,
+	})
+}
+
+// update book by id, with If-Match only if the book was not changed since
+func (bc *BookController) UpdateBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
 	books := models.Books{}
-	c.Bind(&books)
+	if err := bindAndValidatePresent(c, &books); err != nil {
+		return err
+	}
+	setISBN(&books)
+	books.Tags = normalizeTags(books.Tags)
+	if err := bc.checkLinks(books); err != nil {
+		return err
+	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	before, err := bc.Books.FindByID(id)
+	if err != nil {
+		return err
+	}
 
+	if books.Version, err = ifMatch(c, before.Version); err != nil {
+		return err
+	}
+	if err := bc.reconcile(&books, &before, true); err != nil {
+		return err
+	}
+
+	if err := bc.Books.Update(id, books); err != nil {
+		return err
+	}
+
+	after, err := bc.Books.FindByID(id)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	if err := config.DB.Model(models.Books{}).Where("id = ?", id).Updates(books).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	if err := audit(c, bc.Audit, models.AuditBook, after.ID, models.AuditUpdate, before, after); err != nil {
+		return err
 	}
 
+	setETag(c, bookETag(after))
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success updated book by id",
 	})
 }
+
+// patch book by id with a merge patch or a json patch, unlike an update it
+// can clear fields
+func (bc *BookController) PatchBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	before, err := bc.Books.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ifMatch(c, before.Version); err != nil {
+		return err
+	}
+
+	book := models.Books{}
+	if err := applyPatch(c, before, &book, "title", "author", "publisher", "isbn", "author_ids", "publisher_id", "category_id", "tags"); err != nil {
+		return err
+	}
+	if err := c.Validate(&book); err != nil {
+		return err
+	}
+	setISBN(&book)
+	book.Tags = normalizeTags(book.Tags)
+	if err := bc.checkLinks(book); err != nil {
+		return err
+	}
+	if err := bc.reconcile(&book, &before, false); err != nil {
+		return err
+	}
+
+	// the patch was applied to before, a change made meanwhile must not be
+	// overwritten
+	book.Version = before.Version
+	if err := bc.Books.Replace(id, book); err != nil {
+		return err
+	}
+
+	after, err := bc.Books.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := audit(c, bc.Audit, models.AuditBook, after.ID, models.AuditUpdate, before, after); err != nil {
+		return err
+	}
+
+	setETag(c, bookETag(after))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success patched book by id",
+	})
+}
+
+// list the changes of a book, its deletion included
+func (bc *BookController) GetBookHistoryController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	exists := func() error {
+		_, err := bc.Books.FindByID(id)
+		return err
+	}
+	return history(c, bc.Audit, models.AuditBook, id, exists, "success get book history")
+}
+
+// put a book back the way it was after the given revision of its history
+func (bc *BookController) RevertBookController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	revision, err := idParam(c, "revision")
+
+	if err != nil {
+		return err
+	}
+
+	event, err := bc.Audit.FindEvent(revision)
+	if err == nil && (event.EntityType != models.AuditBook || event.EntityID != uint(id)) {
+		err = apperrors.NotFound(fmt.Sprintf("book %d has no revision %d", id, revision))
+	}
+	if err != nil {
+		return err
+	}
+	if event.State == nil {
+		return apperrors.BadRequest(fmt.Sprintf("revision %d deleted the book, there is nothing to revert to", revision))
+	}
+
+	var book models.Books
+	data, err := json.Marshal(event.State)
+	if err == nil {
+		err = json.Unmarshal(data, &book)
+	}
+	if err != nil {
+		return err
+	}
+
+	before, err := bc.Books.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if book.Version, err = ifMatch(c, before.Version); err != nil {
+		return err
+	}
+
+	// an author, publisher or category may have been deleted since
+	if err := bc.checkLinks(book); err != nil {
+		return err
+	}
+	if err := bc.reconcile(&book, &before, false); err != nil {
+		return err
+	}
+
+	if err := bc.Books.Replace(id, book); err != nil {
+		return err
+	}
+
+	after, err := bc.Books.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := audit(c, bc.Audit, models.AuditBook, after.ID, models.AuditRevert, before, after); err != nil {
+		return err
+	}
+
+	setETag(c, bookETag(after))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success reverted book",
+		"book":    after,
+	})
+}
@@ -3,44 +3,46 @@ package controllers
 import (
 	"bytes"
 	"encoding/json"
-	"learn_testing/config"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
 	"learn_testing/models"
+	"learn_testing/repositories"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
-func TestGetBooksController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New()
+// an echo like the one routes.New builds
+func newTestEcho() *echo.Echo {
+	e := echo.New()
+	e.Validator = helpers.NewValidator()
+	return e
+}
 
+func newBookController(t *testing.T, books ...models.Books) *BookController {
+	memory := repositories.NewMemoryBookRepository()
+	repo, err := repositories.NewIndexedBookRepository(memory)
 	assert.NoError(t, err)
+	for i := range books {
+		assert.NoError(t, repo.Create(&books[i]))
+	}
+	return NewBookController(repo, repo, repositories.NewMemoryAuditRepository(), repositories.NewMemoryAuthorRepository(memory), repositories.NewMemoryPublisherRepository(memory), repositories.NewMemoryCategoryRepository(), repositories.NewMemoryReviewRepository(memory))
+}
 
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	row := sqlmock.NewRows([]string{"title", "publisher"}).
-		AddRow("jalan jalan", "gramed")
+func TestGetBooksController(t *testing.T) {
+	t.Parallel()
 
-	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `books` WHERE `books`.`deleted_at` IS NULL")).
-		WillReturnRows(row)
+	bc := newBookController(t, models.Books{Title: "jalan jalan", Publisher: "gramed"})
 
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
 		Method           string
-		Body             models.Books
 		HasReturnBody    bool
 		ExpectBody       models.Books
 	}{
@@ -48,21 +50,23 @@ func TestGetBooksController(t *testing.T) {
 			"success",
 			http.StatusOK,
 			"GET",
-			models.Books{},
-			false,
-			models.Books{},
+			true,
+			models.Books{Title: "jalan jalan"},
 		},
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
 			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 
-			err := GetBooksController(ctx)
+			err := bc.GetBooksController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -72,36 +76,22 @@ func TestGetBooksController(t *testing.T) {
 				err := json.NewDecoder(w.Result().Body).Decode(&response)
 
 				assert.NoError(t, err)
-				assert.Equal(t, val.ExpectBody.Title, response["books"].(map[string]interface{})["title"])
+				assert.Equal(t, val.ExpectBody.Title, response["books"].([]interface{})[0].(map[string]interface{})["title"])
 			}
 		})
 	}
 }
 
 func TestGetBookController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New()
-
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	row := sqlmock.NewRows([]string{"title", "publisher", "author"}).
-		AddRow("jalan jalan", "gramed", "ahmad")
+	t.Parallel()
 
-	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `books` WHERE id = ? AND `books`.`deleted_at` IS NULL")).
-		WithArgs(1).
-		WillReturnRows(row)
+	bc := newBookController(t, models.Books{Title: "jalan jalan", Publisher: "gramed", Author: "ahmad"})
 
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
 		Method           string
-		Body             models.Books
+		Param            string
 		HasReturnBody    bool
 		ExpectBody       models.Books
 	}{
@@ -109,7 +99,7 @@ func TestGetBookController(t *testing.T) {
 			"success",
 			http.StatusOK,
 			"GET",
-			models.Books{},
+			"1",
 			true,
 			models.Books{
 				Title:     "jalan jalan",
@@ -117,21 +107,43 @@ func TestGetBookController(t *testing.T) {
 				Author:    "ahmad",
 			},
 		},
+		{
+			"invalid id",
+			http.StatusBadRequest,
+			"GET",
+			"abc",
+			false,
+			models.Books{},
+		},
+		{
+			"not found",
+			http.StatusNotFound,
+			"GET",
+			"99",
+			false,
+			models.Books{},
+		},
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
-			res, _ := json.Marshal(val.Body)
-			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			t.Parallel()
+
+			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
-			ctx.SetParamValues("1")
+			ctx.SetParamValues(val.Param)
 
-			err := GetBookController(ctx)
+			err := bc.GetBookController(ctx)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				return
+			}
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -142,29 +154,15 @@ func TestGetBookController(t *testing.T) {
 
 				assert.NoError(t, err)
 				assert.Equal(t, val.ExpectBody.Title, response["book"].(map[string]interface{})["title"])
+				assert.Equal(t, val.ExpectBody.Author, response["book"].(map[string]interface{})["author"])
 			}
 		})
 	}
 }
 
 func TestCreateBookController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
+	t.Parallel()
 
-	mocked.ExpectBegin()
-	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `books` (`created_at`,`updated_at`,`deleted_at`,`title`,`publisher`,`author`) VALUES (?,?,?,?,?,?)")).
-		WithArgs(time.Now(), time.Now(), "NULL", "jalan jalan", "gramed", "ahmad").
-		WillReturnResult(sqlmock.NewErrorResult(nil))
-
-	mocked.ExpectCommit()
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
@@ -188,15 +186,21 @@ func TestCreateBookController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			bc := newBookController(t)
+
 			res, _ := json.Marshal(val.Body)
 			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 
-			err := CreateBookController(ctx)
+			err := bc.CreateBookController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -208,31 +212,15 @@ func TestCreateBookController(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			stored, _ := bc.Books.FindByID(1)
+			assert.Equal(t, val.Body.Title, stored.Title)
 		})
 	}
 }
 
 func TestDeleteBookController(t *testing.T) {
-	// mocking
-	dbFakeGorm, mocked, err := sqlmock.New()
-
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	mocked.ExpectBegin()
-
-	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `books` WHERE id = ?")).
-		WithArgs(1).
-		WillReturnResult(sqlmock.NewResult(1, 0)).
-		WillReturnError(nil)
-
-	mocked.ExpectCommit()
+	t.Parallel()
 
 	testCase := []struct {
 		Name             string
@@ -251,18 +239,23 @@ func TestDeleteBookController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			bc := newBookController(t, models.Books{Title: "jalan jalan"})
+
 			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
 			// handler echo
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
 			ctx.SetParamValues("1")
 
-			err := DeleteBookController(ctx)
+			err := bc.DeleteBookController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -275,28 +268,108 @@ func TestDeleteBookController(t *testing.T) {
 				assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			stored, _ := bc.Books.FindByID(1)
+			assert.Zero(t, stored.ID)
 		})
 	}
 }
 
-func TestUpdateBookController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+func TestDeleteBookControllerPermanent(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name             string
+		Role             string
+		Query            string
+		ExpectStatusCode int
+		ExpectTrashed    int64
+	}{
+		{"soft by default", models.RoleLibrarian, "", http.StatusOK, 1},
+		{"admin purges", models.RoleAdmin, "?permanent=true", http.StatusOK, 0},
+		{"librarian can not purge", models.RoleLibrarian, "?permanent=true", http.StatusForbidden, 0},
+		{"not a boolean", models.RoleAdmin, "?permanent=yes", http.StatusBadRequest, 0},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			bc := newBookController(t, models.Books{Title: "jalan jalan"})
+
+			r := httptest.NewRequest("DELETE", "/"+val.Query, nil)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("1")
+			ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": val.Role}})
+
+			err := bc.DeleteBookController(ctx)
+			if val.ExpectStatusCode == http.StatusOK {
+				assert.NoError(t, err)
+			} else {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+			}
+
+			_, page, err := bc.Books.List(repositories.ListQuery{Trashed: true})
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectTrashed, page.Total)
+		})
+	}
+}
+
+func TestRestoreBookController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "jalan jalan"}, models.Books{Title: "harry potter"})
+	assert.NoError(t, bc.Books.Delete(1, 0))
 
+	// the trash lists the deleted book, search no longer finds it
+	r := httptest.NewRequest("GET", "/books/trash", nil)
+	w := httptest.NewRecorder()
+	e := newTestEcho()
+	assert.NoError(t, bc.GetTrashedBooksController(e.NewContext(r, w)))
+
+	var response struct {
+		Books []models.Books  `json:"books"`
+		Meta  models.ListMeta `json:"meta"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Equal(t, int64(1), response.Meta.Total)
+	assert.Equal(t, "jalan jalan", response.Books[0].Title)
+
+	results, err := bc.Search.Search("jalan", 10)
 	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	restore := func(id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("POST", "/", nil)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		return w, bc.RestoreBookController(ctx)
+	}
 
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
+	w, err = restore("1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
 
-	config.DB = dbGorm
+	results, err = bc.Search.Search("jalan", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
 
-	mocked.ExpectBegin()
-	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `book` SET `updated_at`=? WHERE id = ? AND `books`.`deleted_at` IS NULL")).
-		WithArgs(time.Now(), 1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	// only books in the trash can be restored
+	_, err = restore("2")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+}
+
+func TestUpdateBookController(t *testing.T) {
+	t.Parallel()
 
-	mocked.ExpectCommit()
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
@@ -308,7 +381,7 @@ func TestUpdateBookController(t *testing.T) {
 		{
 			"success",
 			http.StatusOK,
-			"POST",
+			"PUT",
 			models.Books{
 				Title:     "jalan jalan",
 				Publisher: "gramed",
@@ -320,18 +393,24 @@ func TestUpdateBookController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			bc := newBookController(t, models.Books{Title: "old title", Author: "someone"})
+
 			res, _ := json.Marshal(val.Body)
 			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
 			ctx.SetParamValues("1")
 
-			err := UpdateBookController(ctx)
+			err := bc.UpdateBookController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -343,6 +422,529 @@ func TestUpdateBookController(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			stored, _ := bc.Books.FindByID(1)
+			assert.Equal(t, val.Body.Title, stored.Title)
+			assert.Equal(t, val.Body.Author, stored.Author)
 		})
 	}
 }
+
+func TestGetBooksControllerPagination(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t,
+		models.Books{Title: "a", Author: "ahmad"},
+		models.Books{Title: "b", Author: "budi"},
+		models.Books{Title: "c", Author: "ahmad"},
+	)
+
+	testCase := []struct {
+		Name             string
+		Query            string
+		ExpectStatusCode int
+		ExpectTotal      float64
+		ExpectTitles     []interface{}
+		ExpectNext       bool
+	}{
+		{"first page", "?limit=1&sort=-title", http.StatusOK, 3, []interface{}{"c"}, true},
+		{"filter", "?author=ahmad", http.StatusOK, 2, []interface{}{"a", "c"}, false},
+		{"invalid limit", "?limit=abc", http.StatusBadRequest, 0, nil, false},
+		{"invalid sort", "?sort=password", http.StatusBadRequest, 0, nil, false},
+		{"invalid date", "?created_after=yesterday", http.StatusBadRequest, 0, nil, false},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/books"+val.Query, nil)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+
+			err := bc.GetBooksController(ctx)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				return
+			}
+			assert.NoError(t, err)
+
+			var response map[string]interface{}
+			assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+
+			var got []interface{}
+			for _, book := range response["books"].([]interface{}) {
+				got = append(got, book.(map[string]interface{})["title"])
+			}
+			assert.Equal(t, val.ExpectTitles, got)
+
+			meta := response["meta"].(map[string]interface{})
+			assert.Equal(t, val.ExpectTotal, meta["total"])
+			next, hasNext := meta["next"].(string)
+			assert.Equal(t, val.ExpectNext, hasNext)
+			if hasNext {
+				assert.Contains(t, next, "/v1/books?cursor=")
+				assert.Contains(t, next, "sort=-title")
+			}
+		})
+	}
+}
+
+func TestSearchBooksController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t,
+		models.Books{Title: "Laskar Pelangi", Author: "Andrea Hirata", Publisher: "Bentang"},
+		models.Books{Title: "Sang Pemimpi", Author: "Andrea Hirata", Publisher: "Bentang"},
+	)
+
+	testCase := []struct {
+		Name             string
+		Query            string
+		ExpectStatusCode int
+		ExpectTitles     []interface{}
+	}{
+		{"success", "?q=pelangi", http.StatusOK, []interface{}{"Laskar Pelangi"}},
+		{"typo", "?q=pemimpy", http.StatusOK, []interface{}{"Sang Pemimpi"}},
+		{"no match", "?q=dune", http.StatusOK, nil},
+		{"missing q", "", http.StatusBadRequest, nil},
+		{"invalid limit", "?q=andrea&limit=0", http.StatusBadRequest, nil},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/books/search"+val.Query, nil)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+
+			err := bc.SearchBooksController(ctx)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				return
+			}
+			assert.NoError(t, err)
+
+			var response map[string]interface{}
+			assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+
+			var got []interface{}
+			for _, result := range response["results"].([]interface{}) {
+				result := result.(map[string]interface{})
+				got = append(got, result["book"].(map[string]interface{})["title"])
+				assert.Contains(t, result["highlights"].(map[string]interface{})["title"], "<mark>")
+			}
+			assert.Equal(t, val.ExpectTitles, got)
+		})
+	}
+}
+
+func TestBookControllerValidation(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name         string
+		Method       string
+		Body         string
+		ExpectStatus int
+		ExpectFields map[string]string
+	}{
+		{"create without title", http.MethodPost, `{"author":"ahmad"}`, http.StatusUnprocessableEntity, map[string]string{"title": "is required"}},
+		{"create with malformed json", http.MethodPost, `{"title":`, http.StatusBadRequest, nil},
+		{"update with a too long title", http.MethodPut, `{"title":"` + strings.Repeat("a", 256) + `"}`, http.StatusUnprocessableEntity, map[string]string{"title": "must be at most 255 characters"}},
+		{"update of one field", http.MethodPut, `{"author":"budi"}`, http.StatusOK, nil},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			bc := newBookController(t, models.Books{Title: "jalan jalan"})
+
+			r := httptest.NewRequest(val.Method, "/", strings.NewReader(val.Body))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.SetPath("/:id")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("1")
+
+			var err error
+			if val.Method == http.MethodPost {
+				err = bc.CreateBookController(ctx)
+			} else {
+				err = bc.UpdateBookController(ctx)
+			}
+
+			if val.ExpectStatus == http.StatusOK {
+				assert.NoError(t, err)
+				return
+			}
+			problem := apperrors.ProblemFor(err)
+			assert.Equal(t, val.ExpectStatus, problem.Status)
+			assert.Equal(t, val.ExpectFields, problem.Errors)
+		})
+	}
+}
+
+func TestBookHistoryAndRevert(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, body string, params ...string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id", "revision")
+		ctx.SetParamValues(params...)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(5), "role": models.RoleLibrarian}})
+		return w, handler(ctx)
+	}
+
+	_, err := call(bc.CreateBookController, `{"title": "jalan jalan", "author": "ahmad"}`)
+	assert.NoError(t, err)
+	_, err = call(bc.UpdateBookController, `{"title": "jalan jalan ke bali"}`, "1")
+	assert.NoError(t, err)
+	// nothing changed, nothing recorded
+	_, err = call(bc.UpdateBookController, `{"author": "ahmad"}`, "1")
+	assert.NoError(t, err)
+
+	w, err := call(bc.GetBookHistoryController, "", "1")
+	assert.NoError(t, err)
+	var response struct {
+		History []models.AuditEvents `json:"history"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response.History, 2)
+
+	update := response.History[1]
+	assert.Equal(t, models.AuditUpdate, update.Action)
+	assert.Equal(t, uint(5), *update.ActorID)
+	assert.Equal(t, models.AuditChanges{"title": {From: "jalan jalan", To: "jalan jalan ke bali"}}, update.Changes)
+
+	// back to the first revision, the revert is history too
+	w, err = call(bc.RevertBookController, "", "1", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	book, err := bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "jalan jalan", book.Title)
+	assert.Equal(t, "ahmad", book.Author)
+
+	revert, err := bc.Audit.FindEvent(3)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditRevert, revert.Action)
+
+	_, err = call(bc.DeleteBookController, "", "1")
+	assert.NoError(t, err)
+
+	testCase := []struct {
+		Name             string
+		Params           []string
+		ExpectStatusCode int
+	}{
+		{"revision of another book", []string{"2", "1"}, http.StatusNotFound},
+		{"unknown revision", []string{"1", "99"}, http.StatusNotFound},
+		{"revision that deleted the book", []string{"1", "4"}, http.StatusBadRequest},
+		{"book in the trash", []string{"1", "1"}, http.StatusNotFound},
+	}
+	for _, val := range testCase {
+		_, err := call(bc.RevertBookController, "", val.Params...)
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+	}
+
+	// the history outlives the book, unknown books have none
+	w, err = call(bc.GetBookHistoryController, "", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	_, err = call(bc.GetBookHistoryController, "", "2")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+}
+
+func TestBookControllerETag(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "jalan jalan", Publisher: "gramed"})
+	e := newTestEcho()
+
+	call := func(method string, handler echo.HandlerFunc, body string, header string, value string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(method, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("1")
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(5), "role": models.RoleLibrarian}})
+		return w, handler(ctx)
+	}
+
+	w, err := call("GET", bc.GetBookController, "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	getCases := []struct {
+		Name             string
+		IfNoneMatch      string
+		ExpectStatusCode int
+	}{
+		{"current version", `"1"`, http.StatusNotModified},
+		{"weak current version", `W/"1"`, http.StatusNotModified},
+		{"any version", `*`, http.StatusNotModified},
+		{"other version", `"2"`, http.StatusOK},
+	}
+	for _, val := range getCases {
+		w, err := call("GET", bc.GetBookController, "", "If-None-Match", val.IfNoneMatch)
+		assert.NoError(t, err, val.Name)
+		assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode, val.Name)
+	}
+
+	// a stale If-Match changes nothing
+	_, err = call("PUT", bc.UpdateBookController, `{"title": "jalan jalan ke bali"}`, "If-Match", `"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, apperrors.StatusCode(err))
+	_, err = call("PUT", bc.UpdateBookController, `{"title": "jalan jalan ke bali"}`, "If-Match", `W/"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, apperrors.StatusCode(err))
+
+	w, err = call("PUT", bc.UpdateBookController, `{"title": "jalan jalan ke bali"}`, "If-Match", `"3", "1"`)
+	assert.NoError(t, err)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// without If-Match the last write wins
+	w, err = call("PUT", bc.UpdateBookController, `{"author": "ahmad"}`, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	// a review makes a cached copy stale but leaves the version to If-Match
+	assert.NoError(t, bc.Reviews.Create(&models.Reviews{BookID: 1, UserID: 2, Rating: 4}))
+	w, err = call("GET", bc.GetBookController, "", "If-None-Match", `"3"`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, `"3-1-4"`, w.Header().Get("ETag"))
+	w, err = call("GET", bc.GetBookController, "", "If-None-Match", `"3-1-4"`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+
+	_, err = call("DELETE", bc.DeleteBookController, "", "If-Match", `"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, apperrors.StatusCode(err))
+	_, err = bc.Books.FindByID(1)
+	assert.NoError(t, err)
+
+	_, err = call("DELETE", bc.DeleteBookController, "", "If-Match", `"3"`)
+	assert.NoError(t, err)
+	_, err = bc.Books.FindByID(1)
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+}
+
+func TestPatchBookController(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name             string
+		ContentType      string
+		Body             string
+		IfMatch          string
+		ExpectStatusCode int
+		ExpectBook       models.Books
+	}{
+		{"merge patch", mimeMergePatch, `{"title": "jalan jalan ke bali"}`, "", http.StatusOK, models.Books{Title: "jalan jalan ke bali", Author: "ahmad", Publisher: "gramed"}},
+		{"merge patch clears with null", mimeMergePatch, `{"author": null, "publisher": ""}`, "", http.StatusOK, models.Books{Title: "jalan jalan"}},
+		{"json patch", mimeJSONPatch, `[{"op": "test", "path": "/version", "value": 1}, {"op": "remove", "path": "/author"}, {"op": "replace", "path": "/publisher", "value": null}]`, `"1"`, http.StatusOK, models.Books{Title: "jalan jalan"}},
+		{"json patch copy", mimeJSONPatch, `[{"op": "copy", "from": "/author", "path": "/publisher"}]`, "", http.StatusOK, models.Books{Title: "jalan jalan", Author: "ahmad", Publisher: "ahmad"}},
+		{"unchanged read only field", mimeMergePatch, `{"version": 1, "title": "x"}`, "", http.StatusOK, models.Books{Title: "x", Author: "ahmad", Publisher: "gramed"}},
+		{"failed test", mimeJSONPatch, `[{"op": "test", "path": "/title", "value": "other"}, {"op": "remove", "path": "/author"}]`, "", http.StatusConflict, models.Books{}},
+		{"missing path", mimeJSONPatch, `[{"op": "replace", "path": "/isbn", "value": "x"}]`, "", http.StatusUnprocessableEntity, models.Books{}},
+		{"malformed patch", mimeJSONPatch, `{"op": "remove"}`, "", http.StatusBadRequest, models.Books{}},
+		{"required field cleared", mimeMergePatch, `{"title": null}`, "", http.StatusUnprocessableEntity, models.Books{}},
+		{"read only field", mimeMergePatch, `{"version": 7}`, "", http.StatusUnprocessableEntity, models.Books{}},
+		{"unknown field", mimeJSONPatch, `[{"op": "add", "path": "/isbn", "value": "x"}]`, "", http.StatusUnprocessableEntity, models.Books{}},
+		{"wrong type", mimeMergePatch, `{"title": 5}`, "", http.StatusUnprocessableEntity, models.Books{}},
+		{"stale if match", mimeMergePatch, `{"title": "x"}`, `"2"`, http.StatusPreconditionFailed, models.Books{}},
+		{"plain json", echo.MIMEApplicationJSON, `{"title": "x"}`, "", http.StatusUnsupportedMediaType, models.Books{}},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			bc := newBookController(t, models.Books{Title: "jalan jalan", Author: "ahmad", Publisher: "gramed"})
+
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(val.Body))
+			r.Header.Set(echo.HeaderContentType, val.ContentType)
+			if val.IfMatch != "" {
+				r.Header.Set("If-Match", val.IfMatch)
+			}
+			w := httptest.NewRecorder()
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("1")
+
+			err := bc.PatchBookController(ctx)
+			book, findErr := bc.Books.FindByID(1)
+			assert.NoError(t, findErr)
+
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				assert.Equal(t, uint(1), book.Version)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+			assert.Equal(t, val.ExpectBook.Title, book.Title)
+			assert.Equal(t, val.ExpectBook.Author, book.Author)
+			assert.Equal(t, val.ExpectBook.Publisher, book.Publisher)
+		})
+	}
+}
+
+func TestBookControllerISBN(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "jalan jalan"})
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, contentType string, body string, name string, value string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, contentType)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames(name)
+		ctx.SetParamValues(value)
+		return w, handler(ctx)
+	}
+
+	// an ISBN-10 is stored as its ISBN-13
+	_, err := call(bc.CreateBookController, echo.MIMEApplicationJSON, `{"title": "cosmos", "isbn": "0-306-40615-2"}`, "", "")
+	assert.NoError(t, err)
+	book, err := bc.Books.FindByID(2)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NullableString("9780306406157"), book.ISBN)
+	assert.Equal(t, "0306406152", book.ISBN10)
+
+	testCase := []struct {
+		Name             string
+		ISBN             string
+		ExpectStatusCode int
+	}{
+		{"isbn 13", "9780306406157", http.StatusOK},
+		{"isbn 13 with hyphens", "978-0-306-40615-7", http.StatusOK},
+		{"isbn 10", "0306406152", http.StatusOK},
+		{"unknown isbn", "979-10-90636-07-1", http.StatusNotFound},
+		{"invalid isbn", "0306406153", http.StatusBadRequest},
+	}
+	for _, val := range testCase {
+		w, err := call(bc.GetBookByISBNController, "", "", "isbn", val.ISBN)
+		if val.ExpectStatusCode != http.StatusOK {
+			assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+			continue
+		}
+		assert.NoError(t, err, val.Name)
+		var response struct {
+			Book models.Books `json:"book"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response), val.Name)
+		assert.Equal(t, "cosmos", response.Book.Title, val.Name)
+	}
+
+	_, err = call(bc.CreateBookController, echo.MIMEApplicationJSON, `{"title": "cosmos", "isbn": "978-0-306-40615-8"}`, "", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+	_, err = call(bc.CreateBookController, echo.MIMEApplicationJSON, `{"title": "cosmos", "isbn": "9780306406157"}`, "", "")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	_, err = call(bc.UpdateBookController, echo.MIMEApplicationJSON, `{"isbn": "0306406152"}`, "id", "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+
+	// the ISBN-10 follows the ISBN and can not be patched on its own
+	_, err = call(bc.PatchBookController, mimeMergePatch, `{"isbn10": "0306406152"}`, "id", "1")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+	_, err = call(bc.PatchBookController, mimeMergePatch, `{"isbn": null}`, "id", "2")
+	assert.NoError(t, err)
+	book, err = bc.Books.FindByID(2)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NullableString(""), book.ISBN)
+	assert.Equal(t, "", book.ISBN10)
+}
+
+func TestBookControllerFacets(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	e := newTestEcho()
+
+	fiction := models.Categories{Name: "Fiction"}
+	assert.NoError(t, bc.Categories.Create(&fiction))
+	fantasy := models.Categories{Name: "Fantasy", ParentID: &fiction.ID}
+	assert.NoError(t, bc.Categories.Create(&fantasy))
+	gollancz := models.Publishers{Name: "Gollancz"}
+	assert.NoError(t, bc.Publishers.Create(&gollancz))
+
+	call := func(handler echo.HandlerFunc, target string, body string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		return w, handler(e.NewContext(r, w))
+	}
+
+	for _, body := range []string{
+		`{"title": "mort", "category_id": 2, "publisher_id": 1, "tags": ["Discworld", " humour ", "discworld"]}`,
+		`{"title": "jingo", "category_id": 2, "tags": ["discworld"]}`,
+		`{"title": "dune", "category_id": 1, "tags": ["space"]}`,
+	} {
+		_, err := call(bc.CreateBookController, "/", body)
+		assert.NoError(t, err)
+	}
+	_, err := call(bc.CreateBookController, "/", `{"title": "x", "tags": ["`+strings.Repeat("a", 51)+`"]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+
+	book, err := bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"discworld", "humour"}, book.Tags)
+
+	type response struct {
+		Books  []models.Books    `json:"books"`
+		Facets models.BookFacets `json:"facets"`
+	}
+	list := func(target string) response {
+		w, err := call(bc.GetBooksController, target, "")
+		assert.NoError(t, err)
+		var res response
+		assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&res))
+		return res
+	}
+
+	// facets are counted when asked for
+	res := list("/?category=1")
+	assert.Nil(t, res.Facets.Categories)
+	_, err = call(bc.GetBooksController, "/?facets=yes", "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+
+	// a category lists the books of its subcategories too
+	res = list("/?category=1&limit=1&facets=true")
+	assert.Len(t, res.Books, 1)
+	assert.Equal(t, []models.FacetCount{{ID: 2, Name: "Fantasy", Count: 2}, {ID: 1, Name: "Fiction", Count: 1}}, res.Facets.Categories)
+	assert.Equal(t, []models.FacetCount{{ID: 1, Name: "Gollancz", Count: 1}}, res.Facets.Publishers)
+	assert.Equal(t, []models.FacetCount{{Name: "discworld", Count: 2}, {Name: "humour", Count: 1}, {Name: "space", Count: 1}}, res.Facets.Tags)
+
+	res = list("/?category=2&tag=Discworld&tag=humour&facets=true")
+	assert.Len(t, res.Books, 1)
+	assert.Equal(t, "mort", res.Books[0].Title)
+	assert.Equal(t, []models.FacetCount{{Name: "discworld", Count: 1}, {Name: "humour", Count: 1}}, res.Facets.Tags)
+
+	_, err = call(bc.GetBooksController, "/?category=9", "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+	_, err = call(bc.GetBooksController, "/?category=fantasy", "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+}
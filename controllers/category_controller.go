@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CategoryController struct {
+	Categories repositories.CategoryRepository
+	Books      repositories.BookRepository
+}
+
+func NewCategoryController(categories repositories.CategoryRepository, books repositories.BookRepository) *CategoryController {
+	return &CategoryController{Categories: categories, Books: books}
+}
+
+// get the category tree
+func (cc *CategoryController) GetCategoriesController(c echo.Context) error {
+	categories, err := cc.Categories.FindAll()
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "success get all categories",
+		"categories": categoryTree(categories, 0),
+	})
+}
+
+// get category by id with its subcategories
+func (cc *CategoryController) GetCategoryController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	category, err := cc.Categories.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	categories, err := cc.Categories.FindAll()
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success get category by id",
+		"category": models.CategoryTree{Categories: category, Children: categoryTree(categories, category.ID)},
+	})
+}
+
+// create new category, under parent_id or as a root
+func (cc *CategoryController) CreateCategoryController(c echo.Context) error {
+	category := models.Categories{}
+	if err := bindAndValidate(c, &category); err != nil {
+		return err
+	}
+
+	if err := cc.checkParent(0, category.ParentID); err != nil {
+		return err
+	}
+
+	if err := cc.Categories.Create(&category); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success create new category",
+		"category": category,
+	})
+}
+
+// update category by id, the category moves to the root unless parent_id
+// is sent and inherits the fine it does not send
+func (cc *CategoryController) UpdateCategoryController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	category := models.Categories{}
+	if err := bindAndValidate(c, &category); err != nil {
+		return err
+	}
+
+	if _, err := cc.Categories.FindByID(id); err != nil {
+		return err
+	}
+
+	if err := cc.checkParent(uint(id), category.ParentID); err != nil {
+		return err
+	}
+
+	if err := cc.Categories.Update(id, category); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated category by id",
+	})
+}
+
+// delete category by id, it must have neither subcategories nor books,
+// in the trash or not
+func (cc *CategoryController) DeleteCategoryController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	categories, err := cc.Categories.FindAll()
+	if err != nil {
+		return err
+	}
+	if len(subtree(categories, uint(id))) > 1 {
+		return apperrors.Conflict("the category has subcategories, move or delete them first")
+	}
+
+	// a book restored from the trash must not come back to a missing category
+	filter := repositories.BookFilter{CategoryIDs: []uint{uint(id)}}
+	for _, trashed := range []bool{false, true} {
+		_, page, err := cc.Books.Filter(filter, repositories.ListQuery{Limit: 1, Trashed: trashed})
+		if err != nil {
+			return err
+		}
+		if page.Total > 0 && trashed {
+			return apperrors.Conflict("the category has books in the trash, restore and move them or purge them first")
+		}
+		if page.Total > 0 {
+			return apperrors.Conflict("the category has books, move them first")
+		}
+	}
+
+	if err := cc.Categories.Delete(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted category by id",
+	})
+}
+
+// the parent of the category id must exist and must not be the category
+// itself or below it, id is 0 for a new category
+func (cc *CategoryController) checkParent(id uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+
+	_, err := cc.Categories.FindByID(int(*parentID))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return apperrors.Validation("request is invalid", map[string]string{
+			"parent_id": fmt.Sprintf("category %d does not exist", *parentID),
+		})
+	}
+	if err != nil || id == 0 {
+		return err
+	}
+
+	categories, err := cc.Categories.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, below := range subtree(categories, id) {
+		if below == *parentID {
+			return apperrors.Validation("request is invalid", map[string]string{
+				"parent_id": "can not be the category itself or one of its subcategories",
+			})
+		}
+	}
+	return nil
+}
+
+// the categories below parentID, 0 for the roots, nested in the order they
+// are given
+func categoryTree(categories []models.Categories, parentID uint) []models.CategoryTree {
+	tree := []models.CategoryTree{}
+	for _, category := range categories {
+		if parentOf(category) == parentID {
+			tree = append(tree, models.CategoryTree{Categories: category, Children: categoryTree(categories, category.ID)})
+		}
+	}
+	return tree
+}
+
+// id and the ids of every category below it
+func subtree(categories []models.Categories, id uint) []uint {
+	ids := []uint{id}
+	seen := map[uint]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, category := range categories {
+			if parentOf(category) == ids[i] && !seen[category.ID] {
+				seen[category.ID] = true
+				ids = append(ids, category.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func parentOf(category models.Categories) uint {
+	if category.ParentID == nil {
+		return 0
+	}
+	return *category.ParentID
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	cc := NewCategoryController(bc.Categories, bc.Books)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, body string, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		return w, handler(ctx)
+	}
+
+	testCase := []struct {
+		Name             string
+		Body             string
+		ExpectStatusCode int
+	}{
+		{"root", `{"name": "Fiction"}`, http.StatusOK},
+		{"subcategory", `{"name": "Fantasy", "parent_id": 1}`, http.StatusOK},
+		{"below a subcategory", `{"name": "Urban Fantasy", "parent_id": 2}`, http.StatusOK},
+		{"unknown parent", `{"name": "x", "parent_id": 9}`, http.StatusUnprocessableEntity},
+		{"no name", `{"parent_id": 1}`, http.StatusUnprocessableEntity},
+	}
+	for _, val := range testCase {
+		_, err := call(cc.CreateCategoryController, val.Body, "")
+		if val.ExpectStatusCode == http.StatusOK {
+			assert.NoError(t, err, val.Name)
+			continue
+		}
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+	}
+
+	w, err := call(cc.GetCategoriesController, "", "")
+	assert.NoError(t, err)
+	var response struct {
+		Categories []models.CategoryTree `json:"categories"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response.Categories, 1)
+	assert.Equal(t, "Fiction", response.Categories[0].Name)
+	assert.Equal(t, "Fantasy", response.Categories[0].Children[0].Name)
+	assert.Equal(t, "Urban Fantasy", response.Categories[0].Children[0].Children[0].Name)
+
+	// a category can not move below itself
+	_, err = call(cc.UpdateCategoryController, `{"name": "Fantasy", "parent_id": 3}`, "2")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+	_, err = call(cc.UpdateCategoryController, `{"name": "Fantasy", "parent_id": 2}`, "2")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+	_, err = call(cc.UpdateCategoryController, `{"name": "x"}`, "9")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	// categories with subcategories or books stay
+	_, err = call(cc.DeleteCategoryController, "", "2")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	_, err = call(bc.CreateBookController, `{"title": "neverwhere", "category_id": 3}`, "")
+	assert.NoError(t, err)
+	_, err = call(bc.CreateBookController, `{"title": "x", "category_id": 9}`, "")
+	assert.Equal(t, http.StatusUnprocessableEntity, apperrors.StatusCode(err))
+	_, err = call(cc.DeleteCategoryController, "", "3")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	// so do the ones with books in the trash only
+	assert.NoError(t, bc.Books.Delete(1, 0))
+	_, err = call(cc.DeleteCategoryController, "", "3")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	assert.NoError(t, bc.Books.Restore(1))
+
+	// moving Urban Fantasy to the root takes its book along
+	_, err = call(cc.UpdateCategoryController, `{"name": "Urban Fantasy"}`, "3")
+	assert.NoError(t, err)
+	_, err = call(cc.DeleteCategoryController, "", "2")
+	assert.NoError(t, err)
+
+	w, err = call(cc.GetCategoryController, "", "1")
+	assert.NoError(t, err)
+	var category struct {
+		Category models.CategoryTree `json:"category"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&category))
+	assert.Equal(t, "Fiction", category.Category.Name)
+	assert.Empty(t, category.Category.Children)
+}
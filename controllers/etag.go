@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// echo has no constants for the conditional request headers
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// the ETag of a book or user is its version
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// the ETag of a reviewed book adds its rating to the version, the review
+// writes keep the rating and leave the version to the catalogue edits
+func bookETag(book models.Books) string {
+	if book.RatingCount == 0 {
+		return etag(book.Version)
+	}
+	rating := strconv.FormatInt(book.RatingCount, 10) + "-" + strconv.FormatFloat(book.Rating, 'f', -1, 64)
+	return `"` + strconv.FormatUint(uint64(book.Version), 10) + "-" + rating + `"`
+}
+
+// versionTag drops the rating from the ETag of a book, "3-2-4.5" is "3"
+func versionTag(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 && strings.HasSuffix(tag, `"`) {
+		return tag[:i] + `"`
+	}
+	return tag
+}
+
+func setETag(c echo.Context, tag string) {
+	c.Response().Header().Set(headerETag, tag)
+}
+
+// check If-Match against the current version of the record, the version
+// returned is what the write must still find, 0 when the client did not
+// ask for a check. Only the version in the ETag of a book is compared, a
+// review posted since the client read the book does not fail the write.
+func ifMatch(c echo.Context, current uint) (uint, error) {
+	header := c.Request().Header.Get(headerIfMatch)
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return 0, nil
+	}
+	if !matchETag(header, etag(current), false) {
+		return 0, apperrors.PreconditionFailed("If-Match does not match the current version " + etag(current))
+	}
+	return current, nil
+}
+
+// whether If-None-Match holds the current ETag, the client's copy is then
+// up to date
+func notModified(c echo.Context, current string) bool {
+	header := c.Request().Header.Get(headerIfNoneMatch)
+	return header != "" && matchETag(header, current, true)
+}
+
+// matchETag looks for tag in a list of entity tags. If-None-Match compares
+// weakly, a W/ prefix is ignored, If-Match never matches a weak tag and
+// compares the version only.
+func matchETag(header, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else {
+			candidate = versionTag(candidate)
+		}
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package controllers
+
+import (
+	"errors"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FineRates are the late fine of books whose category sets none, in minor
+// units of Currency.
+type FineRates struct {
+	DailyRate int64
+	Cap       int64
+	Currency  string
+}
+
+type FineController struct {
+	Fines      repositories.FineRepository
+	Books      repositories.BookRepository
+	Categories repositories.CategoryRepository
+	Rates      FineRates
+}
+
+func NewFineController(fines repositories.FineRepository, books repositories.BookRepository, categories repositories.CategoryRepository, rates FineRates) *FineController {
+	return &FineController{Fines: fines, Books: books, Categories: categories, Rates: rates}
+}
+
+// Accrue charges the borrower of a returned loan for every day, started,
+// it was late, at the rate of the category of the book. It returns nil when
+// the loan was on time or the rate is zero, and the fine charged already
+// when there is one, so a return whose fine failed can be fined again.
+func (fc *FineController) Accrue(loan models.Loans) (*models.Fines, error) {
+	fine, err := fc.Charge(loan)
+	if !errors.Is(err, repositories.ErrLoanFined) {
+		return fine, err
+	}
+
+	fines, _, err := fc.Fines.List(repositories.FineFilter{LoanID: loan.ID}, repositories.ListQuery{Limit: 1})
+	if err != nil || len(fines) == 0 {
+		return nil, err
+	}
+	return &fines[0], nil
+}
+
+// Charge is Accrue but returns ErrLoanFined when the loan was fined
+// already, the fines sweep uses it to tell the fines it charged.
+func (fc *FineController) Charge(loan models.Loans) (*models.Fines, error) {
+	days := daysLate(loan.DueAt, *loan.ReturnedAt)
+	if days == 0 {
+		return nil, nil
+	}
+
+	// a book deleted while on loan is fined at the default rate
+	var categoryID *uint
+	book, err := fc.Books.FindByID(int(loan.BookID))
+	if err == nil {
+		categoryID = book.CategoryID
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+
+	rate, limit, err := fc.rates(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	amount := int64(days) * rate
+	if limit > 0 && amount > limit {
+		amount = limit
+	}
+	if amount == 0 {
+		return nil, nil
+	}
+
+	fine := models.Fines{LoanID: loan.ID, UserID: loan.UserID, BookID: loan.BookID, DaysLate: days, DailyRate: rate, Amount: amount}
+	if err := fc.Fines.Charge(&fine); err != nil {
+		return nil, err
+	}
+	return &fine, nil
+}
+
+// the rate and cap of a category, each from the nearest category up the
+// tree that sets it, or the defaults
+func (fc *FineController) rates(categoryID *uint) (int64, int64, error) {
+	rate, limit := fc.Rates.DailyRate, fc.Rates.Cap
+	if categoryID == nil {
+		return rate, limit, nil
+	}
+
+	categories, err := fc.Categories.FindAll()
+	if err != nil {
+		return 0, 0, err
+	}
+	byID := map[uint]models.Categories{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	var rateSet, limitSet bool
+	seen := map[uint]bool{}
+	for id := *categoryID; id != 0 && !seen[id]; id = parentOf(byID[id]) {
+		seen[id] = true
+		category := byID[id]
+		if category.FineDailyRate != nil && !rateSet {
+			rate, rateSet = *category.FineDailyRate, true
+		}
+		if category.FineCap != nil && !limitSet {
+			limit, limitSet = *category.FineCap, true
+		}
+	}
+	return rate, limit, nil
+}
+
+// whole days from due to returned, a day started counts
+func daysLate(due, returned time.Time) int {
+	late := returned.Sub(due)
+	if late <= 0 {
+		return 0
+	}
+	day := 24 * time.Hour
+	return int((late + day - 1) / day)
+}
+
+// list the fines of the current user and what they owe in total,
+// ?outstanding=true for the ones left to pay
+func (fc *FineController) GetMyFinesController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	filter := repositories.FineFilter{UserID: uint(userID)}
+	if filter.Outstanding, err = outstandingParam(c); err != nil {
+		return err
+	}
+
+	fines, page, err := fc.Fines.List(filter, query)
+	if err != nil {
+		return err
+	}
+
+	balance, err := fc.Fines.Balance(userID)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success get my fines",
+		"fines":    fines,
+		"balance":  balance,
+		"currency": fc.Rates.Currency,
+		"meta":     listMeta(c, query, page),
+	})
+}
+
+// list the fines of every user, or of ?user=
+func (fc *FineController) GetFinesController(c echo.Context) error {
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	filter := repositories.FineFilter{}
+	if filter.Outstanding, err = outstandingParam(c); err != nil {
+		return err
+	}
+	if value := c.QueryParam("user"); value != "" {
+		userID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return apperrors.BadRequest("user must be a number")
+		}
+		filter.UserID = uint(userID)
+	}
+
+	fines, page, err := fc.Fines.List(filter, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success get all fines",
+		"fines":    fines,
+		"currency": fc.Rates.Currency,
+		"meta":     listMeta(c, query, page),
+	})
+}
+
+func outstandingParam(c echo.Context) (bool, error) {
+	value := c.QueryParam("outstanding")
+	if value == "" {
+		return false, nil
+	}
+	outstanding, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, apperrors.BadRequest("outstanding must be true or false")
+	}
+	return outstanding, nil
+}
+
+// get fine by id with its payments and waivers
+func (fc *FineController) GetFineController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	fine, err := fc.Fines.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	entries, err := fc.Fines.Entries(id)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success get fine by id",
+		"fine":     fine,
+		"entries":  entries,
+		"currency": fc.Rates.Currency,
+	})
+}
+
+// take a payment, part or all of the balance, off a fine
+func (fc *FineController) PayFineController(c echo.Context) error {
+	return fc.settle(c, models.FinePayment, "success pay fine")
+}
+
+// waive part or all of the balance of a fine
+func (fc *FineController) WaiveFineController(c echo.Context) error {
+	return fc.settle(c, models.FineWaiver, "success waive fine")
+}
+
+// settle records the amount and note of the request as a kind entry on the
+// fine :id, taken by the current user
+func (fc *FineController) settle(c echo.Context, kind string, message string) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	body := models.FineEntries{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	entry := models.FineEntries{Kind: kind, Amount: body.Amount, Note: body.Note, RecordedBy: uint(userID)}
+	fine, err := fc.Fines.Settle(id, &entry)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  message,
+		"fine":     fine,
+		"entry":    entry,
+		"currency": fc.Rates.Currency,
+	})
+}
+
+// sum the fines charged from ?from= up to ?to=, by default all of them,
+// and list who owes the most
+func (fc *FineController) GetFineReportController(c echo.Context) error {
+	from, err := queryTime(c, "from")
+	if err != nil {
+		return err
+	}
+	to, err := queryTime(c, "to")
+	if err != nil {
+		return err
+	}
+
+	report, err := fc.Fines.Report(from, to)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "success get fine report",
+		"report":   report,
+		"currency": fc.Rates.Currency,
+	})
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFineController has Fiction fining 50 a day up to 300 and Fantasy
+// below it fining 10 a day, the defaults are 25 a day up to 2000
+func newFineController(t *testing.T) *FineController {
+	rate, limit, fantasyRate := int64(50), int64(300), int64(10)
+	categories := repositories.NewMemoryCategoryRepository()
+	fiction := models.Categories{Name: "Fiction", FineDailyRate: &rate, FineCap: &limit}
+	assert.NoError(t, categories.Create(&fiction))
+	fantasy := models.Categories{Name: "Fantasy", ParentID: &fiction.ID, FineDailyRate: &fantasyRate}
+	assert.NoError(t, categories.Create(&fantasy))
+
+	bc := newBookController(t, models.Books{Title: "mort", CategoryID: &fantasy.ID}, models.Books{Title: "atlas"}, models.Books{Title: "dune", CategoryID: &fiction.ID})
+	return NewFineController(repositories.NewMemoryFineRepository(), bc.Books, categories, FineRates{DailyRate: 25, Cap: 2000, Currency: "USD"})
+}
+
+func TestFineControllerAccrue(t *testing.T) {
+	t.Parallel()
+
+	fc := newFineController(t)
+	due := time.Now().Add(-24 * time.Hour)
+
+	testCase := []struct {
+		Name         string
+		BookID       uint
+		Late         time.Duration
+		ExpectDays   int
+		ExpectAmount int64
+	}{
+		{"on time", 1, -time.Hour, 0, 0},
+		{"a day started", 2, time.Hour, 1, 25},
+		{"rate of the category", 1, 72 * time.Hour, 3, 30},
+		{"cap of the parent", 1, 40 * 24 * time.Hour, 40, 300},
+		{"capped", 3, 10 * 24 * time.Hour, 10, 300},
+		{"unknown book", 9, 48 * time.Hour, 2, 50},
+	}
+	for i, val := range testCase {
+		returned := due.Add(val.Late)
+		loan := models.Loans{ID: uint(i + 1), BookID: val.BookID, UserID: 1, DueAt: due, ReturnedAt: &returned}
+
+		fine, err := fc.Accrue(loan)
+		assert.NoError(t, err, val.Name)
+		if val.ExpectAmount == 0 {
+			assert.Nil(t, fine, val.Name)
+			continue
+		}
+		if assert.NotNil(t, fine, val.Name) {
+			assert.Equal(t, val.ExpectDays, fine.DaysLate, val.Name)
+			assert.Equal(t, val.ExpectAmount, fine.Amount, val.Name)
+			assert.Equal(t, val.ExpectAmount, fine.Balance, val.Name)
+		}
+	}
+
+	// a loan is fined once, accruing again finds its fine
+	returned := due.Add(time.Hour)
+	loan := models.Loans{ID: 2, BookID: 2, UserID: 1, DueAt: due, ReturnedAt: &returned}
+	_, err := fc.Charge(loan)
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	fine, err := fc.Accrue(loan)
+	assert.NoError(t, err)
+	if assert.NotNil(t, fine) {
+		assert.Equal(t, uint(2), fine.LoanID)
+		assert.Equal(t, int64(25), fine.Amount)
+	}
+}
+
+func TestFineSweeper(t *testing.T) {
+	t.Parallel()
+
+	fc := newFineController(t)
+	loans := repositories.NewMemoryLoanRepository()
+	now := time.Now()
+	for bookID := 1; bookID <= 3; bookID++ {
+		assert.NoError(t, loans.AddCopy(&models.Copies{BookID: uint(bookID)}, now))
+	}
+
+	// two late returns, the first fined on return, and one on time
+	for bookID, due := range map[int]time.Time{1: now.Add(-72 * time.Hour), 2: now.Add(-48 * time.Hour), 3: now.Add(time.Hour)} {
+		_, err := loans.Checkout(bookID, 1, due, 5)
+		assert.NoError(t, err)
+	}
+	for bookID := 1; bookID <= 3; bookID++ {
+		loan, err := loans.Return(bookID, 1, now)
+		assert.NoError(t, err)
+		if bookID == 1 {
+			_, err = fc.Accrue(loan)
+			assert.NoError(t, err)
+		}
+	}
+
+	sweeper := repositories.NewFineSweeper(loans, fc.Charge, time.Hour, time.Minute, nil)
+	charged, err := sweeper.Sweep(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), charged)
+
+	charged, err = sweeper.Sweep(time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, charged)
+
+	fines, page, err := fc.Fines.List(repositories.FineFilter{UserID: 1}, repositories.ListQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, []uint{1, 2}, []uint{fines[0].BookID, fines[1].BookID})
+
+	// returns older than the window are left alone
+	charged, err = sweeper.Sweep(time.Now().Add(2 * time.Hour))
+	assert.NoError(t, err)
+	assert.Zero(t, charged)
+}
+
+func TestFineController(t *testing.T) {
+	t.Parallel()
+
+	fc := newFineController(t)
+	e := newTestEcho()
+	assert.NoError(t, fc.Fines.Charge(&models.Fines{LoanID: 1, UserID: 1, BookID: 1, Amount: 100}))
+	assert.NoError(t, fc.Fines.Charge(&models.Fines{LoanID: 2, UserID: 2, BookID: 1, Amount: 30}))
+
+	call := func(handler echo.HandlerFunc, target string, body string, userID int, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(userID), "role": models.RoleLibrarian}})
+		return w, handler(ctx)
+	}
+
+	testCase := []struct {
+		Name             string
+		Handler          echo.HandlerFunc
+		Body             string
+		FineID           string
+		ExpectStatusCode int
+		ExpectBalance    int64
+	}{
+		{"partial payment", fc.PayFineController, `{"amount": 40}`, "1", http.StatusOK, 60},
+		{"waiver", fc.WaiveFineController, `{"amount": 10, "note": "first time"}`, "1", http.StatusOK, 50},
+		{"more than the balance", fc.PayFineController, `{"amount": 51}`, "1", http.StatusUnprocessableEntity, 0},
+		{"no amount", fc.PayFineController, `{}`, "1", http.StatusUnprocessableEntity, 0},
+		{"negative amount", fc.WaiveFineController, `{"amount": -5}`, "1", http.StatusUnprocessableEntity, 0},
+		{"unknown fine", fc.PayFineController, `{"amount": 1}`, "9", http.StatusNotFound, 0},
+		{"paid off", fc.PayFineController, `{"amount": 30}`, "2", http.StatusOK, 0},
+	}
+	for _, val := range testCase {
+		w, err := call(val.Handler, "/", val.Body, 7, val.FineID)
+		if val.ExpectStatusCode != http.StatusOK {
+			assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+			continue
+		}
+		assert.NoError(t, err, val.Name)
+		var response struct {
+			Fine  models.Fines       `json:"fine"`
+			Entry models.FineEntries `json:"entry"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response), val.Name)
+		assert.Equal(t, val.ExpectBalance, response.Fine.Balance, val.Name)
+		assert.Equal(t, uint(7), response.Entry.RecordedBy, val.Name)
+	}
+
+	w, err := call(fc.GetMyFinesController, "/?outstanding=true", "", 1, "")
+	assert.NoError(t, err)
+	var mine struct {
+		Fines    []models.Fines `json:"fines"`
+		Balance  int64          `json:"balance"`
+		Currency string         `json:"currency"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&mine))
+	assert.Len(t, mine.Fines, 1)
+	assert.Equal(t, int64(50), mine.Balance)
+	assert.Equal(t, "USD", mine.Currency)
+
+	w, err = call(fc.GetFineController, "/", "", 7, "1")
+	assert.NoError(t, err)
+	var detail struct {
+		Entries []models.FineEntries `json:"entries"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&detail))
+	assert.Len(t, detail.Entries, 2)
+
+	w, err = call(fc.GetFineReportController, "/", "", 7, "")
+	assert.NoError(t, err)
+	var report struct {
+		Report models.FineReport `json:"report"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&report))
+	assert.Equal(t, int64(130), report.Report.Charged)
+	assert.Equal(t, int64(50), report.Report.Outstanding)
+
+	_, err = call(fc.GetFinesController, "/?user=x", "", 7, "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+	_, err = call(fc.GetFineReportController, "/?from=yesterday", "", 7, "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+}
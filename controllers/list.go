@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// read limit, offset, cursor, sort, created_after, created_before and the
+// given equality filters from the query string
+func listQuery(c echo.Context, filters ...string) (repositories.ListQuery, error) {
+	query := repositories.ListQuery{
+		Limit:   repositories.DefaultLimit,
+		Cursor:  c.QueryParam("cursor"),
+		Sort:    repositories.ParseSort(c.QueryParam("sort")),
+		Filters: map[string]string{},
+	}
+
+	var err error
+	if limit := c.QueryParam("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+			return query, apperrors.BadRequest("limit must be a positive number")
+		}
+		if query.Limit > repositories.MaxLimit {
+			query.Limit = repositories.MaxLimit
+		}
+	}
+	if offset := c.QueryParam("offset"); offset != "" {
+		if query.Offset, err = strconv.Atoi(offset); err != nil || query.Offset < 0 {
+			return query, apperrors.BadRequest("offset must not be negative")
+		}
+	}
+
+	for _, name := range filters {
+		if value := c.QueryParam(name); value != "" {
+			query.Filters[name] = value
+		}
+	}
+
+	if query.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// a RFC 3339 timestamp or a plain date
+func queryTime(c echo.Context, name string) (*time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, apperrors.BadRequest(fmt.Sprintf("%s must be a date or RFC 3339 timestamp", name))
+}
+
+// total and links to the neighbouring pages, the links keep every other
+// parameter of the request
+func listMeta(c echo.Context, query repositories.ListQuery, page repositories.Page) models.ListMeta {
+	link := func(cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+		values := c.Request().URL.Query()
+		values.Del("offset")
+		values.Set("cursor", cursor)
+		return c.Request().URL.Path + "?" + values.Encode()
+	}
+
+	return models.ListMeta{
+		Total: page.Total,
+		Limit: query.Limit,
+		Next:  link(page.Next),
+		Prev:  link(page.Prev),
+	}
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type LoanController struct {
+	Loans repositories.LoanRepository
+	Books repositories.BookRepository
+	// Period is how long a book is lent for, Limit how many books a user
+	// can borrow at once and PickupPeriod how long a copy is held for
+	// the user whose hold it goes to
+	Period       time.Duration
+	Limit        int
+	PickupPeriod time.Duration
+	// Fines charges late returns, nil charges nothing
+	Fines *FineController
+}
+
+func NewLoanController(loans repositories.LoanRepository, books repositories.BookRepository, period time.Duration, limit int, pickupPeriod time.Duration, fines *FineController) *LoanController {
+	return &LoanController{Loans: loans, Books: books, Period: period, Limit: limit, PickupPeriod: pickupPeriod, Fines: fines}
+}
+
+// list the copies of a book and how many are on the shelf
+func (lc *LoanController) GetCopiesController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := lc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	copies, err := lc.Loans.ListCopies(id)
+
+	if err != nil {
+		return err
+	}
+
+	available := 0
+	for _, bookCopy := range copies {
+		if bookCopy.Available {
+			available++
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "success get copies of book",
+		"copies":    copies,
+		"available": available,
+	})
+}
+
+// add a copy of a book, it goes to the first hold on the book if any
+func (lc *LoanController) AddCopyController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := lc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	bookCopy := models.Copies{BookID: uint(id)}
+	if err := lc.Loans.AddCopy(&bookCopy, time.Now().Add(lc.PickupPeriod)); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success add copy of book",
+		"copy":    bookCopy,
+	})
+}
+
+// withdraw a copy, it must not be on loan or held
+func (lc *LoanController) DeleteCopyController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if err := lc.Loans.DeleteCopy(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted copy by id",
+	})
+}
+
+// lend a copy of the book to the current user
+func (lc *LoanController) CheckoutController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := lc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	loan, err := lc.Loans.Checkout(id, userID, time.Now().Add(lc.Period), lc.Limit)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success checkout book",
+		"loan":    loan,
+	})
+}
+
+// give back the copy of the book the current user borrowed, it goes to the
+// first hold on the book if any and a late return is fined
+func (lc *LoanController) ReturnController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	loan, err := lc.Loans.Return(id, userID, time.Now().Add(lc.PickupPeriod))
+	if err != nil {
+		return err
+	}
+
+	// the book is back either way, a fine that fails now is charged by the
+	// fines sweep
+	var fine *models.Fines
+	if lc.Fines != nil {
+		if fine, err = lc.Fines.Accrue(loan); err != nil {
+			c.Logger().Errorf("fining loan %d: %v", loan.ID, err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success return book",
+		"loan":    loan,
+		"fine":    fine,
+	})
+}
+
+// list the loans of the current user, ?open=true for the books they still
+// have
+func (lc *LoanController) GetMyLoansController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	filter := repositories.LoanFilter{UserID: uint(userID)}
+	if value := c.QueryParam("open"); value != "" {
+		if filter.Open, err = strconv.ParseBool(value); err != nil {
+			return apperrors.BadRequest("open must be true or false")
+		}
+	}
+
+	loans, page, err := lc.Loans.List(filter, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get my loans",
+		"loans":   loans,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// list the loans past their due date, the longest overdue first
+func (lc *LoanController) GetOverdueLoansController(c echo.Context) error {
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+	if len(query.Sort) == 0 {
+		query.Sort = []repositories.SortField{{Field: "due_at"}}
+	}
+
+	now := time.Now()
+	loans, page, err := lc.Loans.List(repositories.LoanFilter{DueBefore: &now}, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get overdue loans",
+		"loans":   loans,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// queue the current user for a book whose copies are all on loan
+func (lc *LoanController) PlaceHoldController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := lc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	hold, err := lc.Loans.PlaceHold(id, userID)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success place hold on book",
+		"hold":    hold,
+	})
+}
+
+// cancel the hold of the current user on a book, a copy held for them goes
+// to the next in line
+func (lc *LoanController) CancelHoldController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	hold, err := lc.Loans.CancelHold(id, userID, time.Now().Add(lc.PickupPeriod))
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success cancel hold on book",
+		"hold":    hold,
+	})
+}
+
+// list the waiting and ready holds on a book in the order they were placed
+func (lc *LoanController) GetBookHoldsController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := lc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	holds, page, err := lc.Loans.ListHolds(repositories.HoldFilter{BookID: uint(id), Active: true}, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get holds on book",
+		"holds":   holds,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// list the holds of the current user with their place in the queue, the
+// waiting and ready ones unless ?status= asks for others
+func (lc *LoanController) GetMyHoldsController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := listQuery(c, "status")
+	if err != nil {
+		return err
+	}
+
+	filter := repositories.HoldFilter{UserID: uint(userID), Active: query.Filters["status"] == ""}
+	holds, page, err := lc.Loans.ListHolds(filter, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get my holds",
+		"holds":   holds,
+		"meta":    listMeta(c, query, page),
+	})
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoanController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "mort"}, models.Books{Title: "jingo"})
+	lc := NewLoanController(repositories.NewMemoryLoanRepository(), bc.Books, 14*24*time.Hour, 1, 72*time.Hour, nil)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, target string, userID int, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(userID), "role": models.RoleMember}})
+		return w, handler(ctx)
+	}
+
+	_, err := call(lc.AddCopyController, "/", 9, "1")
+	assert.NoError(t, err)
+	_, err = call(lc.AddCopyController, "/", 9, "2")
+	assert.NoError(t, err)
+	_, err = call(lc.AddCopyController, "/", 9, "3")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	w, err := call(lc.CheckoutController, "/", 1, "1")
+	assert.NoError(t, err)
+	var response struct {
+		Loan models.Loans `json:"loan"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Equal(t, uint(1), response.Loan.CopyID)
+	assert.WithinDuration(t, time.Now().Add(14*24*time.Hour), response.Loan.DueAt, time.Minute)
+
+	testCase := []struct {
+		Name             string
+		UserID           int
+		BookID           string
+		ExpectStatusCode int
+		ExpectCode       string
+	}{
+		{"every copy on loan", 2, "1", http.StatusConflict, "no_copy_available"},
+		{"limit reached", 1, "2", http.StatusConflict, "loan_limit_reached"},
+		{"unknown book", 2, "9", http.StatusNotFound, "not_found"},
+	}
+	for _, val := range testCase {
+		_, err := call(lc.CheckoutController, "/", val.UserID, val.BookID)
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+		assert.Equal(t, val.ExpectCode, apperrors.ProblemFor(err).Code, val.Name)
+	}
+
+	w, err = call(lc.GetCopiesController, "/", 0, "1")
+	assert.NoError(t, err)
+	var copies struct {
+		Copies    []models.Copies `json:"copies"`
+		Available int             `json:"available"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&copies))
+	assert.Len(t, copies.Copies, 1)
+	assert.Equal(t, 0, copies.Available)
+
+	_, err = call(lc.DeleteCopyController, "/", 9, "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+
+	// only the borrower returns the book
+	_, err = call(lc.ReturnController, "/", 2, "1")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+	_, err = call(lc.ReturnController, "/", 1, "1")
+	assert.NoError(t, err)
+	_, err = call(lc.CheckoutController, "/", 1, "2")
+	assert.NoError(t, err)
+
+	w, err = call(lc.GetMyLoansController, "/?open=true", 1, "")
+	assert.NoError(t, err)
+	var loans struct {
+		Loans []models.Loans `json:"loans"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&loans))
+	assert.Len(t, loans.Loans, 1)
+	assert.Equal(t, uint(2), loans.Loans[0].BookID)
+
+	_, err = call(lc.GetMyLoansController, "/?open=maybe", 1, "")
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+}
+
+func TestGetOverdueLoansController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "mort"}, models.Books{Title: "jingo"})
+	loans := repositories.NewMemoryLoanRepository()
+	for _, bookID := range []uint{1, 2} {
+		assert.NoError(t, loans.AddCopy(&models.Copies{BookID: bookID}, time.Now()))
+	}
+	_, err := loans.Checkout(1, 1, time.Now().Add(-time.Hour), 5)
+	assert.NoError(t, err)
+	_, err = loans.Checkout(2, 2, time.Now().Add(time.Hour), 5)
+	assert.NoError(t, err)
+
+	fc := NewFineController(repositories.NewMemoryFineRepository(), bc.Books, bc.Categories, FineRates{DailyRate: 25})
+	lc := NewLoanController(loans, bc.Books, time.Hour, 5, time.Hour, fc)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	err = lc.GetOverdueLoansController(newTestEcho().NewContext(r, w))
+	assert.NoError(t, err)
+
+	var response struct {
+		Loans []models.Loans `json:"loans"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response.Loans, 1)
+	assert.Equal(t, uint(1), response.Loans[0].UserID)
+
+	// the overdue book is fined on its return, the other one is not
+	for _, val := range []struct {
+		UserID     int
+		BookID     string
+		ExpectFine bool
+	}{{1, "1", true}, {2, "2", false}} {
+		r = httptest.NewRequest(http.MethodPost, "/", nil)
+		w = httptest.NewRecorder()
+		ctx := newTestEcho().NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(val.BookID)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(val.UserID), "role": models.RoleMember}})
+		assert.NoError(t, lc.ReturnController(ctx))
+
+		var returned struct {
+			Fine *models.Fines `json:"fine"`
+		}
+		assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&returned))
+		if !val.ExpectFine {
+			assert.Nil(t, returned.Fine)
+		} else if assert.NotNil(t, returned.Fine) {
+			assert.Equal(t, int64(25), returned.Fine.Amount)
+		}
+	}
+}
+
+func TestHoldController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "mort"})
+	lc := NewLoanController(repositories.NewMemoryLoanRepository(), bc.Books, 14*24*time.Hour, 5, 72*time.Hour, nil)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, target string, userID int, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, target, nil)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(userID), "role": models.RoleMember}})
+		return w, handler(ctx)
+	}
+	type holds struct {
+		Holds []models.Holds `json:"holds"`
+	}
+
+	_, err := call(lc.AddCopyController, "/", 9, "1")
+	assert.NoError(t, err)
+	_, err = call(lc.PlaceHoldController, "/", 2, "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	assert.Equal(t, "copy_available", apperrors.ProblemFor(err).Code)
+	_, err = call(lc.CheckoutController, "/", 1, "1")
+	assert.NoError(t, err)
+
+	for _, userID := range []int{2, 3} {
+		_, err = call(lc.PlaceHoldController, "/", userID, "1")
+		assert.NoError(t, err)
+	}
+
+	testCase := []struct {
+		Name             string
+		UserID           int
+		BookID           string
+		ExpectStatusCode int
+		ExpectCode       string
+	}{
+		{"held already", 2, "1", http.StatusConflict, "already_held"},
+		{"borrowed already", 1, "1", http.StatusConflict, "already_borrowed"},
+		{"unknown book", 2, "9", http.StatusNotFound, "not_found"},
+	}
+	for _, val := range testCase {
+		_, err := call(lc.PlaceHoldController, "/", val.UserID, val.BookID)
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+		assert.Equal(t, val.ExpectCode, apperrors.ProblemFor(err).Code, val.Name)
+	}
+
+	w, err := call(lc.GetMyHoldsController, "/", 3, "")
+	assert.NoError(t, err)
+	var mine holds
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&mine))
+	if assert.Len(t, mine.Holds, 1) {
+		assert.Equal(t, 2, mine.Holds[0].Position)
+	}
+
+	// the returned copy is held for the first in line only
+	_, err = call(lc.ReturnController, "/", 1, "1")
+	assert.NoError(t, err)
+	_, err = call(lc.CheckoutController, "/", 3, "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+
+	w, err = call(lc.GetBookHoldsController, "/", 9, "1")
+	assert.NoError(t, err)
+	var queue holds
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&queue))
+	if assert.Len(t, queue.Holds, 2) {
+		assert.Equal(t, models.HoldReady, queue.Holds[0].Status)
+		assert.WithinDuration(t, time.Now().Add(72*time.Hour), *queue.Holds[0].ExpiresAt, time.Minute)
+		assert.Equal(t, 1, queue.Holds[1].Position)
+	}
+
+	// cancelling passes the copy on
+	_, err = call(lc.CancelHoldController, "/", 2, "1")
+	assert.NoError(t, err)
+	_, err = call(lc.CancelHoldController, "/", 2, "1")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+	_, err = call(lc.CheckoutController, "/", 3, "1")
+	assert.NoError(t, err)
+
+	w, err = call(lc.GetMyHoldsController, "/?status=cancelled", 2, "")
+	assert.NoError(t, err)
+	mine = holds{}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&mine))
+	if assert.Len(t, mine.Holds, 1) {
+		assert.Equal(t, models.HoldCancelled, mine.Holds[0].Status)
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// id of the user owning the token
+func currentUserID(c echo.Context) (int, error) {
+	id, ok := m.CurrentUserID(c)
+	if !ok {
+		return 0, apperrors.Unauthorized("missing or malformed jwt")
+	}
+	return id, nil
+}
+
+// get the current user
+func (uc *UserController) GetMeController(c echo.Context) error {
+	id, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return uc.getUser(c, id, "success get current user")
+}
+
+// update the current user
+func (uc *UserController) UpdateMeController(c echo.Context) error {
+	id, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return uc.updateUser(c, id, "success updated current user")
+}
+
+// delete the current user
+func (uc *UserController) DeleteMeController(c echo.Context) error {
+	id, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	return uc.deleteUser(c, id, "success deleted current user")
+}
+
+// change the password of the current user, every other session is logged out
+func (uc *UserController) ChangeMyPasswordController(c echo.Context) error {
+	id, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	request := models.ChangePasswordRequest{}
+	if err := bindAndValidate(c, &request); err != nil {
+		return err
+	}
+
+	user, err := uc.Users.FindByID(id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return apperrors.Unauthorized("user no longer exists")
+	}
+	if err != nil {
+		return err
+	}
+
+	match, _, err := helpers.VerifyPassword(request.CurrentPassword, user.Password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return apperrors.Forbidden("current password is incorrect")
+	}
+
+	hash, err := helpers.HashPassword(request.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := uc.update(c, id, func(models.Users, uint) error { return uc.Users.UpdatePassword(id, hash) }); err != nil {
+		return err
+	}
+
+	claims, _ := m.TokenClaims(c)
+	sid, _ := claims["sid"].(string)
+
+	if err := uc.Tokens.RevokeUserSessions(id, sid); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success changed password",
+	})
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
+	"learn_testing/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMeController(t *testing.T) {
+	t.Parallel()
+
+	uc := newUserController(t,
+		models.Users{Name: "someone else", Email: "else@gmail.com"},
+		models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com"},
+	)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	e := newTestEcho()
+	ctx := e.NewContext(r, w)
+	ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(2), "role": models.RoleMember}})
+
+	err := uc.GetMeController(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var response map[string]interface{}
+	err = json.NewDecoder(w.Result().Body).Decode(&response)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ahmad naufal", response["user"].(map[string]interface{})["name"])
+}
+
+func TestUpdateMeControllerRejectsPassword(t *testing.T) {
+	t.Parallel()
+
+	uc := newUserController(t, models.Users{Name: "ahmad naufal"})
+
+	res, _ := json.Marshal(models.Users{Password: "new@1234"})
+	r := httptest.NewRequest("PUT", "/", bytes.NewBuffer(res))
+	r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+
+	e := newTestEcho()
+	ctx := e.NewContext(r, w)
+	ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": models.RoleMember}})
+
+	err := uc.UpdateMeController(ctx)
+
+	assert.Equal(t, http.StatusBadRequest, apperrors.StatusCode(err))
+}
+
+func TestChangeMyPasswordController(t *testing.T) {
+	t.Parallel()
+
+	hash, err := helpers.HashPassword("alta@1234")
+	assert.NoError(t, err)
+
+	testCase := []struct {
+		Name             string
+		Body             models.ChangePasswordRequest
+		ExpectStatusCode int
+	}{
+		{
+			"success",
+			models.ChangePasswordRequest{CurrentPassword: "alta@1234", NewPassword: "new@1234"},
+			http.StatusOK,
+		},
+		{
+			"wrong current password",
+			models.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new@1234"},
+			http.StatusForbidden,
+		},
+		{
+			"weak new password",
+			models.ChangePasswordRequest{CurrentPassword: "alta@1234", NewPassword: "password"},
+			http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, models.Users{Name: "ahmad naufal", Password: hash})
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "current", TokenHash: "a"}))
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "other", TokenHash: "b"}))
+
+			res, _ := json.Marshal(val.Body)
+			r := httptest.NewRequest("PUT", "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "sid": "current"}})
+
+			err := uc.ChangeMyPasswordController(ctx)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
+
+			stored, _ := uc.Users.FindByID(1)
+			match, _, err := helpers.VerifyPassword(val.Body.NewPassword, stored.Password)
+			assert.NoError(t, err)
+			assert.True(t, match)
+
+			// only the other sessions are logged out
+			revoked, _ := uc.Tokens.IsRevoked("token-id", "current")
+			assert.False(t, revoked)
+			revoked, _ = uc.Tokens.IsRevoked("token-id", "other")
+			assert.True(t, revoked)
+		})
+	}
+}
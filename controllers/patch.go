@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"learn_testing/apperrors"
+	"learn_testing/jsonpatch"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+
+	headerAcceptPatch = "Accept-Patch"
+)
+
+// applyPatch applies the PATCH request body to the JSON of record and
+// decodes the writable fields of the result into patched, which should be
+// empty: a field removed or set to null by the patch stays empty. The
+// other fields of record may be tested but not changed.
+func applyPatch(c echo.Context, record interface{}, patched interface{}, writable ...string) error {
+	doc, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	patch, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	var result []byte
+	switch mediaType {
+	case mimeMergePatch:
+		result, err = jsonpatch.Merge(doc, patch)
+	case mimeJSONPatch:
+		result, err = jsonpatch.Apply(doc, patch)
+	default:
+		c.Response().Header().Set(headerAcceptPatch, mimeMergePatch+", "+mimeJSONPatch)
+		return apperrors.New(http.StatusUnsupportedMediaType, "unsupported_media_type", "patch must be "+mimeMergePatch+" or "+mimeJSONPatch)
+	}
+	switch {
+	case errors.Is(err, jsonpatch.ErrMalformed):
+		return apperrors.BadRequest(err.Error())
+	case errors.Is(err, jsonpatch.ErrPath):
+		return apperrors.New(http.StatusUnprocessableEntity, "unprocessable_patch", err.Error())
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		return apperrors.Conflict(err.Error())
+	case err != nil:
+		return err
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, &after); err != nil {
+		return apperrors.New(http.StatusUnprocessableEntity, "unprocessable_patch", "the patched document must be an object")
+	}
+
+	fields := map[string]string{}
+	values := map[string]interface{}{}
+	for name := range after {
+		if _, known := before[name]; !known && !contains(writable, name) {
+			fields[name] = "is not a field"
+		}
+	}
+	for name, value := range before {
+		if !contains(writable, name) && !reflect.DeepEqual(value, after[name]) {
+			fields[name] = "is read only"
+		}
+	}
+	for _, name := range writable {
+		values[name] = after[name]
+	}
+	if len(fields) > 0 {
+		return apperrors.Validation("patch is invalid", fields)
+	}
+
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(raw, patched); errors.As(err, &typeErr) {
+		return apperrors.Validation("patch is invalid", map[string]string{typeErr.Field: "must be a " + typeErr.Type.String()})
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PublisherController struct {
+	Publishers repositories.PublisherRepository
+	Books      repositories.BookRepository
+	Index      repositories.BookIndexer
+	Audit      repositories.AuditRepository
+}
+
+func NewPublisherController(publishers repositories.PublisherRepository, books repositories.BookRepository, index repositories.BookIndexer, audit repositories.AuditRepository) *PublisherController {
+	return &PublisherController{Publishers: publishers, Books: books, Index: index, Audit: audit}
+}
+
+// get all publishers
+func (pc *PublisherController) GetPublishersController(c echo.Context) error {
+	query, err := listQuery(c, "name")
+	if err != nil {
+		return err
+	}
+
+	publishers, page, err := pc.Publishers.List(query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "success get all publishers",
+		"publishers": publishers,
+		"meta":       listMeta(c, query, page),
+	})
+}
+
+// get publisher by id
+func (pc *PublisherController) GetPublisherController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	publisher, err := pc.Publishers.FindByID(id)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "success get publisher by id",
+		"publisher": publisher,
+	})
+}
+
+// list the books of an publisher
+func (pc *PublisherController) GetPublisherBooksController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := pc.Publishers.FindByID(id); err != nil {
+		return err
+	}
+
+	query, err := listQuery(c, "author", "publisher", "title")
+	if err != nil {
+		return err
+	}
+
+	books, page, err := pc.Books.ListByPublisher(id, query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get books of publisher",
+		"books":   books,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// create new publisher
+func (pc *PublisherController) CreatePublisherController(c echo.Context) error {
+	publisher := models.Publishers{}
+	if err := bindAndValidate(c, &publisher); err != nil {
+		return err
+	}
+
+	if err := pc.Publishers.Create(&publisher); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "success create new publisher",
+		"publisher": publisher,
+	})
+}
+
+// update publisher by id
+func (pc *PublisherController) UpdatePublisherController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	publisher := models.Publishers{}
+	if err := bindAndValidatePresent(c, &publisher); err != nil {
+		return err
+	}
+
+	// the books carry the new name of the publisher, each one audited
+	books := func(query repositories.ListQuery) ([]models.Books, repositories.Page, error) {
+		return pc.Books.ListByPublisher(id, query)
+	}
+	var credited map[uint]models.Books
+	if publisher.Name != "" {
+		if credited, err = booksByID(books); err != nil {
+			return err
+		}
+	}
+
+	if err := pc.Publishers.Update(id, publisher); err != nil {
+		return err
+	}
+	if publisher.Name != "" {
+		if err := pc.Index.ReindexPublisher(id); err != nil {
+			return err
+		}
+		renamed, err := booksByID(books)
+		if err != nil {
+			return err
+		}
+		if err := auditCredits(c, pc.Audit, credited, renamed); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated publisher by id",
+	})
+}
+
+// delete publisher by id, publishers that still publish a book can not be
+// deleted
+func (pc *PublisherController) DeletePublisherController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	// a book restored from the trash must not come back to a missing publisher
+	for _, trashed := range []bool{false, true} {
+		_, page, err := pc.Books.ListByPublisher(id, repositories.ListQuery{Limit: 1, Trashed: trashed})
+		if err != nil {
+			return err
+		}
+		if page.Total > 0 && trashed {
+			return apperrors.Conflict("the publisher has books in the trash, restore and unlink them or purge them first")
+		}
+		if page.Total > 0 {
+			return apperrors.Conflict("the publisher has books, unlink them first")
+		}
+	}
+
+	if err := pc.Publishers.Delete(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted publisher by id",
+	})
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisherController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t)
+	pc := NewPublisherController(bc.Publishers, bc.Books, bc.Search.(repositories.BookIndexer), bc.Audit)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, contentType string, body string, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, contentType)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		return w, handler(ctx)
+	}
+
+	_, err := call(pc.CreatePublisherController, echo.MIMEApplicationJSON, `{"name": "Gollancz"}`, "")
+	assert.NoError(t, err)
+	_, err = call(bc.CreateBookController, echo.MIMEApplicationJSON, `{"title": "discworld", "publisher_id": 1}`, "")
+	assert.NoError(t, err)
+
+	w, err := call(pc.GetPublisherBooksController, "", "", "1")
+	assert.NoError(t, err)
+	var response struct {
+		Books []models.Books `json:"books"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response.Books, 1)
+	assert.Equal(t, "discworld", response.Books[0].Title)
+
+	// a new name is written on the books and found by search
+	_, err = call(pc.UpdatePublisherController, echo.MIMEApplicationJSON, `{"name": "Victor Gollancz"}`, "1")
+	assert.NoError(t, err)
+	book, err := bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, "Victor Gollancz", book.Publisher)
+	results, err := bc.Search.Search("victor", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = call(pc.DeletePublisherController, "", "", "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	// so do the ones with books in the trash only
+	assert.NoError(t, bc.Books.Delete(1, 0))
+	_, err = call(pc.DeletePublisherController, "", "", "1")
+	assert.Equal(t, http.StatusConflict, apperrors.StatusCode(err))
+	assert.NoError(t, bc.Books.Restore(1))
+	// a merge patch null unlinks the publisher
+	_, err = call(bc.PatchBookController, mimeMergePatch, `{"publisher_id": null}`, "1")
+	assert.NoError(t, err)
+	_, err = call(pc.DeletePublisherController, "", "", "1")
+	assert.NoError(t, err)
+
+	book, err = bc.Books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Nil(t, book.PublisherID)
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// a numeric path parameter such as :id
+func idParam(c echo.Context, name string) (int, error) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, apperrors.BadRequest(fmt.Sprintf("%s must be a number", name))
+	}
+	return id, nil
+}
+
+// ?permanent=true on a delete, which only admins may ask for
+func permanentDelete(c echo.Context) (bool, error) {
+	value := c.QueryParam("permanent")
+	if value == "" {
+		return false, nil
+	}
+
+	permanent, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, apperrors.BadRequest("permanent must be true or false")
+	}
+	if permanent && !m.HasRole(c, models.RoleAdmin) {
+		return false, apperrors.Forbidden("only admins can delete permanently")
+	}
+	return permanent, nil
+}
+
+// bind the request body into i and check its validate tags
+func bindAndValidate(c echo.Context, i interface{}) error {
+	if err := c.Bind(i); err != nil {
+		return err
+	}
+	return c.Validate(i)
+}
+
+// like bindAndValidate, but fields left empty are not checked, for updates
+// that only change what was sent
+func bindAndValidatePresent(c echo.Context, i interface{}) error {
+	if err := c.Bind(i); err != nil {
+		return err
+	}
+	return validatePresent(c, i)
+}
+
+func validatePresent(c echo.Context, i interface{}) error {
+	if v, ok := c.Echo().Validator.(*helpers.Validator); ok {
+		return v.ValidatePresent(i)
+	}
+	return c.Validate(i)
+}
+
+func validateExcept(c echo.Context, i interface{}, fields ...string) error {
+	if v, ok := c.Echo().Validator.(*helpers.Validator); ok {
+		return v.ValidateExcept(i, fields...)
+	}
+	return c.Validate(i)
+}
@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"learn_testing/apperrors"
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReviewController struct {
+	Reviews repositories.ReviewRepository
+	Books   repositories.BookRepository
+}
+
+func NewReviewController(reviews repositories.ReviewRepository, books repositories.BookRepository) *ReviewController {
+	return &ReviewController{Reviews: reviews, Books: books}
+}
+
+// list the reviews of a book with their summary
+func (rc *ReviewController) GetReviewsController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := rc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	reviews, page, err := rc.Reviews.List(id, query)
+	if err != nil {
+		return err
+	}
+
+	summary, err := rc.Reviews.Summary(id)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get reviews of book",
+		"reviews": reviews,
+		"rating":  summary,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// review a book as the current user, once
+func (rc *ReviewController) CreateReviewController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	body := models.Reviews{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	if _, err := rc.Books.FindByID(id); err != nil {
+		return err
+	}
+
+	review := models.Reviews{BookID: uint(id), UserID: uint(userID), Rating: body.Rating, Body: body.Body}
+	if err := rc.Reviews.Create(&review); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success create new review",
+		"review":  review,
+	})
+}
+
+// update review by id, only its author can
+func (rc *ReviewController) UpdateReviewController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	body := models.Reviews{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	if _, err := rc.authored(c, id, false); err != nil {
+		return err
+	}
+
+	if err := rc.Reviews.Update(id, body); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated review by id",
+	})
+}
+
+// delete review by id, its author or an admin can
+func (rc *ReviewController) DeleteReviewController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := rc.authored(c, id, true); err != nil {
+		return err
+	}
+
+	if err := rc.Reviews.Delete(id); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted review by id",
+	})
+}
+
+// the review id if the current user wrote it, or is an admin and admins
+// are allowed
+func (rc *ReviewController) authored(c echo.Context, id int, admins bool) (models.Reviews, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return models.Reviews{}, err
+	}
+
+	review, err := rc.Reviews.FindByID(id)
+	if err != nil {
+		return review, err
+	}
+	if review.UserID != uint(userID) && !(admins && m.HasRole(c, models.RoleAdmin)) {
+		return review, apperrors.Forbidden("only the author can change a review")
+	}
+	return review, nil
+}
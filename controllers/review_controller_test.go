@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "mort"}, models.Books{Title: "jingo"})
+	rc := NewReviewController(bc.Reviews, bc.Books)
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, target string, body string, userID int, role string, id string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(id)
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(userID), "role": role}})
+		return w, handler(ctx)
+	}
+
+	testCase := []struct {
+		Name             string
+		Handler          echo.HandlerFunc
+		Body             string
+		UserID           int
+		Role             string
+		ID               string
+		ExpectStatusCode int
+	}{
+		{"review", rc.CreateReviewController, `{"rating": 5, "body": "funny"}`, 1, models.RoleMember, "1", http.StatusOK},
+		{"another user", rc.CreateReviewController, `{"rating": 2}`, 2, models.RoleMember, "1", http.StatusOK},
+		{"other book", rc.CreateReviewController, `{"rating": 4}`, 1, models.RoleMember, "2", http.StatusOK},
+		{"twice", rc.CreateReviewController, `{"rating": 4}`, 1, models.RoleMember, "1", http.StatusConflict},
+		{"rating too high", rc.CreateReviewController, `{"rating": 6}`, 3, models.RoleMember, "1", http.StatusUnprocessableEntity},
+		{"no rating", rc.CreateReviewController, `{"body": "meh"}`, 3, models.RoleMember, "1", http.StatusUnprocessableEntity},
+		{"unknown book", rc.CreateReviewController, `{"rating": 3}`, 3, models.RoleMember, "9", http.StatusNotFound},
+		{"edit own", rc.UpdateReviewController, `{"rating": 4, "body": "still funny"}`, 1, models.RoleMember, "1", http.StatusOK},
+		{"edit other", rc.UpdateReviewController, `{"rating": 1}`, 2, models.RoleMember, "1", http.StatusForbidden},
+		{"admin edits other", rc.UpdateReviewController, `{"rating": 1}`, 9, models.RoleAdmin, "1", http.StatusForbidden},
+		{"delete other", rc.DeleteReviewController, ``, 2, models.RoleMember, "3", http.StatusForbidden},
+		{"delete own", rc.DeleteReviewController, ``, 1, models.RoleMember, "3", http.StatusOK},
+		{"delete someone else's", rc.DeleteReviewController, ``, 1, models.RoleMember, "2", http.StatusForbidden},
+		{"unknown review", rc.DeleteReviewController, ``, 1, models.RoleMember, "9", http.StatusNotFound},
+	}
+	for _, val := range testCase {
+		_, err := call(val.Handler, "/", val.Body, val.UserID, val.Role, val.ID)
+		if val.ExpectStatusCode == http.StatusOK {
+			assert.NoError(t, err, val.Name)
+			continue
+		}
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+	}
+
+	// the book carries its rating and the response the histogram
+	w, err := call(bc.GetBookController, "/", "", 0, "", "1")
+	assert.NoError(t, err)
+	var response struct {
+		Book   models.Books         `json:"book"`
+		Rating models.RatingSummary `json:"rating"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Equal(t, 3.0, response.Book.Rating)
+	assert.Equal(t, int64(2), response.Book.RatingCount)
+	assert.Equal(t, map[uint]int64{1: 0, 2: 1, 3: 0, 4: 1, 5: 0}, response.Rating.Histogram)
+	// reviews leave the version alone, an If-Match read before them holds
+	assert.Equal(t, `"1-2-3"`, w.Header().Get(headerETag))
+
+	book, err := bc.Books.FindByID(2)
+	assert.NoError(t, err)
+	assert.Zero(t, book.RatingCount)
+
+	w, err = call(bc.GetBooksController, "/?sort=-rating", "", 0, "", "")
+	assert.NoError(t, err)
+	var books struct {
+		Books []models.Books `json:"books"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&books))
+	assert.Equal(t, "mort", books.Books[0].Title)
+
+	// an admin moderates
+	_, err = call(rc.DeleteReviewController, "/", "", 9, models.RoleAdmin, "2")
+	assert.NoError(t, err)
+	w, err = call(rc.GetReviewsController, "/", "", 0, "", "1")
+	assert.NoError(t, err)
+	var reviews struct {
+		Reviews []models.Reviews     `json:"reviews"`
+		Rating  models.RatingSummary `json:"rating"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&reviews))
+	if assert.Len(t, reviews.Reviews, 1) {
+		assert.Equal(t, "still funny", reviews.Reviews[0].Body)
+	}
+	assert.Equal(t, 4.0, reviews.Rating.Average)
+}
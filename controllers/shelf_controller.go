@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SharedShelfRoute names the route of the read-only link of public shelves,
+// it takes the share token of the shelf.
+const SharedShelfRoute = "shared-shelf"
+
+type ShelfController struct {
+	Shelves repositories.ShelfRepository
+	Books   repositories.BookRepository
+}
+
+func NewShelfController(shelves repositories.ShelfRepository, books repositories.BookRepository) *ShelfController {
+	return &ShelfController{Shelves: shelves, Books: books}
+}
+
+// list the shelves of the current user
+func (sc *ShelfController) GetMyShelvesController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := listQuery(c)
+	if err != nil {
+		return err
+	}
+
+	shelves, page, err := sc.Shelves.List(userID, query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get my shelves",
+		"shelves": shelves,
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// create a shelf for the current user, a public one gets a share link
+func (sc *ShelfController) CreateShelfController(c echo.Context) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return err
+	}
+
+	body := models.ShelfRequest{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	shelf := models.Shelves{UserID: uint(userID), Name: body.Name}
+	if err := share(&shelf, body.Public != nil && *body.Public); err != nil {
+		return err
+	}
+	if err := sc.Shelves.Create(&shelf); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success create new shelf",
+		"shelf":   shelf,
+		"link":    sharedLink(c, shelf),
+	})
+}
+
+// get a shelf of the current user with its books in order
+func (sc *ShelfController) GetMyShelfController(c echo.Context) error {
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	books, err := sc.books(shelf)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get shelf by id",
+		"shelf":   shelf,
+		"books":   books,
+		"link":    sharedLink(c, shelf),
+	})
+}
+
+// rename a shelf of the current user or change its visibility, making it
+// private revokes its share link and leaving public out keeps it
+func (sc *ShelfController) UpdateShelfController(c echo.Context) error {
+	body := models.ShelfRequest{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	shelf.Name = body.Name
+	if body.Public != nil {
+		if err := share(&shelf, *body.Public); err != nil {
+			return err
+		}
+	}
+	if err := sc.Shelves.Update(int(shelf.ID), shelf); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated shelf by id",
+		"shelf":   shelf,
+		"link":    sharedLink(c, shelf),
+	})
+}
+
+// delete a shelf of the current user, the books stay in the catalogue
+func (sc *ShelfController) DeleteShelfController(c echo.Context) error {
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.Shelves.Delete(int(shelf.ID)); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success deleted shelf by id",
+	})
+}
+
+// put a book on a shelf of the current user, last unless a position is given
+func (sc *ShelfController) AddShelfBookController(c echo.Context) error {
+	body := models.ShelfBookRequest{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := sc.Books.FindByID(int(body.BookID)); err != nil {
+		return err
+	}
+	if err := sc.Shelves.AddBook(int(shelf.ID), int(body.BookID), body.Position); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success add book to shelf",
+	})
+}
+
+// take a book off a shelf of the current user
+func (sc *ShelfController) RemoveShelfBookController(c echo.Context) error {
+	bookID, err := idParam(c, "book_id")
+
+	if err != nil {
+		return err
+	}
+
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.Shelves.RemoveBook(int(shelf.ID), bookID); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success remove book from shelf",
+	})
+}
+
+// move books to the front of a shelf of the current user in the order given
+func (sc *ShelfController) ReorderShelfController(c echo.Context) error {
+	body := models.ReorderShelfRequest{}
+	if err := bindAndValidate(c, &body); err != nil {
+		return err
+	}
+
+	shelf, err := sc.owned(c)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.Shelves.Reorder(int(shelf.ID), body.BookIDs); err != nil {
+		return err
+	}
+
+	shelf, err = sc.Shelves.FindByID(int(shelf.ID))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success reorder shelf",
+		"shelf":   shelf,
+	})
+}
+
+// get a public shelf by its share token, no login needed
+func (sc *ShelfController) GetSharedShelfController(c echo.Context) error {
+	shelf, err := sc.Shelves.FindByToken(c.Param("token"))
+	if err != nil {
+		return err
+	}
+
+	books, err := sc.books(shelf)
+	if err != nil {
+		return err
+	}
+	// the ids of the books shown, the trashed ones are not shared either
+	bookIDs := make([]uint, len(books))
+	for i, book := range books {
+		bookIDs[i] = book.ID
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get shared shelf",
+		"shelf": map[string]interface{}{
+			"name":       shelf.Name,
+			"book_ids":   bookIDs,
+			"updated_at": shelf.UpdatedAt,
+		},
+		"books": books,
+	})
+}
+
+// the shelf :id if the current user owns it, other shelves are not found so
+// that private ones do not show
+func (sc *ShelfController) owned(c echo.Context) (models.Shelves, error) {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return models.Shelves{}, err
+	}
+
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return models.Shelves{}, err
+	}
+
+	shelf, err := sc.Shelves.FindByID(id)
+	if err != nil {
+		return shelf, err
+	}
+	if shelf.UserID != uint(userID) {
+		return models.Shelves{}, repositories.ErrNotFound
+	}
+	return shelf, nil
+}
+
+// the books of the shelf in its order, books in the trash are left out
+func (sc *ShelfController) books(shelf models.Shelves) ([]models.Books, error) {
+	found, err := sc.Books.FindByIDs(shelf.BookIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Books, len(found))
+	for _, book := range found {
+		byID[book.ID] = book
+	}
+
+	books := make([]models.Books, 0, len(found))
+	for _, bookID := range shelf.BookIDs {
+		if book, ok := byID[bookID]; ok {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+// share sets the visibility of shelf, a shelf that becomes public gets a new
+// share token and a private one none
+func share(shelf *models.Shelves, public bool) error {
+	shelf.Public = public
+	if !public {
+		shelf.ShareToken = ""
+		return nil
+	}
+	if shelf.ShareToken != "" {
+		return nil
+	}
+
+	token, err := m.RandomToken()
+	if err != nil {
+		return err
+	}
+	shelf.ShareToken = models.NullableString(token)
+	return nil
+}
+
+// the read-only link of a public shelf, empty for a private one
+func sharedLink(c echo.Context, shelf models.Shelves) string {
+	if !shelf.Public {
+		return ""
+	}
+	return c.Echo().Reverse(SharedShelfRoute, string(shelf.ShareToken))
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"encoding/json"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShelfController(t *testing.T) {
+	t.Parallel()
+
+	bc := newBookController(t, models.Books{Title: "mort"}, models.Books{Title: "jingo"}, models.Books{Title: "eric"})
+	sc := NewShelfController(repositories.NewMemoryShelfRepository(), bc.Books)
+	e := newTestEcho()
+	e.GET("/v1/shelves/shared/:token", sc.GetSharedShelfController).Name = SharedShelfRoute
+
+	call := func(handler echo.HandlerFunc, body string, userID int, params ...string) (map[string]interface{}, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		var names, values []string
+		for i := 0; i < len(params); i += 2 {
+			names, values = append(names, params[i]), append(values, params[i+1])
+		}
+		ctx.SetParamNames(names...)
+		ctx.SetParamValues(values...)
+		if userID > 0 {
+			ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(userID), "role": models.RoleMember}})
+		}
+		if err := handler(ctx); err != nil {
+			return nil, err
+		}
+		response := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+		return response, nil
+	}
+
+	testCase := []struct {
+		Name             string
+		Handler          echo.HandlerFunc
+		Body             string
+		UserID           int
+		Params           []string
+		ExpectStatusCode int
+	}{
+		{"to read", sc.CreateShelfController, `{"name": "to read"}`, 1, nil, http.StatusOK},
+		{"favourites", sc.CreateShelfController, `{"name": "favourites", "public": true}`, 1, nil, http.StatusOK},
+		{"same name", sc.CreateShelfController, `{"name": "to read"}`, 1, nil, http.StatusConflict},
+		{"another user", sc.CreateShelfController, `{"name": "to read"}`, 2, nil, http.StatusOK},
+		{"no name", sc.CreateShelfController, `{"public": true}`, 1, nil, http.StatusUnprocessableEntity},
+		{"add", sc.AddShelfBookController, `{"book_id": 1}`, 1, []string{"id", "1"}, http.StatusOK},
+		{"add last", sc.AddShelfBookController, `{"book_id": 2}`, 1, []string{"id", "1"}, http.StatusOK},
+		{"add first", sc.AddShelfBookController, `{"book_id": 3, "position": 1}`, 1, []string{"id", "1"}, http.StatusOK},
+		{"add twice", sc.AddShelfBookController, `{"book_id": 3}`, 1, []string{"id", "1"}, http.StatusConflict},
+		{"unknown book", sc.AddShelfBookController, `{"book_id": 9}`, 1, []string{"id", "1"}, http.StatusNotFound},
+		{"shelf of another user", sc.AddShelfBookController, `{"book_id": 1}`, 2, []string{"id", "1"}, http.StatusNotFound},
+		{"reorder", sc.ReorderShelfController, `{"book_ids": [2, 1]}`, 1, []string{"id", "1"}, http.StatusOK},
+		{"reorder a book not on the shelf", sc.ReorderShelfController, `{"book_ids": [9]}`, 1, []string{"id", "1"}, http.StatusNotFound},
+		{"reorder nothing", sc.ReorderShelfController, `{"book_ids": []}`, 1, []string{"id", "1"}, http.StatusUnprocessableEntity},
+		{"remove", sc.RemoveShelfBookController, ``, 1, []string{"id", "1", "book_id", "1"}, http.StatusOK},
+		{"remove again", sc.RemoveShelfBookController, ``, 1, []string{"id", "1", "book_id", "1"}, http.StatusNotFound},
+		{"delete shelf of another user", sc.DeleteShelfController, ``, 2, []string{"id", "2"}, http.StatusNotFound},
+	}
+	for _, val := range testCase {
+		_, err := call(val.Handler, val.Body, val.UserID, val.Params...)
+		if val.ExpectStatusCode == http.StatusOK {
+			assert.NoError(t, err, val.Name)
+			continue
+		}
+		assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err), val.Name)
+	}
+
+	response, err := call(sc.GetMyShelfController, "", 1, "id", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, response["shelf"].(map[string]interface{})["book_ids"])
+	assert.Equal(t, "jingo", response["books"].([]interface{})[0].(map[string]interface{})["title"])
+	assert.Empty(t, response["link"])
+
+	response, err = call(sc.GetMyShelvesController, "", 1)
+	assert.NoError(t, err)
+	assert.Len(t, response["shelves"], 2)
+
+	// a public shelf is shared with a link until it is made private
+	response, err = call(sc.UpdateShelfController, `{"name": "next up", "public": true}`, 1, "id", "1")
+	assert.NoError(t, err)
+	link := response["link"].(string)
+	assert.True(t, strings.HasPrefix(link, "/v1/shelves/shared/"))
+	token := strings.TrimPrefix(link, "/v1/shelves/shared/")
+
+	// books in the trash are left out
+	assert.NoError(t, bc.Books.Delete(3, 0))
+	response, err = call(sc.GetSharedShelfController, "", 0, "token", token)
+	assert.NoError(t, err)
+	assert.Equal(t, "next up", response["shelf"].(map[string]interface{})["name"])
+	assert.Len(t, response["books"], 1)
+	assert.Equal(t, []interface{}{float64(2)}, response["shelf"].(map[string]interface{})["book_ids"])
+
+	// another user can read it, but not change it
+	_, err = call(sc.UpdateShelfController, `{"name": "mine"}`, 2, "id", "1")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	// a rename keeps the link
+	response, err = call(sc.UpdateShelfController, `{"name": "up next"}`, 1, "id", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, link, response["link"])
+	_, err = call(sc.GetSharedShelfController, "", 0, "token", token)
+	assert.NoError(t, err)
+
+	_, err = call(sc.UpdateShelfController, `{"name": "next up", "public": false}`, 1, "id", "1")
+	assert.NoError(t, err)
+	_, err = call(sc.GetSharedShelfController, "", 0, "token", token)
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+
+	// made public again it gets a new link
+	response, err = call(sc.UpdateShelfController, `{"name": "next up", "public": true}`, 1, "id", "1")
+	assert.NoError(t, err)
+	assert.NotEqual(t, link, response["link"])
+
+	_, err = call(sc.DeleteShelfController, "", 1, "id", "1")
+	assert.NoError(t, err)
+	_, err = call(sc.GetMyShelfController, "", 1, "id", "1")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"errors"
+	"learn_testing/apperrors"
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type TokenController struct {
+	Users  repositories.UserRepository
+	Tokens repositories.TokenRepository
+	Issuer *m.TokenIssuer
+}
+
+func NewTokenController(users repositories.UserRepository, tokens repositories.TokenRepository, issuer *m.TokenIssuer) *TokenController {
+	return &TokenController{Users: users, Tokens: tokens, Issuer: issuer}
+}
+
+// a refresh token for the given session (token family), only its hash is stored
+func newRefreshToken(issuer *m.TokenIssuer, userId uint, familyId string) (string, *models.RefreshTokens, error) {
+	token, err := m.RandomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return token, &models.RefreshTokens{
+		UserID:    userId,
+		FamilyID:  familyId,
+		TokenHash: m.HashRefreshToken(token),
+		ExpiresAt: time.Now().Add(issuer.RefreshTokenTTL),
+	}, nil
+}
+
+// create access and refresh token for a new login session
+func issueSession(tokens repositories.TokenRepository, issuer *m.TokenIssuer, user models.Users) (models.TokenResponse, error) {
+	familyId, err := m.RandomToken()
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	refreshToken, stored, err := newRefreshToken(issuer, user.ID, familyId)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	if err := tokens.CreateRefreshToken(stored); err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	token, err := issuer.CreateToken(int(user.ID), user.Name, user.Role, familyId)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	return models.TokenResponse{Token: token, RefreshToken: refreshToken}, nil
+}
+
+var errInvalidRefreshToken = apperrors.Unauthorized("invalid refresh token")
+
+// exchange a refresh token for a new access and refresh token
+func (tc *TokenController) RefreshTokenController(c echo.Context) error {
+	request := models.TokenResponse{}
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+
+	if request.RefreshToken == "" {
+		return apperrors.BadRequest("refresh_token is required")
+	}
+
+	stored, err := tc.Tokens.FindRefreshToken(m.HashRefreshToken(request.RefreshToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	// a token that was already rotated or revoked is presented again, assume
+	// it was stolen and kill the whole session
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return tc.revokeReusedSession(stored.FamilyID)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return apperrors.Unauthorized("refresh token expired")
+	}
+
+	user, err := tc.Users.FindByID(int(stored.UserID))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	refreshToken, next, err := newRefreshToken(tc.Issuer, stored.UserID, stored.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	err = tc.Tokens.RotateRefreshToken(stored.ID, next)
+	if errors.Is(err, repositories.ErrTokenConsumed) {
+		return tc.revokeReusedSession(stored.FamilyID)
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := tc.Issuer.CreateToken(int(user.ID), user.Name, user.Role, stored.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success refresh token",
+		"token":   models.TokenResponse{Token: token, RefreshToken: refreshToken},
+	})
+}
+
+func (tc *TokenController) revokeReusedSession(familyId string) error {
+	if err := tc.Tokens.RevokeFamily(familyId); err != nil {
+		return err
+	}
+	return apperrors.Unauthorized("refresh token reuse detected")
+}
+
+// revoke the current access token and its session
+func (tc *TokenController) LogoutController(c echo.Context) error {
+	claims, ok := m.TokenClaims(c)
+	if !ok {
+		return apperrors.Unauthorized("missing or malformed jwt")
+	}
+
+	jti, _ := claims["jti"].(string)
+	sid, _ := claims["sid"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	if err := tc.Tokens.RevokeSession(jti, time.Unix(int64(exp), 0), sid); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success logout",
+	})
+}
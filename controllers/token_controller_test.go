@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"learn_testing/apperrors"
+	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var testTokenIssuer = m.NewTokenIssuer("secret", time.Hour, 24*time.Hour)
+
+func TestRefreshTokenController(t *testing.T) {
+	t.Parallel()
+
+	usedAt := time.Now().Add(-time.Minute)
+
+	testCase := []struct {
+		Name             string
+		Stored           *models.RefreshTokens
+		ExpectRevoked    bool
+		ExpectStatusCode int
+		ExpectMessage    string
+	}{
+		{
+			"unknown token",
+			nil,
+			false,
+			http.StatusUnauthorized,
+			"invalid refresh token",
+		},
+		{
+			"reused token revokes session",
+			&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: m.HashRefreshToken("refresh"), ExpiresAt: time.Now().Add(time.Hour), UsedAt: &usedAt},
+			true,
+			http.StatusUnauthorized,
+			"refresh token reuse detected",
+		},
+		{
+			"expired token",
+			&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: m.HashRefreshToken("refresh"), ExpiresAt: time.Now().Add(-time.Hour)},
+			false,
+			http.StatusUnauthorized,
+			"refresh token expired",
+		},
+		{
+			"deleted user",
+			&models.RefreshTokens{UserID: 9, FamilyID: "family", TokenHash: m.HashRefreshToken("refresh"), ExpiresAt: time.Now().Add(time.Hour)},
+			false,
+			http.StatusUnauthorized,
+			"invalid refresh token",
+		},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			tokens := repositories.NewMemoryTokenRepository()
+			if val.Stored != nil {
+				assert.NoError(t, tokens.CreateRefreshToken(val.Stored))
+			}
+			tc := NewTokenController(repositories.NewMemoryUserRepository(), tokens, testTokenIssuer)
+
+			res, _ := json.Marshal(models.TokenResponse{RefreshToken: "refresh"})
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+
+			err := tc.RefreshTokenController(ctx)
+
+			problem := apperrors.ProblemFor(err)
+			assert.Equal(t, val.ExpectStatusCode, problem.Status)
+			assert.Equal(t, val.ExpectMessage, problem.Detail)
+
+			revoked, err := tokens.IsRevoked("token-id", "family")
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectRevoked, revoked)
+		})
+	}
+}
+
+func TestRefreshTokenControllerRotation(t *testing.T) {
+	t.Parallel()
+
+	users := repositories.NewMemoryUserRepository()
+	assert.NoError(t, users.Create(&models.Users{Name: "ahmad naufal", Role: models.RoleMember}))
+	tokens := repositories.NewMemoryTokenRepository()
+	tc := NewTokenController(users, tokens, testTokenIssuer)
+
+	session, err := issueSession(tokens, testTokenIssuer, models.Users{Model: gorm.Model{ID: 1}})
+	assert.NoError(t, err)
+
+	refresh := func(refreshToken string) (*httptest.ResponseRecorder, error) {
+		res, _ := json.Marshal(models.TokenResponse{RefreshToken: refreshToken})
+		r := httptest.NewRequest("POST", "/", bytes.NewBuffer(res))
+		r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		w := httptest.NewRecorder()
+
+		e := newTestEcho()
+		return w, tc.RefreshTokenController(e.NewContext(r, w))
+	}
+
+	w, err := refresh(session.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	rotated := response["token"].(map[string]interface{})["refresh_token"].(string)
+	assert.NotEqual(t, session.RefreshToken, rotated)
+
+	// presenting the first token again kills the rotated one too
+	_, err = refresh(session.RefreshToken)
+	assert.Equal(t, "refresh token reuse detected", apperrors.ProblemFor(err).Detail)
+
+	_, err = refresh(rotated)
+	assert.Equal(t, "refresh token reuse detected", apperrors.ProblemFor(err).Detail)
+}
+
+func TestLogoutController(t *testing.T) {
+	t.Parallel()
+
+	tokens := repositories.NewMemoryTokenRepository()
+	assert.NoError(t, tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash"}))
+	tc := NewTokenController(repositories.NewMemoryUserRepository(), tokens, testTokenIssuer)
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	r := httptest.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	e := newTestEcho()
+	ctx := e.NewContext(r, w)
+	ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{
+		"jti":    "token-id",
+		"sid":    "family",
+		"userId": float64(1),
+		"exp":    float64(exp),
+	}})
+
+	err := tc.LogoutController(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	var response map[string]interface{}
+	err = json.NewDecoder(w.Result().Body).Decode(&response)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "success logout", response["message"])
+
+	revoked, err := tokens.IsRevoked("token-id", "other-family")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = tokens.IsRevoked("other-token", "family")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
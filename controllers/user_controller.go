@@ -1,59 +1,195 @@
 package controllers
 
 import (
-	"learn_testing/config"
+	"errors"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
 	m "learn_testing/middleware"
 	"learn_testing/models"
+	"learn_testing/repositories"
 	"net/http"
-	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
 
+type UserController struct {
+	Users  repositories.UserRepository
+	Tokens repositories.TokenRepository
+	Issuer *m.TokenIssuer
+	Audit  repositories.AuditRepository
+}
+
+func NewUserController(users repositories.UserRepository, tokens repositories.TokenRepository, issuer *m.TokenIssuer, audit repositories.AuditRepository) *UserController {
+	return &UserController{Users: users, Tokens: tokens, Issuer: issuer, Audit: audit}
+}
+
+// update runs write against the user id and records what it changed,
+// write gets the user as it was and the version If-Match asked for
+func (uc *UserController) update(c echo.Context, id int, write func(before models.Users, version uint) error) error {
+	before, err := uc.Users.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	version, err := ifMatch(c, before.Version)
+	if err != nil {
+		return err
+	}
+
+	if err := write(before, version); err != nil {
+		return err
+	}
+
+	after, err := uc.Users.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := audit(c, uc.Audit, models.AuditUser, after.ID, models.AuditUpdate, before, after); err != nil {
+		return err
+	}
+
+	setETag(c, etag(after.Version))
+	return nil
+}
+
 // get all users
-func GetUsersController(c echo.Context) error {
-	var users []models.Users
+func (uc *UserController) GetUsersController(c echo.Context) error {
+	query, err := listQuery(c, "name", "email", "role")
+	if err != nil {
+		return err
+	}
+
+	users, page, err := uc.Users.List(query)
 
-	if err := config.DB.Find(&users).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	if err != nil {
+		return err
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "success get all users",
-		"users":   users,
+		"users":   models.NewUserProfiles(users),
+		"meta":    listMeta(c, query, page),
 	})
 }
 
+// list the deleted users that can still be restored
+func (uc *UserController) GetTrashedUsersController(c echo.Context) error {
+	query, err := listQuery(c, "name", "email", "role")
+	if err != nil {
+		return err
+	}
+	query.Trashed = true
+
+	users, page, err := uc.Users.List(query)
+
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success get trashed users",
+		"users":   models.NewUserProfiles(users),
+		"meta":    listMeta(c, query, page),
+	})
+}
+
+// restore a deleted user from the trash, the sessions revoked on delete
+// stay revoked
+func (uc *UserController) RestoreUserController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	if err := uc.Users.Restore(id); err != nil {
+		return err
+	}
+
+	user, err := uc.Users.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := audit(c, uc.Audit, models.AuditUser, user.ID, models.AuditRestore, nil, user); err != nil {
+		return err
+	}
+
+	return uc.getUser(c, id, "success restored user by id")
+}
+
+// list the changes of a user, its deletion included
+func (uc *UserController) GetUserHistoryController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	exists := func() error {
+		_, err := uc.Users.FindByID(id)
+		return err
+	}
+	return history(c, uc.Audit, models.AuditUser, id, exists, "success get user history")
+}
+
 // get user by id
-func GetUserController(c echo.Context) error {
-	var user models.Users
+func (uc *UserController) GetUserController(c echo.Context) error {
+	id, err := idParam(c, "id")
 
-	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return uc.getUser(c, id, "success get user by id")
+}
+
+func (uc *UserController) getUser(c echo.Context, id int, message string) error {
+	user, err := uc.Users.FindByID(id)
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	if err := config.DB.Where("id = ?", id).Find(&user).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	setETag(c, etag(user.Version))
+	if notModified(c, etag(user.Version)) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "success get user by id",
-		"user":    user,
+		"message": message,
+		"user":    models.NewUserProfile(user),
 	})
 }
 
 // create new user
-func CreateUserController(c echo.Context) error {
+func (uc *UserController) CreateUserController(c echo.Context) error {
 	user := models.Users{}
-	c.Bind(&user)
+	if err := c.Bind(&user); err != nil {
+		return err
+	}
 
-	if err := config.DB.Create(&models.Users{
+	user.Email = helpers.NormalizeEmail(user.Email)
+	if err := c.Validate(&user); err != nil {
+		return err
+	}
+
+	hash, err := helpers.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+
+	created := models.Users{
 		Name:     user.Name,
 		Email:    user.Email,
-		Password: user.Password,
-	}).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		Password: hash,
+		Role:     models.RoleMember,
+	}
+	if err := uc.Users.Create(&created); err != nil {
+		return err
+	}
+
+	if err := audit(c, uc.Audit, models.AuditUser, created.ID, models.AuditCreate, nil, created); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -62,67 +198,269 @@ func CreateUserController(c echo.Context) error {
 }
 
 // delete user by id
-func DeleteUserController(c echo.Context) error {
-	var user models.Users
+func (uc *UserController) DeleteUserController(c echo.Context) error {
+	id, err := idParam(c, "id")
 
-	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return uc.deleteUser(c, id, "success deleted user by id")
+}
 
+// the user goes to the trash unless ?permanent=true
+func (uc *UserController) deleteUser(c echo.Context, id int, message string) error {
+	permanent, err := permanentDelete(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	res := config.DB.Unscoped().Delete(&user, "id = ?", id)
+	// an account in the trash can still be purged
+	var (
+		before  interface{}
+		version uint
+	)
+	user, err := uc.Users.FindByID(id)
+	if err == nil {
+		before = user
+		if version, err = ifMatch(c, user.Version); err != nil {
+			return err
+		}
+	} else if !permanent || !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
 
-	if res.Error != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	action := models.AuditDelete
+	if permanent {
+		action = models.AuditPurge
+		err = uc.Users.Purge(id)
+	} else {
+		err = uc.Users.Delete(id, version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := uc.Tokens.RevokeUserSessions(id, ""); err != nil {
+		return err
+	}
+
+	if err := audit(c, uc.Audit, models.AuditUser, uint(id), action, before, nil); err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "success deleted user by id",
+		"message": message,
 	})
 }
 
 // update user by id
-func UpdateUserController(c echo.Context) error {
+func (uc *UserController) UpdateUserController(c echo.Context) error {
+	id, err := idParam(c, "id")
+
+	if err != nil {
+		return err
+	}
+
+	return uc.updateUser(c, id, "success updated user by id")
+}
+
+func (uc *UserController) updateUser(c echo.Context, id int, message string) error {
 	users := models.Users{}
-	c.Bind(&users)
+	if err := c.Bind(&users); err != nil {
+		return err
+	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	// the role is only changed through UpdateUserRoleController
+	users.Role = ""
+	users.Email = helpers.NormalizeEmail(users.Email)
+
+	// members change their password through ChangeMyPasswordController, which
+	// checks the current one first, admins may reset it here
+	if users.Password != "" && !m.HasRole(c, models.RoleAdmin) {
+		return apperrors.BadRequest("password can only be changed through /v1/me/password")
+	}
+
+	if err := validatePresent(c, &users); err != nil {
+		return err
+	}
+
+	if users.Password != "" {
+		var err error
+		if users.Password, err = helpers.HashPassword(users.Password); err != nil {
+			return err
+		}
+	}
+
+	write := func(_ models.Users, version uint) error {
+		users.Version = version
+		return uc.Users.Update(id, users)
+	}
+	if err := uc.update(c, id, write); err != nil {
+		return err
+	}
+
+	// a reset password signs the user out everywhere
+	if users.Password != "" {
+		if err := uc.Tokens.RevokeUserSessions(id, ""); err != nil {
+			return err
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": message,
+	})
+}
+
+// patch user by id with a merge patch or a json patch, the same fields as
+// an update can be changed
+func (uc *UserController) PatchUserController(c echo.Context) error {
+	id, err := idParam(c, "id")
 
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return err
 	}
 
-	if err := config.DB.Model(models.Users{}).Where("id = ?", id).Updates(users).Error; err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	reset := false
+	write := func(before models.Users, _ uint) error {
+		// the password can be set but not read
+		before.Password = ""
+		users := models.Users{}
+		if err := applyPatch(c, before, &users, "name", "email", "password"); err != nil {
+			return err
+		}
+		users.Email = helpers.NormalizeEmail(users.Email)
+
+		if users.Password == "" {
+			if err := validateExcept(c, &users, "Password"); err != nil {
+				return err
+			}
+		} else {
+			if !m.HasRole(c, models.RoleAdmin) {
+				return apperrors.BadRequest("password can only be changed through /v1/me/password")
+			}
+			if err := c.Validate(&users); err != nil {
+				return err
+			}
+			var err error
+			if users.Password, err = helpers.HashPassword(users.Password); err != nil {
+				return err
+			}
+			reset = true
+		}
+
+		// the patch was applied to before, a change made meanwhile must not
+		// be overwritten
+		users.Version = before.Version
+		return uc.Users.Update(id, users)
+	}
+	if err := uc.update(c, id, write); err != nil {
+		return err
+	}
+
+	// a reset password signs the user out everywhere
+	if reset {
+		if err := uc.Tokens.RevokeUserSessions(id, ""); err != nil {
+			return err
+		}
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": "success updated user by id",
+		"message": "success patched user by id",
 	})
 }
 
-func LoginUserController(c echo.Context) error {
-	user := models.Users{}
-	c.Bind(&user)
+// change the role of a user by id
+func (uc *UserController) UpdateUserRoleController(c echo.Context) error {
+	request := models.Users{}
+	if err := c.Bind(&request); err != nil {
+		return err
+	}
+
+	id, err := idParam(c, "id")
 
-	err := config.DB.Where("email = ? AND password = ?", user.Email, user.Password).First(&user).Error
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"message": "login failed",
-			"error":   err.Error(),
-		})
+		return err
+	}
+
+	if !models.IsValidRole(request.Role) {
+		return apperrors.Validation("request is invalid", map[string]string{"role": "must be one of admin, librarian, member"})
 	}
 
-	token, err := m.CreateToken(int(user.ID), user.Name)
+	if err := uc.update(c, id, func(models.Users, uint) error { return uc.Users.UpdateRole(id, request.Role) }); err != nil {
+		return err
+	}
+
+	// tokens carry the role, the user signs in again to get the new one
+	if err := uc.Tokens.RevokeUserSessions(id, ""); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message": "success updated user role by id",
+	})
+}
+
+// the same answer for an unknown email and a wrong password, so logins can
+// not be used to find out which emails have an account
+var errInvalidLogin = apperrors.Unauthorized("invalid email or password")
+
+// login user and return jwt token
+func (uc *UserController) LoginUserController(c echo.Context) error {
+	login := models.Users{}
+	if err := c.Bind(&login); err != nil {
+		return err
+	}
+	// a legacy row with an empty password must not let an empty one in
+	if login.Password == "" {
+		return errInvalidLogin
+	}
+
+	user, err := uc.Users.FindByEmail(helpers.NormalizeEmail(login.Email))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errInvalidLogin
+	}
+	if err != nil {
+		return err
+	}
+
+	// a stored value that is no hash we can check is the row's problem, not
+	// the client's, it is logged and answered like a wrong password
+	match, needsRehash, err := helpers.VerifyPassword(login.Password, user.Password)
+	if errors.Is(err, helpers.ErrInvalidHash) || errors.Is(err, helpers.ErrIncompatibleVersion) {
+		c.Logger().Errorf("verify password of user %d: %v", user.ID, err)
+		return errInvalidLogin
+	}
+	if err != nil {
+		return err
+	}
+	if !match {
+		return errInvalidLogin
+	}
+
+	// upgrade plaintext rows and hashes made with old parameters, a failure
+	// here must not block the login
+	if needsRehash {
+		if hash, err := helpers.HashPassword(login.Password); err == nil {
+			if err := uc.Users.RehashPassword(int(user.ID), hash); err != nil {
+				c.Logger().Errorf("rehash password for user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	tokens, err := issueSession(uc.Tokens, uc.Issuer, user)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"message": "login failed",
-			"error":   err.Error(),
-		})
+		return err
 	}
 
-	userResponse := models.UserResponse{ID: int(user.ID), Name: user.Name, Email: user.Email, Token: token}
+	userResponse := models.UserResponse{
+		ID:           int(user.ID),
+		Name:         user.Name,
+		Email:        user.Email,
+		Role:         user.Role,
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"messages": "success create user",
@@ -2,46 +2,38 @@ package controllers
 
 import (
 	"bytes"
-	"database/sql/driver"
 	"encoding/json"
-	"learn_testing/config"
+	"learn_testing/apperrors"
+	"learn_testing/helpers"
 	"learn_testing/models"
+	"learn_testing/repositories"
 	"net/http"
 	"net/http/httptest"
-	"regexp"
+	"strings"
 	"testing"
-	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
-func TestGetUsersController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New()
-
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
+func newUserController(t *testing.T, users ...models.Users) *UserController {
+	repo := repositories.NewMemoryUserRepository()
+	for i := range users {
+		assert.NoError(t, repo.Create(&users[i]))
+	}
+	return NewUserController(repo, repositories.NewMemoryTokenRepository(), testTokenIssuer, repositories.NewMemoryAuditRepository())
+}
 
-	row := sqlmock.NewRows([]string{"name", "email"}).
-		AddRow("ahmad naufal", "ahmad@gmail.com")
+func TestGetUsersController(t *testing.T) {
+	t.Parallel()
 
-	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL")).
-		WillReturnRows(row)
+	uc := newUserController(t, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com"})
 
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
 		Method           string
-		Body             models.Users
 		HasReturnBody    bool
 		ExpectBody       models.Users
 	}{
@@ -49,21 +41,23 @@ func TestGetUsersController(t *testing.T) {
 			"success",
 			http.StatusOK,
 			"GET",
-			models.Users{},
-			false,
-			models.Users{},
+			true,
+			models.Users{Name: "ahmad naufal"},
 		},
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
 			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 
-			err := GetUsersController(ctx)
+			err := uc.GetUsersController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -73,36 +67,21 @@ func TestGetUsersController(t *testing.T) {
 				err := json.NewDecoder(w.Result().Body).Decode(&response)
 
 				assert.NoError(t, err)
-				assert.Equal(t, val.ExpectBody.Name, response["user"].(map[string]interface{})["name"])
+				assert.Equal(t, val.ExpectBody.Name, response["users"].([]interface{})[0].(map[string]interface{})["name"])
 			}
 		})
 	}
 }
 
 func TestGetUserController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New()
+	t.Parallel()
 
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	row := sqlmock.NewRows([]string{"name", "email", "password"}).
-		AddRow("ahmad naufal", "ahmad@gmail.com", "alta@1234")
-
-	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE id = ? AND `users`.`deleted_at` IS NULL")).
-		WithArgs(1).
-		WillReturnRows(row)
+	uc := newUserController(t, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com", Password: "alta@1234"})
 
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
 		Method           string
-		Body             models.Users
 		HasReturnBody    bool
 		ExpectBody       models.Users
 	}{
@@ -110,7 +89,6 @@ func TestGetUserController(t *testing.T) {
 			"success",
 			http.StatusOK,
 			"GET",
-			models.Users{},
 			true,
 			models.Users{
 				Name: "ahmad naufal",
@@ -119,18 +97,20 @@ func TestGetUserController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
-			res, _ := json.Marshal(val.Body)
-			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			t.Parallel()
+
+			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
 			ctx.SetParamValues("1")
 
-			err := GetUserController(ctx)
+			err := uc.GetUserController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -146,31 +126,9 @@ func TestGetUserController(t *testing.T) {
 	}
 }
 
-type AnyTime struct{}
-
-func (a AnyTime) Match(v driver.Value) bool {
-	_, ok := v.(time.Time)
-	return ok
-}
-
 func TestCreateUserController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
-
-	assert.NoError(t, err)
+	t.Parallel()
 
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	mocked.ExpectBegin()
-	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`name`,`email`,`password`) VALUES (?,?,?,?,?,?)")).
-		WithArgs(AnyTime{}, AnyTime{}, "NULL", "ahmad naufal", "ahmad@gmail.com", "alta@1234").
-		WillReturnResult(sqlmock.NewErrorResult(nil))
-
-	mocked.ExpectCommit()
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
@@ -187,6 +145,7 @@ func TestCreateUserController(t *testing.T) {
 				Name:     "ahmad naufal",
 				Email:    "ahmad@gmail.com",
 				Password: "alta@1234",
+				Role:     models.RoleAdmin,
 			},
 			true,
 			"success create new users",
@@ -194,15 +153,21 @@ func TestCreateUserController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t)
+
 			res, _ := json.Marshal(val.Body)
 			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 
-			err := CreateUserController(ctx)
+			err := uc.CreateUserController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -214,31 +179,20 @@ func TestCreateUserController(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			// the password is stored hashed and the role can not be chosen
+			stored, _ := uc.Users.FindByID(1)
+			match, _, err := helpers.VerifyPassword(val.Body.Password, stored.Password)
+			assert.NoError(t, err)
+			assert.True(t, match)
+			assert.NotEqual(t, val.Body.Password, stored.Password)
+			assert.Equal(t, models.RoleMember, stored.Role)
 		})
 	}
 }
 
 func TestDeleteUserController(t *testing.T) {
-	// mocking
-	dbFakeGorm, mocked, err := sqlmock.New()
-
-	assert.NoError(t, err)
-
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
-
-	config.DB = dbGorm
-
-	mocked.ExpectBegin()
-
-	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `users` WHERE id = ?")).
-		WithArgs(1).
-		WillReturnResult(sqlmock.NewResult(1, 0)).
-		WillReturnError(nil)
-
-	mocked.ExpectCommit()
+	t.Parallel()
 
 	testCase := []struct {
 		Name             string
@@ -257,18 +211,24 @@ func TestDeleteUserController(t *testing.T) {
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, models.Users{Name: "ahmad naufal"})
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash"}))
+
 			r := httptest.NewRequest(val.Method, "/", nil)
 			w := httptest.NewRecorder()
 
 			// handler echo
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
 			ctx.SetParamValues("1")
 
-			err := DeleteUserController(ctx)
+			err := uc.DeleteUserController(ctx)
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -281,32 +241,130 @@ func TestDeleteUserController(t *testing.T) {
 				assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			// sessions of the deleted user are revoked
+			revoked, err := uc.Tokens.IsRevoked("token-id", "family")
+			assert.NoError(t, err)
+			assert.True(t, revoked)
 		})
 	}
 }
 
-func TestUpdateUserController(t *testing.T) {
-	dbFakeGorm, mocked, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+func TestRestoreUserController(t *testing.T) {
+	t.Parallel()
+
+	uc := newUserController(t, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com"})
+	e := newTestEcho()
+
+	call := func(handler echo.HandlerFunc, method, target string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(method, target, nil)
+		w := httptest.NewRecorder()
+		ctx := e.NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("1")
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(2), "role": models.RoleAdmin}})
+		return w, handler(ctx)
+	}
+
+	_, err := call(uc.DeleteUserController, "DELETE", "/")
+	assert.NoError(t, err)
+
+	w, err := call(uc.GetTrashedUsersController, "GET", "/users/trash")
+	assert.NoError(t, err)
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Len(t, response["users"], 1)
+
+	w, err = call(uc.RestoreUserController, "POST", "/")
+	assert.NoError(t, err)
+	assert.NoError(t, json.NewDecoder(w.Result().Body).Decode(&response))
+	assert.Equal(t, "success restored user by id", response["message"])
+
+	stored, err := uc.Users.FindByEmail("ahmad@gmail.com")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), stored.ID)
+
+	// an admin can skip the trash
+	_, err = call(uc.DeleteUserController, "DELETE", "/?permanent=true")
+	assert.NoError(t, err)
+	_, err = call(uc.RestoreUserController, "POST", "/")
+	assert.Equal(t, http.StatusNotFound, apperrors.StatusCode(err))
 
+	history, _, err := uc.Audit.History(models.AuditUser, 1, repositories.ListQuery{})
 	assert.NoError(t, err)
+	var actions []string
+	for _, event := range history {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{models.AuditDelete, models.AuditRestore, models.AuditPurge}, actions)
+}
+
+func TestUserResponsesHidePassword(t *testing.T) {
+	t.Parallel()
+
+	uc := newUserController(t,
+		models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com", Password: "secret-hash"},
+		models.Users{Name: "budi", Email: "budi@gmail.com", Password: "secret-hash"},
+	)
+	assert.NoError(t, uc.Users.Delete(2, 0))
+
+	testCase := []struct {
+		Name    string
+		Handler echo.HandlerFunc
+	}{
+		{"get", uc.GetUserController},
+		{"list", uc.GetUsersController},
+		{"trash", uc.GetTrashedUsersController},
+		{"me", uc.GetMeController},
+	}
+	for _, val := range testCase {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+		ctx := newTestEcho().NewContext(r, w)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues("1")
+		ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": models.RoleAdmin}})
+
+		assert.NoError(t, val.Handler(ctx), val.Name)
+		assert.Contains(t, w.Body.String(), `"email"`, val.Name)
+		assert.NotContains(t, w.Body.String(), "password", val.Name)
+		assert.NotContains(t, w.Body.String(), "secret-hash", val.Name)
+	}
+}
 
-	dbGorm, _ := gorm.Open(mysql.New(mysql.Config{
-		SkipInitializeWithVersion: true,
-		Conn:                      dbFakeGorm,
-	}))
+func TestUserHistoryRedactsPassword(t *testing.T) {
+	t.Parallel()
 
-	config.DB = dbGorm
+	uc := newUserController(t, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com", Password: "old-hash"})
 
-	mocked.ExpectBegin()
-	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
-		WithArgs(AnyTime{}, 1).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	r := httptest.NewRequest("PUT", "/", strings.NewReader(`{"name": "ahmad", "password": "alta@12345"}`))
+	r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	e := newTestEcho()
+	ctx := e.NewContext(r, w)
+	ctx.SetParamNames("id")
+	ctx.SetParamValues("1")
+	ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(2), "role": models.RoleAdmin}})
+	assert.NoError(t, uc.UpdateUserController(ctx))
+
+	history, _, err := uc.Audit.History(models.AuditUser, 1, repositories.ListQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, models.AuditChanges{
+		"name":     {From: "ahmad naufal", To: "ahmad"},
+		"password": {From: "[redacted]", To: "[redacted]"},
+	}, history[0].Changes)
+	assert.Equal(t, "[redacted]", history[0].State["password"])
+}
+
+func TestUpdateUserController(t *testing.T) {
+	t.Parallel()
 
-	mocked.ExpectCommit()
 	testCase := []struct {
 		Name             string
 		ExpectStatusCode int
 		Method           string
+		Role             string
 		Body             models.Users
 		HasReturnBody    bool
 		ExpectBody       string
@@ -314,7 +372,8 @@ func TestUpdateUserController(t *testing.T) {
 		{
 			"success",
 			http.StatusOK,
-			"POST",
+			"PUT",
+			models.RoleAdmin,
 			models.Users{
 				Name:     "ahmad naufal",
 				Email:    "ahmad@gmail.com",
@@ -323,21 +382,44 @@ func TestUpdateUserController(t *testing.T) {
 			true,
 			"success updated user by id",
 		},
+		{
+			"member can not reset password",
+			http.StatusBadRequest,
+			"PUT",
+			models.RoleMember,
+			models.Users{
+				Password: "alta@1234",
+			},
+			false,
+			"",
+		},
 	}
 
 	for _, val := range testCase {
+		val := val
 		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, models.Users{Name: "old name", Email: "old@gmail.com", Role: models.RoleMember})
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash"}))
+
 			res, _ := json.Marshal(val.Body)
 			r := httptest.NewRequest(val.Method, "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			w := httptest.NewRecorder()
 
-			e := echo.New()
+			e := newTestEcho()
 			ctx := e.NewContext(r, w)
 			ctx.SetPath("/:id")
 			ctx.SetParamNames("id")
 			ctx.SetParamValues("1")
+			ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": val.Role}})
 
-			err := UpdateUserController(ctx)
+			err := uc.UpdateUserController(ctx)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				return
+			}
 			assert.NoError(t, err)
 
 			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
@@ -349,6 +431,347 @@ func TestUpdateUserController(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, val.ExpectBody, response["message"])
 			}
+
+			stored, _ := uc.Users.FindByID(1)
+			assert.Equal(t, val.Body.Name, stored.Name)
+			match, _, err := helpers.VerifyPassword(val.Body.Password, stored.Password)
+			assert.NoError(t, err)
+			assert.True(t, match)
+			assert.NotEqual(t, val.Body.Password, stored.Password)
+
+			// a reset password signs the user out everywhere
+			revoked, err := uc.Tokens.IsRevoked("token-id", "family")
+			assert.NoError(t, err)
+			assert.True(t, revoked)
+		})
+	}
+}
+
+func TestUpdateUserRoleController(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name             string
+		Body             models.Users
+		ExpectStatusCode int
+	}{
+		{"success", models.Users{Role: models.RoleLibrarian}, http.StatusOK},
+		{"unknown role", models.Users{Role: "owner"}, http.StatusUnprocessableEntity},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, models.Users{Name: "ahmad naufal", Role: models.RoleMember})
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash"}))
+
+			res, _ := json.Marshal(val.Body)
+			r := httptest.NewRequest("PUT", "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.SetPath("/:id/role")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("1")
+
+			err := uc.UpdateUserRoleController(ctx)
+			revoked, revokedErr := uc.Tokens.IsRevoked("token-id", "family")
+			assert.NoError(t, revokedErr)
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				assert.False(t, revoked)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
+
+			stored, _ := uc.Users.FindByID(1)
+			assert.Equal(t, val.Body.Role, stored.Role)
+
+			// sessions issued with the old role are revoked
+			assert.True(t, revoked)
+		})
+	}
+}
+
+func TestLoginUserController(t *testing.T) {
+	t.Parallel()
+
+	hash, err := helpers.HashPassword("alta@1234")
+	assert.NoError(t, err)
+
+	testCase := []struct {
+		Name             string
+		ExpectStatusCode int
+		Stored           models.Users
+		Body             models.Users
+		ExpectBody       string
+	}{
+		{
+			"success",
+			http.StatusOK,
+			models.Users{Email: "ahmad@gmail.com", Password: hash},
+			models.Users{Email: "ahmad@gmail.com", Password: "alta@1234"},
+			"",
+		},
+		{
+			"success with legacy plaintext password",
+			http.StatusOK,
+			models.Users{Email: "ahmad@gmail.com", Password: "alta@1234"},
+			models.Users{Email: "ahmad@gmail.com", Password: "alta@1234"},
+			"",
+		},
+		{
+			"email ignores case and spaces",
+			http.StatusOK,
+			models.Users{Email: "ahmad@gmail.com", Password: hash},
+			models.Users{Email: " Ahmad@Gmail.com", Password: "alta@1234"},
+			"",
+		},
+		{
+			"unknown email",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: hash},
+			models.Users{Email: "nobody@gmail.com", Password: "alta@1234"},
+			"invalid email or password",
+		},
+		{
+			"wrong password",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: hash},
+			models.Users{Email: "ahmad@gmail.com", Password: "wrong"},
+			"invalid email or password",
+		},
+		{
+			"wrong legacy plaintext password",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: "alta@1234"},
+			models.Users{Email: "ahmad@gmail.com", Password: "wrong"},
+			"invalid email or password",
+		},
+		{
+			"stored value that is no hash",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: "$alta@1234"},
+			models.Users{Email: "ahmad@gmail.com", Password: "$alta@1234"},
+			"invalid email or password",
+		},
+		{
+			"argon2 hash of another version",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: strings.Replace(hash, "$v=19$", "$v=16$", 1)},
+			models.Users{Email: "ahmad@gmail.com", Password: "alta@1234"},
+			"invalid email or password",
+		},
+		{
+			"empty password",
+			http.StatusUnauthorized,
+			models.Users{Email: "ahmad@gmail.com", Password: ""},
+			models.Users{Email: "ahmad@gmail.com", Password: ""},
+			"invalid email or password",
+		},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, val.Stored)
+
+			res, _ := json.Marshal(val.Body)
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+
+			// failures are rendered like the server does
+			if err := uc.LoginUserController(ctx); err != nil {
+				apperrors.HTTPErrorHandler(err, ctx)
+			}
+
+			assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
+
+			var response map[string]interface{}
+			err := json.NewDecoder(w.Result().Body).Decode(&response)
+
+			assert.NoError(t, err)
+
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, apperrors.MIMEProblemJSON, w.Result().Header.Get(echo.HeaderContentType))
+				assert.Equal(t, val.ExpectBody, response["detail"])
+				assert.Equal(t, "unauthorized", response["code"])
+				return
+			}
+
+			// the response carries a working token pair and the stored
+			// password is now an argon2id hash
+			user := response["user"].(map[string]interface{})
+			assert.NotEmpty(t, user["refresh_token"])
+
+			token, err := jwt.Parse(user["token"].(string), func(*jwt.Token) (interface{}, error) {
+				return testTokenIssuer.Secret, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, float64(1), token.Claims.(jwt.MapClaims)["userId"])
+
+			stored, _ := uc.Users.FindByID(1)
+			_, needsRehash, err := helpers.VerifyPassword(val.Body.Password, stored.Password)
+			assert.NoError(t, err)
+			assert.False(t, needsRehash)
+			// nothing the user sees changed, their next If-Match still holds
+			assert.Equal(t, uint(1), stored.Version)
+		})
+	}
+}
+
+func TestCreateUserControllerEmailTaken(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name  string
+		Email string
+	}{
+		{"same email", "ahmad@gmail.com"},
+		{"other case", "Ahmad@Gmail.COM"},
+		{"surrounding spaces", " ahmad@gmail.com "},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t, models.Users{Name: "ahmad", Email: "ahmad@gmail.com"})
+
+			res, _ := json.Marshal(models.Users{Name: "ahmad naufal", Email: val.Email, Password: "alta@1234"})
+			r := httptest.NewRequest("POST", "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			err := uc.CreateUserController(e.NewContext(r, w))
+
+			problem := apperrors.ProblemFor(err)
+			assert.Equal(t, http.StatusConflict, problem.Status)
+			assert.Equal(t, "email is already taken", problem.Detail)
+		})
+	}
+}
+
+func TestCreateUserControllerValidation(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name         string
+		Body         models.Users
+		ExpectFields map[string]string
+	}{
+		{
+			"empty",
+			models.Users{},
+			map[string]string{"name": "is required", "email": "is required", "password": "is required"},
+		},
+		{
+			"malformed email and weak password",
+			models.Users{Name: "ahmad", Email: "ahmad.gmail.com", Password: "12345678"},
+			map[string]string{"email": "must be a valid email address", "password": "must contain a letter and a digit"},
+		},
+		{
+			"short password",
+			models.Users{Name: "ahmad", Email: "ahmad@gmail.com", Password: "a1"},
+			map[string]string{"password": "must be at least 8 characters"},
+		},
+	}
+
+	for _, val := range testCase {
+		val := val
+		t.Run(val.Name, func(t *testing.T) {
+			t.Parallel()
+
+			uc := newUserController(t)
+
+			res, _ := json.Marshal(val.Body)
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(res))
+			r.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+
+			err := uc.CreateUserController(ctx)
+
+			problem := apperrors.ProblemFor(err)
+			assert.Equal(t, http.StatusUnprocessableEntity, problem.Status)
+			assert.Equal(t, val.ExpectFields, problem.Errors)
+
+			users, _ := uc.Users.FindAll()
+			assert.Empty(t, users)
+		})
+	}
+}
+
+func TestPatchUserController(t *testing.T) {
+	t.Parallel()
+
+	testCase := []struct {
+		Name             string
+		Role             string
+		Body             string
+		ExpectStatusCode int
+		ExpectName       string
+		ExpectPassword   bool
+	}{
+		{"change name", models.RoleMember, `{"name": "ahmad"}`, http.StatusOK, "ahmad", false},
+		{"password is not readable", models.RoleMember, `[{"op": "test", "path": "/password", "value": "old-hash"}]`, http.StatusConflict, "", false},
+		{"member sets password", models.RoleMember, `[{"op": "replace", "path": "/password", "value": "alta@12345"}]`, http.StatusBadRequest, "", false},
+		{"admin sets password", models.RoleAdmin, `[{"op": "replace", "path": "/password", "value": "alta@12345"}]`, http.StatusOK, "ahmad naufal", true},
+		{"role is read only", models.RoleAdmin, `[{"op": "replace", "path": "/role", "value": "admin"}]`, http.StatusUnprocessableEntity, "", false},
+		{"invalid email", models.RoleMember, `[{"op": "replace", "path": "/email", "value": "ahmad"}]`, http.StatusUnprocessableEntity, "", false},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			uc := newUserController(t, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com", Password: "old-hash", Role: models.RoleMember})
+			assert.NoError(t, uc.Tokens.CreateRefreshToken(&models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash"}))
+
+			contentType := mimeJSONPatch
+			if strings.HasPrefix(val.Body, "{") {
+				contentType = mimeMergePatch
+			}
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(val.Body))
+			r.Header.Set(echo.HeaderContentType, contentType)
+			w := httptest.NewRecorder()
+			e := newTestEcho()
+			ctx := e.NewContext(r, w)
+			ctx.SetParamNames("id")
+			ctx.SetParamValues("1")
+			ctx.Set("user", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": val.Role}})
+
+			err := uc.PatchUserController(ctx)
+			user, findErr := uc.Users.FindByID(1)
+			assert.NoError(t, findErr)
+
+			if val.ExpectStatusCode != http.StatusOK {
+				assert.Equal(t, val.ExpectStatusCode, apperrors.StatusCode(err))
+				assert.Equal(t, uint(1), user.Version)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectName, user.Name)
+			assert.Equal(t, "ahmad@gmail.com", user.Email)
+			assert.Equal(t, models.RoleMember, user.Role)
+			assert.Equal(t, val.ExpectPassword, user.Password != "old-hash")
+			revoked, err := uc.Tokens.IsRevoked("token-id", "family")
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectPassword, revoked)
 		})
 	}
 }
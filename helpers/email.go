@@ -0,0 +1,9 @@
+package helpers
+
+import "strings"
+
+// NormalizeEmail is the form emails are stored and looked up in, so that
+// "Ahmad@Gmail.com " and "ahmad@gmail.com" are the same account.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,70 @@
+package helpers
+
+import "strings"
+
+// NormalizeISBN is the form ISBNs are stored and looked up in: the ISBN-13
+// of isbn, which may be an ISBN-10 or an ISBN-13 with hyphens and spaces.
+// ok is false when isbn is not a valid ISBN, ISBN-13s start with 978 or 979,
+// other EAN-13s such as the 977 of ISSNs are not ISBNs.
+func NormalizeISBN(isbn string) (isbn13 string, ok bool) {
+	isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+
+	switch len(isbn) {
+	case 10:
+		if !digits(isbn[:9]) || isbn10Check(isbn[:9]) != isbn[9] {
+			return "", false
+		}
+		isbn = "978" + isbn[:9]
+		return isbn + string(isbn13Check(isbn)), true
+	case 13:
+		if !digits(isbn) || !(strings.HasPrefix(isbn, "978") || strings.HasPrefix(isbn, "979")) || isbn13Check(isbn[:12]) != isbn[12] {
+			return "", false
+		}
+		return isbn, true
+	}
+	return "", false
+}
+
+// ISBN10 is the ISBN-10 of a normalized ISBN-13, only those starting with
+// 978 have one.
+func ISBN10(isbn13 string) (string, bool) {
+	if len(isbn13) != 13 || !strings.HasPrefix(isbn13, "978") {
+		return "", false
+	}
+	return isbn13[3:12] + string(isbn10Check(isbn13[3:12])), true
+}
+
+// the check digit of the first 9 digits of an ISBN-10, X stands for 10
+func isbn10Check(digits string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(digits[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// the check digit of the first 12 digits of an ISBN-13
+func isbn13Check(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(digits[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
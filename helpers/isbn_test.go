@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	testCase := []struct {
+		Name   string
+		ISBN   string
+		Expect string
+		Valid  bool
+	}{
+		{"isbn 13", "9780306406157", "9780306406157", true},
+		{"isbn 13 with hyphens", "978-0-306-40615-7", "9780306406157", true},
+		{"isbn 10 is converted", "0-306-40615-2", "9780306406157", true},
+		{"isbn 10 with X check digit", "0-8044-2957-x", "9780804429573", true},
+		{"979 prefix", "979-10-90636-07-1", "9791090636071", true},
+		{"isbn 13 wrong check digit", "978-0-306-40615-8", "", false},
+		{"issn prefix", "977-0-306-40615-8", "", false},
+		{"980 prefix", "980-0-306-40615-2", "", false},
+		{"not a bookland prefix", "123-0-306-40615-5", "", false},
+		{"isbn 10 wrong check digit", "0-306-40615-3", "", false},
+		{"X inside isbn 10", "0-30X-40615-2", "", false},
+		{"wrong length", "978030640615", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			isbn, ok := NormalizeISBN(val.ISBN)
+			assert.Equal(t, val.Valid, ok)
+			assert.Equal(t, val.Expect, isbn)
+		})
+	}
+}
+
+func TestISBN10(t *testing.T) {
+	isbn, ok := ISBN10("9780306406157")
+	assert.True(t, ok)
+	assert.Equal(t, "0306406152", isbn)
+
+	isbn, ok = ISBN10("9780804429573")
+	assert.True(t, ok)
+	assert.Equal(t, "080442957X", isbn)
+
+	_, ok = ISBN10("9791090636071")
+	assert.False(t, ok)
+}
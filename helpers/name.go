@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NameKey is what two spellings of the same name have in common: their
+// letters and digits, lower cased. "J.K. Rowling" and "JK  Rowling" are the
+// same author by it.
+func NameKey(name string) string {
+	var key strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
+
+// CleanName collapses the white space of a name.
+func CleanName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// SplitAuthors splits the authors credited on a book, separated by ";" or
+// "&", into their cleaned names.
+func SplitAuthors(author string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(author, func(r rune) bool { return r == ';' || r == '&' }) {
+		if name = CleanName(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// JoinAuthors credits names on a book the way SplitAuthors reads them.
+func JoinAuthors(names []string) string {
+	return strings.Join(names, "; ")
+}
@@ -0,0 +1,225 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// the argon2id parameters a stored hash may carry, memory is in KiB
+const (
+	minArgon2Memory     = 8
+	maxArgon2Memory     = 1024 * 1024
+	maxArgon2Iterations = 64
+)
+
+var (
+	ErrInvalidHash         = errors.New("password hash is not in a supported format")
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+)
+
+// PasswordConfig holds the parameters used when hashing new passwords.
+type PasswordConfig struct {
+	Algorithm         string
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	Argon2SaltLength  uint32
+	Argon2KeyLength   uint32
+	BcryptCost        int
+}
+
+// DefaultPasswordConfig returns argon2id settings following the OWASP
+// recommendation (19 MiB, 2 iterations, 1 thread).
+func DefaultPasswordConfig() PasswordConfig {
+	return PasswordConfig{
+		Algorithm:         AlgorithmArgon2id,
+		Argon2Memory:      19 * 1024,
+		Argon2Iterations:  2,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+		BcryptCost:        bcrypt.DefaultCost,
+	}
+}
+
+type PasswordHasher struct {
+	config PasswordConfig
+}
+
+func NewPasswordHasher(config PasswordConfig) (*PasswordHasher, error) {
+	switch config.Algorithm {
+	case AlgorithmArgon2id:
+		if config.Argon2Memory == 0 || config.Argon2Iterations == 0 || config.Argon2Parallelism == 0 {
+			return nil, errors.New("argon2id memory, iterations and parallelism must be greater than zero")
+		}
+		// the hashes must pass the bounds Verify puts on stored ones
+		if config.Argon2Memory < minArgon2Memory || config.Argon2Memory > maxArgon2Memory || config.Argon2Iterations > maxArgon2Iterations {
+			return nil, fmt.Errorf("argon2id memory must be between %d and %d KiB and iterations at most %d", minArgon2Memory, maxArgon2Memory, maxArgon2Iterations)
+		}
+		if config.Argon2SaltLength < 8 || config.Argon2KeyLength < 16 {
+			return nil, errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes")
+		}
+	case AlgorithmBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown password algorithm %q", config.Algorithm)
+	}
+
+	return &PasswordHasher{config: config}, nil
+}
+
+// Hash encodes the password with the configured algorithm. Argon2id hashes
+// use the PHC string format so the parameters travel with the hash.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+		return string(hash), err
+	}
+
+	salt := make([]byte, h.config.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt,
+		h.config.Argon2Iterations,
+		h.config.Argon2Memory,
+		h.config.Argon2Parallelism,
+		h.config.Argon2KeyLength,
+	)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.config.Argon2Memory,
+		h.config.Argon2Iterations,
+		h.config.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify compares password with a stored value. needsRehash reports whether
+// the stored value should be replaced with a fresh hash: it is true for
+// legacy plaintext rows and for hashes made with other parameters.
+func (h *PasswordHasher) Verify(password, stored string) (match bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(stored)
+		if err != nil {
+			return false, false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Argon2Iterations, params.Argon2Memory, params.Argon2Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		return true, h.config.Algorithm != AlgorithmArgon2id ||
+			params.Argon2Memory != h.config.Argon2Memory ||
+			params.Argon2Iterations != h.config.Argon2Iterations ||
+			params.Argon2Parallelism != h.config.Argon2Parallelism ||
+			uint32(len(salt)) != h.config.Argon2SaltLength ||
+			uint32(len(key)) != h.config.Argon2KeyLength, nil
+
+	case isBcryptHash(stored):
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(stored))
+		if err != nil {
+			return false, false, err
+		}
+
+		return true, h.config.Algorithm != AlgorithmBcrypt || cost != h.config.BcryptCost, nil
+
+	case strings.HasPrefix(stored, "$"):
+		return false, false, ErrInvalidHash
+
+	default:
+		// rows created before hashing was introduced hold the plaintext
+		// password, they are upgraded on the next successful login
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(password)) != 1 {
+			return false, false, nil
+		}
+		return true, true, nil
+	}
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+func decodeArgon2id(stored string) (PasswordConfig, []byte, []byte, error) {
+	var params PasswordConfig
+
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, ErrIncompatibleVersion
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Iterations, &params.Argon2Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	// argon2 panics on zero iterations or threads and allocates the memory
+	// it is given, a stored value must not decide either
+	if params.Argon2Iterations == 0 || params.Argon2Iterations > maxArgon2Iterations ||
+		params.Argon2Parallelism == 0 ||
+		params.Argon2Memory < minArgon2Memory || params.Argon2Memory > maxArgon2Memory {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.Algorithm = AlgorithmArgon2id
+	return params, salt, key, nil
+}
+
+var passwordHasher, _ = NewPasswordHasher(DefaultPasswordConfig())
+
+// SetPasswordHasher replaces the hasher used by HashPassword and VerifyPassword.
+func SetPasswordHasher(h *PasswordHasher) {
+	passwordHasher = h
+}
+
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+func VerifyPassword(password, stored string) (match bool, needsRehash bool, err error) {
+	return passwordHasher.Verify(password, stored)
+}
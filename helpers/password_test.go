@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	argon, err := NewPasswordHasher(DefaultPasswordConfig())
+	assert.NoError(t, err)
+
+	bcryptConfig := DefaultPasswordConfig()
+	bcryptConfig.Algorithm = AlgorithmBcrypt
+	bcryptConfig.BcryptCost = 4
+	bcryptHasher, err := NewPasswordHasher(bcryptConfig)
+	assert.NoError(t, err)
+
+	strongerConfig := DefaultPasswordConfig()
+	strongerConfig.Argon2Iterations = 3
+	stronger, err := NewPasswordHasher(strongerConfig)
+	assert.NoError(t, err)
+
+	argonHash, err := argon.Hash("alta@1234")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argonHash, "$argon2id$v=19$m=19456,t=2,p=1$"))
+
+	bcryptHash, err := bcryptHasher.Hash("alta@1234")
+	assert.NoError(t, err)
+
+	testCase := []struct {
+		Name              string
+		Hasher            *PasswordHasher
+		Password          string
+		Stored            string
+		ExpectMatch       bool
+		ExpectNeedsRehash bool
+	}{
+		{"argon2id match", argon, "alta@1234", argonHash, true, false},
+		{"argon2id mismatch", argon, "wrong", argonHash, false, false},
+		{"argon2id parameters changed", stronger, "alta@1234", argonHash, true, true},
+		{"bcrypt match", bcryptHasher, "alta@1234", bcryptHash, true, false},
+		{"bcrypt upgraded to argon2id", argon, "alta@1234", bcryptHash, true, true},
+		{"bcrypt mismatch", argon, "wrong", bcryptHash, false, false},
+		{"legacy plaintext", argon, "alta@1234", "alta@1234", true, true},
+		{"legacy plaintext mismatch", argon, "wrong", "alta@1234", false, false},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			match, needsRehash, err := val.Hasher.Verify(val.Password, val.Stored)
+
+			assert.NoError(t, err)
+			assert.Equal(t, val.ExpectMatch, match)
+			assert.Equal(t, val.ExpectNeedsRehash, needsRehash)
+		})
+	}
+}
+
+func TestNewPasswordHasherInvalidConfig(t *testing.T) {
+	config := DefaultPasswordConfig()
+	config.Algorithm = "md5"
+	_, err := NewPasswordHasher(config)
+	assert.Error(t, err)
+
+	config = DefaultPasswordConfig()
+	config.Algorithm = AlgorithmBcrypt
+	config.BcryptCost = 99
+	_, err = NewPasswordHasher(config)
+	assert.Error(t, err)
+
+	_, _, err = passwordHasher.Verify("alta@1234", "$argon2id$broken")
+	assert.ErrorIs(t, err, ErrInvalidHash)
+
+	// parameters argon2 panics on or would allocate without bound
+	for _, params := range []string{"m=19456,t=0,p=1", "m=19456,t=2,p=0", "m=0,t=2,p=1", "m=4294967295,t=2,p=1", "m=19456,t=4294967295,p=1"} {
+		_, _, err = passwordHasher.Verify("alta@1234", "$argon2id$v=19$"+params+"$c2FsdHNhbHRzYWx0$a2V5a2V5a2V5a2V5a2V5aw")
+		assert.ErrorIs(t, err, ErrInvalidHash, params)
+	}
+}
@@ -0,0 +1,10 @@
+package helpers
+
+import "strings"
+
+// NormalizeTag is the form tags are stored and filtered in: lower cased with
+// single spaces, so that " Science  Fiction" and "science fiction" are the
+// same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
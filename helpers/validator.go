@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"fmt"
+	"learn_testing/apperrors"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Validator checks the `validate` tags of request payloads, it is installed
+// as echo's Validator. Failures are an apperrors validation error listing
+// every invalid field under its json name.
+type Validator struct {
+	validate *validator.Validate
+}
+
+func NewValidator() *Validator {
+	v := validator.New()
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// at least one letter and one digit, the length is checked with min/max
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		var letter, digit bool
+		for _, r := range fl.Field().String() {
+			letter = letter || unicode.IsLetter(r)
+			digit = digit || unicode.IsDigit(r)
+		}
+		return letter && digit
+	})
+
+	// max counts runes, bcrypt only takes passwords of up to 72 bytes
+	v.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		limit, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= limit
+	})
+
+	// an ISBN-10 or ISBN-13, hyphens and spaces allowed, this replaces the
+	// stricter isbn of the validator
+	v.RegisterValidation("isbn", func(fl validator.FieldLevel) bool {
+		_, ok := NormalizeISBN(fl.Field().String())
+		return ok
+	})
+
+	return &Validator{validate: v}
+}
+
+func (v *Validator) Validate(i interface{}) error {
+	return v.result(v.validate.Struct(i))
+}
+
+// ValidatePresent only checks the fields that are set, for partial updates
+// where an empty field means "unchanged".
+func (v *Validator) ValidatePresent(i interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(i))
+
+	var present []string
+	for j := 0; j < value.NumField(); j++ {
+		field := value.Type().Field(j)
+		if field.Anonymous || !field.IsExported() || value.Field(j).IsZero() {
+			continue
+		}
+		present = append(present, field.Name)
+	}
+	if len(present) == 0 {
+		return nil
+	}
+
+	return v.result(v.validate.StructPartial(i, present...))
+}
+
+// ValidateExcept checks every field but the named ones, for write-only
+// fields that are left empty when unchanged.
+func (v *Validator) ValidateExcept(i interface{}, fields ...string) error {
+	return v.result(v.validate.StructExcept(i, fields...))
+}
+
+func (v *Validator) result(err error) error {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	fields := map[string]string{}
+	for _, fe := range errs {
+		fields[fe.Field()] = message(fe)
+	}
+	return apperrors.Validation("request is invalid", fields)
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s characters", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s characters", fe.Param())
+	case "maxbytes":
+		return fmt.Sprintf("must be at most %s bytes", fe.Param())
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "password":
+		return "must contain a letter and a digit"
+	case "isbn":
+		return "must be a valid ISBN-10 or ISBN-13"
+	}
+	return "is invalid"
+}
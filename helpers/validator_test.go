@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"learn_testing/apperrors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type validatedRequest struct {
+	Name     string `json:"name" validate:"required,max=5"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72,password"`
+}
+
+func TestValidator(t *testing.T) {
+	testCase := []struct {
+		Name         string
+		Request      validatedRequest
+		Present      bool
+		ExpectFields map[string]string
+	}{
+		{"valid", validatedRequest{"ahmad", "alta@1234"}, false, nil},
+		{"every field is reported", validatedRequest{"ahmad naufal", ""}, false, map[string]string{"name": "must be at most 5 characters", "password": "is required"}},
+		{"password strength", validatedRequest{"ahmad", "abcdefgh"}, false, map[string]string{"password": "must contain a letter and a digit"}},
+		{"password bytes", validatedRequest{"ahmad", strings.Repeat("é", 40) + "1"}, false, map[string]string{"password": "must be at most 72 bytes"}},
+		{"present fields only", validatedRequest{Name: "ahmad"}, true, nil},
+		{"present fields are checked", validatedRequest{Password: "abc"}, true, map[string]string{"password": "must be at least 8 characters"}},
+	}
+
+	v := NewValidator()
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			var err error
+			if val.Present {
+				err = v.ValidatePresent(&val.Request)
+			} else {
+				err = v.Validate(&val.Request)
+			}
+
+			if val.ExpectFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			appErr, ok := err.(*apperrors.Error)
+			assert.True(t, ok)
+			assert.Equal(t, val.ExpectFields, appErr.Fields)
+		})
+	}
+}
+
+func TestValidatorExcept(t *testing.T) {
+	v := NewValidator()
+
+	assert.NoError(t, v.ValidateExcept(&validatedRequest{Name: "ahmad"}, "Password"))
+
+	err := v.ValidateExcept(&validatedRequest{Password: "abc"}, "Password")
+	appErr, ok := err.(*apperrors.Error)
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"name": "is required"}, appErr.Fields)
+}
@@ -0,0 +1,87 @@
+package jsonpatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	testCase := []struct {
+		Name   string
+		Doc    string
+		Patch  string
+		Expect string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null removes member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"array is replaced", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{"nested merge", `{"a":{"b":"c","d":"e"}}`, `{"a":{"b":"f","d":null}}`, `{"a":{"b":"f"}}`},
+		{"object replaces scalar", `{"a":"b"}`, `{"a":{"c":null,"d":"e"}}`, `{"a":{"d":"e"}}`},
+		{"non object patch replaces", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"empty patch", `{"a":"b"}`, `{}`, `{"a":"b"}`},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			result, err := Merge([]byte(val.Doc), []byte(val.Patch))
+			assert.NoError(t, err)
+			assert.JSONEq(t, val.Expect, string(result))
+		})
+	}
+
+	_, err := Merge([]byte(`{}`), []byte(`{"a":`))
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestApply(t *testing.T) {
+	testCase := []struct {
+		Name   string
+		Doc    string
+		Patch  string
+		Expect string
+		Err    error
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`, nil},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, nil},
+		{"append array element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`, nil},
+		{"add null", `{"foo":"bar"}`, `[{"op":"add","path":"/foo","value":null}]`, `{"foo":null}`, nil},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, nil},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, nil},
+		{"replace member", `{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo"}`, nil},
+		{"replace array element", `{"foo":["a","b"]}`, `[{"op":"replace","path":"/foo/0","value":"c"}]`, `{"foo":["c","b"]}`, nil},
+		{"move member", `{"foo":{"bar":"baz"},"qux":{}}`, `[{"op":"move","from":"/foo/bar","path":"/qux/thud"}]`, `{"foo":{},"qux":{"thud":"baz"}}`, nil},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, nil},
+		{"copy member", `{"foo":{"a":1}}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"foo":{"a":1},"bar":{"a":1}}`, nil},
+		{"test then replace", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2},{"op":"replace","path":"/baz","value":"x"}]`, `{"baz":"x","foo":["a",2,"c"]}`, nil},
+		{"test null", `{"foo":null}`, `[{"op":"test","path":"/foo","value":null}]`, `{"foo":null}`, nil},
+		{"escaped pointer", `{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"replace","path":"/m~0n","value":3}]`, `{"m~n":3}`, nil},
+		{"replace whole document", `{"foo":1}`, `[{"op":"replace","path":"","value":{"bar":2}}]`, `{"bar":2}`, nil},
+
+		{"failed test", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", ErrTestFailed},
+		{"failed test applies nothing", `{"baz":"qux"}`, `[{"op":"replace","path":"/baz","value":"x"},{"op":"test","path":"/baz","value":"qux"}]`, "", ErrTestFailed},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", ErrPath},
+		{"remove missing member", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "", ErrPath},
+		{"replace missing member", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, "", ErrPath},
+		{"index out of range", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":1}]`, "", ErrPath},
+		{"leading zero index", `{"foo":["a","b"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", ErrPath},
+		{"move into itself", `{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar"}]`, "", ErrPath},
+		{"missing value", `{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "", ErrMalformed},
+		{"unknown op", `{"foo":"bar"}`, `[{"op":"merge","path":"/foo","value":1}]`, "", ErrMalformed},
+		{"relative path", `{"foo":"bar"}`, `[{"op":"remove","path":"foo"}]`, "", ErrMalformed},
+		{"not an array", `{"foo":"bar"}`, `{"op":"remove","path":"/foo"}`, "", ErrMalformed},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			result, err := Apply([]byte(val.Doc), []byte(val.Patch))
+			if val.Err != nil {
+				assert.ErrorIs(t, err, val.Err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, val.Expect, string(result))
+		})
+	}
+}
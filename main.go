@@ -1,16 +1,21 @@
 package main
 
 import (
-	"fmt"
 	"learn_testing/config"
 	"learn_testing/routes"
+	"os"
 )
 
 func main() {
-	config.Init()
+	cfg := config.LoadOrExit()
+
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		os.Exit(migrate(cfg, cfg.Args[1:]))
+	}
+
+	config.Init(cfg)
 
 	// start the server, and log if it fails
-	e := routes.New()
-	e.Logger.Fatal(e.Start(":8000"))
-	fmt.Println(config.ViperEnvVariable("SECRET_KEY"))
+	e := routes.New(cfg, config.DB)
+	e.Logger.Fatal(e.Start(":" + cfg.Server.Port))
 }
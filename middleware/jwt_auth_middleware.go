@@ -1,19 +1,103 @@
 package middleware
 
 import (
-	"learn_testing/config"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"learn_testing/repositories"
+	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
 )
 
-func CreateToken(userId int, name string) (string, error) {
-	key := []byte(config.ViperEnvVariable("SECRET_KEY"))
+// TokenIssuer signs access tokens and knows the lifetime of refresh tokens.
+type TokenIssuer struct {
+	Secret          []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+func NewTokenIssuer(secret string, accessTokenTTL, refreshTokenTTL time.Duration) *TokenIssuer {
+	return &TokenIssuer{
+		Secret:          []byte(secret),
+		AccessTokenTTL:  accessTokenTTL,
+		RefreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+func (ti *TokenIssuer) CreateToken(userId int, name string, role string, sessionId string) (string, error) {
+	jti, err := RandomToken()
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{}
+	claims["jti"] = jti
+	claims["sid"] = sessionId
 	claims["userId"] = userId
 	claims["name"] = name
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix()
+	claims["role"] = role
+	claims["exp"] = time.Now().Add(ti.AccessTokenTTL).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(key)
+	return token.SignedString(ti.Secret)
+}
+
+// RandomToken returns 32 random bytes encoded as url safe base64, used for
+// refresh tokens, token ids and session ids.
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken returns the value stored in the database for a refresh
+// token, so a leaked table cannot be used to refresh sessions.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenClaims returns the claims of the token validated by middleware.JWT.
+func TokenClaims(c echo.Context) (jwt.MapClaims, bool) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return claims, ok
+}
+
+// RevocationCheck rejects access tokens that were revoked by logout or whose
+// session was revoked after refresh token reuse. It must run after middleware.JWT.
+func RevocationCheck(tokens repositories.TokenRepository) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := TokenClaims(c)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt")
+			}
+
+			jti, _ := claims["jti"].(string)
+			sid, _ := claims["sid"].(string)
+			if jti == "" || sid == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token has no id")
+			}
+
+			revoked, err := tokens.IsRevoked(jti, sid)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			if revoked {
+				return echo.NewHTTPError(http.StatusUnauthorized, "token has been revoked")
+			}
+
+			return next(c)
+		}
+	}
 }
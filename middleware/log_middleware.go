@@ -5,8 +5,8 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func LogMiddleware(e *echo.Echo) {
+func LogMiddleware(e *echo.Echo, format string) {
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "method=${method}, uri=${uri},  status=${status}, latency_human=${latency_human}\n",
+		Format: format,
 	}))
 }
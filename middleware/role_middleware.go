@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CurrentUserID returns the userId claim of the token validated by middleware.JWT.
+func CurrentUserID(c echo.Context) (int, bool) {
+	claims, ok := TokenClaims(c)
+	if !ok {
+		return 0, false
+	}
+
+	// numbers are decoded from the token as float64
+	userId, ok := claims["userId"].(float64)
+	if !ok || userId <= 0 {
+		return 0, false
+	}
+	return int(userId), true
+}
+
+// HasRole reports whether the role claim of the current token is one of roles.
+func HasRole(c echo.Context, roles ...string) bool {
+	claims, ok := TokenClaims(c)
+	if !ok {
+		return false
+	}
+
+	role, _ := claims["role"].(string)
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRoles only lets through tokens whose role claim is one of roles.
+// It must run after middleware.JWT.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := TokenClaims(c); !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt")
+			}
+
+			if !HasRole(c, roles...) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient permissions")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireSelfOrRoles lets through callers whose userId claim equals the path
+// parameter param, or whose role is one of roles. It must run after middleware.JWT.
+func RequireSelfOrRoles(param string, roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userId, ok := CurrentUserID(c)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "missing or malformed jwt")
+			}
+
+			if id, err := strconv.Atoi(c.Param(param)); err == nil && id == userId {
+				return next(c)
+			}
+
+			if !HasRole(c, roles...) {
+				return echo.NewHTTPError(http.StatusForbidden, "you can only modify your own account")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRoles(t *testing.T) {
+	testCase := []struct {
+		Name             string
+		Token            *jwt.Token
+		ExpectStatusCode int
+	}{
+		{"admin allowed", &jwt.Token{Claims: jwt.MapClaims{"role": "admin"}}, http.StatusOK},
+		{"librarian allowed", &jwt.Token{Claims: jwt.MapClaims{"role": "librarian"}}, http.StatusOK},
+		{"member forbidden", &jwt.Token{Claims: jwt.MapClaims{"role": "member"}}, http.StatusForbidden},
+		{"missing role forbidden", &jwt.Token{Claims: jwt.MapClaims{}}, http.StatusForbidden},
+		{"missing token", nil, http.StatusUnauthorized},
+	}
+
+	handler := RequireRoles("admin", "librarian")(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			r := httptest.NewRequest("DELETE", "/", nil)
+			w := httptest.NewRecorder()
+
+			e := echo.New()
+			ctx := e.NewContext(r, w)
+			if val.Token != nil {
+				ctx.Set("user", val.Token)
+			}
+
+			err := handler(ctx)
+			if val.ExpectStatusCode == http.StatusOK {
+				assert.NoError(t, err)
+				assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
+				return
+			}
+
+			httpError, ok := err.(*echo.HTTPError)
+			assert.True(t, ok)
+			assert.Equal(t, val.ExpectStatusCode, httpError.Code)
+		})
+	}
+}
+
+func TestRequireSelfOrRoles(t *testing.T) {
+	testCase := []struct {
+		Name             string
+		Token            *jwt.Token
+		Param            string
+		ExpectStatusCode int
+	}{
+		{"own account", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(2), "role": "member"}}, "2", http.StatusOK},
+		{"other account", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(2), "role": "member"}}, "3", http.StatusForbidden},
+		{"admin on other account", &jwt.Token{Claims: jwt.MapClaims{"userId": float64(1), "role": "admin"}}, "3", http.StatusOK},
+		{"missing user id", &jwt.Token{Claims: jwt.MapClaims{"role": "admin"}}, "3", http.StatusUnauthorized},
+	}
+
+	handler := RequireSelfOrRoles("id", "admin")(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/", nil)
+			w := httptest.NewRecorder()
+
+			e := echo.New()
+			ctx := e.NewContext(r, w)
+			ctx.SetPath("/:id")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(val.Param)
+			ctx.Set("user", val.Token)
+
+			err := handler(ctx)
+			if val.ExpectStatusCode == http.StatusOK {
+				assert.NoError(t, err)
+				assert.Equal(t, val.ExpectStatusCode, w.Result().StatusCode)
+				return
+			}
+
+			httpError, ok := err.(*echo.HTTPError)
+			assert.True(t, ok)
+			assert.Equal(t, val.ExpectStatusCode, httpError.Code)
+		})
+	}
+}
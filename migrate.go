@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"learn_testing/config"
+	"learn_testing/migrations"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: learn_testing migrate <command>
+
+  up          apply every pending migration
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and when they were applied
+  duplicates  list accounts sharing an email, they block the unique email index
+`
+
+// migrate runs the migrate subcommand and returns the exit code.
+func migrate(cfg *config.AppConfig, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	config.InitDB(cfg.DB)
+	migrator := migrations.New(config.DB)
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("nothing to migrate")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Missing {
+				applied += " (unknown to this binary)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+
+	case "duplicates":
+		accounts, err := migrations.DuplicateEmails(config.DB)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(accounts) == 0 {
+			fmt.Println("no duplicate emails")
+			return 0
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "EMAIL\tID\tNAME\tCREATED\tDELETED")
+		for _, account := range accounts {
+			deleted := "-"
+			if account.DeletedAt != nil {
+				deleted = account.DeletedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", account.Email, account.ID, account.Name,
+				account.CreatedAt.Format("2006-01-02 15:04:05"), deleted)
+		}
+		w.Flush()
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
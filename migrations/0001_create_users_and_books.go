@@ -0,0 +1,38 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type users0001 struct {
+	gorm.Model
+	Name     string
+	Email    string
+	Password string
+}
+
+func (users0001) TableName() string {
+	return "users"
+}
+
+type books0001 struct {
+	gorm.Model
+	Title     string
+	Author    string
+	Publisher string
+}
+
+func (books0001) TableName() string {
+	return "books"
+}
+
+// AutoMigrate rather than CreateTable, databases created by the old
+// AutoMigrate at startup already have these tables and are adopted as is
+var createUsersAndBooks = Migration{
+	Version: 1,
+	Name:    "create_users_and_books",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&users0001{}, &books0001{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&books0001{}, &users0001{})
+	},
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type users0002 struct {
+	Role string `gorm:"size:20;not null;default:member"`
+}
+
+func (users0002) TableName() string {
+	return "users"
+}
+
+var addUserRole = Migration{
+	Version: 2,
+	Name:    "add_user_role",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&users0002{}, "Role") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&users0002{}, "Role")
+	},
+	// DROP COLUMN keeps the indexes of users, see addVersions
+	Down: func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "users"}, clause.Column{Name: "role"}).Error
+	},
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type refreshTokens0003 struct {
+	gorm.Model
+	UserID    uint
+	FamilyID  string `gorm:"size:64;index"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (refreshTokens0003) TableName() string {
+	return "refresh_tokens"
+}
+
+type revokedTokens0003 struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (revokedTokens0003) TableName() string {
+	return "revoked_tokens"
+}
+
+var createTokens = Migration{
+	Version: 3,
+	Name:    "create_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&refreshTokens0003{}, &revokedTokens0003{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&revokedTokens0003{}, &refreshTokens0003{})
+	},
+}
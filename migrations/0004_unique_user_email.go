@@ -0,0 +1,91 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type users0004 struct {
+	Email string `gorm:"size:255;uniqueIndex:idx_users_email"`
+}
+
+func (users0004) TableName() string {
+	return "users"
+}
+
+// DuplicateAccount is one of several accounts sharing an email once case
+// and surrounding spaces are ignored.
+type DuplicateAccount struct {
+	ID        uint
+	Name      string
+	Email     string
+	CreatedAt time.Time
+	DeletedAt *time.Time
+}
+
+// DuplicateEmails lists the accounts that keep the unique email index from
+// being created, grouped by normalized email and oldest first. Soft deleted
+// rows are included, the index covers them too.
+func DuplicateEmails(db *gorm.DB) ([]DuplicateAccount, error) {
+	var accounts []DuplicateAccount
+	err := db.Raw(`SELECT id, name, email, created_at, deleted_at FROM users
+		WHERE LOWER(TRIM(email)) IN (
+			SELECT LOWER(TRIM(email)) FROM users GROUP BY LOWER(TRIM(email)) HAVING COUNT(*) > 1
+		)
+		ORDER BY LOWER(TRIM(email)), id`).Scan(&accounts).Error
+	return accounts, err
+}
+
+// DuplicateEmailsError stops the migration until the duplicates are merged
+// or deleted by hand, which one to keep is not ours to decide.
+type DuplicateEmailsError struct {
+	Accounts []DuplicateAccount
+}
+
+func (e *DuplicateEmailsError) Error() string {
+	emails := map[string][]string{}
+	var order []string
+	for _, account := range e.Accounts {
+		email := strings.ToLower(strings.TrimSpace(account.Email))
+		if _, ok := emails[email]; !ok {
+			order = append(order, email)
+		}
+		emails[email] = append(emails[email], fmt.Sprint(account.ID))
+	}
+
+	lines := make([]string, len(order))
+	for i, email := range order {
+		lines[i] = fmt.Sprintf("%s (ids %s)", email, strings.Join(emails[email], ", "))
+	}
+	return fmt.Sprintf("%d emails belong to several accounts, run `migrate duplicates` for details: %s",
+		len(order), strings.Join(lines, "; "))
+}
+
+var uniqueUserEmail = Migration{
+	Version: 4,
+	Name:    "unique_user_email",
+	Up: func(tx *gorm.DB) error {
+		duplicates, err := DuplicateEmails(tx)
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return &DuplicateEmailsError{Accounts: duplicates}
+		}
+
+		if err := tx.Exec("UPDATE users SET email = LOWER(TRIM(email))").Error; err != nil {
+			return err
+		}
+		// mysql can not index the longtext gorm creates for a plain string
+		if err := tx.Migrator().AlterColumn(&users0004{}, "Email"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateIndex(&users0004{}, "idx_users_email")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropIndex(&users0004{}, "idx_users_email")
+	},
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type auditEvents0005 struct {
+	ID         uint   `gorm:"primarykey"`
+	EntityType string `gorm:"size:32;index:idx_audit_events_entity"`
+	EntityID   uint   `gorm:"index:idx_audit_events_entity"`
+	Action     string `gorm:"size:16"`
+	ActorID    *uint
+	Changes    string  `gorm:"type:text"`
+	State      *string `gorm:"type:text"`
+	CreatedAt  time.Time
+}
+
+func (auditEvents0005) TableName() string {
+	return "audit_events"
+}
+
+var createAuditEvents = Migration{
+	Version: 5,
+	Name:    "create_audit_events",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&auditEvents0005{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&auditEvents0005{})
+	},
+}
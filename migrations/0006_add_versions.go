@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type books0006 struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (books0006) TableName() string {
+	return "books"
+}
+
+type users0006 struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (users0006) TableName() string {
+	return "users"
+}
+
+var addVersions = Migration{
+	Version: 6,
+	Name:    "add_versions",
+	Up: func(tx *gorm.DB) error {
+		for _, table := range []interface{}{&books0006{}, &users0006{}} {
+			if tx.Migrator().HasColumn(table, "Version") {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(table, "Version"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// the sqlite driver drops a column by copying the table, which loses its
+	// indexes and the unique email with them; every database we support
+	// knows DROP COLUMN
+	Down: func(tx *gorm.DB) error {
+		for _, table := range []string{"users", "books"} {
+			if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: "version"}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type books0007 struct {
+	ISBN   *string `gorm:"size:13;uniqueIndex:idx_books_isbn"`
+	ISBN10 string  `gorm:"size:10"`
+}
+
+func (books0007) TableName() string {
+	return "books"
+}
+
+var addBookISBN = Migration{
+	Version: 7,
+	Name:    "add_book_isbn",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"ISBN", "ISBN10"} {
+			if tx.Migrator().HasColumn(&books0007{}, column) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&books0007{}, column); err != nil {
+				return err
+			}
+		}
+		// books without an ISBN are NULL, the index only applies to the others
+		return tx.Migrator().CreateIndex(&books0007{}, "idx_books_isbn")
+	},
+	// see addVersions for why the columns are not dropped by the migrator
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&books0007{}, "idx_books_isbn"); err != nil {
+			return err
+		}
+		for _, column := range []string{"isbn10", "isbn"} {
+			if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "books"}, clause.Column{Name: column}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
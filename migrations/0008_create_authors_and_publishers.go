@@ -0,0 +1,201 @@
+package migrations
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type authors0008 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"size:255"`
+}
+
+func (authors0008) TableName() string {
+	return "authors"
+}
+
+type publishers0008 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"size:255"`
+}
+
+func (publishers0008) TableName() string {
+	return "publishers"
+}
+
+type bookAuthors0008 struct {
+	BookID   uint `gorm:"primaryKey;autoIncrement:false"`
+	AuthorID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Position int  `gorm:"not null;default:0"`
+}
+
+func (bookAuthors0008) TableName() string {
+	return "book_authors"
+}
+
+// trashed books are linked too, they may be restored
+type books0008 struct {
+	ID          uint
+	Author      string
+	Publisher   string
+	PublisherID *uint `gorm:"index"`
+}
+
+func (books0008) TableName() string {
+	return "books"
+}
+
+var createAuthorsAndPublishers = Migration{
+	Version: 8,
+	Name:    "create_authors_and_publishers",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&authors0008{}, &publishers0008{}, &bookAuthors0008{}); err != nil {
+			return err
+		}
+		if !tx.Migrator().HasColumn(&books0008{}, "PublisherID") {
+			if err := tx.Migrator().AddColumn(&books0008{}, "PublisherID"); err != nil {
+				return err
+			}
+		}
+		if err := tx.Migrator().CreateIndex(&books0008{}, "PublisherID"); err != nil {
+			return err
+		}
+
+		var books []books0008
+		if err := tx.Order("id").Find(&books).Error; err != nil {
+			return err
+		}
+		return linkBooks(tx, books)
+	},
+	// see addVersions for why the column is not dropped by the migrator
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&bookAuthors0008{}, &publishers0008{}, &authors0008{}); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&books0008{}, "PublisherID"); err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "books"}, clause.Column{Name: "publisher_id"}).Error
+	},
+}
+
+// linkBooks turns the free-text authors and publishers of books into
+// entities and links the books to them. Several authors are separated by
+// ";" or "&".
+func linkBooks(tx *gorm.DB, books []books0008) error {
+	authors, publishers := newEntityNames(), newEntityNames()
+	for _, book := range books {
+		for _, name := range splitAuthors(book.Author) {
+			authors.add(name)
+		}
+		publishers.add(book.Publisher)
+	}
+
+	authorIDs := map[string]uint{}
+	for _, key := range authors.keys {
+		author := authors0008{Name: authors.name(key)}
+		if err := tx.Create(&author).Error; err != nil {
+			return err
+		}
+		authorIDs[key] = author.ID
+	}
+
+	publisherBooks := map[string][]uint{}
+	var links []bookAuthors0008
+	for _, book := range books {
+		linked := map[uint]bool{}
+		for _, name := range splitAuthors(book.Author) {
+			id, ok := authorIDs[entityKey(name)]
+			if !ok || linked[id] {
+				continue
+			}
+			linked[id] = true
+			links = append(links, bookAuthors0008{BookID: book.ID, AuthorID: id, Position: len(linked) - 1})
+		}
+		if key := entityKey(book.Publisher); key != "" {
+			publisherBooks[key] = append(publisherBooks[key], book.ID)
+		}
+	}
+	if len(links) > 0 {
+		if err := tx.CreateInBatches(links, 100).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, key := range publishers.keys {
+		publisher := publishers0008{Name: publishers.name(key)}
+		if err := tx.Create(&publisher).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&books0008{}).Where("id IN ?", publisherBooks[key]).Update("publisher_id", publisher.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitAuthors(author string) []string {
+	return strings.FieldsFunc(author, func(r rune) bool { return r == ';' || r == '&' })
+}
+
+// entityKey is what two spellings of the same name have in common: their
+// letters and digits, lower cased. "J.K. Rowling" and "JK Rowling" share
+// the key "jkrowling".
+func entityKey(name string) string {
+	var key strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
+
+// entityNames collects the spellings of each key in the order the keys were
+// first seen.
+type entityNames struct {
+	keys      []string
+	spellings map[string][]string
+	counts    map[string]int
+}
+
+func newEntityNames() *entityNames {
+	return &entityNames{spellings: map[string][]string{}, counts: map[string]int{}}
+}
+
+func (e *entityNames) add(name string) {
+	name = strings.Join(strings.Fields(name), " ")
+	key := entityKey(name)
+	if key == "" {
+		return
+	}
+	if _, ok := e.spellings[key]; !ok {
+		e.keys = append(e.keys, key)
+	}
+	if e.counts[name] == 0 {
+		e.spellings[key] = append(e.spellings[key], name)
+	}
+	e.counts[name]++
+}
+
+// name is the spelling most books use, the first one seen on a tie.
+func (e *entityNames) name(key string) string {
+	best := ""
+	for _, spelling := range e.spellings[key] {
+		if best == "" || e.counts[spelling] > e.counts[best] {
+			best = spelling
+		}
+	}
+	return best
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type categories0009 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	Name      string         `gorm:"size:100"`
+	ParentID  *uint          `gorm:"index"`
+}
+
+func (categories0009) TableName() string {
+	return "categories"
+}
+
+type bookTags0009 struct {
+	BookID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Tag    string `gorm:"primaryKey;size:50;index"`
+}
+
+func (bookTags0009) TableName() string {
+	return "book_tags"
+}
+
+type books0009 struct {
+	CategoryID *uint `gorm:"index"`
+}
+
+func (books0009) TableName() string {
+	return "books"
+}
+
+var createCategoriesAndTags = Migration{
+	Version: 9,
+	Name:    "create_categories_and_tags",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&categories0009{}, &bookTags0009{}); err != nil {
+			return err
+		}
+		if !tx.Migrator().HasColumn(&books0009{}, "CategoryID") {
+			if err := tx.Migrator().AddColumn(&books0009{}, "CategoryID"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().CreateIndex(&books0009{}, "CategoryID")
+	},
+	// see addVersions for why the column is not dropped by the migrator
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&bookTags0009{}, &categories0009{}); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&books0009{}, "CategoryID"); err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "books"}, clause.Column{Name: "category_id"}).Error
+	},
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type copies0010 struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+	BookID    uint           `gorm:"not null;index"`
+}
+
+func (copies0010) TableName() string {
+	return "copies"
+}
+
+type loans0010 struct {
+	ID         uint      `gorm:"primarykey"`
+	BookID     uint      `gorm:"not null;index"`
+	CopyID     uint      `gorm:"not null;index"`
+	UserID     uint      `gorm:"not null;index"`
+	DueAt      time.Time `gorm:"index"`
+	ReturnedAt *time.Time
+	// NULL once returned, the unique index only applies to open loans
+	OpenCopyID *uint `gorm:"uniqueIndex"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (loans0010) TableName() string {
+	return "loans"
+}
+
+var createCopiesAndLoans = Migration{
+	Version: 10,
+	Name:    "create_copies_and_loans",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&copies0010{}, &loans0010{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&loans0010{}, &copies0010{})
+	},
+}
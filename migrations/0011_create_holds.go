@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type holds0011 struct {
+	ID     uint   `gorm:"primarykey"`
+	BookID uint   `gorm:"not null;index"`
+	UserID uint   `gorm:"not null;index"`
+	Status string `gorm:"size:16;index"`
+	CopyID *uint
+	// NULL unless the hold is ready, the unique index only applies to those
+	ReservedCopyID *uint `gorm:"uniqueIndex"`
+	ExpiresAt      *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (holds0011) TableName() string {
+	return "holds"
+}
+
+var createHolds = Migration{
+	Version: 11,
+	Name:    "create_holds",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&holds0011{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&holds0011{})
+	},
+}
@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type categories0012 struct {
+	FineDailyRate *int64
+	FineCap       *int64
+}
+
+func (categories0012) TableName() string {
+	return "categories"
+}
+
+type fines0012 struct {
+	ID        uint `gorm:"primarykey"`
+	LoanID    uint `gorm:"not null;uniqueIndex"`
+	UserID    uint `gorm:"not null;index"`
+	BookID    uint `gorm:"not null"`
+	DaysLate  int
+	DailyRate int64
+	Amount    int64
+	Paid      int64
+	Waived    int64
+	Balance   int64 `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (fines0012) TableName() string {
+	return "fines"
+}
+
+type fineEntries0012 struct {
+	ID         uint   `gorm:"primarykey"`
+	FineID     uint   `gorm:"not null;index"`
+	Kind       string `gorm:"size:16"`
+	Amount     int64
+	Note       string `gorm:"size:255"`
+	RecordedBy uint
+	CreatedAt  time.Time
+}
+
+func (fineEntries0012) TableName() string {
+	return "fine_entries"
+}
+
+var createFines = Migration{
+	Version: 12,
+	Name:    "create_fines",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"FineDailyRate", "FineCap"} {
+			if err := tx.Migrator().AddColumn(&categories0012{}, column); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().CreateTable(&fines0012{}, &fineEntries0012{})
+	},
+	// DROP COLUMN keeps the index on parent_id, see addVersions
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&fineEntries0012{}, &fines0012{}); err != nil {
+			return err
+		}
+		for _, column := range []string{"fine_cap", "fine_daily_rate"} {
+			if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "categories"}, clause.Column{Name: column}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type books0013 struct {
+	Rating      float64 `gorm:"not null;default:0;index"`
+	RatingCount int64   `gorm:"not null;default:0"`
+}
+
+func (books0013) TableName() string {
+	return "books"
+}
+
+type reviews0013 struct {
+	ID        uint `gorm:"primarykey"`
+	BookID    uint `gorm:"not null;uniqueIndex:idx_reviews_book_user"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_reviews_book_user;index"`
+	Rating    uint
+	Body      string `gorm:"size:2000"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (reviews0013) TableName() string {
+	return "reviews"
+}
+
+var createReviews = Migration{
+	Version: 13,
+	Name:    "create_reviews",
+	Up: func(tx *gorm.DB) error {
+		for _, column := range []string{"Rating", "RatingCount"} {
+			if err := tx.Migrator().AddColumn(&books0013{}, column); err != nil {
+				return err
+			}
+		}
+		if err := tx.Migrator().CreateIndex(&books0013{}, "Rating"); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateTable(&reviews0013{})
+	},
+	// DROP COLUMN keeps the other indexes of books, see addVersions
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&reviews0013{}); err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropIndex(&books0013{}, "Rating"); err != nil {
+			return err
+		}
+		for _, column := range []string{"rating_count", "rating"} {
+			if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: "books"}, clause.Column{Name: column}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type shelves0014 struct {
+	ID         uint    `gorm:"primarykey"`
+	UserID     uint    `gorm:"not null;uniqueIndex:idx_shelves_user_name"`
+	Name       string  `gorm:"size:100;uniqueIndex:idx_shelves_user_name"`
+	Public     bool    `gorm:"not null;default:false"`
+	ShareToken *string `gorm:"size:64;uniqueIndex"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (shelves0014) TableName() string {
+	return "shelves"
+}
+
+type shelfBooks0014 struct {
+	ShelfID   uint `gorm:"primaryKey;autoIncrement:false"`
+	BookID    uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Position  int  `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+func (shelfBooks0014) TableName() string {
+	return "shelf_books"
+}
+
+var createShelves = Migration{
+	Version: 14,
+	Name:    "create_shelves",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&shelves0014{}, &shelfBooks0014{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&shelfBooks0014{}, &shelves0014{})
+	},
+}
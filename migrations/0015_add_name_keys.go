@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type authors0015 struct {
+	ID      uint   `gorm:"primarykey"`
+	Name    string `gorm:"size:255"`
+	NameKey string `gorm:"size:255;index"`
+}
+
+func (authors0015) TableName() string {
+	return "authors"
+}
+
+type publishers0015 struct {
+	ID      uint   `gorm:"primarykey"`
+	Name    string `gorm:"size:255"`
+	NameKey string `gorm:"size:255;index"`
+}
+
+func (publishers0015) TableName() string {
+	return "publishers"
+}
+
+// nameKey0015 is helpers.NameKey as it was when the keys were added: the
+// letters and digits of a name, lower cased.
+func nameKey0015(name string) string {
+	var key strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
+
+// addNameKeys stores the key authors and publishers are told apart by, so
+// that books credited by name link to the entity of that name.
+var addNameKeys = Migration{
+	Version: 15,
+	Name:    "add_name_keys",
+	Up: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&authors0015{}, &publishers0015{}} {
+			if err := tx.Migrator().AddColumn(model, "NameKey"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateIndex(model, "NameKey"); err != nil {
+				return err
+			}
+		}
+
+		var authors []authors0015
+		if err := tx.Unscoped().Find(&authors).Error; err != nil {
+			return err
+		}
+		for _, author := range authors {
+			if err := tx.Model(&author).Update("name_key", nameKey0015(author.Name)).Error; err != nil {
+				return err
+			}
+		}
+
+		var publishers []publishers0015
+		if err := tx.Unscoped().Find(&publishers).Error; err != nil {
+			return err
+		}
+		for _, publisher := range publishers {
+			if err := tx.Model(&publisher).Update("name_key", nameKey0015(publisher.Name)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// DROP COLUMN keeps the other indexes of the tables, see addVersions
+	Down: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&authors0015{}, &publishers0015{}} {
+			if err := tx.Migrator().DropIndex(model, "NameKey"); err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"authors", "publishers"} {
+			if err := tx.Exec("ALTER TABLE ? DROP COLUMN ?", clause.Table{Name: table}, clause.Column{Name: "name_key"}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
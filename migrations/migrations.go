@@ -0,0 +1,28 @@
+// Package migrations holds the versioned schema of the service.
+//
+// Every migration declares its own copy of the tables it touches instead of
+// using the models package, so later changes to the models do not rewrite
+// history. Add a new file with the next version and list it in All; never
+// edit a migration that was released.
+package migrations
+
+// All returns the migrations of the service in version order.
+func All() []Migration {
+	return []Migration{
+		createUsersAndBooks,
+		addUserRole,
+		createTokens,
+		uniqueUserEmail,
+		createAuditEvents,
+		addVersions,
+		addBookISBN,
+		createAuthorsAndPublishers,
+		createCategoriesAndTags,
+		createCopiesAndLoans,
+		createHolds,
+		createFines,
+		createReviews,
+		createShelves,
+		addNameKeys,
+	}
+}
@@ -0,0 +1,319 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// Migration is one versioned schema change. Up and Down run inside a
+// transaction together with the bookkeeping row, so a failing migration is
+// not recorded (MySQL commits DDL implicitly, keep those migrations small).
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Status is a migration known to the binary, the database or both.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	// Missing is set for versions applied to the database that this binary
+	// does not know, usually because a newer release migrated it
+	Missing bool
+}
+
+type schemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// schemaMigrationLock holds at most one row, inserting it is the lock. A
+// primary key insert is atomic on every driver, unlike advisory locks.
+type schemaMigrationLock struct {
+	ID       int    `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string `gorm:"size:255"`
+	LockedAt time.Time
+}
+
+func (schemaMigrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+	// Owner identifies this process in the lock row
+	Owner string
+	// LockTimeout is how long to wait for another process to finish
+	LockTimeout time.Duration
+	// StaleAfter is the age after which a lock is assumed to belong to a
+	// crashed process and taken over
+	StaleAfter time.Duration
+	// Heartbeat is how often the lock is refreshed while migrations run, so
+	// a long migration is not taken for a crashed one. It must be well
+	// below StaleAfter.
+	Heartbeat time.Duration
+}
+
+// waits between attempts to take the lock, doubling up to the most
+const (
+	lockRetryFirst = 100 * time.Millisecond
+	lockRetryMost  = 2 * time.Second
+)
+
+// New returns a migrator for every migration of the service.
+func New(db *gorm.DB) *Migrator {
+	host, _ := os.Hostname()
+
+	return &Migrator{
+		DB:          db,
+		Migrations:  All(),
+		Owner:       fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano()),
+		LockTimeout: time.Minute,
+		StaleAfter:  15 * time.Minute,
+		Heartbeat:   time.Minute,
+	}
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up() ([]Migration, error) {
+	var applied []Migration
+
+	err := m.withLock(func() error {
+		done, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.sorted() {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			migration := migration
+			err := m.DB.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migrate up %d %s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.withLock(func() error {
+		var rows []schemaMigration
+		if err := m.DB.Order("version desc").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		known := map[int64]Migration{}
+		for _, migration := range m.Migrations {
+			known[migration.Version] = migration
+		}
+
+		for _, row := range rows {
+			migration, ok := known[row.Version]
+			if !ok {
+				return fmt.Errorf("migrate down %d %s: unknown to this binary", row.Version, row.Name)
+			}
+
+			err := m.DB.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, row.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migrate down %d %s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every migration with the time it was applied, pending ones
+// have no AppliedAt.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.DB.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	done, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []Status
+	for _, migration := range m.sorted() {
+		s := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := done[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			s.AppliedAt = &appliedAt
+			delete(done, migration.Version)
+		}
+		status = append(status, s)
+	}
+	for _, row := range done {
+		appliedAt := row.AppliedAt
+		status = append(status, Status{Version: row.Version, Name: row.Name, AppliedAt: &appliedAt, Missing: true})
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+func (m *Migrator) sorted() []Migration {
+	migrations := append([]Migration(nil), m.Migrations...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+func (m *Migrator) applied() (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := m.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	done := map[int64]schemaMigration{}
+	for _, row := range rows {
+		done[row.Version] = row
+	}
+	return done, nil
+}
+
+func (m *Migrator) withLock(fn func() error) (err error) {
+	if err := m.DB.AutoMigrate(&schemaMigration{}, &schemaMigrationLock{}); err != nil {
+		return err
+	}
+
+	if err := m.lock(); err != nil {
+		return err
+	}
+	// a lock left behind holds the next run until it is stale
+	defer func() {
+		if unlockErr := m.unlock(); unlockErr != nil && err == nil {
+			err = fmt.Errorf("releasing the migrations lock: %w", unlockErr)
+		}
+	}()
+
+	stop := make(chan struct{})
+	lost := make(chan error, 1)
+	go m.heartbeat(stop, lost)
+
+	err = fn()
+	close(stop)
+	if err != nil {
+		return err
+	}
+	// another process may have migrated alongside, the run must not pass
+	// for a clean one
+	select {
+	case err := <-lost:
+		return err
+	default:
+		return nil
+	}
+}
+
+func (m *Migrator) lock() error {
+	deadline := time.Now().Add(m.LockTimeout)
+	wait := lockRetryFirst
+
+	for {
+		err := m.DB.Create(&schemaMigrationLock{ID: 1, Owner: m.Owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			return nil
+		}
+
+		// the insert failed, find out whether someone holds the lock
+		var held schemaMigrationLock
+		findErr := m.DB.First(&held, 1).Error
+		switch {
+		case errors.Is(findErr, gorm.ErrRecordNotFound):
+			// released in the meantime, or the insert failed for another
+			// reason, which the deadline reports
+			if time.Now().After(deadline) {
+				return fmt.Errorf("taking the migrations lock: %w", err)
+			}
+		case findErr != nil:
+			return findErr
+		case time.Since(held.LockedAt) > m.StaleAfter:
+			// unless its owner refreshed it meanwhile
+			result := m.DB.Where("id = ? AND owner = ? AND locked_at < ?", 1, held.Owner, time.Now().Add(-m.StaleAfter)).Delete(&schemaMigrationLock{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%w: held by %s since %s", ErrLocked, held.Owner, held.LockedAt.Format(time.RFC3339))
+			}
+		case time.Now().After(deadline):
+			return fmt.Errorf("%w: held by %s since %s", ErrLocked, held.Owner, held.LockedAt.Format(time.RFC3339))
+		}
+
+		time.Sleep(wait)
+		if wait *= 2; wait > lockRetryMost {
+			wait = lockRetryMost
+		}
+	}
+}
+
+// heartbeat refreshes the lock every Heartbeat until stop is closed. It
+// sends to lost and gives up when the lock is no longer this process's.
+func (m *Migrator) heartbeat(stop <-chan struct{}, lost chan<- error) {
+	ticker := time.NewTicker(m.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			result := m.DB.Model(&schemaMigrationLock{}).Where("id = ? AND owner = ?", 1, m.Owner).Update("locked_at", now)
+			if result.Error == nil && result.RowsAffected == 0 {
+				lost <- fmt.Errorf("%w: the lock of %s was taken over while migrating", ErrLocked, m.Owner)
+				return
+			}
+		}
+	}
+}
+
+func (m *Migrator) unlock() error {
+	return m.DB.Where("id = ? AND owner = ?", 1, m.Owner).Delete(&schemaMigrationLock{}).Error
+}
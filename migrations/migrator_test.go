@@ -0,0 +1,263 @@
+package migrations
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestMigrator(t *testing.T) *Migrator {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+
+	m := New(db)
+	m.LockTimeout = time.Second
+	return m
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	m := newTestMigrator(t)
+
+	applied, err := m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(All()))
+	assert.True(t, m.DB.Migrator().HasTable("refresh_tokens"))
+	assert.True(t, m.DB.Migrator().HasTable("audit_events"))
+	assert.True(t, m.DB.Migrator().HasColumn(&books0006{}, "version"))
+	assert.True(t, m.DB.Migrator().HasIndex(&books0007{}, "idx_books_isbn"))
+	assert.True(t, m.DB.Migrator().HasTable("book_authors"))
+	assert.True(t, m.DB.Migrator().HasTable("book_tags"))
+	assert.True(t, m.DB.Migrator().HasIndex(&loans0010{}, "OpenCopyID"))
+	assert.True(t, m.DB.Migrator().HasIndex(&holds0011{}, "ReservedCopyID"))
+	assert.True(t, m.DB.Migrator().HasIndex(&fines0012{}, "LoanID"))
+	assert.True(t, m.DB.Migrator().HasColumn(&categories0012{}, "fine_cap"))
+	assert.True(t, m.DB.Migrator().HasIndex(&books0013{}, "Rating"))
+	assert.True(t, m.DB.Migrator().HasIndex(&reviews0013{}, "idx_reviews_book_user"))
+	assert.True(t, m.DB.Migrator().HasIndex(&shelves0014{}, "idx_shelves_user_name"))
+	assert.True(t, m.DB.Migrator().HasTable("shelf_books"))
+	assert.True(t, m.DB.Migrator().HasIndex(&authors0015{}, "NameKey"))
+	assert.True(t, m.DB.Migrator().HasColumn(&books0009{}, "category_id"))
+	assert.True(t, m.DB.Migrator().HasColumn(&users0002{}, "role"))
+
+	// a second run has nothing to do
+	applied, err = m.Up()
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := m.Down(len(All()) - 1)
+	assert.NoError(t, err)
+	var versions []int64
+	for _, migration := range reverted {
+		versions = append(versions, migration.Version)
+	}
+	assert.Equal(t, []int64{15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2}, versions)
+	assert.False(t, m.DB.Migrator().HasTable("refresh_tokens"))
+	assert.False(t, m.DB.Migrator().HasColumn(&books0007{}, "isbn"))
+	assert.False(t, m.DB.Migrator().HasTable("authors"))
+	assert.False(t, m.DB.Migrator().HasTable("categories"))
+	assert.False(t, m.DB.Migrator().HasTable("loans"))
+	assert.False(t, m.DB.Migrator().HasTable("holds"))
+	assert.False(t, m.DB.Migrator().HasTable("fines"))
+	assert.False(t, m.DB.Migrator().HasTable("reviews"))
+	assert.False(t, m.DB.Migrator().HasTable("shelves"))
+	assert.False(t, m.DB.Migrator().HasColumn(&books0009{}, "category_id"))
+	assert.False(t, m.DB.Migrator().HasColumn(&users0002{}, "role"))
+	assert.True(t, m.DB.Migrator().HasTable("users"))
+
+	status, err := m.Status()
+	assert.NoError(t, err)
+	assert.Len(t, status, len(All()))
+	assert.NotNil(t, status[0].AppliedAt)
+	for _, s := range status[1:] {
+		assert.Nil(t, s.AppliedAt)
+	}
+}
+
+func TestMigratorUniqueUserEmail(t *testing.T) {
+	m := newTestMigrator(t)
+	m.Migrations = All()[:3]
+	_, err := m.Up()
+	assert.NoError(t, err)
+
+	users := []map[string]interface{}{
+		{"name": "ahmad", "email": "Ahmad@mail.com"},
+		{"name": "budi", "email": "budi@mail.com"},
+		{"name": "ahmad naufal", "email": " ahmad@mail.com"},
+	}
+	for _, user := range users {
+		assert.NoError(t, m.DB.Table("users").Create(user).Error)
+	}
+
+	// the duplicates are reported and nothing is changed
+	m.Migrations = All()[:4]
+	_, err = m.Up()
+	var duplicates *DuplicateEmailsError
+	assert.ErrorAs(t, err, &duplicates)
+	assert.Len(t, duplicates.Accounts, 2)
+	assert.Equal(t, []uint{1, 3}, []uint{duplicates.Accounts[0].ID, duplicates.Accounts[1].ID})
+	assert.False(t, m.DB.Migrator().HasIndex(&users0004{}, "idx_users_email"))
+
+	assert.NoError(t, m.DB.Exec("DELETE FROM users WHERE id = 3").Error)
+	applied, err := m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.True(t, m.DB.Migrator().HasIndex(&users0004{}, "idx_users_email"))
+
+	var email string
+	assert.NoError(t, m.DB.Raw("SELECT email FROM users WHERE id = 1").Scan(&email).Error)
+	assert.Equal(t, "ahmad@mail.com", email)
+
+	err = m.DB.Table("users").Create(map[string]interface{}{"name": "copy", "email": "budi@mail.com"}).Error
+	assert.Error(t, err)
+}
+
+func TestMigratorAuthorsAndPublishers(t *testing.T) {
+	m := newTestMigrator(t)
+	m.Migrations = All()[:7]
+	_, err := m.Up()
+	assert.NoError(t, err)
+
+	books := []map[string]interface{}{
+		{"title": "a", "author": "J.K. Rowling", "publisher": "Bloomsbury"},
+		{"title": "b", "author": "JK Rowling", "publisher": "bloomsbury "},
+		{"title": "c", "author": "JK  Rowling", "publisher": ""},
+		{"title": "d", "author": "Neil Gaiman & Terry Pratchett", "publisher": "Gollancz"},
+		{"title": "e", "author": "Terry Pratchett; terry pratchett", "publisher": "Bloomsbury"},
+		{"title": "f", "author": "", "publisher": "..."},
+	}
+	for _, book := range books {
+		assert.NoError(t, m.DB.Table("books").Create(book).Error)
+	}
+
+	m.Migrations = All()[:8]
+	applied, err := m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, applied, 1)
+
+	// the spelling most books use names the entity
+	var authors, publishers []string
+	assert.NoError(t, m.DB.Raw("SELECT name FROM authors ORDER BY id").Scan(&authors).Error)
+	assert.Equal(t, []string{"JK Rowling", "Neil Gaiman", "Terry Pratchett"}, authors)
+	assert.NoError(t, m.DB.Raw("SELECT name FROM publishers ORDER BY id").Scan(&publishers).Error)
+	assert.Equal(t, []string{"Bloomsbury", "Gollancz"}, publishers)
+
+	var links []bookAuthors0008
+	assert.NoError(t, m.DB.Order("book_id, position").Find(&links).Error)
+	assert.Equal(t, []bookAuthors0008{
+		{BookID: 1, AuthorID: 1}, {BookID: 2, AuthorID: 1}, {BookID: 3, AuthorID: 1},
+		{BookID: 4, AuthorID: 2}, {BookID: 4, AuthorID: 3, Position: 1},
+		{BookID: 5, AuthorID: 3},
+	}, links)
+
+	var publisherIDs []uint
+	assert.NoError(t, m.DB.Raw("SELECT COALESCE(publisher_id, 0) FROM books ORDER BY id").Scan(&publisherIDs).Error)
+	assert.Equal(t, []uint{1, 1, 0, 2, 1, 0}, publisherIDs)
+
+	// the names are keyed for the books credited by name later on
+	m.Migrations = All()
+	_, err = m.Up()
+	assert.NoError(t, err)
+	var keys []string
+	assert.NoError(t, m.DB.Raw("SELECT name_key FROM authors ORDER BY id").Scan(&keys).Error)
+	assert.Equal(t, []string{"jkrowling", "neilgaiman", "terrypratchett"}, keys)
+}
+
+func TestMigratorFailedMigrationIsNotRecorded(t *testing.T) {
+	m := newTestMigrator(t)
+	m.Migrations = append(m.Migrations, Migration{
+		Version: 99,
+		Name:    "broken",
+		Up:      func(tx *gorm.DB) error { return errors.New("boom") },
+		Down:    func(tx *gorm.DB) error { return nil },
+	})
+
+	applied, err := m.Up()
+	assert.Error(t, err)
+	assert.Len(t, applied, len(All()))
+
+	status, err := m.Status()
+	assert.NoError(t, err)
+	assert.Nil(t, status[len(status)-1].AppliedAt)
+}
+
+func TestMigratorLock(t *testing.T) {
+	testCase := []struct {
+		Name        string
+		LockedAt    time.Time
+		ExpectError error
+	}{
+		{"held by another process", time.Now(), ErrLocked},
+		{"stale lock is taken over", time.Now().Add(-time.Hour), nil},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			m := newTestMigrator(t)
+			assert.NoError(t, m.DB.AutoMigrate(&schemaMigrationLock{}))
+			assert.NoError(t, m.DB.Create(&schemaMigrationLock{ID: 1, Owner: "other", LockedAt: val.LockedAt}).Error)
+
+			_, err := m.Up()
+			assert.ErrorIs(t, err, val.ExpectError)
+
+			// the lock is released after a successful run
+			var locks int64
+			m.DB.Model(&schemaMigrationLock{}).Count(&locks)
+			if val.ExpectError == nil {
+				assert.Zero(t, locks)
+			}
+		})
+	}
+}
+
+func TestMigratorLockHeartbeat(t *testing.T) {
+	m := newTestMigrator(t)
+	m.Heartbeat = 10 * time.Millisecond
+	assert.NoError(t, m.DB.AutoMigrate(&schemaMigrationLock{}))
+	assert.NoError(t, m.lock())
+	assert.NoError(t, m.DB.Model(&schemaMigrationLock{}).Where("id = ?", 1).Update("locked_at", time.Now().Add(-time.Hour)).Error)
+
+	stop := make(chan struct{})
+	lost := make(chan error, 1)
+	go m.heartbeat(stop, lost)
+
+	// a long run keeps its lock fresh
+	assert.Eventually(t, func() bool {
+		var held schemaMigrationLock
+		return m.DB.First(&held, 1).Error == nil && time.Since(held.LockedAt) < time.Minute
+	}, time.Second, 10*time.Millisecond)
+
+	// and finds out when it was taken over
+	assert.NoError(t, m.DB.Model(&schemaMigrationLock{}).Where("id = ?", 1).Update("owner", "other").Error)
+	select {
+	case err := <-lost:
+		assert.ErrorIs(t, err, ErrLocked)
+	case <-time.After(time.Second):
+		t.Error("the lost lock was not reported")
+	}
+	close(stop)
+}
+
+func TestMigratorUnlockError(t *testing.T) {
+	m := newTestMigrator(t)
+
+	// a lock that can not be released fails the run
+	err := m.withLock(func() error {
+		return m.DB.Migrator().DropTable(&schemaMigrationLock{})
+	})
+	assert.ErrorContains(t, err, "releasing the migrations lock")
+
+	// the error of the run comes first
+	failed := errors.New("failed")
+	err = m.withLock(func() error {
+		if err := m.DB.Migrator().DropTable(&schemaMigrationLock{}); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	AuditRevert  = "revert"
+)
+
+const (
+	AuditBook = "book"
+	AuditUser = "user"
+)
+
+// AuditEvents records one change of a book or a user. The id is the
+// revision of the record. State is the record as it was after the change,
+// empty once it is deleted, Changes only holds the fields that changed.
+type AuditEvents struct {
+	ID         uint         `json:"revision" gorm:"primarykey"`
+	EntityType string       `json:"entity_type" gorm:"size:32;index:idx_audit_events_entity"`
+	EntityID   uint         `json:"entity_id" gorm:"index:idx_audit_events_entity"`
+	Action     string       `json:"action" gorm:"size:16"`
+	ActorID    *uint        `json:"actor_id"`
+	Changes    AuditChanges `json:"changes"`
+	State      AuditState   `json:"state,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// AuditChange is the value of a field before and after a change, nil when
+// the record did not exist.
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditChanges maps json field names to their change, it is stored as json.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) GormDataType() string {
+	return "text"
+}
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	return jsonValue(c)
+}
+
+func (c *AuditChanges) Scan(src interface{}) error {
+	return scanJSON(src, c)
+}
+
+// AuditState maps json field names to their values, it is stored as json.
+type AuditState map[string]interface{}
+
+func (s AuditState) GormDataType() string {
+	return "text"
+}
+
+func (s AuditState) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return jsonValue(s)
+}
+
+func (s *AuditState) Scan(src interface{}) error {
+	return scanJSON(src, s)
+}
+
+func jsonValue(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, dest)
+	case string:
+		return json.Unmarshal([]byte(src), dest)
+	}
+	return fmt.Errorf("can not scan %T into %T", src, dest)
+}
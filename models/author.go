@@ -0,0 +1,20 @@
+package models
+
+import "gorm.io/gorm"
+
+// Authors are the people credited on books, a book links them through
+// BookAuthors in the order they are credited.
+type Authors struct {
+	gorm.Model
+	Name string `json:"name" form:"name" gorm:"size:255" validate:"required,max=255"`
+	// NameKey is helpers.NameKey of Name, kept by the repositories
+	NameKey string `json:"-" form:"-" gorm:"size:255;index"`
+}
+
+// BookAuthors links a book to one of its authors, Position orders the
+// authors of a book.
+type BookAuthors struct {
+	BookID   uint `gorm:"primaryKey;autoIncrement:false"`
+	AuthorID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Position int  `gorm:"not null;default:0"`
+}
@@ -1,10 +1,68 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"database/sql/driver"
+	"fmt"
 
+	"gorm.io/gorm"
+)
+
+// Author and Publisher are the names as credited on the book, AuthorIDs and
+// PublisherID link it to the Authors and Publishers it belongs to.
 type Books struct {
 	gorm.Model
-	Title     string `json:"title" form:"title"`
-	Author    string `json:"author" form:"author"`
-	Publisher string `json:"publisher" form:"publisher"`
+	Title     string `json:"title" form:"title" validate:"required,max=255"`
+	Author    string `json:"author" form:"author" validate:"max=255"`
+	Publisher string `json:"publisher" form:"publisher" validate:"max=255"`
+	// ISBN is stored as the ISBN-13 of the edition, ISBN10 is derived from
+	// it and empty for ISBNs that have no ISBN-10
+	ISBN   NullableString `json:"isbn" form:"isbn" gorm:"size:13;uniqueIndex" validate:"omitempty,isbn"`
+	ISBN10 string         `json:"isbn10" form:"-" gorm:"size:10"`
+	// AuthorIDs is stored in BookAuthors, in the order the authors are credited
+	AuthorIDs   []uint `json:"author_ids" form:"-" gorm:"-"`
+	PublisherID *uint  `json:"publisher_id" form:"-" gorm:"index"`
+	CategoryID  *uint  `json:"category_id" form:"-" gorm:"index"`
+	// LinkAuthors and LinkPublisher ask a write to link the book by name, it
+	// sets the links and credited names and creates the authors and the
+	// publisher that do not exist yet along with the book
+	LinkAuthors   []string `json:"-" form:"-" gorm:"-"`
+	LinkPublisher string   `json:"-" form:"-" gorm:"-"`
+	// Tags is stored in BookTags, sorted
+	Tags []string `json:"tags" form:"-" gorm:"-" validate:"max=20,dive,max=50"`
+	// Rating is the average of the reviews of the book, 0 without any, and
+	// RatingCount how many there are; both are kept by the review writes
+	// and do not change the version, the ETag of the book adds them to it
+	Rating      float64 `json:"rating" form:"-" gorm:"not null;default:0;index" audit:"-"`
+	RatingCount int64   `json:"rating_count" form:"-" gorm:"not null;default:0" audit:"-"`
+	// Version goes up with every change to the catalogue entry
+	Version uint `json:"version" form:"-" gorm:"not null;default:1" audit:"-"`
+}
+
+// NullableString is stored as NULL when empty, so that a unique index only
+// applies to the rows that have a value.
+type NullableString string
+
+func (s NullableString) GormDataType() string {
+	return "string"
+}
+
+func (s NullableString) Value() (driver.Value, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+func (s *NullableString) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*s = ""
+	case []byte:
+		*s = NullableString(src)
+	case string:
+		*s = NullableString(src)
+	default:
+		return fmt.Errorf("can not scan %T into %T", src, s)
+	}
+	return nil
 }
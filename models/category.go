@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// Categories form a tree, a category without ParentID is a root. A book is
+// in at most one category, and in every category above it.
+//
+// FineDailyRate and FineCap are the late fine of the books in the category,
+// in minor units; unset they are those of the parent, or the configured
+// ones for a root. A zero cap does not cap the fine.
+type Categories struct {
+	gorm.Model
+	Name          string `json:"name" form:"name" gorm:"size:100" validate:"required,max=100"`
+	ParentID      *uint  `json:"parent_id" form:"parent_id" gorm:"index"`
+	FineDailyRate *int64 `json:"fine_daily_rate" form:"fine_daily_rate" validate:"omitempty,min=0"`
+	FineCap       *int64 `json:"fine_cap" form:"fine_cap" validate:"omitempty,min=0"`
+}
+
+// CategoryTree is a category with its subcategories.
+type CategoryTree struct {
+	Categories
+	Children []CategoryTree `json:"children"`
+}
+
+// BookTags tags a book, tags are normalized with helpers.NormalizeTag.
+type BookTags struct {
+	BookID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Tag    string `gorm:"primaryKey;size:50;index"`
+}
@@ -1,16 +0,0 @@
-package models
-
-type Config struct {
-	DB_Username string
-	DB_Password string
-	DB_Port     string
-	DB_Host     string
-	DB_Name     string
-}
-
-type UserResponse struct {
-	ID    int    `json:"id" form:"id"`
-	Name  string `json:"name" form:"name"`
-	Email string `json:"email" form:"email"`
-	Token string `json:"token" form:"token"`
-}
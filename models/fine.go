@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	FinePayment = "payment"
+	FineWaiver  = "waiver"
+)
+
+// Fines charge a user for a loan returned late, one fine per loan. Money is
+// in minor units of the configured currency: Amount is DaysLate times
+// DailyRate, capped, and Balance is what is left once Paid and Waived are
+// taken off.
+type Fines struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	LoanID    uint      `json:"loan_id" gorm:"not null;uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	BookID    uint      `json:"book_id" gorm:"not null"`
+	DaysLate  int       `json:"days_late"`
+	DailyRate int64     `json:"daily_rate"`
+	Amount    int64     `json:"amount"`
+	Paid      int64     `json:"paid"`
+	Waived    int64     `json:"waived"`
+	Balance   int64     `json:"balance" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FineEntries are the payments and waivers taken off a fine, RecordedBy is
+// the librarian who took them.
+type FineEntries struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	FineID     uint      `json:"fine_id" gorm:"not null;index"`
+	Kind       string    `json:"kind" gorm:"size:16"`
+	Amount     int64     `json:"amount" form:"amount" validate:"required,min=1"`
+	Note       string    `json:"note" form:"note" gorm:"size:255" validate:"max=255"`
+	RecordedBy uint      `json:"recorded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
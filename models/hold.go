@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	HoldWaiting   = "waiting"
+	HoldReady     = "ready"
+	HoldFulfilled = "fulfilled"
+	HoldCancelled = "cancelled"
+	HoldExpired   = "expired"
+)
+
+// Holds queue users for a book whose copies are all on loan, first come
+// first served. A copy that comes back is held for the first waiting user
+// until ExpiresAt: the hold is ready and ReservedCopyID is that copy, its
+// unique index keeps a copy from being held for two users. Position is the
+// place of a waiting hold in the queue of the book, from 1.
+type Holds struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	BookID         uint       `json:"book_id" gorm:"not null;index"`
+	UserID         uint       `json:"user_id" gorm:"not null;index"`
+	Status         string     `json:"status" gorm:"size:16;index"`
+	CopyID         *uint      `json:"copy_id"`
+	ReservedCopyID *uint      `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Position       int        `json:"position,omitempty" gorm:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
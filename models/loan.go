@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Copies are the physical copies of a book, each is lent to one user at a
+// time. Available tells whether the copy is on the shelf.
+type Copies struct {
+	gorm.Model
+	BookID    uint `json:"book_id" form:"-" gorm:"not null;index"`
+	Available bool `json:"available" form:"-" gorm:"-"`
+}
+
+// Loans lend a copy of a book to a user until DueAt. OpenCopyID is the copy
+// while the loan is open and NULL once it is returned, its unique index
+// keeps a copy from being lent twice.
+type Loans struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	BookID     uint       `json:"book_id" gorm:"not null;index"`
+	CopyID     uint       `json:"copy_id" gorm:"not null;index"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	DueAt      time.Time  `json:"due_at" gorm:"index"`
+	ReturnedAt *time.Time `json:"returned_at"`
+	OpenCopyID *uint      `json:"-" gorm:"uniqueIndex"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
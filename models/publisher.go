@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// Publishers publish books, a book has at most one.
+type Publishers struct {
+	gorm.Model
+	Name string `json:"name" form:"name" gorm:"size:255" validate:"required,max=255"`
+	// NameKey is helpers.NameKey of Name, kept by the repositories
+	NameKey string `json:"-" form:"-" gorm:"size:255;index"`
+}
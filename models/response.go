@@ -0,0 +1,112 @@
+package models
+
+import (
+	"math"
+
+	"gorm.io/gorm"
+)
+
+type UserResponse struct {
+	ID           int    `json:"id" form:"id"`
+	Name         string `json:"name" form:"name"`
+	Email        string `json:"email" form:"email"`
+	Role         string `json:"role" form:"role"`
+	Token        string `json:"token" form:"token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// UserProfile is a user as the API shows it, without the password hash.
+type UserProfile struct {
+	gorm.Model
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Version uint   `json:"version"`
+}
+
+func NewUserProfile(user Users) UserProfile {
+	return UserProfile{Model: user.Model, Name: user.Name, Email: user.Email, Role: user.Role, Version: user.Version}
+}
+
+func NewUserProfiles(users []Users) []UserProfile {
+	profiles := make([]UserProfile, len(users))
+	for i, user := range users {
+		profiles[i] = NewUserProfile(user)
+	}
+	return profiles
+}
+
+// ListMeta is returned next to a page of results. Next and Prev are links
+// to the neighbouring pages, omitted on the first and last page.
+type ListMeta struct {
+	Total int64  `json:"total"`
+	Limit int    `json:"limit"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+// BookSearchResult is a book found by full-text search, Highlights holds the
+// matching fields with the matched words wrapped in <mark>.
+type BookSearchResult struct {
+	Book       Books             `json:"book"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// BookFacets counts the books of a list, all of its pages, by category, tag
+// and publisher. Each facet holds the values with the most books first.
+type BookFacets struct {
+	Categories []FacetCount `json:"categories"`
+	Tags       []FacetCount `json:"tags"`
+	Publishers []FacetCount `json:"publishers"`
+}
+
+// FacetCount is the number of books with a value of a facet. Tags are
+// named by the tag itself and have no ID.
+type FacetCount struct {
+	ID    uint   `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// FineReport sums the fines charged in a period, Debtors are the users who
+// owe the most on them.
+type FineReport struct {
+	Fines       int64        `json:"fines"`
+	Charged     int64        `json:"charged"`
+	Paid        int64        `json:"paid"`
+	Waived      int64        `json:"waived"`
+	Outstanding int64        `json:"outstanding"`
+	Debtors     []FineDebtor `json:"debtors" gorm:"-"`
+}
+
+// FineDebtor is what a user owes on the fines of a report.
+type FineDebtor struct {
+	UserID  uint  `json:"user_id"`
+	Balance int64 `json:"balance"`
+}
+
+// RatingSummary aggregates the reviews of a book: the average rating,
+// rounded to two decimals, how many reviews there are and how many gave
+// each rating from 1 to 5.
+type RatingSummary struct {
+	Average   float64        `json:"average"`
+	Count     int64          `json:"count"`
+	Histogram map[uint]int64 `json:"histogram"`
+}
+
+// NewRatingSummary sums up a histogram of ratings, ratings missing from it
+// count 0.
+func NewRatingSummary(histogram map[uint]int64) RatingSummary {
+	summary := RatingSummary{Histogram: map[uint]int64{}}
+	var total int64
+	for rating := uint(1); rating <= 5; rating++ {
+		summary.Histogram[rating] = histogram[rating]
+		summary.Count += histogram[rating]
+		total += int64(rating) * histogram[rating]
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(total)/float64(summary.Count)*100) / 100
+	}
+	return summary
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Reviews rate a book from 1 to 5 with an optional text, a user reviews a
+// book once.
+type Reviews struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	BookID    uint      `json:"book_id" form:"-" gorm:"not null;uniqueIndex:idx_reviews_book_user"`
+	UserID    uint      `json:"user_id" form:"-" gorm:"not null;uniqueIndex:idx_reviews_book_user;index"`
+	Rating    uint      `json:"rating" form:"rating" validate:"required,min=1,max=5"`
+	Body      string    `json:"body" form:"body" gorm:"size:2000" validate:"max=2000"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Shelves are the named reading lists of a user, "to read", "favourites" or
+// any other, a user names each of their shelves differently. A public shelf
+// has a ShareToken that anyone can read it with, making it private again
+// revokes the token.
+type Shelves struct {
+	ID         uint           `json:"id" gorm:"primarykey"`
+	UserID     uint           `json:"user_id" form:"-" gorm:"not null;uniqueIndex:idx_shelves_user_name"`
+	Name       string         `json:"name" form:"name" gorm:"size:100;uniqueIndex:idx_shelves_user_name" validate:"required,max=100"`
+	Public     bool           `json:"public" form:"public" gorm:"not null;default:false"`
+	ShareToken NullableString `json:"share_token,omitempty" form:"-" gorm:"size:64;uniqueIndex"`
+	// BookIDs is stored in ShelfBooks, in the order of the shelf
+	BookIDs   []uint    `json:"book_ids" form:"-" gorm:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ShelfBooks puts a book on a shelf, Position orders the books of a shelf.
+type ShelfBooks struct {
+	ShelfID   uint `gorm:"primaryKey;autoIncrement:false"`
+	BookID    uint `gorm:"primaryKey;autoIncrement:false;index"`
+	Position  int  `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+// ShelfBookRequest puts a book on a shelf at Position, from 1, or last
+// when Position is 0.
+type ShelfBookRequest struct {
+	BookID   uint `json:"book_id" form:"book_id" validate:"required"`
+	Position int  `json:"position" form:"position" validate:"min=0"`
+}
+
+// ShelfRequest renames a shelf, a Public left out leaves the shelf as
+// public or private as it was.
+type ShelfRequest struct {
+	Name   string `json:"name" form:"name" validate:"required,max=100"`
+	Public *bool  `json:"public" form:"public"`
+}
+
+// ReorderShelfRequest moves BookIDs to the front of a shelf in their order.
+type ReorderShelfRequest struct {
+	BookIDs []uint `json:"book_ids" form:"book_ids" validate:"required,min=1,max=1000"`
+}
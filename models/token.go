@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshTokens stores the sha256 of every issued refresh token. Tokens
+// rotated from the same login share a FamilyID, which is also carried by the
+// access token as the "sid" claim.
+type RefreshTokens struct {
+	gorm.Model
+	UserID    uint       `json:"user_id"`
+	FamilyID  string     `json:"family_id" gorm:"size:64;index"`
+	TokenHash string     `json:"-" gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// RevokedTokens is the deny list of access token ids (jti claim).
+type RevokedTokens struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token" form:"token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
@@ -2,9 +2,28 @@ package models
 
 import "gorm.io/gorm"
 
+const (
+	RoleAdmin     = "admin"
+	RoleLibrarian = "librarian"
+	RoleMember    = "member"
+)
+
 type Users struct {
 	gorm.Model
-	Name     string `json:"name" form:"name"`
-	Email    string `json:"email" form:"email"`
-	Password string `json:"password" form:"password"`
+	Name     string `json:"name" form:"name" validate:"required,max=100"`
+	Email    string `json:"email" form:"email" gorm:"size:255;uniqueIndex" validate:"required,email,max=255"`
+	Password string `json:"password" form:"password" audit:"redact" validate:"required,min=8,maxbytes=72,password"`
+	Role     string `json:"role" form:"role" gorm:"size:20;not null;default:member" validate:"omitempty,oneof=admin librarian member"`
+	// Version goes up with every change, it is the ETag of the user
+	Version uint `json:"version" form:"-" gorm:"not null;default:1" audit:"-"`
+}
+
+// IsValidRole reports whether role is one of the known roles.
+func IsValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleLibrarian || role == RoleMember
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" form:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" form:"new_password" validate:"required,min=8,maxbytes=72,password"`
 }
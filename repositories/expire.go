@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// HoldExpirer expires the holds not picked up in time, which passes their
+// copies on to the next in line. Every instance of the service may run one,
+// expiring is idempotent.
+type HoldExpirer struct {
+	Loans        LoanRepository
+	PickupPeriod time.Duration
+	Interval     time.Duration
+	Logger       *log.Logger
+}
+
+func NewHoldExpirer(loans LoanRepository, pickupPeriod, interval time.Duration, logger *log.Logger) *HoldExpirer {
+	return &HoldExpirer{Loans: loans, PickupPeriod: pickupPeriod, Interval: interval, Logger: logger}
+}
+
+// Expire expires the ready holds whose pickup ran out before now, the
+// copies they free are held until now + PickupPeriod.
+func (e *HoldExpirer) Expire(now time.Time) (int64, error) {
+	return e.Loans.ExpireHolds(now, now.Add(e.PickupPeriod))
+}
+
+// Run expires holds every Interval until ctx is done.
+func (e *HoldExpirer) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := e.Expire(now)
+			if err != nil {
+				e.Logger.Printf("expiring holds: %v", err)
+			}
+			if expired > 0 {
+				e.Logger.Printf("expired %d holds", expired)
+			}
+		}
+	}
+}
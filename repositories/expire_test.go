@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoldExpirer(t *testing.T) {
+	loans := NewMemoryLoanRepository()
+	now := time.Now()
+	assert.NoError(t, loans.AddCopy(&models.Copies{BookID: 1}, now))
+	_, err := loans.Checkout(1, 1, now, 5)
+	assert.NoError(t, err)
+	for user := 2; user <= 3; user++ {
+		_, err = loans.PlaceHold(1, user)
+		assert.NoError(t, err)
+	}
+	_, err = loans.Return(1, 1, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	expirer := NewHoldExpirer(loans, 2*time.Hour, time.Minute, nil)
+
+	expired, err := expirer.Expire(now)
+	assert.NoError(t, err)
+	assert.Zero(t, expired)
+
+	// the next in line has the pickup period from the expiry on
+	later := now.Add(90 * time.Minute)
+	expired, err = expirer.Expire(later)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+
+	holds, _, err := loans.ListHolds(HoldFilter{UserID: 3}, ListQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldReady, holds[0].Status)
+	assert.Equal(t, later.Add(2*time.Hour), *holds[0].ExpiresAt)
+}
@@ -0,0 +1,32 @@
+package repositories
+
+import (
+	"learn_testing/models"
+
+	"gorm.io/gorm"
+)
+
+type GormAuditRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormAuditRepository(db *gorm.DB) *GormAuditRepository {
+	return &GormAuditRepository{DB: db}
+}
+
+func (r *GormAuditRepository) Record(event *models.AuditEvents) error {
+	return r.DB.Create(event).Error
+}
+
+func (r *GormAuditRepository) History(entityType string, entityID uint, query ListQuery) ([]models.AuditEvents, Page, error) {
+	return listGorm(r.DB.Where("entity_type = ? AND entity_id = ?", entityType, entityID), auditFields, query)
+}
+
+func (r *GormAuditRepository) FindEvent(id int) (models.AuditEvents, error) {
+	var event models.AuditEvents
+	res := r.DB.Where("id = ?", id).Find(&event)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return event, notFound("audit event", id)
+	}
+	return event, res.Error
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditRepository(t *testing.T) {
+	repos := map[string]AuditRepository{
+		"memory": NewMemoryAuditRepository(),
+		"gorm":   NewGormAuditRepository(newSQLiteDB(t)),
+	}
+
+	actor := uint(7)
+	events := []models.AuditEvents{
+		{EntityType: models.AuditBook, EntityID: 1, Action: models.AuditCreate, ActorID: &actor,
+			Changes: models.AuditChanges{"title": {To: "a"}}, State: models.AuditState{"title": "a"}},
+		{EntityType: models.AuditUser, EntityID: 1, Action: models.AuditCreate},
+		{EntityType: models.AuditBook, EntityID: 1, Action: models.AuditUpdate,
+			Changes: models.AuditChanges{"title": {From: "a", To: "b"}}, State: models.AuditState{"title": "b"}},
+		{EntityType: models.AuditBook, EntityID: 1, Action: models.AuditDelete,
+			Changes: models.AuditChanges{"title": {From: "b"}}},
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			for i := range events {
+				event := events[i]
+				assert.NoError(t, repo.Record(&event))
+				assert.Equal(t, uint(i+1), event.ID)
+			}
+
+			history, page, err := repo.History(models.AuditBook, 1, ListQuery{Sort: ParseSort("-id")})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), page.Total)
+			assert.Equal(t, []uint{4, 3, 1}, []uint{history[0].ID, history[1].ID, history[2].ID})
+
+			// changes and state survive the round trip
+			assert.Equal(t, models.AuditChanges{"title": {From: "a", To: "b"}}, history[1].Changes)
+			assert.Equal(t, models.AuditState{"title": "b"}, history[1].State)
+			assert.Nil(t, history[0].State)
+			assert.Equal(t, &actor, history[2].ActorID)
+
+			history, _, err = repo.History(models.AuditBook, 1, ListQuery{Filters: map[string]string{"action": "update"}})
+			assert.NoError(t, err)
+			assert.Len(t, history, 1)
+
+			event, err := repo.FindEvent(2)
+			assert.NoError(t, err)
+			assert.Equal(t, models.AuditUser, event.EntityType)
+
+			_, err = repo.FindEvent(99)
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/helpers"
+	"learn_testing/models"
+
+	"gorm.io/gorm"
+)
+
+type GormAuthorRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormAuthorRepository(db *gorm.DB) *GormAuthorRepository {
+	return &GormAuthorRepository{DB: db}
+}
+
+func (r *GormAuthorRepository) List(query ListQuery) ([]models.Authors, Page, error) {
+	return listGorm(r.DB, authorFields, query)
+}
+
+func (r *GormAuthorRepository) FindByID(id int) (models.Authors, error) {
+	var author models.Authors
+	res := r.DB.Where("id = ?", id).Find(&author)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return author, notFound("author", id)
+	}
+	return author, res.Error
+}
+
+func (r *GormAuthorRepository) FindByName(name string) (models.Authors, error) {
+	var author models.Authors
+	res := r.DB.Where("name_key = ?", helpers.NameKey(name)).Order("id").Limit(1).Find(&author)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return author, fmt.Errorf("author %q: %w", name, ErrNotFound)
+	}
+	return author, res.Error
+}
+
+func (r *GormAuthorRepository) Create(author *models.Authors) error {
+	author.NameKey = helpers.NameKey(author.Name)
+	return r.DB.Create(author).Error
+}
+
+// Update saves the non zero fields of author, a new name is credited on
+// its books along with it.
+func (r *GormAuthorRepository) Update(id int, author models.Authors) error {
+	values := map[string]interface{}{}
+	if author.Name != "" {
+		values["name"] = author.Name
+		values["name_key"] = helpers.NameKey(author.Name)
+	}
+	// gorm skips an update without values, which affected takes for a
+	// missing author
+	if len(values) == 0 {
+		_, err := r.FindByID(id)
+		return err
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := affected(tx.Model(&models.Authors{}).Where("id = ?", id).Updates(values), "author", id); err != nil {
+			return err
+		}
+		return creditAuthor(tx, id)
+	})
+}
+
+func (r *GormAuthorRepository) Delete(id int) error {
+	return affected(r.DB.Delete(&models.Authors{}, "id = ?", id), "author", id)
+}
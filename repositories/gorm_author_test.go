@@ -0,0 +1,155 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorRepository(t *testing.T) {
+	repos := map[string]AuthorRepository{
+		"memory": NewMemoryAuthorRepository(nil),
+		"gorm":   NewGormAuthorRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			for _, name := range []string{"Terry Pratchett", "Neil Gaiman"} {
+				assert.NoError(t, repo.Create(&models.Authors{Name: name}))
+			}
+
+			authors, page, err := repo.List(ListQuery{Sort: []SortField{{Field: "name"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			assert.Equal(t, "Neil Gaiman", authors[0].Name)
+
+			authors, _, err = repo.List(ListQuery{Filters: map[string]string{"name": "terry pratchett"}})
+			assert.NoError(t, err)
+			assert.Len(t, authors, 1)
+
+			assert.NoError(t, repo.Update(1, models.Authors{Name: "Sir Terry Pratchett"}))
+			author, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "Sir Terry Pratchett", author.Name)
+			// an update without a name changes nothing
+			assert.NoError(t, repo.Update(1, models.Authors{}))
+
+			// names match by their helpers.NameKey
+			author, err = repo.FindByName("sir terry  pratchett.")
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), author.ID)
+			_, err = repo.FindByName("Terry Pratchett")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.NoError(t, repo.Delete(1))
+			_, err = repo.FindByName("Sir Terry Pratchett")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = repo.FindByID(1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Authors{Name: "x"}), ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Authors{}), ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(1), ErrNotFound)
+		})
+	}
+}
+
+func TestBookRepositoryAuthors(t *testing.T) {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	publisher := uint(5)
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Create(&models.Books{Title: "good omens", AuthorIDs: []uint{2, 1}, PublisherID: &publisher}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "discworld", AuthorIDs: []uint{1}}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "sandman"}))
+
+			// the authors keep the order they are credited in
+			book, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{2, 1}, book.AuthorIDs)
+			assert.Equal(t, publisher, *book.PublisherID)
+			book, err = repo.FindByID(3)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{}, book.AuthorIDs)
+			assert.Nil(t, book.PublisherID)
+
+			books, page, err := repo.ListByAuthor(1, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			assert.Equal(t, []string{"good omens", "discworld"}, titles(books))
+			books, _, err = repo.ListByPublisher(5, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"good omens"}, titles(books))
+
+			// nil leaves the authors alone, empty removes them
+			assert.NoError(t, repo.Update(2, models.Books{Title: "the colour of magic"}))
+			books, _, err = repo.ListByAuthor(1, ListQuery{})
+			assert.NoError(t, err)
+			assert.Len(t, books, 2)
+			assert.NoError(t, repo.Update(2, models.Books{AuthorIDs: []uint{}}))
+			assert.NoError(t, repo.Update(3, models.Books{AuthorIDs: []uint{2}}))
+			books, _, err = repo.ListByAuthor(2, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"good omens", "sandman"}, titles(books))
+
+			assert.NoError(t, repo.Replace(1, models.Books{Title: "good omens"}))
+			book, err = repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{}, book.AuthorIDs)
+			assert.Nil(t, book.PublisherID)
+
+			// trashed books are listed in the trash only
+			assert.NoError(t, repo.Delete(3, 0))
+			books, _, err = repo.ListByAuthor(2, ListQuery{})
+			assert.NoError(t, err)
+			assert.Empty(t, books)
+			books, _, err = repo.ListByAuthor(2, ListQuery{Trashed: true})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"sandman"}, titles(books))
+		})
+	}
+}
+
+func TestAuthorRepositoryRenameCreditsBooks(t *testing.T) {
+	db := newSQLiteDB(t)
+	memoryBooks := NewMemoryBookRepository()
+	repos := map[string]struct {
+		Authors AuthorRepository
+		Books   BookRepository
+	}{
+		"memory": {NewMemoryAuthorRepository(memoryBooks), memoryBooks},
+		"gorm":   {NewGormAuthorRepository(db), NewGormBookRepository(db)},
+	}
+
+	for name, repos := range repos {
+		repo, books := repos.Authors, repos.Books
+		t.Run(name, func(t *testing.T) {
+			for _, name := range []string{"Terry Pratchett", "Neil Gaiman"} {
+				assert.NoError(t, repo.Create(&models.Authors{Name: name}))
+			}
+			assert.NoError(t, books.Create(&models.Books{Title: "good omens", Author: "Neil Gaiman; Terry Pratchett", AuthorIDs: []uint{2, 1}}))
+			assert.NoError(t, books.Create(&models.Books{Title: "discworld", Author: "Terry Pratchett", AuthorIDs: []uint{1}}))
+			assert.NoError(t, books.Create(&models.Books{Title: "sandman", Author: "Neil Gaiman", AuthorIDs: []uint{2}}))
+			assert.NoError(t, books.Delete(2, 1))
+
+			assert.NoError(t, repo.Update(1, models.Authors{Name: "Sir Terry Pratchett"}))
+
+			// trashed books are credited too, they may be restored
+			book, err := books.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "Neil Gaiman; Sir Terry Pratchett", book.Author)
+			assert.Equal(t, uint(2), book.Version)
+			trashed, _, err := books.ListByAuthor(1, ListQuery{Trashed: true})
+			assert.NoError(t, err)
+			assert.Equal(t, "Sir Terry Pratchett", trashed[0].Author)
+			book, err = books.FindByID(3)
+			assert.NoError(t, err)
+			assert.Equal(t, "Neil Gaiman", book.Author)
+			assert.Equal(t, uint(1), book.Version)
+		})
+	}
+}
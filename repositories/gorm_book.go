@@ -0,0 +1,458 @@
+package repositories
+
+import (
+	"errors"
+	"learn_testing/helpers"
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormBookRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormBookRepository(db *gorm.DB) *GormBookRepository {
+	return &GormBookRepository{DB: db}
+}
+
+func (r *GormBookRepository) FindAll() ([]models.Books, error) {
+	var books []models.Books
+	if err := r.DB.Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, loadLinks(r.DB, books)
+}
+
+func (r *GormBookRepository) List(query ListQuery) ([]models.Books, Page, error) {
+	return r.list(r.DB, query)
+}
+
+func (r *GormBookRepository) Filter(filter BookFilter, query ListQuery) ([]models.Books, Page, error) {
+	return r.list(r.filter(filter), query)
+}
+
+// Facets groups the books of the list by category and publisher, and its
+// tags by tag.
+func (r *GormBookRepository) Facets(filter BookFilter, query ListQuery) (models.BookFacets, error) {
+	facets := models.BookFacets{Categories: []models.FacetCount{}, Tags: []models.FacetCount{}, Publishers: []models.FacetCount{}}
+	if _, err := newPlan(bookFields, query); err != nil {
+		return facets, err
+	}
+	listed := func() *gorm.DB {
+		return filterGorm(r.filter(filter), bookFields, query)
+	}
+
+	for _, facet := range []struct {
+		column string
+		counts *[]models.FacetCount
+	}{{"category_id", &facets.Categories}, {"publisher_id", &facets.Publishers}} {
+		err := listed().Select(facet.column + " AS id, COUNT(*) AS count").Where(facet.column + " IS NOT NULL").
+			Group(facet.column).Order("count DESC, " + facet.column).Limit(FacetLimit).Scan(facet.counts).Error
+		if err != nil {
+			return facets, err
+		}
+	}
+
+	err := r.DB.Model(&models.BookTags{}).Select("tag AS name, COUNT(*) AS count").Where("book_id IN (?)", listed().Select("id")).
+		Group("tag").Order("count DESC, tag").Limit(FacetLimit).Scan(&facets.Tags).Error
+	return facets, err
+}
+
+// filter selects the books of filter, the tags must be distinct.
+func (r *GormBookRepository) filter(filter BookFilter) *gorm.DB {
+	db := r.DB
+	if len(filter.CategoryIDs) > 0 {
+		db = db.Where("category_id IN ?", filter.CategoryIDs)
+	}
+	if len(filter.Tags) > 0 {
+		tagged := r.DB.Model(&models.BookTags{}).Select("book_id").Where("tag IN ?", filter.Tags).
+			Group("book_id").Having("COUNT(*) = ?", len(filter.Tags))
+		db = db.Where("id IN (?)", tagged)
+	}
+	return db
+}
+
+func (r *GormBookRepository) ListByAuthor(authorID int, query ListQuery) ([]models.Books, Page, error) {
+	linked := r.DB.Model(&models.BookAuthors{}).Select("book_id").Where("author_id = ?", authorID)
+	return r.list(r.DB.Where("id IN (?)", linked), query)
+}
+
+func (r *GormBookRepository) ListByPublisher(publisherID int, query ListQuery) ([]models.Books, Page, error) {
+	return r.list(r.DB.Where("publisher_id = ?", publisherID), query)
+}
+
+func (r *GormBookRepository) list(db *gorm.DB, query ListQuery) ([]models.Books, Page, error) {
+	books, page, err := listGorm(db, bookFields, query)
+	if err != nil {
+		return nil, page, err
+	}
+	return books, page, loadLinks(r.DB, books)
+}
+
+func (r *GormBookRepository) FindByID(id int) (models.Books, error) {
+	return r.find(r.DB.Where("id = ?", id), notFound("book", id))
+}
+
+func (r *GormBookRepository) FindByIDs(ids []uint) ([]models.Books, error) {
+	books := []models.Books{}
+	if len(ids) == 0 {
+		return books, nil
+	}
+	if err := r.DB.Where("id IN ?", ids).Order("id").Find(&books).Error; err != nil {
+		return nil, err
+	}
+	return books, loadLinks(r.DB, books)
+}
+
+func (r *GormBookRepository) FindByISBN(isbn string) (models.Books, error) {
+	return r.find(r.DB.Where("isbn = ?", isbn), ErrNotFound)
+}
+
+// find returns the book db selects or missing when there is none.
+func (r *GormBookRepository) find(db *gorm.DB, missing error) (models.Books, error) {
+	var book models.Books
+	res := db.Find(&book)
+	if res.Error != nil {
+		return book, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return book, missing
+	}
+	books := []models.Books{book}
+	err := loadLinks(r.DB, books)
+	return books[0], err
+}
+
+func (r *GormBookRepository) Create(book *models.Books) error {
+	book.Version = 1
+	book.Rating, book.RatingCount = 0, 0
+	return isbnTaken(r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := linkNames(tx, book); err != nil {
+			return err
+		}
+		if err := tx.Save(book).Error; err != nil {
+			return err
+		}
+		if err := setAuthors(tx, book.ID, book.AuthorIDs); err != nil {
+			return err
+		}
+		return setTags(tx, book.ID, book.Tags)
+	}))
+}
+
+// Update saves the non zero fields of book.
+func (r *GormBookRepository) Update(id int, book models.Books) error {
+	return isbnTaken(r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := linkNames(tx, &book); err != nil {
+			return err
+		}
+
+		values := map[string]interface{}{}
+		if book.Title != "" {
+			values["title"] = book.Title
+		}
+		// the credited names go with the links, even when they are empty
+		if book.Author != "" || book.AuthorIDs != nil {
+			values["author"] = book.Author
+		}
+		if book.Publisher != "" || book.PublisherID != nil {
+			values["publisher"] = book.Publisher
+		}
+		// the ISBN-10 follows the ISBN, even when there is none
+		if book.ISBN != "" {
+			values["isbn"] = book.ISBN
+			values["isbn10"] = book.ISBN10
+		}
+		if book.PublisherID != nil {
+			values["publisher_id"] = *book.PublisherID
+		}
+		if book.CategoryID != nil {
+			values["category_id"] = *book.CategoryID
+		}
+		if err := versioned(tx, &models.Books{}, "book", id, book.Version, values); err != nil {
+			return err
+		}
+		if book.AuthorIDs != nil {
+			if err := setAuthors(tx, uint(id), book.AuthorIDs); err != nil {
+				return err
+			}
+		}
+		if book.Tags == nil {
+			return nil
+		}
+		return setTags(tx, uint(id), book.Tags)
+	}))
+}
+
+func (r *GormBookRepository) Replace(id int, book models.Books) error {
+	return isbnTaken(r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := linkNames(tx, &book); err != nil {
+			return err
+		}
+
+		values := map[string]interface{}{
+			"title":        book.Title,
+			"author":       book.Author,
+			"publisher":    book.Publisher,
+			"isbn":         book.ISBN,
+			"isbn10":       book.ISBN10,
+			"publisher_id": book.PublisherID,
+			"category_id":  book.CategoryID,
+		}
+		if err := versioned(tx, &models.Books{}, "book", id, book.Version, values); err != nil {
+			return err
+		}
+		if err := setAuthors(tx, uint(id), book.AuthorIDs); err != nil {
+			return err
+		}
+		return setTags(tx, uint(id), book.Tags)
+	}))
+}
+
+// linkNames links book to the authors and the publisher it names in
+// LinkAuthors and LinkPublisher, the ones that do not exist yet are created
+// in tx and go with it when the write fails.
+func linkNames(tx *gorm.DB, book *models.Books) error {
+	if book.LinkAuthors != nil {
+		authors := NewGormAuthorRepository(tx)
+		ids, names := []uint{}, []string{}
+		seen := map[uint]bool{}
+		for _, name := range book.LinkAuthors {
+			author, err := authors.FindByName(name)
+			if errors.Is(err, ErrNotFound) {
+				author = models.Authors{Name: name}
+				err = authors.Create(&author)
+			}
+			if err != nil {
+				return err
+			}
+			if !seen[author.ID] {
+				seen[author.ID] = true
+				ids, names = append(ids, author.ID), append(names, author.Name)
+			}
+		}
+		book.AuthorIDs, book.Author = ids, helpers.JoinAuthors(names)
+	}
+
+	if book.LinkPublisher != "" {
+		publishers := NewGormPublisherRepository(tx)
+		publisher, err := publishers.FindByName(book.LinkPublisher)
+		if errors.Is(err, ErrNotFound) {
+			publisher = models.Publishers{Name: book.LinkPublisher}
+			err = publishers.Create(&publisher)
+		}
+		if err != nil {
+			return err
+		}
+		book.PublisherID, book.Publisher = &publisher.ID, publisher.Name
+	}
+	return nil
+}
+
+// loadLinks fills in the AuthorIDs and the Tags of books.
+func loadLinks(db *gorm.DB, books []models.Books) error {
+	if len(books) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(books))
+	index := map[uint]int{}
+	for i := range books {
+		books[i].AuthorIDs = []uint{}
+		books[i].Tags = []string{}
+		ids[i] = books[i].ID
+		index[books[i].ID] = i
+	}
+
+	var links []models.BookAuthors
+	if err := db.Where("book_id IN ?", ids).Order("book_id, position").Find(&links).Error; err != nil {
+		return err
+	}
+	for _, link := range links {
+		book := &books[index[link.BookID]]
+		book.AuthorIDs = append(book.AuthorIDs, link.AuthorID)
+	}
+
+	var tags []models.BookTags
+	if err := db.Where("book_id IN ?", ids).Order("book_id, tag").Find(&tags).Error; err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		book := &books[index[tag.BookID]]
+		book.Tags = append(book.Tags, tag.Tag)
+	}
+	return nil
+}
+
+// setAuthors replaces the authors of the book id.
+func setAuthors(tx *gorm.DB, id uint, authorIDs []uint) error {
+	if err := tx.Where("book_id = ?", id).Delete(&models.BookAuthors{}).Error; err != nil {
+		return err
+	}
+	if len(authorIDs) == 0 {
+		return nil
+	}
+
+	links := make([]models.BookAuthors, len(authorIDs))
+	for i, authorID := range authorIDs {
+		links[i] = models.BookAuthors{BookID: id, AuthorID: authorID, Position: i}
+	}
+	return tx.Create(&links).Error
+}
+
+// creditAuthor rewrites the author text of the books, trashed or not, that
+// credit the author id, from the names of all their authors in order.
+func creditAuthor(tx *gorm.DB, authorID int) error {
+	credited := tx.Model(&models.BookAuthors{}).Select("book_id").Where("author_id = ?", authorID)
+	var links []struct {
+		BookID uint
+		Name   string
+	}
+	err := tx.Model(&models.BookAuthors{}).
+		Select("book_authors.book_id, authors.name").
+		Joins("JOIN authors ON authors.id = book_authors.author_id AND authors.deleted_at IS NULL").
+		Where("book_authors.book_id IN (?)", credited).
+		Order("book_authors.book_id, book_authors.position").
+		Scan(&links).Error
+	if err != nil {
+		return err
+	}
+
+	names := map[uint][]string{}
+	for _, link := range links {
+		names[link.BookID] = append(names[link.BookID], link.Name)
+	}
+	for bookID, names := range names {
+		values := map[string]interface{}{"author": helpers.JoinAuthors(names), "version": gorm.Expr("version + 1")}
+		if err := tx.Unscoped().Model(&models.Books{}).Where("id = ?", bookID).UpdateColumns(values).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTags replaces the tags of the book id.
+func setTags(tx *gorm.DB, id uint, tags []string) error {
+	if err := tx.Where("book_id = ?", id).Delete(&models.BookTags{}).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	rows := make([]models.BookTags, len(tags))
+	for i, tag := range tags {
+		rows[i] = models.BookTags{BookID: id, Tag: tag}
+	}
+	return tx.Create(&rows).Error
+}
+
+// isbnTaken turns a violation of the unique ISBN into ErrISBNTaken, it is
+// the only unique index of books.
+func isbnTaken(err error) error {
+	if isUniqueViolation(err) {
+		return ErrISBNTaken
+	}
+	return err
+}
+
+// Delete moves the book to the trash.
+func (r *GormBookRepository) Delete(id int, version uint) error {
+	res := whereVersion(r.DB, version).Delete(&models.Books{}, "id = ?", id)
+	return versionResult(r.DB, res, &models.Books{}, "book", id, version)
+}
+
+func (r *GormBookRepository) Restore(id int) error {
+	res := r.DB.Unscoped().Model(&models.Books{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	return affected(res, "book", id)
+}
+
+func (r *GormBookRepository) Purge(id int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&models.Books{}).Where("id = ?", id).Scopes(settledBooks).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			var count int64
+			if err := tx.Unscoped().Model(&models.Books{}).Where("id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return notFound("book", id)
+			}
+			return ErrStillLent
+		}
+		_, err := purgeBooks(tx, ids)
+		return err
+	})
+}
+
+func (r *GormBookRepository) PurgeTrash(before time.Time) (int64, error) {
+	var purged int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&models.Books{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Scopes(settledBooks).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		purged, err = purgeBooks(tx, ids)
+		return err
+	})
+	return purged, err
+}
+
+// settledBooks leaves out the books with a copy on loan, a late return not
+// fined yet or a fine left to pay, purging them would lose track of them
+func settledBooks(db *gorm.DB) *gorm.DB {
+	lent := db.Session(&gorm.Session{NewDB: true}).Model(&models.Loans{}).Select("book_id").Where("returned_at IS NULL")
+	unfined := unfinedLoans(db).Select("book_id")
+	owed := db.Session(&gorm.Session{NewDB: true}).Model(&models.Fines{}).Select("book_id").Where("balance > 0")
+	return db.Where("id NOT IN (?)", lent).Where("id NOT IN (?)", unfined).Where("id NOT IN (?)", owed)
+}
+
+// unfinedLoans are the late returns without a fine, the fine sweeper
+// charges them later
+func unfinedLoans(db *gorm.DB) *gorm.DB {
+	fined := db.Session(&gorm.Session{NewDB: true}).Model(&models.Fines{}).Select("loan_id")
+	return db.Session(&gorm.Session{NewDB: true}).Model(&models.Loans{}).
+		Where("returned_at > due_at").Where("id NOT IN (?)", fined)
+}
+
+// purgeBooks deletes the books ids for good with their copies, loans,
+// holds, reviews and links. Their fines stay, they are the money ledger.
+// The ids are read beforehand, MySQL can not delete from a table its
+// subquery reads.
+func purgeBooks(tx *gorm.DB, ids []uint) (int64, error) {
+	for _, refers := range []struct {
+		model interface{}
+		where string
+		value interface{}
+	}{
+		{&models.BookAuthors{}, "book_id IN ?", ids},
+		{&models.BookTags{}, "book_id IN ?", ids},
+		{&models.ShelfBooks{}, "book_id IN ?", ids},
+		{&models.Reviews{}, "book_id IN ?", ids},
+		{&models.Holds{}, "book_id IN ?", ids},
+		{&models.Loans{}, "book_id IN ?", ids},
+		{&models.Copies{}, "book_id IN ?", ids},
+	} {
+		if err := tx.Unscoped().Where(refers.where, refers.value).Delete(refers.model).Error; err != nil {
+			return 0, err
+		}
+	}
+	res := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Books{})
+	return res.RowsAffected, res.Error
+}
+
+// affected turns a write that matched no row into ErrNotFound.
+func affected(res *gorm.DB, kind string, id int) error {
+	if res.Error == nil && res.RowsAffected == 0 {
+		return notFound(kind, id)
+	}
+	return res.Error
+}
@@ -0,0 +1,421 @@
+package repositories
+
+import (
+	"database/sql/driver"
+	"learn_testing/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type AnyTime struct{}
+
+func (a AnyTime) Match(v driver.Value) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	dbFakeGorm, mocked, err := sqlmock.New()
+
+	assert.NoError(t, err)
+
+	dbGorm, err := gorm.Open(mysql.New(mysql.Config{
+		SkipInitializeWithVersion: true,
+		Conn:                      dbFakeGorm,
+	}))
+
+	assert.NoError(t, err)
+
+	return dbGorm, mocked
+}
+
+func TestGormBookRepositoryFindAll(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	row := sqlmock.NewRows([]string{"id", "title", "publisher"}).
+		AddRow(1, "jalan jalan", "gramed")
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `books` WHERE `books`.`deleted_at` IS NULL")).
+		WillReturnRows(row)
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `book_authors` WHERE book_id IN (?) ORDER BY book_id, position")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "author_id", "position"}).AddRow(1, 7, 0))
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `book_tags` WHERE book_id IN (?) ORDER BY book_id, tag")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "tag"}).AddRow(1, "fantasy").AddRow(1, "magic"))
+
+	books, err := NewGormBookRepository(db).FindAll()
+
+	assert.NoError(t, err)
+	assert.Len(t, books, 1)
+	assert.Equal(t, "jalan jalan", books[0].Title)
+	assert.Equal(t, []uint{7}, books[0].AuthorIDs)
+	assert.Equal(t, []string{"fantasy", "magic"}, books[0].Tags)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormBookRepositoryFindByID(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	row := sqlmock.NewRows([]string{"id", "title", "publisher", "author"}).
+		AddRow(1, "jalan jalan", "gramed", "ahmad")
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `books` WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs(1).
+		WillReturnRows(row)
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `book_authors` WHERE book_id IN (?) ORDER BY book_id, position")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "author_id", "position"}))
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `book_tags` WHERE book_id IN (?) ORDER BY book_id, tag")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"book_id", "tag"}))
+
+	book, err := NewGormBookRepository(db).FindByID(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "jalan jalan", book.Title)
+	assert.Equal(t, "ahmad", book.Author)
+	assert.Equal(t, []uint{}, book.AuthorIDs)
+	assert.Equal(t, []string{}, book.Tags)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormBookRepositoryCreate(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `books` (`created_at`,`updated_at`,`deleted_at`,`title`,`author`,`publisher`,`isbn`,`isbn10`,`publisher_id`,`category_id`,`rating`,`rating_count`,`version`) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)")).
+		WithArgs(AnyTime{}, AnyTime{}, nil, "jalan jalan", "ahmad", "gramed", nil, "", nil, nil, 0.0, 0, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `book_authors` WHERE book_id = ?")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `book_authors` (`book_id`,`author_id`,`position`) VALUES (?,?,?),(?,?,?)")).
+		WithArgs(1, 3, 0, 1, 2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `book_tags` WHERE book_id = ?")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `book_tags` (`book_id`,`tag`) VALUES (?,?)")).
+		WithArgs(1, "travel").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mocked.ExpectCommit()
+
+	book := models.Books{Title: "jalan jalan", Author: "ahmad", Publisher: "gramed", AuthorIDs: []uint{3, 2}, Tags: []string{"travel"}}
+	err := NewGormBookRepository(db).Create(&book)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), book.ID)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormBookRepositoryUpdate(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `books` SET `author`=?,`publisher`=?,`title`=?,`version`=version + 1,`updated_at`=? WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs("ahmad", "gramed", "jalan jalan", AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormBookRepository(db).Update(1, models.Books{Title: "jalan jalan", Author: "ahmad", Publisher: "gramed"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormBookRepositoryDelete(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `books` SET `deleted_at`=? WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs(AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormBookRepository(db).Delete(1, 0)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormBookRepositoryPurge(t *testing.T) {
+	db := newSQLiteDB(t)
+	books, loans, fines := NewGormBookRepository(db), NewGormLoanRepository(db), NewGormFineRepository(db)
+	reviews, shelves := NewGormReviewRepository(db), NewGormShelfRepository(db)
+	now := time.Now()
+
+	assert.NoError(t, NewGormUserRepository(db).Create(&models.Users{Name: "ahmad", Email: "ahmad@gmail.com"}))
+	assert.NoError(t, books.Create(&models.Books{Title: "mort", Tags: []string{"discworld"}}))
+	assert.NoError(t, loans.AddCopy(&models.Copies{BookID: 1}, now))
+	_, err := loans.Checkout(1, 1, now.Add(-48*time.Hour), 5)
+	assert.NoError(t, err)
+
+	// a copy on loan keeps the book, so does a late return not fined yet
+	// and a fine left to pay
+	assert.ErrorIs(t, books.Purge(1), ErrStillLent)
+	loan, err := loans.Return(1, 1, now)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, books.Purge(1), ErrStillLent)
+	assert.NoError(t, fines.Charge(&models.Fines{LoanID: loan.ID, UserID: 1, BookID: 1, Amount: 20}))
+	assert.ErrorIs(t, books.Purge(1), ErrStillLent)
+	_, err = fines.Settle(1, &models.FineEntries{Kind: models.FinePayment, Amount: 20})
+	assert.NoError(t, err)
+
+	assert.NoError(t, reviews.Create(&models.Reviews{BookID: 1, UserID: 1, Rating: 4}))
+	shelf := models.Shelves{UserID: 1, Name: "to read"}
+	assert.NoError(t, shelves.Create(&shelf))
+	assert.NoError(t, shelves.AddBook(int(shelf.ID), 1, 0))
+
+	assert.NoError(t, books.Purge(1))
+	for _, model := range []interface{}{&models.Books{}, &models.BookTags{}, &models.Copies{}, &models.Loans{}, &models.Reviews{}, &models.ShelfBooks{}} {
+		var count int64
+		assert.NoError(t, db.Unscoped().Model(model).Count(&count).Error)
+		assert.Zero(t, count, "%T", model)
+	}
+	// the fines are the money ledger, they stay
+	fine, err := fines.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), fine.BookID)
+	entries, err := fines.Entries(1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.ErrorIs(t, books.Purge(1), ErrNotFound)
+}
+
+func TestGormBookRepositoryNotFound(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `books` WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `books` SET `deleted_at`=? WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs(AnyTime{}, 9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectCommit()
+
+	repo := NewGormBookRepository(db)
+
+	_, err := repo.FindByID(9)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.EqualError(t, err, "book 9: record not found")
+
+	assert.ErrorIs(t, repo.Delete(9, 0), ErrNotFound)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestBookRepositoryTrash(t *testing.T) {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			for _, title := range []string{"a", "b", "c"} {
+				assert.NoError(t, repo.Create(&models.Books{Title: title}))
+			}
+			assert.ErrorIs(t, repo.Restore(1), ErrNotFound)
+
+			assert.NoError(t, repo.Delete(1, 0))
+			assert.NoError(t, repo.Delete(2, 0))
+			assert.ErrorIs(t, repo.Delete(1, 0), ErrNotFound)
+
+			// trashed books are hidden from everything but the trash
+			_, err := repo.FindByID(1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Books{Title: "x"}), ErrNotFound)
+			books, _, err := repo.List(ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"c"}, titles(books))
+			books, page, err := repo.List(ListQuery{Trashed: true})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			assert.Equal(t, []string{"a", "b"}, titles(books))
+
+			assert.NoError(t, repo.Restore(1))
+			book, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "a", book.Title)
+
+			// only what was trashed before the cut-off is purged
+			purged, err := repo.PurgeTrash(time.Now().Add(-time.Hour))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), purged)
+			purged, err = repo.PurgeTrash(time.Now().Add(time.Second))
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), purged)
+			assert.ErrorIs(t, repo.Restore(2), ErrNotFound)
+
+			assert.NoError(t, repo.Purge(3))
+			books, page, err = repo.List(ListQuery{Trashed: true})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(0), page.Total)
+		})
+	}
+}
+
+func TestGormBookRepositoryReplace(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `books` SET `author`=?,`category_id`=?,`isbn`=?,`isbn10`=?,`publisher`=?,`publisher_id`=?,`title`=?,`version`=version + 1,`updated_at`=? WHERE id = ? AND `books`.`deleted_at` IS NULL")).
+		WithArgs("", nil, nil, "", "", nil, "jalan jalan", AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `book_authors` WHERE book_id = ?")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `book_tags` WHERE book_id = ?")).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectCommit()
+
+	// empty fields are written too
+	err := NewGormBookRepository(db).Replace(1, models.Books{Title: "jalan jalan"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestBookRepositoryVersion(t *testing.T) {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			book := models.Books{Title: "a"}
+			assert.NoError(t, repo.Create(&book))
+			assert.Equal(t, uint(1), book.Version)
+
+			assert.NoError(t, repo.Update(1, models.Books{Title: "b", Version: 1}))
+			assert.ErrorIs(t, repo.Update(1, models.Books{Title: "c", Version: 1}), ErrVersionMismatch)
+			assert.ErrorIs(t, repo.Replace(1, models.Books{Title: "c", Version: 1}), ErrVersionMismatch)
+			// without a version the write always happens
+			assert.NoError(t, repo.Update(1, models.Books{Author: "ahmad"}))
+
+			stored, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(3), stored.Version)
+			assert.Equal(t, "b", stored.Title)
+
+			assert.ErrorIs(t, repo.Delete(1, 2), ErrVersionMismatch)
+			assert.NoError(t, repo.Delete(1, 3))
+			assert.ErrorIs(t, repo.Update(1, models.Books{Title: "c", Version: 3}), ErrNotFound)
+
+			assert.NoError(t, repo.Restore(1))
+			stored, err = repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(4), stored.Version)
+		})
+	}
+}
+
+func TestBookRepositoryISBN(t *testing.T) {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			// books without an ISBN do not collide
+			assert.NoError(t, repo.Create(&models.Books{Title: "a"}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "b"}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "c", ISBN: "9780306406157", ISBN10: "0306406152"}))
+
+			book, err := repo.FindByISBN("9780306406157")
+			assert.NoError(t, err)
+			assert.Equal(t, "c", book.Title)
+			assert.Equal(t, "0306406152", book.ISBN10)
+			_, err = repo.FindByISBN("9791090636071")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.ErrorIs(t, repo.Create(&models.Books{Title: "d", ISBN: "9780306406157"}), ErrISBNTaken)
+			assert.ErrorIs(t, repo.Update(1, models.Books{ISBN: "9780306406157"}), ErrISBNTaken)
+			assert.ErrorIs(t, repo.Replace(1, models.Books{Title: "a", ISBN: "9780306406157"}), ErrISBNTaken)
+
+			// a new ISBN without an ISBN-10 clears the old one
+			assert.NoError(t, repo.Update(3, models.Books{ISBN: "9791090636071"}))
+			book, err = repo.FindByID(3)
+			assert.NoError(t, err)
+			assert.Equal(t, models.NullableString("9791090636071"), book.ISBN)
+			assert.Equal(t, "", book.ISBN10)
+
+			// trashed books keep their ISBN until they are purged
+			assert.NoError(t, repo.Delete(3, 0))
+			_, err = repo.FindByISBN("9791090636071")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Books{ISBN: "9791090636071"}), ErrISBNTaken)
+			assert.NoError(t, repo.Purge(3))
+			assert.NoError(t, repo.Update(1, models.Books{ISBN: "9791090636071"}))
+
+			assert.NoError(t, repo.Replace(1, models.Books{Title: "a"}))
+			book, err = repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, models.NullableString(""), book.ISBN)
+		})
+	}
+}
+
+func TestBookRepositoryLinksNames(t *testing.T) {
+	db := newSQLiteDB(t)
+	memoryBooks := NewMemoryBookRepository()
+	repos := map[string]struct {
+		Books      BookRepository
+		Authors    AuthorRepository
+		Publishers PublisherRepository
+	}{
+		"memory": {memoryBooks, NewMemoryAuthorRepository(memoryBooks), NewMemoryPublisherRepository(memoryBooks)},
+		"gorm":   {NewGormBookRepository(db), NewGormAuthorRepository(db), NewGormPublisherRepository(db)},
+	}
+
+	for name, repos := range repos {
+		repo, authors, publishers := repos.Books, repos.Authors, repos.Publishers
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, authors.Create(&models.Authors{Name: "Terry Pratchett"}))
+
+			// known names are linked, new ones created, each once
+			book := models.Books{Title: "good omens", ISBN: "9780306406157", LinkAuthors: []string{"Neil Gaiman", "terry pratchett", "Neil  Gaiman"}, LinkPublisher: "Gollancz"}
+			assert.NoError(t, repo.Create(&book))
+			stored, err := repo.FindByID(int(book.ID))
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{2, 1}, stored.AuthorIDs)
+			assert.Equal(t, "Neil Gaiman; Terry Pratchett", stored.Author)
+			assert.Equal(t, "Gollancz", stored.Publisher)
+			publisher, err := publishers.FindByName("gollancz")
+			assert.NoError(t, err)
+			assert.Equal(t, &publisher.ID, stored.PublisherID)
+
+			// a write that fails creates nothing
+			failed := []error{
+				repo.Create(&models.Books{Title: "x", ISBN: "9780306406157", LinkAuthors: []string{"Jane Austen"}, LinkPublisher: "Penguin"}),
+				repo.Update(int(book.ID), models.Books{Version: 9, LinkAuthors: []string{"Jane Austen"}, LinkPublisher: "Penguin"}),
+				repo.Replace(99, models.Books{Title: "x", LinkAuthors: []string{"Jane Austen"}, LinkPublisher: "Penguin"}),
+			}
+			assert.ErrorIs(t, failed[0], ErrISBNTaken)
+			assert.ErrorIs(t, failed[1], ErrVersionMismatch)
+			assert.ErrorIs(t, failed[2], ErrNotFound)
+			_, err = authors.FindByName("Jane Austen")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = publishers.FindByName("Penguin")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.NoError(t, repo.Update(int(book.ID), models.Books{LinkAuthors: []string{"Jane Austen"}}))
+			author, err := authors.FindByName("Jane Austen")
+			assert.NoError(t, err)
+			stored, err = repo.FindByID(int(book.ID))
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{author.ID}, stored.AuthorIDs)
+			assert.Equal(t, "Jane Austen", stored.Author)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"learn_testing/models"
+
+	"gorm.io/gorm"
+)
+
+type GormCategoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormCategoryRepository(db *gorm.DB) *GormCategoryRepository {
+	return &GormCategoryRepository{DB: db}
+}
+
+func (r *GormCategoryRepository) FindAll() ([]models.Categories, error) {
+	var categories []models.Categories
+	if err := r.DB.Order("name, id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *GormCategoryRepository) FindByID(id int) (models.Categories, error) {
+	var category models.Categories
+	res := r.DB.Where("id = ?", id).Find(&category)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return category, notFound("category", id)
+	}
+	return category, res.Error
+}
+
+func (r *GormCategoryRepository) FindByIDs(ids []uint) ([]models.Categories, error) {
+	categories := []models.Categories{}
+	if len(ids) == 0 {
+		return categories, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Order("id").Find(&categories).Error
+	return categories, err
+}
+
+func (r *GormCategoryRepository) Create(category *models.Categories) error {
+	return r.DB.Create(category).Error
+}
+
+func (r *GormCategoryRepository) Update(id int, category models.Categories) error {
+	values := map[string]interface{}{
+		"name":            category.Name,
+		"parent_id":       category.ParentID,
+		"fine_daily_rate": category.FineDailyRate,
+		"fine_cap":        category.FineCap,
+	}
+	return affected(r.DB.Model(&models.Categories{}).Where("id = ?", id).Updates(values), "category", id)
+}
+
+func (r *GormCategoryRepository) Delete(id int) error {
+	return affected(r.DB.Delete(&models.Categories{}, "id = ?", id), "category", id)
+}
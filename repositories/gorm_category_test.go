@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryRepository(t *testing.T) {
+	repos := map[string]CategoryRepository{
+		"memory": NewMemoryCategoryRepository(),
+		"gorm":   NewGormCategoryRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			fiction := models.Categories{Name: "Fiction"}
+			assert.NoError(t, repo.Create(&fiction))
+			assert.NoError(t, repo.Create(&models.Categories{Name: "Fantasy", ParentID: &fiction.ID}))
+
+			categories, err := repo.FindAll()
+			assert.NoError(t, err)
+			assert.Len(t, categories, 2)
+			assert.Equal(t, "Fantasy", categories[0].Name)
+			assert.Equal(t, fiction.ID, *categories[0].ParentID)
+
+			// a nil parent moves the category to the root
+			rate := int64(50)
+			assert.NoError(t, repo.Update(2, models.Categories{Name: "High Fantasy", FineDailyRate: &rate}))
+			category, err := repo.FindByID(2)
+			assert.NoError(t, err)
+			assert.Equal(t, "High Fantasy", category.Name)
+			assert.Nil(t, category.ParentID)
+			assert.Equal(t, rate, *category.FineDailyRate)
+			assert.Nil(t, category.FineCap)
+
+			categories, err = repo.FindByIDs([]uint{2, 9, 1})
+			assert.NoError(t, err)
+			assert.Len(t, categories, 2)
+			assert.Equal(t, "Fiction", categories[0].Name)
+
+			assert.NoError(t, repo.Delete(2))
+			_, err = repo.FindByID(2)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(2, models.Categories{Name: "x"}), ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(2), ErrNotFound)
+		})
+	}
+}
+
+func TestBookRepositoryFilter(t *testing.T) {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	fiction, fantasy, publisher := uint(1), uint(2), uint(7)
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Create(&models.Books{Title: "mort", Author: "pratchett", CategoryID: &fantasy, PublisherID: &publisher, Tags: []string{"discworld", "humour"}}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "jingo", Author: "pratchett", CategoryID: &fantasy, Tags: []string{"discworld"}}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "dune", CategoryID: &fiction, PublisherID: &publisher, Tags: []string{"space"}}))
+			assert.NoError(t, repo.Create(&models.Books{Title: "atlas"}))
+
+			book, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"discworld", "humour"}, book.Tags)
+			assert.Equal(t, fantasy, *book.CategoryID)
+
+			books, page, err := repo.Filter(BookFilter{CategoryIDs: []uint{fiction, fantasy}}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), page.Total)
+			assert.Equal(t, []string{"mort", "jingo", "dune"}, titles(books))
+
+			// a book needs every tag
+			books, _, err = repo.Filter(BookFilter{Tags: []string{"discworld", "humour"}}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"mort"}, titles(books))
+			books, _, err = repo.Filter(BookFilter{CategoryIDs: []uint{fiction}, Tags: []string{"discworld"}}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Empty(t, books)
+
+			// the facets count every page of the list
+			facets, err := repo.Facets(BookFilter{}, ListQuery{Limit: 1})
+			assert.NoError(t, err)
+			assert.Equal(t, []models.FacetCount{{ID: fantasy, Count: 2}, {ID: fiction, Count: 1}}, facets.Categories)
+			assert.Equal(t, []models.FacetCount{{ID: publisher, Count: 2}}, facets.Publishers)
+			assert.Equal(t, []models.FacetCount{{Name: "discworld", Count: 2}, {Name: "humour", Count: 1}, {Name: "space", Count: 1}}, facets.Tags)
+
+			facets, err = repo.Facets(BookFilter{Tags: []string{"discworld"}}, ListQuery{Filters: map[string]string{"title": "jingo"}})
+			assert.NoError(t, err)
+			assert.Equal(t, []models.FacetCount{{ID: fantasy, Count: 1}}, facets.Categories)
+			assert.Equal(t, []models.FacetCount{}, facets.Publishers)
+			assert.Equal(t, []models.FacetCount{{Name: "discworld", Count: 1}}, facets.Tags)
+
+			_, err = repo.Facets(BookFilter{}, ListQuery{Filters: map[string]string{"isbn": "x"}})
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+
+			// nil leaves the tags alone, empty removes them
+			assert.NoError(t, repo.Update(2, models.Books{Title: "jingo!"}))
+			book, err = repo.FindByID(2)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"discworld"}, book.Tags)
+			assert.NoError(t, repo.Update(2, models.Books{Tags: []string{}, CategoryID: &fiction}))
+			book, err = repo.FindByID(2)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{}, book.Tags)
+			assert.Equal(t, fiction, *book.CategoryID)
+
+			assert.NoError(t, repo.Replace(1, models.Books{Title: "mort"}))
+			book, err = repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{}, book.Tags)
+			assert.Nil(t, book.CategoryID)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormFineRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormFineRepository(db *gorm.DB) *GormFineRepository {
+	return &GormFineRepository{DB: db}
+}
+
+func (r *GormFineRepository) Charge(fine *models.Fines) error {
+	fine.Paid, fine.Waived = 0, 0
+	fine.Balance = fine.Amount
+	if err := r.DB.Create(fine).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrLoanFined
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *GormFineRepository) FindByID(id int) (models.Fines, error) {
+	return findFine(r.DB, id)
+}
+
+func findFine(db *gorm.DB, id int) (models.Fines, error) {
+	var fine models.Fines
+	res := db.Where("id = ?", id).Find(&fine)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return fine, notFound("fine", id)
+	}
+	return fine, res.Error
+}
+
+func (r *GormFineRepository) List(filter FineFilter, query ListQuery) ([]models.Fines, Page, error) {
+	db := r.DB
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.LoanID != 0 {
+		db = db.Where("loan_id = ?", filter.LoanID)
+	}
+	if filter.Outstanding {
+		db = db.Where("balance > 0")
+	}
+	return listGorm(db, fineFields, query)
+}
+
+func (r *GormFineRepository) Balance(userID int) (int64, error) {
+	var balance int64
+	err := r.DB.Model(&models.Fines{}).Select("COALESCE(SUM(balance), 0)").Where("user_id = ?", userID).Scan(&balance).Error
+	return balance, err
+}
+
+// Settle takes the amount off the balance only if the balance covers it, so
+// two librarians taking the same payment can not both succeed.
+func (r *GormFineRepository) Settle(fineID int, entry *models.FineEntries) (models.Fines, error) {
+	var fine models.Fines
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		column := "paid"
+		if entry.Kind == models.FineWaiver {
+			column = "waived"
+		}
+		res := tx.Model(&models.Fines{}).Where("id = ? AND balance >= ?", fineID, entry.Amount).Updates(map[string]interface{}{
+			column:       gorm.Expr(column+" + ?", entry.Amount),
+			"balance":    gorm.Expr("balance - ?", entry.Amount),
+			"updated_at": time.Now(),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if _, err := findFine(tx, fineID); err != nil {
+				return err
+			}
+			return ErrExceedsBalance
+		}
+
+		entry.FineID = uint(fineID)
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		var err error
+		fine, err = findFine(tx, fineID)
+		return err
+	})
+	return fine, err
+}
+
+func (r *GormFineRepository) Entries(fineID int) ([]models.FineEntries, error) {
+	var entries []models.FineEntries
+	if err := r.DB.Where("fine_id = ?", fineID).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *GormFineRepository) Report(from, to *time.Time) (models.FineReport, error) {
+	charged := func() *gorm.DB {
+		db := r.DB.Model(&models.Fines{})
+		if from != nil {
+			db = db.Where("created_at >= ?", from.Local())
+		}
+		if to != nil {
+			db = db.Where("created_at < ?", to.Local())
+		}
+		return db
+	}
+
+	report := models.FineReport{Debtors: []models.FineDebtor{}}
+	err := charged().Select("COUNT(*) AS fines, COALESCE(SUM(amount), 0) AS charged, COALESCE(SUM(paid), 0) AS paid, " +
+		"COALESCE(SUM(waived), 0) AS waived, COALESCE(SUM(balance), 0) AS outstanding").Scan(&report).Error
+	if err != nil {
+		return report, err
+	}
+
+	err = charged().Select("user_id, SUM(balance) AS balance").Group("user_id").Having("SUM(balance) > 0").
+		Order("balance DESC, user_id").Limit(ReportLimit).Scan(&report.Debtors).Error
+	return report, err
+}
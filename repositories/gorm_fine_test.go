@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/models"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestFineRepository(t *testing.T) {
+	repos := map[string]FineRepository{
+		"memory": NewMemoryFineRepository(),
+		"gorm":   NewGormFineRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			fine := models.Fines{LoanID: 1, UserID: 1, BookID: 1, DaysLate: 4, DailyRate: 25, Amount: 100}
+			assert.NoError(t, repo.Charge(&fine))
+			assert.Equal(t, int64(100), fine.Balance)
+			assert.ErrorIs(t, repo.Charge(&models.Fines{LoanID: 1, UserID: 1, Amount: 50}), ErrLoanFined)
+			assert.NoError(t, repo.Charge(&models.Fines{LoanID: 2, UserID: 2, BookID: 1, Amount: 30}))
+
+			// partial payments and waivers go into the ledger
+			fine, err := repo.Settle(1, &models.FineEntries{Kind: models.FinePayment, Amount: 40, RecordedBy: 9})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(40), fine.Paid)
+			assert.Equal(t, int64(60), fine.Balance)
+			fine, err = repo.Settle(1, &models.FineEntries{Kind: models.FineWaiver, Amount: 10, Note: "first time"})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(10), fine.Waived)
+			assert.Equal(t, int64(50), fine.Balance)
+			_, err = repo.Settle(1, &models.FineEntries{Kind: models.FinePayment, Amount: 51})
+			assert.ErrorIs(t, err, ErrExceedsBalance)
+			_, err = repo.Settle(9, &models.FineEntries{Kind: models.FinePayment, Amount: 1})
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			entries, err := repo.Entries(1)
+			assert.NoError(t, err)
+			if assert.Len(t, entries, 2) {
+				assert.Equal(t, models.FinePayment, entries[0].Kind)
+				assert.Equal(t, uint(9), entries[0].RecordedBy)
+				assert.Equal(t, "first time", entries[1].Note)
+			}
+
+			balance, err := repo.Balance(1)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(50), balance)
+
+			_, err = repo.Settle(2, &models.FineEntries{Kind: models.FinePayment, Amount: 30})
+			assert.NoError(t, err)
+			fines, page, err := repo.List(FineFilter{Outstanding: true}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), page.Total)
+			assert.Equal(t, uint(1), fines[0].ID)
+			_, page, err = repo.List(FineFilter{UserID: 2}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), page.Total)
+
+			report, err := repo.Report(nil, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, models.FineReport{
+				Fines: 2, Charged: 130, Paid: 70, Waived: 10, Outstanding: 50,
+				Debtors: []models.FineDebtor{{UserID: 1, Balance: 50}},
+			}, report)
+
+			later := time.Now().Add(time.Hour)
+			report, err = repo.Report(&later, nil)
+			assert.NoError(t, err)
+			assert.Zero(t, report.Fines)
+			assert.Empty(t, report.Debtors)
+		})
+	}
+}
+
+func TestGormFineRepositoryConcurrentSettle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000&_txlock=immediate", path)), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Fines{}, &models.FineEntries{}))
+
+	repo := NewGormFineRepository(db)
+	assert.NoError(t, repo.Charge(&models.Fines{LoanID: 1, UserID: 1, Amount: 100}))
+
+	// two librarians take the same payment, only one gets through
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, 2)
+	)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = repo.Settle(1, &models.FineEntries{Kind: models.FinePayment, Amount: 60})
+		}(i)
+	}
+	wg.Wait()
+
+	assert.ElementsMatch(t, []error{nil, ErrExceedsBalance}, errs)
+	fine, err := repo.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), fine.Balance)
+	entries, err := repo.Entries(1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,437 @@
+package repositories
+
+import (
+	"errors"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// checkoutAttempts is how often Checkout picks another copy when the one it
+// picked was lent by a concurrent checkout.
+const checkoutAttempts = 3
+
+// assignAttempts is how often assignCopies picks another waiting hold when
+// the one it picked was taken meanwhile.
+const assignAttempts = 3
+
+// errCopyTaken is a checkout that lost the race for its copy.
+var errCopyTaken = errors.New("the copy was lent meanwhile")
+
+// errHoldsBusy is an assignment that kept losing the race for the holds of
+// the book, the caller may try again.
+var errHoldsBusy = apperrors.Conflict("the holds of the book changed meanwhile, try again")
+
+var activeHolds = []string{models.HoldWaiting, models.HoldReady}
+
+type GormLoanRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormLoanRepository(db *gorm.DB) *GormLoanRepository {
+	return &GormLoanRepository{DB: db}
+}
+
+func (r *GormLoanRepository) ListCopies(bookID int) ([]models.Copies, error) {
+	var copies []models.Copies
+	if err := r.DB.Where("book_id = ?", bookID).Order("id").Find(&copies).Error; err != nil {
+		return nil, err
+	}
+	if len(copies) == 0 {
+		return copies, nil
+	}
+
+	var free []uint
+	if err := freeCopies(r.DB, uint(bookID)).Pluck("id", &free).Error; err != nil {
+		return nil, err
+	}
+	for i := range copies {
+		copies[i].Available = containsID(free, copies[i].ID)
+	}
+	return copies, nil
+}
+
+// freeCopies selects the copies of a book that are neither lent nor held.
+func freeCopies(tx *gorm.DB, bookID uint) *gorm.DB {
+	lent := tx.Model(&models.Loans{}).Select("open_copy_id").Where("open_copy_id IS NOT NULL")
+	held := tx.Model(&models.Holds{}).Select("reserved_copy_id").Where("reserved_copy_id IS NOT NULL")
+	return tx.Model(&models.Copies{}).Where("book_id = ? AND id NOT IN (?) AND id NOT IN (?)", bookID, lent, held).Order("id")
+}
+
+func (r *GormLoanRepository) AddCopy(bookCopy *models.Copies, pickupBy time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(bookCopy).Error; err != nil {
+			return err
+		}
+		if err := assignCopies(tx, bookCopy.BookID, pickupBy); err != nil {
+			return err
+		}
+
+		var held int64
+		if err := tx.Model(&models.Holds{}).Where("reserved_copy_id = ?", bookCopy.ID).Count(&held).Error; err != nil {
+			return err
+		}
+		bookCopy.Available = held == 0
+		return nil
+	})
+}
+
+// DeleteCopy moves the copy to the trash, only if it is neither lent nor
+// held.
+func (r *GormLoanRepository) DeleteCopy(id int) error {
+	lent := r.DB.Model(&models.Loans{}).Select("open_copy_id").Where("open_copy_id = ?", id)
+	held := r.DB.Model(&models.Holds{}).Select("reserved_copy_id").Where("reserved_copy_id = ?", id)
+	res := r.DB.Where("id = ? AND NOT EXISTS (?) AND NOT EXISTS (?)", id, lent, held).Delete(&models.Copies{})
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+
+	var count int64
+	if err := r.DB.Model(&models.Copies{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCopyOnLoan
+	}
+	return notFound("copy", id)
+}
+
+func (r *GormLoanRepository) Checkout(bookID, userID int, due time.Time, limit int) (models.Loans, error) {
+	var (
+		loan models.Loans
+		err  error
+	)
+	for attempt := 0; attempt < checkoutAttempts; attempt++ {
+		if loan, err = r.checkout(bookID, userID, due, limit); !errors.Is(err, errCopyTaken) {
+			return loan, err
+		}
+	}
+	return loan, ErrNoCopyAvailable
+}
+
+// checkout lends the copy held for the user or the first free copy. The
+// lock on the user serializes their checkouts so that the limit holds, the
+// unique index on the open copy keeps two users from getting the same copy.
+func (r *GormLoanRepository) checkout(bookID, userID int, due time.Time, limit int) (models.Loans, error) {
+	loan := models.Loans{BookID: uint(bookID), UserID: uint(userID), DueAt: due.Local()}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var open []models.Loans
+		if err := tx.Where("user_id = ? AND returned_at IS NULL", userID).Find(&open).Error; err != nil {
+			return err
+		}
+		for _, other := range open {
+			if other.BookID == uint(bookID) {
+				return ErrAlreadyBorrowed
+			}
+		}
+		if len(open) >= limit {
+			return ErrLoanLimit
+		}
+
+		var hold models.Holds
+		res := tx.Where("book_id = ? AND user_id = ? AND status = ?", bookID, userID, models.HoldReady).Limit(1).Find(&hold)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			loan.CopyID = *hold.ReservedCopyID
+			res = tx.Model(&hold).Where("status = ?", models.HoldReady).
+				Updates(map[string]interface{}{"status": models.HoldFulfilled, "reserved_copy_id": nil})
+			if res.Error != nil {
+				return res.Error
+			}
+			// expired meanwhile, the copy went to the next in line
+			if res.RowsAffected == 0 {
+				return errCopyTaken
+			}
+		} else {
+			var bookCopy models.Copies
+			res = freeCopies(tx, uint(bookID)).Limit(1).Find(&bookCopy)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return ErrNoCopyAvailable
+			}
+			loan.CopyID = bookCopy.ID
+		}
+
+		// a hold the user still waits with is fulfilled too, a copy must not
+		// be held later for someone who has the book
+		err := tx.Model(&models.Holds{}).Where("book_id = ? AND user_id = ? AND status = ?", bookID, userID, models.HoldWaiting).
+			Updates(map[string]interface{}{"status": models.HoldFulfilled, "copy_id": loan.CopyID}).Error
+		if err != nil {
+			return err
+		}
+
+		loan.OpenCopyID = &loan.CopyID
+		if err := tx.Create(&loan).Error; err != nil {
+			if isUniqueViolation(err) {
+				return errCopyTaken
+			}
+			return err
+		}
+		return nil
+	})
+	return loan, err
+}
+
+// lockUser locks the row of the user until the end of tx, sqlite locks the
+// whole database anyway.
+func lockUser(tx *gorm.DB, userID int) error {
+	var user models.Users
+	res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userID).Find(&user)
+	return affected(res, "user", userID)
+}
+
+func (r *GormLoanRepository) Return(bookID, userID int, pickupBy time.Time) (models.Loans, error) {
+	var loan models.Loans
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("book_id = ? AND user_id = ? AND returned_at IS NULL", bookID, userID).Limit(1).Find(&loan)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoOpenLoan
+		}
+
+		// a concurrent return of the same loan closes it only once
+		now := time.Now()
+		res = tx.Model(&loan).Where("returned_at IS NULL").Updates(map[string]interface{}{"returned_at": now, "open_copy_id": nil})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoOpenLoan
+		}
+		loan.ReturnedAt = &now
+		loan.OpenCopyID = nil
+		return assignCopies(tx, loan.BookID, pickupBy)
+	})
+	return loan, err
+}
+
+func (r *GormLoanRepository) List(filter LoanFilter, query ListQuery) ([]models.Loans, Page, error) {
+	db := r.DB
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.BookID != 0 {
+		db = db.Where("book_id = ?", filter.BookID)
+	}
+	if filter.Open || filter.DueBefore != nil {
+		db = db.Where("returned_at IS NULL")
+	}
+	if filter.DueBefore != nil {
+		db = db.Where("due_at < ?", filter.DueBefore.Local())
+	}
+	if filter.ReturnedLateSince != nil {
+		db = db.Where("returned_at >= ? AND returned_at > due_at", filter.ReturnedLateSince.Local())
+	}
+	return listGorm(db, loanFields, query)
+}
+
+func (r *GormLoanRepository) PlaceHold(bookID, userID int) (models.Holds, error) {
+	hold := models.Holds{BookID: uint(bookID), UserID: uint(userID), Status: models.HoldWaiting}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, userID); err != nil {
+			return err
+		}
+
+		var count int64
+		err := tx.Model(&models.Holds{}).Where("book_id = ? AND user_id = ? AND status IN ?", bookID, userID, activeHolds).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyHeld
+		}
+		if err := tx.Model(&models.Loans{}).Where("book_id = ? AND user_id = ? AND returned_at IS NULL", bookID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyBorrowed
+		}
+		if err := freeCopies(tx, uint(bookID)).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrCopyAvailable
+		}
+
+		if err := tx.Create(&hold).Error; err != nil {
+			return err
+		}
+		holds := []models.Holds{hold}
+		if err := setPositions(tx, holds); err != nil {
+			return err
+		}
+		hold = holds[0]
+		return nil
+	})
+	return hold, err
+}
+
+func (r *GormLoanRepository) CancelHold(bookID, userID int, pickupBy time.Time) (models.Holds, error) {
+	var hold models.Holds
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("book_id = ? AND user_id = ? AND status IN ?", bookID, userID, activeHolds).Limit(1).Find(&hold)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoHold
+		}
+
+		res = tx.Model(&hold).Where("status IN ?", activeHolds).
+			Updates(map[string]interface{}{"status": models.HoldCancelled, "reserved_copy_id": nil})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNoHold
+		}
+		hold.Status = models.HoldCancelled
+		hold.ReservedCopyID = nil
+		return assignCopies(tx, hold.BookID, pickupBy)
+	})
+	return hold, err
+}
+
+func (r *GormLoanRepository) ListHolds(filter HoldFilter, query ListQuery) ([]models.Holds, Page, error) {
+	db := r.DB
+	if filter.UserID != 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.BookID != 0 {
+		db = db.Where("book_id = ?", filter.BookID)
+	}
+	if filter.Active {
+		db = db.Where("status IN ?", activeHolds)
+	}
+
+	holds, page, err := listGorm(db, holdFields, query)
+	if err != nil {
+		return nil, page, err
+	}
+	return holds, page, setPositions(r.DB, holds)
+}
+
+// setPositions numbers the waiting holds in the queues of their books.
+func setPositions(db *gorm.DB, holds []models.Holds) error {
+	queues := map[uint][]uint{}
+	for i := range holds {
+		bookID := holds[i].BookID
+		if holds[i].Status != models.HoldWaiting {
+			continue
+		}
+		if _, ok := queues[bookID]; !ok {
+			var queue []uint
+			err := db.Model(&models.Holds{}).Where("book_id = ? AND status = ?", bookID, models.HoldWaiting).Order("id").Pluck("id", &queue).Error
+			if err != nil {
+				return err
+			}
+			queues[bookID] = queue
+		}
+		for position, id := range queues[bookID] {
+			if id == holds[i].ID {
+				holds[i].Position = position + 1
+			}
+		}
+	}
+	return nil
+}
+
+func (r *GormLoanRepository) ExpireHolds(now, pickupBy time.Time) (int64, error) {
+	var expired int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var holds []models.Holds
+		if err := tx.Where("status = ? AND expires_at < ?", models.HoldReady, now.Local()).Order("id").Find(&holds).Error; err != nil {
+			return err
+		}
+
+		books := map[uint]bool{}
+		for _, hold := range holds {
+			res := tx.Model(&hold).Where("status = ?", models.HoldReady).
+				Updates(map[string]interface{}{"status": models.HoldExpired, "reserved_copy_id": nil})
+			if res.Error != nil {
+				return res.Error
+			}
+			expired += res.RowsAffected
+			books[hold.BookID] = true
+		}
+		for bookID := range books {
+			if err := assignCopies(tx, bookID, pickupBy); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return expired, err
+}
+
+// assignCopies holds the free copies of a book for its waiting holds, first
+// come first served, until pickupBy.
+//
+// Assignments of a book take turns on the row of the book. The next waiting
+// hold is read with a locking read, which sees the latest rows even under
+// REPEATABLE READ, and skips the holds a concurrent cancel has locked. A
+// copy held meanwhile clashes on reserved_copy_id and is left to its hold.
+func assignCopies(tx *gorm.DB, bookID uint, pickupBy time.Time) error {
+	var book models.Books
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", bookID).Find(&book).Error; err != nil {
+		return err
+	}
+
+	var free []models.Copies
+	if err := freeCopies(tx, bookID).Find(&free).Error; err != nil {
+		return err
+	}
+
+	for _, bookCopy := range free {
+		for attempt := 0; ; attempt++ {
+			if attempt == assignAttempts {
+				return errHoldsBusy
+			}
+
+			var hold models.Holds
+			res := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("book_id = ? AND status = ?", bookID, models.HoldWaiting).Order("id").Limit(1).Find(&hold)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+
+			// the savepoint keeps the transaction usable after a clash
+			copyID := bookCopy.ID
+			var assigned int64
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				res := tx.Model(&hold).Where("status = ?", models.HoldWaiting).Updates(map[string]interface{}{
+					"status":           models.HoldReady,
+					"copy_id":          copyID,
+					"reserved_copy_id": copyID,
+					"expires_at":       pickupBy.Local(),
+				})
+				assigned = res.RowsAffected
+				return res.Error
+			})
+			if isUniqueViolation(err) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			// a hold taken by a concurrent assignment goes on to the next
+			if assigned > 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
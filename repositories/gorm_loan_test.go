@@ -0,0 +1,305 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/migrations"
+	"learn_testing/models"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newLoanRepositories has users 1 to 3 and a book 1 with two copies in both
+// implementations. The database takes its write lock like the service's.
+func newLoanRepositories(t *testing.T) map[string]LoanRepository {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?_busy_timeout=5000&_txlock=immediate", path)), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	users := NewGormUserRepository(db)
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, users.Create(&models.Users{Name: "user", Email: fmt.Sprintf("user%d@example.com", i)}))
+	}
+
+	pickupBy := time.Now().Add(72 * time.Hour)
+	repos := map[string]LoanRepository{
+		"memory": NewMemoryLoanRepository(),
+		"gorm":   NewGormLoanRepository(db),
+	}
+	for _, repo := range repos {
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, repo.AddCopy(&models.Copies{BookID: 1}, pickupBy))
+		}
+	}
+	return repos
+}
+
+func TestLoanRepository(t *testing.T) {
+	due := time.Now().Add(14 * 24 * time.Hour)
+	pickupBy := time.Now().Add(72 * time.Hour)
+
+	for name, repo := range newLoanRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			loan, err := repo.Checkout(1, 1, due, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), loan.CopyID)
+			assert.Nil(t, loan.ReturnedAt)
+
+			_, err = repo.Checkout(1, 1, due, 5)
+			assert.ErrorIs(t, err, ErrAlreadyBorrowed)
+			loan, err = repo.Checkout(1, 2, due, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(2), loan.CopyID)
+			_, err = repo.Checkout(1, 3, due, 5)
+			assert.ErrorIs(t, err, ErrNoCopyAvailable)
+			_, err = repo.Checkout(2, 3, due, 5)
+			assert.ErrorIs(t, err, ErrNoCopyAvailable)
+
+			copies, err := repo.ListCopies(1)
+			assert.NoError(t, err)
+			assert.Len(t, copies, 2)
+			assert.False(t, copies[0].Available)
+			assert.ErrorIs(t, repo.DeleteCopy(1), ErrCopyOnLoan)
+			assert.ErrorIs(t, repo.DeleteCopy(9), ErrNotFound)
+
+			// the returned copy is the one lent next
+			loan, err = repo.Return(1, 1, pickupBy)
+			assert.NoError(t, err)
+			assert.NotNil(t, loan.ReturnedAt)
+			_, err = repo.Return(1, 1, pickupBy)
+			assert.ErrorIs(t, err, ErrNoOpenLoan)
+			loan, err = repo.Checkout(1, 3, due, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), loan.CopyID)
+
+			// a withdrawn copy is not lent anymore
+			_, err = repo.Return(1, 2, pickupBy)
+			assert.NoError(t, err)
+			assert.NoError(t, repo.DeleteCopy(2))
+			_, err = repo.Checkout(1, 2, due, 5)
+			assert.ErrorIs(t, err, ErrNoCopyAvailable)
+			copies, err = repo.ListCopies(1)
+			assert.NoError(t, err)
+			assert.Len(t, copies, 1)
+
+			// the limit counts open loans only
+			assert.NoError(t, repo.AddCopy(&models.Copies{BookID: 2}, pickupBy))
+			_, err = repo.Checkout(2, 3, due, 1)
+			assert.ErrorIs(t, err, ErrLoanLimit)
+			_, err = repo.Checkout(2, 1, due, 1)
+			assert.NoError(t, err)
+
+			loans, page, err := repo.List(LoanFilter{UserID: 1}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			loans, _, err = repo.List(LoanFilter{UserID: 1, Open: true}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Len(t, loans, 1)
+			assert.Equal(t, uint(2), loans[0].BookID)
+		})
+	}
+}
+
+func TestLoanRepositoryOverdue(t *testing.T) {
+	now := time.Now()
+	pickupBy := now.Add(72 * time.Hour)
+
+	for name, repo := range newLoanRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.Checkout(1, 1, now.Add(-48*time.Hour), 5)
+			assert.NoError(t, err)
+			_, err = repo.Checkout(1, 2, now.Add(-24*time.Hour), 5)
+			assert.NoError(t, err)
+			_, err = repo.Return(1, 2, pickupBy)
+			assert.NoError(t, err)
+			assert.NoError(t, repo.AddCopy(&models.Copies{BookID: 1}, pickupBy))
+			_, err = repo.Checkout(1, 3, now.Add(time.Hour), 5)
+			assert.NoError(t, err)
+
+			// returned loans are not overdue anymore
+			loans, page, err := repo.List(LoanFilter{DueBefore: &now}, ListQuery{Sort: []SortField{{Field: "due_at"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), page.Total)
+			assert.Equal(t, uint(1), loans[0].UserID)
+		})
+	}
+}
+
+func TestLoanRepositoryConcurrentCheckout(t *testing.T) {
+	due := time.Now().Add(time.Hour)
+
+	for name, repo := range newLoanRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			// three users race for two copies
+			var (
+				wg     sync.WaitGroup
+				mu     sync.Mutex
+				copies []uint
+				errs   []error
+			)
+			for user := 1; user <= 3; user++ {
+				wg.Add(1)
+				go func(user int) {
+					defer wg.Done()
+					loan, err := repo.Checkout(1, user, due, 5)
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						errs = append(errs, err)
+						return
+					}
+					copies = append(copies, loan.CopyID)
+				}(user)
+			}
+			wg.Wait()
+
+			assert.ElementsMatch(t, []uint{1, 2}, copies)
+			if assert.Len(t, errs, 1) {
+				assert.ErrorIs(t, errs[0], ErrNoCopyAvailable)
+			}
+		})
+	}
+}
+
+func TestGormLoanRepositoryOpenCopyIsUnique(t *testing.T) {
+	repo := newLoanRepositories(t)["gorm"].(*GormLoanRepository)
+
+	loan, err := repo.Checkout(1, 1, time.Now(), 5)
+	assert.NoError(t, err)
+	pickupBy := time.Now().Add(time.Hour)
+
+	// the index holds even for a writer that skips Checkout
+	err = repo.DB.Create(&models.Loans{BookID: 1, CopyID: loan.CopyID, UserID: 2, OpenCopyID: &loan.CopyID}).Error
+	assert.True(t, isUniqueViolation(err))
+
+	_, err = repo.Return(1, 1, pickupBy)
+	assert.NoError(t, err)
+	err = repo.DB.Create(&models.Loans{BookID: 1, CopyID: loan.CopyID, UserID: 2, OpenCopyID: &loan.CopyID}).Error
+	assert.NoError(t, err)
+}
+
+func TestHoldRepository(t *testing.T) {
+	due := time.Now().Add(14 * 24 * time.Hour)
+	pickupBy := time.Now().Add(72 * time.Hour)
+
+	for name, repo := range newLoanRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := repo.PlaceHold(1, 3)
+			assert.ErrorIs(t, err, ErrCopyAvailable)
+			_, err = repo.Checkout(1, 1, due, 5)
+			assert.NoError(t, err)
+			_, err = repo.PlaceHold(1, 2)
+			assert.ErrorIs(t, err, ErrCopyAvailable)
+			_, err = repo.Checkout(1, 2, due, 5)
+			assert.NoError(t, err)
+			_, err = repo.PlaceHold(1, 1)
+			assert.ErrorIs(t, err, ErrAlreadyBorrowed)
+
+			hold, err := repo.PlaceHold(1, 3)
+			assert.NoError(t, err)
+			assert.Equal(t, models.HoldWaiting, hold.Status)
+			assert.Equal(t, 1, hold.Position)
+			_, err = repo.PlaceHold(1, 3)
+			assert.ErrorIs(t, err, ErrAlreadyHeld)
+
+			// the returned copy waits for the first in line
+			_, err = repo.Return(1, 1, pickupBy)
+			assert.NoError(t, err)
+			hold, err = repo.PlaceHold(1, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, hold.Position)
+
+			holds, _, err := repo.ListHolds(HoldFilter{BookID: 1, Active: true}, ListQuery{})
+			assert.NoError(t, err)
+			if assert.Len(t, holds, 2) {
+				assert.Equal(t, models.HoldReady, holds[0].Status)
+				assert.Equal(t, uint(1), *holds[0].CopyID)
+				assert.WithinDuration(t, pickupBy, *holds[0].ExpiresAt, time.Second)
+				assert.Zero(t, holds[0].Position)
+				assert.Equal(t, models.HoldWaiting, holds[1].Status)
+			}
+			copies, err := repo.ListCopies(1)
+			assert.NoError(t, err)
+			assert.False(t, copies[0].Available)
+			assert.ErrorIs(t, repo.DeleteCopy(1), ErrCopyOnLoan)
+
+			// nobody else takes the held copy
+			_, err = repo.Checkout(1, 1, due, 5)
+			assert.ErrorIs(t, err, ErrNoCopyAvailable)
+			loan, err := repo.Checkout(1, 3, due, 5)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), loan.CopyID)
+			holds, _, err = repo.ListHolds(HoldFilter{UserID: 3}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, models.HoldFulfilled, holds[0].Status)
+
+			// a cancelled hold passes the copy on, an expired one too
+			_, err = repo.Return(1, 2, pickupBy)
+			assert.NoError(t, err)
+			_, err = repo.PlaceHold(1, 2)
+			assert.NoError(t, err)
+			hold, err = repo.CancelHold(1, 1, pickupBy)
+			assert.NoError(t, err)
+			assert.Equal(t, models.HoldCancelled, hold.Status)
+			_, err = repo.CancelHold(1, 1, pickupBy)
+			assert.ErrorIs(t, err, ErrNoHold)
+
+			expired, err := repo.ExpireHolds(time.Now(), pickupBy)
+			assert.NoError(t, err)
+			assert.Zero(t, expired)
+			expired, err = repo.ExpireHolds(pickupBy.Add(time.Minute), pickupBy)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), expired)
+
+			holds, _, err = repo.ListHolds(HoldFilter{UserID: 2}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, models.HoldExpired, holds[0].Status)
+			copies, err = repo.ListCopies(1)
+			assert.NoError(t, err)
+			assert.True(t, copies[1].Available)
+
+			// a new copy goes to the queue first
+			_, err = repo.Checkout(1, 2, due, 5)
+			assert.NoError(t, err)
+			_, err = repo.PlaceHold(1, 1)
+			assert.NoError(t, err)
+			bookCopy := models.Copies{BookID: 1}
+			assert.NoError(t, repo.AddCopy(&bookCopy, pickupBy))
+			assert.False(t, bookCopy.Available)
+			holds, _, err = repo.ListHolds(HoldFilter{UserID: 1, Active: true}, ListQuery{})
+			assert.NoError(t, err)
+			assert.Equal(t, bookCopy.ID, *holds[0].CopyID)
+		})
+	}
+}
+
+func TestGormHoldRepositoryReservedCopyIsUnique(t *testing.T) {
+	repo := newLoanRepositories(t)["gorm"].(*GormLoanRepository)
+
+	copyID := uint(1)
+	assert.NoError(t, repo.DB.Create(&models.Holds{BookID: 1, UserID: 1, Status: models.HoldReady, ReservedCopyID: &copyID}).Error)
+	err := repo.DB.Create(&models.Holds{BookID: 1, UserID: 2, Status: models.HoldReady, ReservedCopyID: &copyID}).Error
+	assert.True(t, isUniqueViolation(err))
+}
+
+func TestGormLoanRepositoryCheckoutFulfilsWaitingHold(t *testing.T) {
+	repo := newLoanRepositories(t)["gorm"].(*GormLoanRepository)
+	due := time.Now().Add(14 * 24 * time.Hour)
+
+	// placed while a return freed a copy, the hold waits next to it
+	assert.NoError(t, repo.DB.Create(&models.Holds{BookID: 1, UserID: 1, Status: models.HoldWaiting}).Error)
+	loan, err := repo.Checkout(1, 1, due, 5)
+	assert.NoError(t, err)
+
+	holds, _, err := repo.ListHolds(HoldFilter{UserID: 1}, ListQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, models.HoldFulfilled, holds[0].Status)
+	assert.Equal(t, loan.CopyID, *holds[0].CopyID)
+}
@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/helpers"
+	"learn_testing/models"
+
+	"gorm.io/gorm"
+)
+
+type GormPublisherRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormPublisherRepository(db *gorm.DB) *GormPublisherRepository {
+	return &GormPublisherRepository{DB: db}
+}
+
+func (r *GormPublisherRepository) List(query ListQuery) ([]models.Publishers, Page, error) {
+	return listGorm(r.DB, publisherFields, query)
+}
+
+func (r *GormPublisherRepository) FindByID(id int) (models.Publishers, error) {
+	var publisher models.Publishers
+	res := r.DB.Where("id = ?", id).Find(&publisher)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return publisher, notFound("publisher", id)
+	}
+	return publisher, res.Error
+}
+
+func (r *GormPublisherRepository) FindByName(name string) (models.Publishers, error) {
+	var publisher models.Publishers
+	res := r.DB.Where("name_key = ?", helpers.NameKey(name)).Order("id").Limit(1).Find(&publisher)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return publisher, fmt.Errorf("publisher %q: %w", name, ErrNotFound)
+	}
+	return publisher, res.Error
+}
+
+func (r *GormPublisherRepository) FindByIDs(ids []uint) ([]models.Publishers, error) {
+	publishers := []models.Publishers{}
+	if len(ids) == 0 {
+		return publishers, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Order("id").Find(&publishers).Error
+	return publishers, err
+}
+
+func (r *GormPublisherRepository) Create(publisher *models.Publishers) error {
+	publisher.NameKey = helpers.NameKey(publisher.Name)
+	return r.DB.Create(publisher).Error
+}
+
+// Update saves the non zero fields of publisher, a new name is written on
+// its books along with it.
+func (r *GormPublisherRepository) Update(id int, publisher models.Publishers) error {
+	values := map[string]interface{}{}
+	if publisher.Name != "" {
+		values["name"] = publisher.Name
+		values["name_key"] = helpers.NameKey(publisher.Name)
+	}
+	// gorm skips an update without values, which affected takes for a
+	// missing publisher
+	if len(values) == 0 {
+		_, err := r.FindByID(id)
+		return err
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := affected(tx.Model(&models.Publishers{}).Where("id = ?", id).Updates(values), "publisher", id); err != nil {
+			return err
+		}
+		books := map[string]interface{}{"publisher": publisher.Name, "version": gorm.Expr("version + 1")}
+		return tx.Unscoped().Model(&models.Books{}).Where("publisher_id = ?", id).UpdateColumns(books).Error
+	})
+}
+
+func (r *GormPublisherRepository) Delete(id int) error {
+	return affected(r.DB.Delete(&models.Publishers{}, "id = ?", id), "publisher", id)
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisherRepository(t *testing.T) {
+	repos := map[string]PublisherRepository{
+		"memory": NewMemoryPublisherRepository(nil),
+		"gorm":   NewGormPublisherRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			for _, name := range []string{"Gollancz", "Bloomsbury"} {
+				assert.NoError(t, repo.Create(&models.Publishers{Name: name}))
+			}
+
+			publishers, page, err := repo.List(ListQuery{Sort: []SortField{{Field: "name"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			assert.Equal(t, "Bloomsbury", publishers[0].Name)
+
+			publishers, _, err = repo.List(ListQuery{Filters: map[string]string{"name": "gollancz"}})
+			assert.NoError(t, err)
+			assert.Len(t, publishers, 1)
+
+			assert.NoError(t, repo.Update(1, models.Publishers{Name: "Gollancz Ltd"}))
+			publisher, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "Gollancz Ltd", publisher.Name)
+			// an update without a name changes nothing
+			assert.NoError(t, repo.Update(1, models.Publishers{}))
+
+			// names match by their helpers.NameKey
+			publisher, err = repo.FindByName("GOLLANCZ LTD")
+			assert.NoError(t, err)
+			assert.Equal(t, uint(1), publisher.ID)
+			_, err = repo.FindByName("Gollancz")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			// unknown ids are left out
+			publishers, err = repo.FindByIDs([]uint{2, 9, 1})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Gollancz Ltd", "Bloomsbury"}, []string{publishers[0].Name, publishers[1].Name})
+			publishers, err = repo.FindByIDs(nil)
+			assert.NoError(t, err)
+			assert.Empty(t, publishers)
+
+			assert.NoError(t, repo.Delete(1))
+			_, err = repo.FindByID(1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Publishers{Name: "x"}), ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Publishers{}), ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(1), ErrNotFound)
+		})
+	}
+}
+
+func TestPublisherRepositoryRenameWritesBooks(t *testing.T) {
+	db := newSQLiteDB(t)
+	memoryBooks := NewMemoryBookRepository()
+	repos := map[string]struct {
+		Publishers PublisherRepository
+		Books      BookRepository
+	}{
+		"memory": {NewMemoryPublisherRepository(memoryBooks), memoryBooks},
+		"gorm":   {NewGormPublisherRepository(db), NewGormBookRepository(db)},
+	}
+
+	for name, repos := range repos {
+		repo, books := repos.Publishers, repos.Books
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Create(&models.Publishers{Name: "Gollancz"}))
+			publisher := uint(1)
+			assert.NoError(t, books.Create(&models.Books{Title: "discworld", Publisher: "Gollancz", PublisherID: &publisher}))
+			assert.NoError(t, books.Create(&models.Books{Title: "sandman", Publisher: "Vertigo"}))
+
+			assert.NoError(t, repo.Update(1, models.Publishers{Name: "Victor Gollancz"}))
+
+			book, err := books.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "Victor Gollancz", book.Publisher)
+			assert.Equal(t, uint(2), book.Version)
+			book, err = books.FindByID(2)
+			assert.NoError(t, err)
+			assert.Equal(t, "Vertigo", book.Publisher)
+		})
+	}
+}
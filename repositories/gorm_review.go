@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"learn_testing/models"
+
+	"gorm.io/gorm"
+)
+
+type GormReviewRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormReviewRepository(db *gorm.DB) *GormReviewRepository {
+	return &GormReviewRepository{DB: db}
+}
+
+func (r *GormReviewRepository) List(bookID int, query ListQuery) ([]models.Reviews, Page, error) {
+	return listGorm(r.DB.Where("book_id = ?", bookID), reviewFields, query)
+}
+
+func (r *GormReviewRepository) FindByID(id int) (models.Reviews, error) {
+	return findReview(r.DB, id)
+}
+
+func findReview(db *gorm.DB, id int) (models.Reviews, error) {
+	var review models.Reviews
+	res := db.Where("id = ?", id).Find(&review)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return review, notFound("review", id)
+	}
+	return review, res.Error
+}
+
+func (r *GormReviewRepository) Create(review *models.Reviews) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrAlreadyReviewed
+			}
+			return err
+		}
+		return rateBook(tx, review.BookID)
+	})
+}
+
+func (r *GormReviewRepository) Update(id int, review models.Reviews) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := findReview(tx, id)
+		if err != nil {
+			return err
+		}
+
+		values := map[string]interface{}{
+			"rating": review.Rating,
+			"body":   review.Body,
+		}
+		if err := affected(tx.Model(&models.Reviews{}).Where("id = ?", id).Updates(values), "review", id); err != nil {
+			return err
+		}
+		return rateBook(tx, stored.BookID)
+	})
+}
+
+func (r *GormReviewRepository) Delete(id int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := findReview(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := affected(tx.Delete(&models.Reviews{}, "id = ?", id), "review", id); err != nil {
+			return err
+		}
+		return rateBook(tx, stored.BookID)
+	})
+}
+
+func (r *GormReviewRepository) Summary(bookID int) (models.RatingSummary, error) {
+	var counts []struct {
+		Rating uint
+		Count  int64
+	}
+	err := r.DB.Model(&models.Reviews{}).Select("rating, COUNT(*) AS count").Where("book_id = ?", bookID).Group("rating").Scan(&counts).Error
+	if err != nil {
+		return models.RatingSummary{}, err
+	}
+
+	histogram := map[uint]int64{}
+	for _, count := range counts {
+		histogram[count.Rating] = count.Count
+	}
+	return models.NewRatingSummary(histogram), nil
+}
+
+// rateBook writes the rating of the book from its reviews in one statement,
+// the last review write to run sees every review committed before it. The
+// rating is derived, it leaves the version alone.
+func rateBook(tx *gorm.DB, bookID uint) error {
+	values := map[string]interface{}{
+		"rating":       gorm.Expr("(SELECT COALESCE(ROUND(AVG(rating), 2), 0) FROM reviews WHERE book_id = ?)", bookID),
+		"rating_count": gorm.Expr("(SELECT COUNT(*) FROM reviews WHERE book_id = ?)", bookID),
+	}
+	return tx.Unscoped().Model(&models.Books{}).Where("id = ?", bookID).UpdateColumns(values).Error
+}
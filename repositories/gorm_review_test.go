@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewRepository(t *testing.T) {
+	db := newSQLiteDB(t)
+	memoryBooks := NewMemoryBookRepository()
+	repos := map[string]struct {
+		Reviews ReviewRepository
+		Books   BookRepository
+	}{
+		"memory": {NewMemoryReviewRepository(memoryBooks), memoryBooks},
+		"gorm":   {NewGormReviewRepository(db), NewGormBookRepository(db)},
+	}
+
+	for name, repos := range repos {
+		repo, books := repos.Reviews, repos.Books
+		t.Run(name, func(t *testing.T) {
+			for _, title := range []string{"mort", "jingo"} {
+				assert.NoError(t, books.Create(&models.Books{Title: title}))
+			}
+
+			for user, rating := range []uint{5, 4, 4} {
+				assert.NoError(t, repo.Create(&models.Reviews{BookID: 1, UserID: uint(user + 1), Rating: rating}))
+			}
+			assert.NoError(t, repo.Create(&models.Reviews{BookID: 2, UserID: 1, Rating: 1}))
+			assert.ErrorIs(t, repo.Create(&models.Reviews{BookID: 1, UserID: 2, Rating: 3}), ErrAlreadyReviewed)
+
+			summary, err := repo.Summary(1)
+			assert.NoError(t, err)
+			assert.Equal(t, models.RatingSummary{Average: 4.33, Count: 3, Histogram: map[uint]int64{1: 0, 2: 0, 3: 0, 4: 2, 5: 1}}, summary)
+
+			// the book is rated along with its reviews, its version stays
+			book, err := books.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, 4.33, book.Rating)
+			assert.Equal(t, int64(3), book.RatingCount)
+			assert.Equal(t, uint(1), book.Version)
+
+			assert.NoError(t, repo.Update(1, models.Reviews{Rating: 2, Body: "it dragged"}))
+			review, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(2), review.Rating)
+			assert.Equal(t, "it dragged", review.Body)
+
+			reviews, page, err := repo.List(1, ListQuery{Sort: []SortField{{Field: "rating", Desc: true}}})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), page.Total)
+			assert.Equal(t, []uint{2, 3, 1}, []uint{reviews[0].ID, reviews[1].ID, reviews[2].ID})
+
+			assert.NoError(t, repo.Delete(1))
+			book, err = books.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, 4.0, book.Rating)
+			assert.Equal(t, int64(2), book.RatingCount)
+
+			_, err = repo.FindByID(1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Update(1, models.Reviews{Rating: 1}), ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(1), ErrNotFound)
+
+			// the user can review the book again
+			assert.NoError(t, repo.Create(&models.Reviews{BookID: 1, UserID: 1, Rating: 3}))
+
+			summary, err = repo.Summary(9)
+			assert.NoError(t, err)
+			assert.Zero(t, summary.Count)
+			assert.Zero(t, summary.Average)
+			assert.Len(t, summary.Histogram, 5)
+		})
+	}
+}
+
+func TestBookRepositorySortByRating(t *testing.T) {
+	for name, repo := range listBookRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			var reviews ReviewRepository
+			switch repo := repo.(type) {
+			case *MemoryBookRepository:
+				reviews = NewMemoryReviewRepository(repo)
+			case *GormBookRepository:
+				reviews = NewGormReviewRepository(repo.DB)
+			}
+			ratings := map[uint][]uint{2: {4, 5}, 3: {3, 3, 3, 4}, 4: {5, 4}}
+			for bookID, ratings := range ratings {
+				for user, rating := range ratings {
+					assert.NoError(t, reviews.Create(&models.Reviews{BookID: bookID, UserID: uint(user + 1), Rating: rating}))
+				}
+			}
+
+			rated, err := repo.FindByID(3)
+			assert.NoError(t, err)
+			assert.Equal(t, 3.25, rated.Rating)
+			assert.Equal(t, int64(4), rated.RatingCount)
+
+			// ties go by id
+			query := ListQuery{Limit: 2, Sort: []SortField{{Field: "rating", Desc: true}}}
+			books, page, err := repo.List(query)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{2, 4}, []uint{books[0].ID, books[1].ID})
+
+			// the cursor carries the rating
+			query.Cursor = page.Next
+			books, _, err = repo.List(query)
+			assert.NoError(t, err)
+			assert.Equal(t, uint(3), books[0].ID)
+			assert.Zero(t, books[1].Rating)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var errNoSharedShelf = fmt.Errorf("shared shelf: %w", ErrNotFound)
+
+type GormShelfRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormShelfRepository(db *gorm.DB) *GormShelfRepository {
+	return &GormShelfRepository{DB: db}
+}
+
+func (r *GormShelfRepository) List(userID int, query ListQuery) ([]models.Shelves, Page, error) {
+	shelves, page, err := listGorm(r.DB.Where("user_id = ?", userID), shelfFields, query)
+	if err != nil {
+		return nil, page, err
+	}
+	return shelves, page, loadShelfBooks(r.DB, shelves)
+}
+
+func (r *GormShelfRepository) FindByID(id int) (models.Shelves, error) {
+	return findShelf(r.DB.Where("id = ?", id), notFound("shelf", id))
+}
+
+func (r *GormShelfRepository) FindByToken(token string) (models.Shelves, error) {
+	return findShelf(r.DB.Where("share_token = ? AND public = ?", token, true), errNoSharedShelf)
+}
+
+func (r *GormShelfRepository) Create(shelf *models.Shelves) error {
+	shelf.BookIDs = []uint{}
+	if err := r.DB.Create(shelf).Error; err != nil {
+		if isUniqueViolation(err) {
+			return ErrShelfNameTaken
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *GormShelfRepository) Update(id int, shelf models.Shelves) error {
+	values := map[string]interface{}{
+		"name":        shelf.Name,
+		"public":      shelf.Public,
+		"share_token": shelf.ShareToken,
+	}
+	err := affected(r.DB.Model(&models.Shelves{}).Where("id = ?", id).Updates(values), "shelf", id)
+	if isUniqueViolation(err) {
+		return ErrShelfNameTaken
+	}
+	return err
+}
+
+func (r *GormShelfRepository) Delete(id int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := affected(tx.Delete(&models.Shelves{}, "id = ?", id), "shelf", id); err != nil {
+			return err
+		}
+		return tx.Where("shelf_id = ?", id).Delete(&models.ShelfBooks{}).Error
+	})
+}
+
+func (r *GormShelfRepository) AddBook(id, bookID, position int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchShelf(tx, id); err != nil {
+			return err
+		}
+
+		var shelved int64
+		if err := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ? AND book_id = ?", id, bookID).Count(&shelved).Error; err != nil {
+			return err
+		}
+		if shelved > 0 {
+			return ErrAlreadyShelved
+		}
+
+		var count int64
+		if err := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if position < 1 || int64(position) > count {
+			position = int(count) + 1
+		}
+
+		shift := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ? AND position >= ?", id, position-1)
+		if err := shift.Update("position", gorm.Expr("position + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ShelfBooks{ShelfID: uint(id), BookID: uint(bookID), Position: position - 1}).Error
+	})
+}
+
+func (r *GormShelfRepository) RemoveBook(id, bookID int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchShelf(tx, id); err != nil {
+			return err
+		}
+
+		var link models.ShelfBooks
+		res := tx.Where("shelf_id = ? AND book_id = ?", id, bookID).Find(&link)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotShelved
+		}
+
+		if err := tx.Where("shelf_id = ? AND book_id = ?", id, bookID).Delete(&models.ShelfBooks{}).Error; err != nil {
+			return err
+		}
+		shift := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ? AND position > ?", id, link.Position)
+		return shift.Update("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+func (r *GormShelfRepository) Reorder(id int, bookIDs []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := touchShelf(tx, id); err != nil {
+			return err
+		}
+
+		var current []uint
+		if err := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ?", id).Order("position").Pluck("book_id", &current).Error; err != nil {
+			return err
+		}
+		order, err := reorder(current, bookIDs)
+		if err != nil {
+			return err
+		}
+
+		for position, bookID := range order {
+			res := tx.Model(&models.ShelfBooks{}).Where("shelf_id = ? AND book_id = ?", id, bookID).Update("position", position)
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+}
+
+// findShelf finds the shelf of db with its books, missing when there is
+// none.
+func findShelf(db *gorm.DB, missing error) (models.Shelves, error) {
+	var shelf models.Shelves
+	res := db.Find(&shelf)
+	if res.Error != nil {
+		return shelf, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return shelf, missing
+	}
+
+	shelves := []models.Shelves{shelf}
+	if err := loadShelfBooks(db.Session(&gorm.Session{NewDB: true}), shelves); err != nil {
+		return shelf, err
+	}
+	return shelves[0], nil
+}
+
+// loadShelfBooks fills in the BookIDs of shelves.
+func loadShelfBooks(db *gorm.DB, shelves []models.Shelves) error {
+	if len(shelves) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(shelves))
+	index := map[uint]int{}
+	for i := range shelves {
+		shelves[i].BookIDs = []uint{}
+		ids[i] = shelves[i].ID
+		index[shelves[i].ID] = i
+	}
+
+	var links []models.ShelfBooks
+	if err := db.Where("shelf_id IN ?", ids).Order("shelf_id, position").Find(&links).Error; err != nil {
+		return err
+	}
+	for _, link := range links {
+		shelf := &shelves[index[link.ShelfID]]
+		shelf.BookIDs = append(shelf.BookIDs, link.BookID)
+	}
+	return nil
+}
+
+// touchShelf bumps the updated_at of the shelf id, which also takes the
+// write lock of the transaction before its books are read.
+func touchShelf(tx *gorm.DB, id int) error {
+	return affected(tx.Model(&models.Shelves{}).Where("id = ?", id).Update("updated_at", time.Now()), "shelf", id)
+}
+
+// reorder returns current with bookIDs moved to the front in their order.
+func reorder(current, bookIDs []uint) ([]uint, error) {
+	on := map[uint]bool{}
+	for _, bookID := range current {
+		on[bookID] = true
+	}
+
+	order := make([]uint, 0, len(current))
+	moved := map[uint]bool{}
+	for _, bookID := range bookIDs {
+		if !on[bookID] {
+			return nil, fmt.Errorf("book %d: %w", bookID, ErrNotShelved)
+		}
+		if !moved[bookID] {
+			order = append(order, bookID)
+			moved[bookID] = true
+		}
+	}
+	for _, bookID := range current {
+		if !moved[bookID] {
+			order = append(order, bookID)
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShelfRepository(t *testing.T) {
+	repos := map[string]ShelfRepository{
+		"memory": NewMemoryShelfRepository(),
+		"gorm":   NewGormShelfRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			toRead := models.Shelves{UserID: 1, Name: "to read"}
+			assert.NoError(t, repo.Create(&toRead))
+			assert.NoError(t, repo.Create(&models.Shelves{UserID: 1, Name: "favourites"}))
+			assert.NoError(t, repo.Create(&models.Shelves{UserID: 2, Name: "to read"}))
+			assert.ErrorIs(t, repo.Create(&models.Shelves{UserID: 1, Name: "to read"}), ErrShelfNameTaken)
+			assert.Equal(t, []uint{}, toRead.BookIDs)
+
+			// books go last unless they are given a place
+			assert.NoError(t, repo.AddBook(1, 10, 0))
+			assert.NoError(t, repo.AddBook(1, 11, 0))
+			assert.NoError(t, repo.AddBook(1, 12, 1))
+			assert.NoError(t, repo.AddBook(1, 13, 3))
+			assert.NoError(t, repo.AddBook(1, 14, 99))
+			assert.ErrorIs(t, repo.AddBook(1, 10, 0), ErrAlreadyShelved)
+			assert.ErrorIs(t, repo.AddBook(9, 10, 0), ErrNotFound)
+
+			shelf, err := repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{12, 10, 13, 11, 14}, shelf.BookIDs)
+
+			assert.NoError(t, repo.RemoveBook(1, 13))
+			assert.ErrorIs(t, repo.RemoveBook(1, 13), ErrNotShelved)
+			assert.NoError(t, repo.Reorder(1, []uint{14, 10}))
+			assert.ErrorIs(t, repo.Reorder(1, []uint{13}), ErrNotShelved)
+			assert.NoError(t, repo.AddBook(1, 15, 2))
+
+			shelf, err = repo.FindByID(1)
+			assert.NoError(t, err)
+			assert.Equal(t, []uint{14, 15, 10, 12, 11}, shelf.BookIDs)
+
+			shelves, page, err := repo.List(1, ListQuery{Sort: []SortField{{Field: "name"}}})
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2), page.Total)
+			assert.Equal(t, "favourites", shelves[0].Name)
+			assert.Equal(t, []uint{}, shelves[0].BookIDs)
+			assert.Equal(t, []uint{14, 15, 10, 12, 11}, shelves[1].BookIDs)
+
+			// only a public shelf is found by its token
+			assert.NoError(t, repo.Update(1, models.Shelves{Name: "to read", ShareToken: "secret"}))
+			_, err = repo.FindByToken("secret")
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.NoError(t, repo.Update(1, models.Shelves{Name: "next up", Public: true, ShareToken: "secret"}))
+			shared, err := repo.FindByToken("secret")
+			assert.NoError(t, err)
+			assert.Equal(t, "next up", shared.Name)
+			assert.Len(t, shared.BookIDs, 5)
+			_, err = repo.FindByToken("other")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			assert.ErrorIs(t, repo.Update(1, models.Shelves{Name: "favourites"}), ErrShelfNameTaken)
+			assert.ErrorIs(t, repo.Update(9, models.Shelves{Name: "x"}), ErrNotFound)
+
+			assert.NoError(t, repo.Delete(1))
+			_, err = repo.FindByID(1)
+			assert.ErrorIs(t, err, ErrNotFound)
+			assert.ErrorIs(t, repo.Delete(1), ErrNotFound)
+			assert.ErrorIs(t, repo.RemoveBook(1, 14), ErrNotFound)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"errors"
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormTokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormTokenRepository(db *gorm.DB) *GormTokenRepository {
+	return &GormTokenRepository{DB: db}
+}
+
+func (r *GormTokenRepository) CreateRefreshToken(token *models.RefreshTokens) error {
+	return r.DB.Create(token).Error
+}
+
+func (r *GormTokenRepository) FindRefreshToken(hash string) (models.RefreshTokens, error) {
+	var token models.RefreshTokens
+	err := r.DB.Where("token_hash = ?", hash).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return token, ErrNotFound
+	}
+	return token, err
+}
+
+func (r *GormTokenRepository) RotateRefreshToken(id uint, next *models.RefreshTokens) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// the used_at condition makes concurrent refreshes with the same
+		// token race for a single winner
+		res := tx.Model(&models.RefreshTokens{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTokenConsumed
+		}
+
+		return tx.Create(next).Error
+	})
+}
+
+func (r *GormTokenRepository) RevokeFamily(familyId string) error {
+	return revokeFamily(r.DB, familyId)
+}
+
+func revokeFamily(db *gorm.DB, familyId string) error {
+	return db.Model(&models.RefreshTokens{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *GormTokenRepository) RevokeUserSessions(userId int, keepFamilyId string) error {
+	return r.DB.Model(&models.RefreshTokens{}).
+		Where("user_id = ? AND family_id <> ? AND revoked_at IS NULL", userId, keepFamilyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *GormTokenRepository) RevokeSession(jti string, expiresAt time.Time, familyId string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		// expired ids are rejected by the jwt middleware anyway
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedTokens{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.RevokedTokens{ID: jti, ExpiresAt: expiresAt}).Error; err != nil {
+			return err
+		}
+		return revokeFamily(tx, familyId)
+	})
+}
+
+func (r *GormTokenRepository) PruneRefreshTokens(before time.Time) (int64, error) {
+	res := r.DB.Unscoped().
+		Where("expires_at < ? OR revoked_at < ?", before, before).
+		Delete(&models.RefreshTokens{})
+	return res.RowsAffected, res.Error
+}
+
+func (r *GormTokenRepository) IsRevoked(jti string, familyId string) (bool, error) {
+	var revoked int64
+	if err := r.DB.Model(&models.RevokedTokens{}).Where("id = ?", jti).Count(&revoked).Error; err != nil {
+		return false, err
+	}
+	if revoked > 0 {
+		return true, nil
+	}
+
+	err := r.DB.Model(&models.RefreshTokens{}).
+		Where("family_id = ? AND revoked_at IS NOT NULL", familyId).
+		Count(&revoked).Error
+	return revoked > 0, err
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGormTokenRepositoryRotateRefreshToken(t *testing.T) {
+	testCase := []struct {
+		Name         string
+		RowsAffected int64
+		ExpectError  error
+	}{
+		{"success", 1, nil},
+		{"already used", 0, ErrTokenConsumed},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			db, mocked := newMockDB(t)
+
+			mocked.ExpectBegin()
+			mocked.ExpectExec(regexp.QuoteMeta("UPDATE `refresh_tokens` SET `used_at`=?,`updated_at`=? WHERE (id = ? AND used_at IS NULL AND revoked_at IS NULL) AND `refresh_tokens`.`deleted_at` IS NULL")).
+				WithArgs(AnyTime{}, AnyTime{}, 1).
+				WillReturnResult(sqlmock.NewResult(0, val.RowsAffected))
+			if val.ExpectError == nil {
+				mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `refresh_tokens`")).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mocked.ExpectCommit()
+			} else {
+				mocked.ExpectRollback()
+			}
+
+			next := models.RefreshTokens{UserID: 1, FamilyID: "family", TokenHash: "hash", ExpiresAt: time.Now()}
+			err := NewGormTokenRepository(db).RotateRefreshToken(1, &next)
+
+			assert.Equal(t, val.ExpectError, err)
+			assert.NoError(t, mocked.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormTokenRepositoryRevokeSession(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `revoked_tokens` WHERE expires_at < ?")).
+		WithArgs(AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `revoked_tokens` (`id`,`expires_at`) VALUES (?,?)")).
+		WithArgs("token-id", AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `refresh_tokens` SET `revoked_at`=?,`updated_at`=? WHERE (family_id = ? AND revoked_at IS NULL)")).
+		WithArgs(AnyTime{}, AnyTime{}, "family").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormTokenRepository(db).RevokeSession("token-id", time.Now().Add(time.Hour), "family")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormTokenRepositoryIsRevoked(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `revoked_tokens` WHERE id = ?")).
+		WithArgs("token-id").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `refresh_tokens` WHERE (family_id = ? AND revoked_at IS NOT NULL) AND `refresh_tokens`.`deleted_at` IS NULL")).
+		WithArgs("family").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	revoked, err := NewGormTokenRepository(db).IsRevoked("token-id", "family")
+
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormTokenRepositoryPruneRefreshTokens(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("DELETE FROM `refresh_tokens` WHERE expires_at < ? OR revoked_at < ?")).
+		WithArgs(AnyTime{}, AnyTime{}).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mocked.ExpectCommit()
+
+	pruned, err := NewGormTokenRepository(db).PruneRefreshTokens(time.Now())
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), pruned)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
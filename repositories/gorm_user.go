@@ -0,0 +1,184 @@
+package repositories
+
+import (
+	"errors"
+	"learn_testing/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GormUserRepository struct {
+	DB *gorm.DB
+}
+
+func NewGormUserRepository(db *gorm.DB) *GormUserRepository {
+	return &GormUserRepository{DB: db}
+}
+
+func (r *GormUserRepository) FindAll() ([]models.Users, error) {
+	var users []models.Users
+	err := r.DB.Find(&users).Error
+	return users, err
+}
+
+func (r *GormUserRepository) List(query ListQuery) ([]models.Users, Page, error) {
+	return listGorm(r.DB, userFields, query)
+}
+
+func (r *GormUserRepository) FindByID(id int) (models.Users, error) {
+	var user models.Users
+	res := r.DB.Where("id = ?", id).Find(&user)
+	if res.Error == nil && res.RowsAffected == 0 {
+		return user, notFound("user", id)
+	}
+	return user, res.Error
+}
+
+func (r *GormUserRepository) FindByEmail(email string) (models.Users, error) {
+	var user models.Users
+	err := r.DB.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *GormUserRepository) Create(user *models.Users) error {
+	user.Version = 1
+	err := r.DB.Create(user).Error
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+// Update saves the non zero fields of user.
+func (r *GormUserRepository) Update(id int, user models.Users) error {
+	values := map[string]interface{}{}
+	if user.Name != "" {
+		values["name"] = user.Name
+	}
+	if user.Email != "" {
+		values["email"] = user.Email
+	}
+	if user.Password != "" {
+		values["password"] = user.Password
+	}
+	if user.Role != "" {
+		values["role"] = user.Role
+	}
+
+	err := versioned(r.DB, &models.Users{}, "user", id, user.Version, values)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r *GormUserRepository) UpdatePassword(id int, hash string) error {
+	return versioned(r.DB, &models.Users{}, "user", id, 0, map[string]interface{}{"password": hash})
+}
+
+func (r *GormUserRepository) RehashPassword(id int, hash string) error {
+	return affected(r.DB.Model(&models.Users{}).Where("id = ?", id).UpdateColumn("password", hash), "user", id)
+}
+
+func (r *GormUserRepository) UpdateRole(id int, role string) error {
+	return versioned(r.DB, &models.Users{}, "user", id, 0, map[string]interface{}{"role": role})
+}
+
+// Delete moves the user to the trash.
+func (r *GormUserRepository) Delete(id int, version uint) error {
+	res := whereVersion(r.DB, version).Delete(&models.Users{}, "id = ?", id)
+	return versionResult(r.DB, res, &models.Users{}, "user", id, version)
+}
+
+func (r *GormUserRepository) Restore(id int) error {
+	res := r.DB.Unscoped().Model(&models.Users{}).Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	return affected(res, "user", id)
+}
+
+func (r *GormUserRepository) Purge(id int) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		if err := tx.Unscoped().Model(&models.Users{}).Where("id = ?", id).Scopes(settledUsers).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			var count int64
+			if err := tx.Unscoped().Model(&models.Users{}).Where("id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return notFound("user", id)
+			}
+			return ErrStillLent
+		}
+		_, err := purgeUsers(tx, ids)
+		return err
+	})
+}
+
+func (r *GormUserRepository) PurgeTrash(before time.Time) (int64, error) {
+	var purged int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&models.Users{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Scopes(settledUsers).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		purged, err = purgeUsers(tx, ids)
+		return err
+	})
+	return purged, err
+}
+
+// settledUsers leaves out the users with a book on loan, a late return not
+// fined yet, a fine left to pay or a copy held for them, which must go back
+// on the shelf first
+func settledUsers(db *gorm.DB) *gorm.DB {
+	lent := db.Session(&gorm.Session{NewDB: true}).Model(&models.Loans{}).Select("user_id").Where("returned_at IS NULL")
+	unfined := unfinedLoans(db).Select("user_id")
+	owed := db.Session(&gorm.Session{NewDB: true}).Model(&models.Fines{}).Select("user_id").Where("balance > 0")
+	held := db.Session(&gorm.Session{NewDB: true}).Model(&models.Holds{}).Select("user_id").Where("status = ?", models.HoldReady)
+	return db.Where("id NOT IN (?)", lent).Where("id NOT IN (?)", unfined).Where("id NOT IN (?)", owed).Where("id NOT IN (?)", held)
+}
+
+// purgeUsers deletes the users ids for good with their loans, holds,
+// reviews, shelves and sessions, and rates again the books they reviewed.
+// Their fines stay, they are the money ledger.
+func purgeUsers(tx *gorm.DB, ids []uint) (int64, error) {
+	var reviewed []uint
+	if err := tx.Model(&models.Reviews{}).Distinct("book_id").Where("user_id IN ?", ids).Pluck("book_id", &reviewed).Error; err != nil {
+		return 0, err
+	}
+
+	shelves := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Shelves{}).Select("id").Where("user_id IN ?", ids)
+	for _, refers := range []struct {
+		model interface{}
+		where string
+		value interface{}
+	}{
+		{&models.Reviews{}, "user_id IN ?", ids},
+		{&models.Holds{}, "user_id IN ?", ids},
+		{&models.Loans{}, "user_id IN ?", ids},
+		{&models.ShelfBooks{}, "shelf_id IN (?)", shelves},
+		{&models.Shelves{}, "user_id IN ?", ids},
+		{&models.RefreshTokens{}, "user_id IN ?", ids},
+	} {
+		if err := tx.Unscoped().Where(refers.where, refers.value).Delete(refers.model).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	for _, bookID := range reviewed {
+		if err := rateBook(tx, bookID); err != nil {
+			return 0, err
+		}
+	}
+	res := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Users{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,257 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGormUserRepositoryFindAll(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	row := sqlmock.NewRows([]string{"name", "email"}).
+		AddRow("ahmad naufal", "ahmad@gmail.com")
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE `users`.`deleted_at` IS NULL")).
+		WillReturnRows(row)
+
+	users, err := NewGormUserRepository(db).FindAll()
+
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, "ahmad naufal", users[0].Name)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryFindByID(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	row := sqlmock.NewRows([]string{"name", "email", "password"}).
+		AddRow("ahmad naufal", "ahmad@gmail.com", "alta@1234")
+
+	mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs(1).
+		WillReturnRows(row)
+
+	user, err := NewGormUserRepository(db).FindByID(1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ahmad naufal", user.Name)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryFindByEmail(t *testing.T) {
+	testCase := []struct {
+		Name        string
+		Rows        *sqlmock.Rows
+		ExpectError error
+	}{
+		{
+			"found",
+			sqlmock.NewRows([]string{"id", "name", "email"}).AddRow(1, "ahmad naufal", "ahmad@gmail.com"),
+			nil,
+		},
+		{
+			"not found",
+			sqlmock.NewRows([]string{"id", "name", "email"}),
+			ErrNotFound,
+		},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			db, mocked := newMockDB(t)
+
+			mocked.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `users` WHERE email = ? AND `users`.`deleted_at` IS NULL ORDER BY `users`.`id` LIMIT 1")).
+				WithArgs("ahmad@gmail.com").
+				WillReturnRows(val.Rows)
+
+			_, err := NewGormUserRepository(db).FindByEmail("ahmad@gmail.com")
+
+			assert.Equal(t, val.ExpectError, err)
+			assert.NoError(t, mocked.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGormUserRepositoryCreate(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("INSERT INTO `users` (`created_at`,`updated_at`,`deleted_at`,`name`,`email`,`password`,`role`,`version`) VALUES (?,?,?,?,?,?,?,?)")).
+		WithArgs(AnyTime{}, AnyTime{}, nil, "ahmad naufal", "ahmad@gmail.com", "hash", models.RoleMember, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	user := models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com", Password: "hash", Role: models.RoleMember}
+	err := NewGormUserRepository(db).Create(&user)
+
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), user.ID)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryUpdate(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `email`=?,`name`=?,`version`=version + 1,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs("ahmad@gmail.com", "ahmad naufal", AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormUserRepository(db).Update(1, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryUpdateRole(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `role`=?,`version`=version + 1,`updated_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs(models.RoleLibrarian, AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormUserRepository(db).UpdateRole(1, models.RoleLibrarian)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryRehashPassword(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `password`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs("hash", 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormUserRepository(db).RehashPassword(1, "hash")
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryDelete(t *testing.T) {
+	db, mocked := newMockDB(t)
+
+	mocked.ExpectBegin()
+	mocked.ExpectExec(regexp.QuoteMeta("UPDATE `users` SET `deleted_at`=? WHERE id = ? AND `users`.`deleted_at` IS NULL")).
+		WithArgs(AnyTime{}, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mocked.ExpectCommit()
+
+	err := NewGormUserRepository(db).Delete(1, 0)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mocked.ExpectationsWereMet())
+}
+
+func TestGormUserRepositoryPurge(t *testing.T) {
+	db := newSQLiteDB(t)
+	users, books, loans := NewGormUserRepository(db), NewGormBookRepository(db), NewGormLoanRepository(db)
+	fines, reviews, shelves := NewGormFineRepository(db), NewGormReviewRepository(db), NewGormShelfRepository(db)
+	now := time.Now()
+
+	for _, name := range []string{"ahmad", "budi"} {
+		assert.NoError(t, users.Create(&models.Users{Name: name, Email: name + "@gmail.com"}))
+	}
+	assert.NoError(t, books.Create(&models.Books{Title: "mort"}))
+	assert.NoError(t, loans.AddCopy(&models.Copies{BookID: 1}, now))
+
+	// budi has the book and is fined for it, ahmad waits for it
+	_, err := loans.Checkout(1, 2, now.Add(-48*time.Hour), 5)
+	assert.NoError(t, err)
+	_, err = loans.PlaceHold(1, 1)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, users.Purge(2), ErrStillLent)
+	loan, err := loans.Return(1, 2, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, users.Purge(2), ErrStillLent)
+	assert.NoError(t, fines.Charge(&models.Fines{LoanID: loan.ID, UserID: 2, BookID: 1, Amount: 20}))
+	assert.ErrorIs(t, users.Purge(2), ErrStillLent)
+
+	// the copy is held for ahmad now
+	assert.ErrorIs(t, users.Purge(1), ErrStillLent)
+	_, err = loans.CancelHold(1, 1, now.Add(time.Hour))
+	assert.NoError(t, err)
+
+	assert.NoError(t, reviews.Create(&models.Reviews{BookID: 1, UserID: 1, Rating: 4}))
+	shelf := models.Shelves{UserID: 1, Name: "to read"}
+	assert.NoError(t, shelves.Create(&shelf))
+	assert.NoError(t, shelves.AddBook(int(shelf.ID), 1, 0))
+
+	// the trash is emptied of the users Purge would take
+	assert.NoError(t, users.Delete(1, 0))
+	assert.NoError(t, users.Delete(2, 0))
+	purged, err := users.PurgeTrash(now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	for _, model := range []interface{}{&models.Holds{}, &models.Reviews{}, &models.Shelves{}, &models.ShelfBooks{}} {
+		var count int64
+		assert.NoError(t, db.Unscoped().Model(model).Count(&count).Error)
+		assert.Zero(t, count, "%T", model)
+	}
+	book, err := books.FindByID(1)
+	assert.NoError(t, err)
+	assert.Zero(t, book.RatingCount)
+
+	_, err = fines.Settle(1, &models.FineEntries{Kind: models.FineWaiver, Amount: 20})
+	assert.NoError(t, err)
+	assert.NoError(t, users.Purge(2))
+	for _, model := range []interface{}{&models.Users{}, &models.Loans{}} {
+		var count int64
+		assert.NoError(t, db.Unscoped().Model(model).Count(&count).Error)
+		assert.Zero(t, count, "%T", model)
+	}
+	// the fines are the money ledger, they stay
+	fine, err := fines.FindByID(1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), fine.UserID)
+	entries, err := fines.Entries(1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.ErrorIs(t, users.Purge(2), ErrNotFound)
+}
+
+func TestUserRepositoryEmailTaken(t *testing.T) {
+	repos := map[string]UserRepository{
+		"memory": NewMemoryUserRepository(),
+		"gorm":   NewGormUserRepository(newSQLiteDB(t)),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, repo.Create(&models.Users{Name: "ahmad", Email: "ahmad@gmail.com"}))
+			assert.NoError(t, repo.Create(&models.Users{Name: "budi", Email: "budi@gmail.com"}))
+
+			err := repo.Create(&models.Users{Name: "copy", Email: "ahmad@gmail.com"})
+			assert.ErrorIs(t, err, ErrEmailTaken)
+
+			err = repo.Update(2, models.Users{Email: "ahmad@gmail.com"})
+			assert.ErrorIs(t, err, ErrEmailTaken)
+
+			// keeping your own email is not a conflict
+			assert.NoError(t, repo.Update(1, models.Users{Name: "ahmad naufal", Email: "ahmad@gmail.com"}))
+
+			// a trashed account keeps its email until it is purged
+			assert.NoError(t, repo.Delete(1, 0))
+			_, err = repo.FindByEmail("ahmad@gmail.com")
+			assert.ErrorIs(t, err, ErrNotFound)
+			err = repo.Create(&models.Users{Name: "copy", Email: "ahmad@gmail.com"})
+			assert.ErrorIs(t, err, ErrEmailTaken)
+
+			assert.NoError(t, repo.Purge(1))
+			assert.NoError(t, repo.Create(&models.Users{Name: "copy", Email: "ahmad@gmail.com"}))
+		})
+	}
+}
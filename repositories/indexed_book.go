@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"learn_testing/search"
+)
+
+var bookSearchWeights = map[string]float64{
+	"title":     3,
+	"author":    2,
+	"publisher": 1,
+}
+
+// IndexedBookRepository keeps a full-text index of the books of the
+// wrapped repository. Writes go to the repository first and are indexed
+// once they succeeded, so the index never holds a book that was not saved.
+type IndexedBookRepository struct {
+	BookRepository
+	Index *search.Index
+}
+
+// NewIndexedBookRepository indexes every book already stored in books.
+func NewIndexedBookRepository(books BookRepository) (*IndexedBookRepository, error) {
+	r := &IndexedBookRepository{BookRepository: books, Index: search.NewIndex(bookSearchWeights)}
+
+	all, err := books.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, book := range all {
+		r.index(book)
+	}
+	return r, nil
+}
+
+func (r *IndexedBookRepository) index(book models.Books) {
+	r.Index.Put(book.ID, map[string]string{
+		"title":     book.Title,
+		"author":    book.Author,
+		"publisher": book.Publisher,
+	})
+}
+
+func (r *IndexedBookRepository) Create(book *models.Books) error {
+	if err := r.BookRepository.Create(book); err != nil {
+		return err
+	}
+	r.index(*book)
+	return nil
+}
+
+// Update re-reads the book, only the non zero fields were written.
+func (r *IndexedBookRepository) Update(id int, book models.Books) error {
+	if err := r.BookRepository.Update(id, book); err != nil {
+		return err
+	}
+	return r.reindex(id)
+}
+
+func (r *IndexedBookRepository) Replace(id int, book models.Books) error {
+	if err := r.BookRepository.Replace(id, book); err != nil {
+		return err
+	}
+	return r.reindex(id)
+}
+
+func (r *IndexedBookRepository) reindex(id int) error {
+	stored, err := r.BookRepository.FindByID(id)
+	if err != nil {
+		return err
+	}
+	r.index(stored)
+	return nil
+}
+
+// Delete and Purge drop the book from the index, trashed books are not
+// searchable.
+func (r *IndexedBookRepository) Delete(id int, version uint) error {
+	if err := r.BookRepository.Delete(id, version); err != nil {
+		return err
+	}
+	r.Index.Remove(uint(id))
+	return nil
+}
+
+func (r *IndexedBookRepository) Purge(id int) error {
+	if err := r.BookRepository.Purge(id); err != nil {
+		return err
+	}
+	r.Index.Remove(uint(id))
+	return nil
+}
+
+func (r *IndexedBookRepository) Restore(id int) error {
+	if err := r.BookRepository.Restore(id); err != nil {
+		return err
+	}
+	return r.reindex(id)
+}
+
+// ReindexAuthor and ReindexPublisher re-read the books of the author or the
+// publisher id, renaming them rewrote the books without going through here.
+func (r *IndexedBookRepository) ReindexAuthor(id int) error {
+	return r.reindexAll(func(query ListQuery) ([]models.Books, Page, error) {
+		return r.BookRepository.ListByAuthor(id, query)
+	})
+}
+
+func (r *IndexedBookRepository) ReindexPublisher(id int) error {
+	return r.reindexAll(func(query ListQuery) ([]models.Books, Page, error) {
+		return r.BookRepository.ListByPublisher(id, query)
+	})
+}
+
+func (r *IndexedBookRepository) reindexAll(list func(ListQuery) ([]models.Books, Page, error)) error {
+	query := ListQuery{Limit: MaxLimit}
+	for {
+		books, page, err := list(query)
+		if err != nil {
+			return err
+		}
+		for _, book := range books {
+			r.index(book)
+		}
+		if page.Next == "" {
+			return nil
+		}
+		query.Cursor = page.Next
+	}
+}
+
+// Search returns up to limit books matching query, best first. Hits on books
+// deleted by another instance since they were indexed are skipped, twice as
+// many hits are read until limit books are found or there are no more.
+func (r *IndexedBookRepository) Search(query string, limit int) ([]models.BookSearchResult, error) {
+	results := []models.BookSearchResult{}
+	read := 0
+	for want := limit; ; want *= 2 {
+		hits := r.Index.Search(query, want)
+
+		ids := make([]uint, 0, len(hits)-read)
+		for _, hit := range hits[read:] {
+			ids = append(ids, hit.ID)
+		}
+		books, err := r.BookRepository.FindByIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[uint]models.Books, len(books))
+		for _, book := range books {
+			found[book.ID] = book
+		}
+
+		for _, hit := range hits[read:] {
+			if book, ok := found[hit.ID]; ok && (limit <= 0 || len(results) < limit) {
+				results = append(results, models.BookSearchResult{Book: book, Score: hit.Score, Highlights: hit.Highlights})
+			}
+		}
+		if limit <= 0 || len(results) == limit || len(hits) < want {
+			return results, nil
+		}
+		read = len(hits)
+	}
+}
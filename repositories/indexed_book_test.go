@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexedBookRepository(t *testing.T) {
+	books := NewMemoryBookRepository()
+	assert.NoError(t, books.Create(&models.Books{Title: "Laskar Pelangi", Author: "Andrea Hirata"}))
+
+	repo, err := NewIndexedBookRepository(books)
+	assert.NoError(t, err)
+
+	// books stored before the index was built are found
+	results, err := repo.Search("pelangi", 10)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "Laskar Pelangi", results[0].Book.Title)
+
+	book := models.Books{Title: "Sang Pemimpi", Author: "Andrea Hirata"}
+	assert.NoError(t, repo.Create(&book))
+	results, _ = repo.Search("andrea", 10)
+	assert.Len(t, results, 2)
+
+	// a partial update keeps the fields that were not sent
+	assert.NoError(t, repo.Update(int(book.ID), models.Books{Title: "Edensor"}))
+	results, _ = repo.Search("pemimpi", 10)
+	assert.Empty(t, results)
+	results, _ = repo.Search("edensor hirata", 10)
+	assert.Len(t, results, 1)
+
+	assert.NoError(t, repo.Delete(int(book.ID), 0))
+	results, _ = repo.Search("edensor", 10)
+	assert.Empty(t, results)
+}
+
+func TestIndexedBookRepositorySearchSkipsDeleted(t *testing.T) {
+	books := NewMemoryBookRepository()
+	repo, err := NewIndexedBookRepository(books)
+	assert.NoError(t, err)
+	for _, title := range []string{"Bumi", "Bulan", "Matahari", "Bintang"} {
+		assert.NoError(t, repo.Create(&models.Books{Title: title, Author: "Tere Liye"}))
+	}
+
+	// deleted by another instance, the index still has them
+	assert.NoError(t, books.Delete(1, 0))
+	assert.NoError(t, books.Delete(2, 0))
+
+	results, err := repo.Search("tere", 2)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	results, _ = repo.Search("tere", 10)
+	assert.Len(t, results, 2)
+}
@@ -0,0 +1,542 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// ErrInvalidQuery is returned by List for unknown fields and bad cursors.
+var ErrInvalidQuery = apperrors.BadRequest("invalid list query")
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery selects a page of rows. Pages are addressed either by Offset or
+// by an opaque Cursor taken from a previous Page, not both. Trashed lists
+// the soft deleted rows instead of the live ones.
+type ListQuery struct {
+	Limit         int
+	Offset        int
+	Cursor        string
+	Sort          []SortField
+	Filters       map[string]string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Trashed       bool
+}
+
+// Page describes the rows returned by List. Next and Prev are cursors for
+// the neighbouring pages, empty when there is none.
+type Page struct {
+	Total int64
+	Next  string
+	Prev  string
+}
+
+// ParseSort reads "title,-created_at", a leading minus sorts descending.
+func ParseSort(s string) []SortField {
+	var fields []SortField
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, "-") {
+			fields = append(fields, SortField{Field: name[1:], Desc: true})
+		} else {
+			fields = append(fields, SortField{Field: strings.TrimPrefix(name, "+")})
+		}
+	}
+	return fields
+}
+
+func formatSort(fields []SortField) string {
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Field
+		if f.Desc {
+			names[i] = "-" + f.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	timeField
+	uintField
+	floatField
+)
+
+// field is a column that can be sorted or filtered on, value reads it from
+// a row for cursors and the memory repositories.
+type field[T any] struct {
+	column     string
+	kind       fieldKind
+	filterable bool
+	value      func(T) interface{}
+}
+
+type fieldSet[T any] map[string]field[T]
+
+var bookFields = fieldSet[models.Books]{
+	"id":         {"id", uintField, false, func(b models.Books) interface{} { return b.ID }},
+	"title":      {"title", stringField, true, func(b models.Books) interface{} { return b.Title }},
+	"rating":     {"rating", floatField, false, func(b models.Books) interface{} { return b.Rating }},
+	"author":     {"author", stringField, true, func(b models.Books) interface{} { return b.Author }},
+	"publisher":  {"publisher", stringField, true, func(b models.Books) interface{} { return b.Publisher }},
+	"created_at": {"created_at", timeField, false, func(b models.Books) interface{} { return b.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(b models.Books) interface{} { return b.UpdatedAt }},
+}
+
+var userFields = fieldSet[models.Users]{
+	"id":         {"id", uintField, false, func(u models.Users) interface{} { return u.ID }},
+	"name":       {"name", stringField, true, func(u models.Users) interface{} { return u.Name }},
+	"email":      {"email", stringField, true, func(u models.Users) interface{} { return u.Email }},
+	"role":       {"role", stringField, true, func(u models.Users) interface{} { return u.Role }},
+	"created_at": {"created_at", timeField, false, func(u models.Users) interface{} { return u.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(u models.Users) interface{} { return u.UpdatedAt }},
+}
+
+var authorFields = fieldSet[models.Authors]{
+	"id":         {"id", uintField, false, func(a models.Authors) interface{} { return a.ID }},
+	"name":       {"name", stringField, true, func(a models.Authors) interface{} { return a.Name }},
+	"created_at": {"created_at", timeField, false, func(a models.Authors) interface{} { return a.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(a models.Authors) interface{} { return a.UpdatedAt }},
+}
+
+var publisherFields = fieldSet[models.Publishers]{
+	"id":         {"id", uintField, false, func(p models.Publishers) interface{} { return p.ID }},
+	"name":       {"name", stringField, true, func(p models.Publishers) interface{} { return p.Name }},
+	"created_at": {"created_at", timeField, false, func(p models.Publishers) interface{} { return p.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(p models.Publishers) interface{} { return p.UpdatedAt }},
+}
+
+var auditFields = fieldSet[models.AuditEvents]{
+	"id":         {"id", uintField, false, func(e models.AuditEvents) interface{} { return e.ID }},
+	"action":     {"action", stringField, true, func(e models.AuditEvents) interface{} { return e.Action }},
+	"created_at": {"created_at", timeField, false, func(e models.AuditEvents) interface{} { return e.CreatedAt }},
+}
+
+var loanFields = fieldSet[models.Loans]{
+	"id":         {"id", uintField, false, func(l models.Loans) interface{} { return l.ID }},
+	"due_at":     {"due_at", timeField, false, func(l models.Loans) interface{} { return l.DueAt }},
+	"created_at": {"created_at", timeField, false, func(l models.Loans) interface{} { return l.CreatedAt }},
+}
+
+var fineFields = fieldSet[models.Fines]{
+	"id":         {"id", uintField, false, func(f models.Fines) interface{} { return f.ID }},
+	"created_at": {"created_at", timeField, false, func(f models.Fines) interface{} { return f.CreatedAt }},
+}
+
+var reviewFields = fieldSet[models.Reviews]{
+	"id":         {"id", uintField, false, func(r models.Reviews) interface{} { return r.ID }},
+	"rating":     {"rating", uintField, false, func(r models.Reviews) interface{} { return r.Rating }},
+	"created_at": {"created_at", timeField, false, func(r models.Reviews) interface{} { return r.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(r models.Reviews) interface{} { return r.UpdatedAt }},
+}
+
+var shelfFields = fieldSet[models.Shelves]{
+	"id":         {"id", uintField, false, func(s models.Shelves) interface{} { return s.ID }},
+	"name":       {"name", stringField, false, func(s models.Shelves) interface{} { return s.Name }},
+	"created_at": {"created_at", timeField, false, func(s models.Shelves) interface{} { return s.CreatedAt }},
+	"updated_at": {"updated_at", timeField, false, func(s models.Shelves) interface{} { return s.UpdatedAt }},
+}
+
+var holdFields = fieldSet[models.Holds]{
+	"id":         {"id", uintField, false, func(h models.Holds) interface{} { return h.ID }},
+	"status":     {"status", stringField, true, func(h models.Holds) interface{} { return h.Status }},
+	"created_at": {"created_at", timeField, false, func(h models.Holds) interface{} { return h.CreatedAt }},
+}
+
+// names lists the sortable fields, for error messages.
+func (fs fieldSet[T]) names() string {
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// cursor is the position after (or, going backward, before) a row: the
+// values of every sort field of that row.
+type cursor struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return c, nil
+}
+
+func formatValue(kind fieldKind, v interface{}) string {
+	switch kind {
+	case timeField:
+		return v.(time.Time).UTC().Format(time.RFC3339Nano)
+	case uintField:
+		return strconv.FormatUint(uint64(v.(uint)), 10)
+	case floatField:
+		return strconv.FormatFloat(v.(float64), 'g', -1, 64)
+	default:
+		return v.(string)
+	}
+}
+
+func parseValue(kind fieldKind, s string) (interface{}, error) {
+	switch kind {
+	case timeField:
+		// rows are written in local time, sqlite compares them as text
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t.Local(), err
+	case uintField:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return uint(n), err
+	case floatField:
+		return strconv.ParseFloat(s, 64)
+	default:
+		return s, nil
+	}
+}
+
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case time.Time:
+		b := b.(time.Time)
+		if a.Before(b) {
+			return -1
+		} else if a.After(b) {
+			return 1
+		}
+		return 0
+	case uint:
+		b := b.(uint)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	case float64:
+		b := b.(float64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	default:
+		return strings.Compare(a.(string), b.(string))
+	}
+}
+
+// plan is a validated ListQuery: the sort always ends with id so that every
+// row has a unique position for the cursor.
+type plan[T any] struct {
+	query  ListQuery
+	fields fieldSet[T]
+	sort   []SortField
+	after  []interface{}
+	cursor cursor
+	offset bool
+}
+
+func newPlan[T any](fields fieldSet[T], q ListQuery) (*plan[T], error) {
+	p := &plan[T]{query: q, fields: fields}
+
+	if p.query.Limit <= 0 {
+		p.query.Limit = DefaultLimit
+	}
+	if p.query.Limit > MaxLimit {
+		p.query.Limit = MaxLimit
+	}
+	if q.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidQuery)
+	}
+	if q.Offset > 0 && q.Cursor != "" {
+		return nil, fmt.Errorf("%w: use either offset or cursor", ErrInvalidQuery)
+	}
+	p.offset = q.Offset > 0
+
+	seen := map[string]bool{}
+	for _, s := range q.Sort {
+		if _, ok := fields[s.Field]; !ok {
+			return nil, fmt.Errorf("%w: can not sort by %q, use one of %s", ErrInvalidQuery, s.Field, fields.names())
+		}
+		if seen[s.Field] {
+			return nil, fmt.Errorf("%w: %q is sorted on twice", ErrInvalidQuery, s.Field)
+		}
+		seen[s.Field] = true
+		p.sort = append(p.sort, s)
+	}
+	if !seen["id"] {
+		p.sort = append(p.sort, SortField{Field: "id"})
+	}
+
+	for name := range q.Filters {
+		if f, ok := fields[name]; !ok || !f.filterable {
+			return nil, fmt.Errorf("%w: can not filter by %q", ErrInvalidQuery, name)
+		}
+	}
+
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != formatSort(p.sort) || len(c.Values) != len(p.sort) {
+			return nil, fmt.Errorf("%w: cursor does not match sort", ErrInvalidQuery)
+		}
+		for i, s := range p.sort {
+			v, err := parseValue(fields[s.Field].kind, c.Values[i])
+			if err != nil {
+				return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+			}
+			p.after = append(p.after, v)
+		}
+		p.cursor = c
+	}
+
+	return p, nil
+}
+
+// order is the sort as run against the data, reversed when walking back.
+func (p *plan[T]) order() []SortField {
+	order := make([]SortField, len(p.sort))
+	for i, s := range p.sort {
+		order[i] = SortField{Field: s.Field, Desc: s.Desc != p.cursor.Backward}
+	}
+	return order
+}
+
+func (p *plan[T]) cursorFor(row T, backward bool) string {
+	c := cursor{Sort: formatSort(p.sort), Backward: backward}
+	for _, s := range p.sort {
+		f := p.fields[s.Field]
+		c.Values = append(c.Values, formatValue(f.kind, f.value(row)))
+	}
+	return c.encode()
+}
+
+// page trims the extra row fetched to detect more data and links the
+// neighbouring pages.
+func (p *plan[T]) page(rows []T, total int64) ([]T, Page) {
+	page := Page{Total: total}
+
+	more := len(rows) > p.query.Limit
+	if more {
+		rows = rows[:p.query.Limit]
+	}
+
+	if p.cursor.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if len(rows) == 0 {
+		return rows, page
+	}
+
+	hasNext, hasPrev := more, p.query.Cursor != "" || p.offset
+	if p.cursor.Backward {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		page.Next = p.cursorFor(rows[len(rows)-1], false)
+	}
+	if hasPrev {
+		page.Prev = p.cursorFor(rows[0], true)
+	}
+	return rows, page
+}
+
+// listGorm runs q against the table of T.
+func listGorm[T any](db *gorm.DB, fields fieldSet[T], q ListQuery) ([]T, Page, error) {
+	p, err := newPlan(fields, q)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	filtered := filterGorm(db, fields, q)
+
+	var total int64
+	if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, Page{}, err
+	}
+
+	tx := filtered.Session(&gorm.Session{})
+	order := p.order()
+	if p.after != nil {
+		where, args := keysetCondition(fields, order, p.after)
+		tx = tx.Where(where, args...)
+	}
+	for _, s := range order {
+		direction := "ASC"
+		if s.Desc {
+			direction = "DESC"
+		}
+		tx = tx.Order(fields[s.Field].column + " " + direction)
+	}
+
+	var rows []T
+	if err := tx.Offset(q.Offset).Limit(p.query.Limit + 1).Find(&rows).Error; err != nil {
+		return nil, Page{}, err
+	}
+
+	rows, page := p.page(rows, total)
+	return rows, page, nil
+}
+
+// filterGorm selects the rows of T that q filters, before paging. The
+// filters must have been checked by newPlan.
+func filterGorm[T any](db *gorm.DB, fields fieldSet[T], q ListQuery) *gorm.DB {
+	filtered := db.Model(new(T))
+	if q.Trashed {
+		filtered = db.Unscoped().Model(new(T)).Where("deleted_at IS NOT NULL")
+	}
+	for name, value := range q.Filters {
+		filtered = filtered.Where(fmt.Sprintf("LOWER(%s) = LOWER(?)", fields[name].column), value)
+	}
+	if q.CreatedAfter != nil {
+		filtered = filtered.Where("created_at > ?", q.CreatedAfter.Local())
+	}
+	if q.CreatedBefore != nil {
+		filtered = filtered.Where("created_at < ?", q.CreatedBefore.Local())
+	}
+	return filtered
+}
+
+// keysetCondition selects the rows after values in the given order:
+// (a > ?) OR (a = ? AND b > ?) OR ... which every database understands,
+// unlike row value comparisons.
+func keysetCondition[T any](fields fieldSet[T], order []SortField, values []interface{}) (string, []interface{}) {
+	var (
+		ors  []string
+		args []interface{}
+	)
+	for i, s := range order {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, fields[order[j].Field].column+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if s.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, fields[s.Field].column+op)
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return strings.Join(ors, " OR "), args
+}
+
+// listMemory runs q against rows the way listGorm would, rows are already
+// the live or the trashed ones as q asks.
+func listMemory[T any](rows []T, fields fieldSet[T], q ListQuery) ([]T, Page, error) {
+	p, err := newPlan(fields, q)
+	if err != nil {
+		return nil, Page{}, err
+	}
+
+	filtered := filterMemory(rows, fields, q)
+
+	order := p.order()
+	compare := func(a T, values []interface{}) int {
+		for i, s := range order {
+			c := compareValues(fields[s.Field].value(a), values[i])
+			if s.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+	valuesOf := func(row T) []interface{} {
+		values := make([]interface{}, len(order))
+		for i, s := range order {
+			values[i] = fields[s.Field].value(row)
+		}
+		return values
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return compare(filtered[i], valuesOf(filtered[j])) < 0
+	})
+
+	total := int64(len(filtered))
+
+	if p.after != nil {
+		start := sort.Search(len(filtered), func(i int) bool { return compare(filtered[i], p.after) > 0 })
+		filtered = filtered[start:]
+	}
+	if q.Offset < len(filtered) {
+		filtered = filtered[q.Offset:]
+	} else {
+		filtered = nil
+	}
+	if len(filtered) > p.query.Limit+1 {
+		filtered = filtered[:p.query.Limit+1]
+	}
+
+	result, page := p.page(append([]T(nil), filtered...), total)
+	return result, page, nil
+}
+
+// filterMemory keeps the rows that q filters, like filterGorm.
+func filterMemory[T any](rows []T, fields fieldSet[T], q ListQuery) []T {
+	created := fields["created_at"]
+	var filtered []T
+	for _, row := range rows {
+		match := true
+		for name, value := range q.Filters {
+			if !strings.EqualFold(fields[name].value(row).(string), value) {
+				match = false
+			}
+		}
+		if q.CreatedAfter != nil && !created.value(row).(time.Time).After(*q.CreatedAfter) {
+			match = false
+		}
+		if q.CreatedBefore != nil && !created.value(row).(time.Time).Before(*q.CreatedBefore) {
+			match = false
+		}
+		if match {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"learn_testing/migrations"
+	"learn_testing/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newSQLiteDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+	return db
+}
+
+// the same books in both implementations, so both must page identically
+func listBookRepositories(t *testing.T) map[string]BookRepository {
+	repos := map[string]BookRepository{
+		"memory": NewMemoryBookRepository(),
+		"gorm":   NewGormBookRepository(newSQLiteDB(t)),
+	}
+
+	books := []models.Books{
+		{Title: "c", Author: "ahmad", Publisher: "gramed"},
+		{Title: "a", Author: "budi", Publisher: "gramed"},
+		{Title: "e", Author: "Ahmad", Publisher: "erlangga"},
+		{Title: "b", Author: "citra", Publisher: "gramed"},
+		{Title: "a", Author: "ahmad", Publisher: "mizan"},
+	}
+	for _, repo := range repos {
+		for _, book := range books {
+			book := book
+			assert.NoError(t, repo.Create(&book))
+		}
+	}
+	return repos
+}
+
+func titles(books []models.Books) []string {
+	var titles []string
+	for _, book := range books {
+		titles = append(titles, book.Title)
+	}
+	return titles
+}
+
+func TestListBooks(t *testing.T) {
+	testCase := []struct {
+		Name        string
+		Query       ListQuery
+		ExpectTotal int64
+		ExpectTitle []string
+	}{
+		{"default order is id", ListQuery{}, 5, []string{"c", "a", "e", "b", "a"}},
+		{"sort", ListQuery{Sort: ParseSort("title,-id")}, 5, []string{"a", "a", "b", "c", "e"}},
+		{"sort descending", ListQuery{Sort: ParseSort("-title")}, 5, []string{"e", "c", "b", "a", "a"}},
+		{"filter ignores case", ListQuery{Filters: map[string]string{"author": "AHMAD"}}, 3, []string{"c", "e", "a"}},
+		{"filters are combined", ListQuery{Filters: map[string]string{"author": "ahmad", "publisher": "gramed"}}, 1, []string{"c"}},
+		{"limit and offset", ListQuery{Limit: 2, Offset: 1}, 5, []string{"a", "e"}},
+		{"created after", ListQuery{CreatedAfter: &time.Time{}}, 5, []string{"c", "a", "e", "b", "a"}},
+	}
+
+	for name, repo := range listBookRepositories(t) {
+		for _, val := range testCase {
+			t.Run(name+" "+val.Name, func(t *testing.T) {
+				books, page, err := repo.List(val.Query)
+				assert.NoError(t, err)
+				assert.Equal(t, val.ExpectTotal, page.Total)
+				assert.Equal(t, val.ExpectTitle, titles(books))
+			})
+		}
+	}
+}
+
+func TestListBooksCursor(t *testing.T) {
+	for name, repo := range listBookRepositories(t) {
+		t.Run(name, func(t *testing.T) {
+			query := ListQuery{Limit: 2, Sort: ParseSort("-title")}
+
+			// walk forward
+			var pages [][]string
+			var page Page
+			for {
+				books, next, err := repo.List(query)
+				assert.NoError(t, err)
+				pages = append(pages, titles(books))
+				page = next
+				if next.Next == "" {
+					break
+				}
+				query.Cursor = next.Next
+			}
+			assert.Equal(t, [][]string{{"e", "c"}, {"b", "a"}, {"a"}}, pages)
+
+			// and back from the last page
+			query.Cursor = page.Prev
+			books, page, err := repo.List(query)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"b", "a"}, titles(books))
+
+			query.Cursor = page.Prev
+			books, page, err = repo.List(query)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"e", "c"}, titles(books))
+			assert.Empty(t, page.Prev)
+			assert.NotEmpty(t, page.Next)
+		})
+	}
+}
+
+func TestListInvalidQuery(t *testing.T) {
+	repo := listBookRepositories(t)["memory"]
+	_, page, err := repo.List(ListQuery{Limit: 1})
+	assert.NoError(t, err)
+
+	testCase := []struct {
+		Name  string
+		Query ListQuery
+	}{
+		{"unknown sort field", ListQuery{Sort: ParseSort("password")}},
+		{"sorted twice", ListQuery{Sort: ParseSort("title,-title")}},
+		{"unknown filter", ListQuery{Filters: map[string]string{"password": "x"}}},
+		{"malformed cursor", ListQuery{Cursor: "not a cursor"}},
+		{"cursor of another sort", ListQuery{Cursor: page.Next, Sort: ParseSort("title")}},
+		{"cursor and offset", ListQuery{Cursor: page.Next, Offset: 1}},
+	}
+
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			_, _, err := repo.List(val.Query)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sync"
+	"time"
+)
+
+// MemoryAuditRepository keeps the audit trail in a slice, it is meant for
+// tests and running the service without a database.
+type MemoryAuditRepository struct {
+	mu     sync.RWMutex
+	events []models.AuditEvents
+}
+
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+func (r *MemoryAuditRepository) Record(event *models.AuditEvents) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.ID = uint(len(r.events) + 1)
+	event.CreatedAt = time.Now()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *MemoryAuditRepository) History(entityType string, entityID uint, query ListQuery) ([]models.AuditEvents, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var events []models.AuditEvents
+	for _, event := range r.events {
+		if event.EntityType == entityType && event.EntityID == entityID {
+			events = append(events, event)
+		}
+	}
+	return listMemory(events, auditFields, query)
+}
+
+func (r *MemoryAuditRepository) FindEvent(id int) (models.AuditEvents, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if id < 1 || id > len(r.events) {
+		return models.AuditEvents{}, notFound("audit event", id)
+	}
+	return r.events[id-1], nil
+}
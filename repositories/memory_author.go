@@ -0,0 +1,126 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/helpers"
+	"learn_testing/models"
+	"sync"
+	"time"
+)
+
+// MemoryAuthorRepository keeps authors in a map, it is meant for tests and
+// running the service without a database. Books gets the new names of the
+// authors and links its books to them by name, nil keeps them nowhere.
+type MemoryAuthorRepository struct {
+	Books *MemoryBookRepository
+
+	mu      sync.RWMutex
+	authors map[uint]models.Authors
+	nextID  uint
+}
+
+func NewMemoryAuthorRepository(books *MemoryBookRepository) *MemoryAuthorRepository {
+	r := &MemoryAuthorRepository{Books: books, authors: map[uint]models.Authors{}, nextID: 1}
+	if books != nil {
+		books.authors = r
+	}
+	return r
+}
+
+func (r *MemoryAuthorRepository) List(query ListQuery) ([]models.Authors, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	authors := make([]models.Authors, 0, len(r.authors))
+	for _, author := range r.authors {
+		authors = append(authors, author)
+	}
+	return listMemory(authors, authorFields, query)
+}
+
+func (r *MemoryAuthorRepository) FindByID(id int) (models.Authors, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	author, ok := r.authors[uint(id)]
+	if !ok {
+		return models.Authors{}, notFound("author", id)
+	}
+	return author, nil
+}
+
+func (r *MemoryAuthorRepository) FindByName(name string) (models.Authors, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	author, ok := r.findByKey(helpers.NameKey(name))
+	if !ok {
+		return models.Authors{}, fmt.Errorf("author %q: %w", name, ErrNotFound)
+	}
+	return author, nil
+}
+
+// findByKey is FindByName for a helpers.NameKey, the caller holds the lock.
+func (r *MemoryAuthorRepository) findByKey(key string) (models.Authors, bool) {
+	var found *models.Authors
+	for _, author := range r.authors {
+		if author.NameKey == key && (found == nil || author.ID < found.ID) {
+			author := author
+			found = &author
+		}
+	}
+	if found == nil {
+		return models.Authors{}, false
+	}
+	return *found, true
+}
+
+func (r *MemoryAuthorRepository) Create(author *models.Authors) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	author.NameKey = helpers.NameKey(author.Name)
+	author.ID = r.nextID
+	author.CreatedAt = now
+	author.UpdatedAt = now
+	r.nextID++
+
+	r.authors[author.ID] = *author
+	return nil
+}
+
+func (r *MemoryAuthorRepository) Update(id int, author models.Authors) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.authors[uint(id)]
+	if !ok {
+		return notFound("author", id)
+	}
+	if author.Name != "" {
+		stored.Name = author.Name
+		stored.NameKey = helpers.NameKey(author.Name)
+	}
+	stored.UpdatedAt = time.Now()
+	r.authors[stored.ID] = stored
+
+	if author.Name != "" && r.Books != nil {
+		r.Books.creditAuthor(stored.ID, func(id uint) (string, bool) {
+			author, ok := r.authors[id]
+			return author.Name, ok
+		})
+	}
+	return nil
+}
+
+func (r *MemoryAuthorRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.authors[uint(id)]; !ok {
+		return notFound("author", id)
+	}
+	delete(r.authors, uint(id))
+	return nil
+}
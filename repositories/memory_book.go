@@ -0,0 +1,517 @@
+package repositories
+
+import (
+	"learn_testing/helpers"
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryBookRepository keeps books in a map, it is meant for tests and
+// running the service without a database. The author and publisher
+// repositories made for it link its books by name, without them the names
+// stay unlinked.
+type MemoryBookRepository struct {
+	authors    *MemoryAuthorRepository
+	publishers *MemoryPublisherRepository
+
+	mu     sync.RWMutex
+	books  map[uint]models.Books
+	nextID uint
+}
+
+func NewMemoryBookRepository() *MemoryBookRepository {
+	return &MemoryBookRepository{books: map[uint]models.Books{}, nextID: 1}
+}
+
+// rows returns the live or the trashed books.
+func (r *MemoryBookRepository) rows(trashed bool) []models.Books {
+	books := make([]models.Books, 0, len(r.books))
+	for _, book := range r.books {
+		if book.DeletedAt.Valid == trashed {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
+func (r *MemoryBookRepository) FindAll() ([]models.Books, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := r.rows(false)
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books, nil
+}
+
+func (r *MemoryBookRepository) List(query ListQuery) ([]models.Books, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return listMemory(r.rows(query.Trashed), bookFields, query)
+}
+
+func (r *MemoryBookRepository) Filter(filter BookFilter, query ListQuery) ([]models.Books, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return listMemory(r.filter(filter, query.Trashed), bookFields, query)
+}
+
+func (r *MemoryBookRepository) Facets(filter BookFilter, query ListQuery) (models.BookFacets, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := newPlan(bookFields, query); err != nil {
+		return models.BookFacets{}, err
+	}
+
+	categories, publishers, tags := map[uint]int64{}, map[uint]int64{}, map[string]int64{}
+	for _, book := range filterMemory(r.filter(filter, query.Trashed), bookFields, query) {
+		if book.CategoryID != nil {
+			categories[*book.CategoryID]++
+		}
+		if book.PublisherID != nil {
+			publishers[*book.PublisherID]++
+		}
+		for _, tag := range book.Tags {
+			tags[tag]++
+		}
+	}
+
+	facets := models.BookFacets{Categories: []models.FacetCount{}, Tags: []models.FacetCount{}, Publishers: []models.FacetCount{}}
+	for id, count := range categories {
+		facets.Categories = append(facets.Categories, models.FacetCount{ID: id, Count: count})
+	}
+	for id, count := range publishers {
+		facets.Publishers = append(facets.Publishers, models.FacetCount{ID: id, Count: count})
+	}
+	for tag, count := range tags {
+		facets.Tags = append(facets.Tags, models.FacetCount{Name: tag, Count: count})
+	}
+	facets.Categories = topFacets(facets.Categories)
+	facets.Publishers = topFacets(facets.Publishers)
+	facets.Tags = topFacets(facets.Tags)
+	return facets, nil
+}
+
+// topFacets keeps the FacetLimit values with the most books, in the order
+// of GormBookRepository.Facets.
+func topFacets(counts []models.FacetCount) []models.FacetCount {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		if counts[i].ID != counts[j].ID {
+			return counts[i].ID < counts[j].ID
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	if len(counts) > FacetLimit {
+		counts = counts[:FacetLimit]
+	}
+	return counts
+}
+
+// filter returns the live or the trashed books of filter.
+func (r *MemoryBookRepository) filter(filter BookFilter, trashed bool) []models.Books {
+	var books []models.Books
+	for _, book := range r.rows(trashed) {
+		if len(filter.CategoryIDs) > 0 && (book.CategoryID == nil || !containsID(filter.CategoryIDs, *book.CategoryID)) {
+			continue
+		}
+		tagged := true
+		for _, tag := range filter.Tags {
+			tagged = tagged && containsTag(book.Tags, tag)
+		}
+		if tagged {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, v := range tags {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryBookRepository) ListByAuthor(authorID int, query ListQuery) ([]models.Books, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var books []models.Books
+	for _, book := range r.rows(query.Trashed) {
+		if containsID(book.AuthorIDs, uint(authorID)) {
+			books = append(books, book)
+		}
+	}
+	return listMemory(books, bookFields, query)
+}
+
+func (r *MemoryBookRepository) ListByPublisher(publisherID int, query ListQuery) ([]models.Books, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var books []models.Books
+	for _, book := range r.rows(query.Trashed) {
+		if book.PublisherID != nil && *book.PublisherID == uint(publisherID) {
+			books = append(books, book)
+		}
+	}
+	return listMemory(books, bookFields, query)
+}
+
+func (r *MemoryBookRepository) FindByID(id int) (models.Books, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	book, ok := r.books[uint(id)]
+	if !ok || book.DeletedAt.Valid {
+		return models.Books{}, notFound("book", id)
+	}
+	return book, nil
+}
+
+func (r *MemoryBookRepository) FindByIDs(ids []uint) ([]models.Books, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	books := []models.Books{}
+	for _, book := range r.rows(false) {
+		if wanted[book.ID] {
+			books = append(books, book)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+	return books, nil
+}
+
+func (r *MemoryBookRepository) FindByISBN(isbn string) (models.Books, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, book := range r.rows(false) {
+		if string(book.ISBN) == isbn {
+			return book, nil
+		}
+	}
+	return models.Books{}, ErrNotFound
+}
+
+// isbnTaken is the unique index on isbn, trashed books keep theirs.
+func (r *MemoryBookRepository) isbnTaken(isbn models.NullableString, id uint) bool {
+	if isbn == "" {
+		return false
+	}
+	for _, book := range r.books {
+		if book.ISBN == isbn && book.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryBookRepository) Create(book *models.Books) error {
+	return r.linked(book, func() error { return r.create(book) })
+}
+
+func (r *MemoryBookRepository) create(book *models.Books) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isbnTaken(book.ISBN, 0) {
+		return ErrISBNTaken
+	}
+
+	now := time.Now()
+	book.ID = r.nextID
+	book.Version = 1
+	book.Rating, book.RatingCount = 0, 0
+	book.AuthorIDs = append([]uint{}, book.AuthorIDs...)
+	book.Tags = append([]string{}, book.Tags...)
+	book.CreatedAt = now
+	book.UpdatedAt = now
+	r.nextID++
+
+	r.books[book.ID] = *book
+	return nil
+}
+
+func (r *MemoryBookRepository) Update(id int, book models.Books) error {
+	return r.linked(&book, func() error { return r.update(id, book) })
+}
+
+func (r *MemoryBookRepository) update(id int, book models.Books) error {
+	return r.modify(id, book.Version, func(stored *models.Books) error {
+		if r.isbnTaken(book.ISBN, stored.ID) {
+			return ErrISBNTaken
+		}
+
+		if book.Title != "" {
+			stored.Title = book.Title
+		}
+		// the credited names go with the links, even when they are empty
+		if book.Author != "" || book.AuthorIDs != nil {
+			stored.Author = book.Author
+		}
+		if book.Publisher != "" || book.PublisherID != nil {
+			stored.Publisher = book.Publisher
+		}
+		if book.ISBN != "" {
+			stored.ISBN = book.ISBN
+			stored.ISBN10 = book.ISBN10
+		}
+		if book.AuthorIDs != nil {
+			stored.AuthorIDs = append([]uint{}, book.AuthorIDs...)
+		}
+		if book.PublisherID != nil {
+			stored.PublisherID = book.PublisherID
+		}
+		if book.CategoryID != nil {
+			stored.CategoryID = book.CategoryID
+		}
+		if book.Tags != nil {
+			stored.Tags = append([]string{}, book.Tags...)
+		}
+		return nil
+	})
+}
+
+func (r *MemoryBookRepository) Replace(id int, book models.Books) error {
+	return r.linked(&book, func() error { return r.replace(id, book) })
+}
+
+func (r *MemoryBookRepository) replace(id int, book models.Books) error {
+	return r.modify(id, book.Version, func(stored *models.Books) error {
+		if r.isbnTaken(book.ISBN, stored.ID) {
+			return ErrISBNTaken
+		}
+
+		stored.Title = book.Title
+		stored.Author = book.Author
+		stored.Publisher = book.Publisher
+		stored.ISBN = book.ISBN
+		stored.ISBN10 = book.ISBN10
+		stored.AuthorIDs = append([]uint{}, book.AuthorIDs...)
+		stored.PublisherID = book.PublisherID
+		stored.CategoryID = book.CategoryID
+		stored.Tags = append([]string{}, book.Tags...)
+		return nil
+	})
+}
+
+// linked links book to the authors and the publisher it names in
+// LinkAuthors and LinkPublisher and runs write. The ones that do not exist
+// yet are only added when write succeeds, their repositories stay locked
+// until then and are locked before the books like their updates do.
+func (r *MemoryBookRepository) linked(book *models.Books, write func() error) error {
+	var authors []models.Authors
+	if book.LinkAuthors != nil && r.authors != nil {
+		r.authors.mu.Lock()
+		defer r.authors.mu.Unlock()
+
+		ids, names := []uint{}, []string{}
+		seen := map[uint]bool{}
+		for _, name := range book.LinkAuthors {
+			key := helpers.NameKey(name)
+			// a name may be credited twice, in another spelling
+			author, ok := r.authors.findByKey(key)
+			for i := 0; i < len(authors) && !ok; i++ {
+				if authors[i].NameKey == key {
+					author, ok = authors[i], true
+				}
+			}
+			if !ok {
+				author = models.Authors{Name: name, NameKey: key}
+				author.ID = r.authors.nextID + uint(len(authors))
+				authors = append(authors, author)
+			}
+			if !seen[author.ID] {
+				seen[author.ID] = true
+				ids, names = append(ids, author.ID), append(names, author.Name)
+			}
+		}
+		book.AuthorIDs, book.Author = ids, helpers.JoinAuthors(names)
+	}
+
+	var publisher *models.Publishers
+	if book.LinkPublisher != "" && r.publishers != nil {
+		r.publishers.mu.Lock()
+		defer r.publishers.mu.Unlock()
+
+		key := helpers.NameKey(book.LinkPublisher)
+		found, ok := r.publishers.findByKey(key)
+		if !ok {
+			found = models.Publishers{Name: book.LinkPublisher, NameKey: key}
+			found.ID = r.publishers.nextID
+			publisher = &found
+		}
+		book.PublisherID, book.Publisher = &found.ID, found.Name
+	}
+
+	if err := write(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, author := range authors {
+		author.CreatedAt, author.UpdatedAt = now, now
+		r.authors.authors[author.ID] = author
+		r.authors.nextID++
+	}
+	if publisher != nil {
+		publisher.CreatedAt, publisher.UpdatedAt = now, now
+		r.publishers.publishers[publisher.ID] = *publisher
+		r.publishers.nextID++
+	}
+	return nil
+}
+
+// rate writes the review summary of the book, trashed or not. The rating is
+// derived, it leaves the version alone.
+func (r *MemoryBookRepository) rate(id int, rating float64, count int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[uint(id)]
+	if !ok {
+		return notFound("book", id)
+	}
+	stored.Rating = rating
+	stored.RatingCount = count
+	r.books[stored.ID] = stored
+	return nil
+}
+
+// creditAuthor rewrites the author text of the books, trashed or not, that
+// credit the author id, name gives the name of each of their authors.
+func (r *MemoryBookRepository) creditAuthor(id uint, name func(uint) (string, bool)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, book := range r.books {
+		if !containsID(book.AuthorIDs, id) {
+			continue
+		}
+		var names []string
+		for _, authorID := range book.AuthorIDs {
+			if name, ok := name(authorID); ok {
+				names = append(names, name)
+			}
+		}
+		book.Author = helpers.JoinAuthors(names)
+		book.Version++
+		r.books[book.ID] = book
+	}
+}
+
+// publish rewrites the publisher text of the books, trashed or not, that the
+// publisher id published.
+func (r *MemoryBookRepository) publish(id uint, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, book := range r.books {
+		if book.PublisherID != nil && *book.PublisherID == id {
+			book.Publisher = name
+			book.Version++
+			r.books[book.ID] = book
+		}
+	}
+}
+
+func (r *MemoryBookRepository) modify(id int, version uint, fn func(*models.Books) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[uint(id)]
+	if !ok || stored.DeletedAt.Valid {
+		return notFound("book", id)
+	}
+	if version != 0 && stored.Version != version {
+		return ErrVersionMismatch
+	}
+
+	if err := fn(&stored); err != nil {
+		return err
+	}
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	r.books[stored.ID] = stored
+	return nil
+}
+
+// Delete moves the book to the trash.
+func (r *MemoryBookRepository) Delete(id int, version uint) error {
+	return r.setDeleted(id, false, version, gorm.DeletedAt{Time: time.Now(), Valid: true})
+}
+
+// Restore bumps the version, the book comes back changed.
+func (r *MemoryBookRepository) Restore(id int) error {
+	return r.setDeleted(id, true, 0, gorm.DeletedAt{})
+}
+
+func (r *MemoryBookRepository) setDeleted(id int, trashed bool, version uint, deletedAt gorm.DeletedAt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.books[uint(id)]
+	if !ok || stored.DeletedAt.Valid != trashed {
+		return notFound("book", id)
+	}
+	if version != 0 && stored.Version != version {
+		return ErrVersionMismatch
+	}
+	if trashed {
+		stored.Version++
+	}
+	stored.DeletedAt = deletedAt
+	r.books[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryBookRepository) Purge(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.books[uint(id)]; !ok {
+		return notFound("book", id)
+	}
+	delete(r.books, uint(id))
+	return nil
+}
+
+func (r *MemoryBookRepository) PurgeTrash(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, book := range r.books {
+		if book.DeletedAt.Valid && book.DeletedAt.Time.Before(before) {
+			delete(r.books, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryCategoryRepository keeps categories in a map, it is meant for tests
+// and running the service without a database.
+type MemoryCategoryRepository struct {
+	mu         sync.RWMutex
+	categories map[uint]models.Categories
+	nextID     uint
+}
+
+func NewMemoryCategoryRepository() *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{categories: map[uint]models.Categories{}, nextID: 1}
+}
+
+func (r *MemoryCategoryRepository) FindAll() ([]models.Categories, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	categories := make([]models.Categories, 0, len(r.categories))
+	for _, category := range r.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if categories[i].Name != categories[j].Name {
+			return categories[i].Name < categories[j].Name
+		}
+		return categories[i].ID < categories[j].ID
+	})
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) FindByID(id int) (models.Categories, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	category, ok := r.categories[uint(id)]
+	if !ok {
+		return models.Categories{}, notFound("category", id)
+	}
+	return category, nil
+}
+
+func (r *MemoryCategoryRepository) FindByIDs(ids []uint) ([]models.Categories, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	categories := []models.Categories{}
+	for _, category := range r.categories {
+		if wanted[category.ID] {
+			categories = append(categories, category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+	return categories, nil
+}
+
+func (r *MemoryCategoryRepository) Create(category *models.Categories) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	category.ID = r.nextID
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	r.nextID++
+
+	r.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Update(id int, category models.Categories) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.categories[uint(id)]
+	if !ok {
+		return notFound("category", id)
+	}
+	stored.Name = category.Name
+	stored.ParentID = category.ParentID
+	stored.FineDailyRate = category.FineDailyRate
+	stored.FineCap = category.FineCap
+	stored.UpdatedAt = time.Now()
+	r.categories[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.categories[uint(id)]; !ok {
+		return notFound("category", id)
+	}
+	delete(r.categories, uint(id))
+	return nil
+}
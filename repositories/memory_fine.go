@@ -0,0 +1,162 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryFineRepository keeps fines and their entries in maps, it is meant
+// for tests and running the service without a database.
+type MemoryFineRepository struct {
+	mu          sync.RWMutex
+	fines       map[uint]models.Fines
+	entries     map[uint][]models.FineEntries
+	nextID      uint
+	nextEntryID uint
+}
+
+func NewMemoryFineRepository() *MemoryFineRepository {
+	return &MemoryFineRepository{
+		fines:       map[uint]models.Fines{},
+		entries:     map[uint][]models.FineEntries{},
+		nextID:      1,
+		nextEntryID: 1,
+	}
+}
+
+func (r *MemoryFineRepository) Charge(fine *models.Fines) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.fines {
+		if other.LoanID == fine.LoanID {
+			return ErrLoanFined
+		}
+	}
+
+	now := time.Now()
+	fine.ID = r.nextID
+	fine.Paid, fine.Waived = 0, 0
+	fine.Balance = fine.Amount
+	fine.CreatedAt = now
+	fine.UpdatedAt = now
+	r.nextID++
+
+	r.fines[fine.ID] = *fine
+	return nil
+}
+
+func (r *MemoryFineRepository) FindByID(id int) (models.Fines, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fine, ok := r.fines[uint(id)]
+	if !ok {
+		return models.Fines{}, notFound("fine", id)
+	}
+	return fine, nil
+}
+
+func (r *MemoryFineRepository) List(filter FineFilter, query ListQuery) ([]models.Fines, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var fines []models.Fines
+	for _, fine := range r.fines {
+		switch {
+		case filter.UserID != 0 && fine.UserID != filter.UserID:
+		case filter.LoanID != 0 && fine.LoanID != filter.LoanID:
+		case filter.Outstanding && fine.Balance == 0:
+		default:
+			fines = append(fines, fine)
+		}
+	}
+	return listMemory(fines, fineFields, query)
+}
+
+func (r *MemoryFineRepository) Balance(userID int) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var balance int64
+	for _, fine := range r.fines {
+		if fine.UserID == uint(userID) {
+			balance += fine.Balance
+		}
+	}
+	return balance, nil
+}
+
+func (r *MemoryFineRepository) Settle(fineID int, entry *models.FineEntries) (models.Fines, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fine, ok := r.fines[uint(fineID)]
+	if !ok {
+		return models.Fines{}, notFound("fine", fineID)
+	}
+	if entry.Amount > fine.Balance {
+		return models.Fines{}, ErrExceedsBalance
+	}
+
+	now := time.Now()
+	if entry.Kind == models.FineWaiver {
+		fine.Waived += entry.Amount
+	} else {
+		fine.Paid += entry.Amount
+	}
+	fine.Balance -= entry.Amount
+	fine.UpdatedAt = now
+	r.fines[fine.ID] = fine
+
+	entry.ID = r.nextEntryID
+	entry.FineID = fine.ID
+	entry.CreatedAt = now
+	r.nextEntryID++
+	r.entries[fine.ID] = append(r.entries[fine.ID], *entry)
+	return fine, nil
+}
+
+func (r *MemoryFineRepository) Entries(fineID int) ([]models.FineEntries, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]models.FineEntries{}, r.entries[uint(fineID)]...), nil
+}
+
+func (r *MemoryFineRepository) Report(from, to *time.Time) (models.FineReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := models.FineReport{Debtors: []models.FineDebtor{}}
+	owed := map[uint]int64{}
+	for _, fine := range r.fines {
+		if (from != nil && fine.CreatedAt.Before(*from)) || (to != nil && !fine.CreatedAt.Before(*to)) {
+			continue
+		}
+		report.Fines++
+		report.Charged += fine.Amount
+		report.Paid += fine.Paid
+		report.Waived += fine.Waived
+		report.Outstanding += fine.Balance
+		owed[fine.UserID] += fine.Balance
+	}
+
+	for userID, balance := range owed {
+		if balance > 0 {
+			report.Debtors = append(report.Debtors, models.FineDebtor{UserID: userID, Balance: balance})
+		}
+	}
+	sort.Slice(report.Debtors, func(i, j int) bool {
+		if report.Debtors[i].Balance != report.Debtors[j].Balance {
+			return report.Debtors[i].Balance > report.Debtors[j].Balance
+		}
+		return report.Debtors[i].UserID < report.Debtors[j].UserID
+	})
+	if len(report.Debtors) > ReportLimit {
+		report.Debtors = report.Debtors[:ReportLimit]
+	}
+	return report, nil
+}
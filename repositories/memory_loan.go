@@ -0,0 +1,365 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryLoanRepository keeps copies, loans and holds in maps, it is meant
+// for tests and running the service without a database. The lock makes a
+// checkout atomic, users are not checked.
+type MemoryLoanRepository struct {
+	mu     sync.RWMutex
+	copies map[uint]models.Copies
+	loans  map[uint]models.Loans
+	holds  map[uint]models.Holds
+	// lent maps the copies on loan to their open loan, held the copies
+	// held for a user to their ready hold
+	lent       map[uint]uint
+	held       map[uint]uint
+	nextCopyID uint
+	nextLoanID uint
+	nextHoldID uint
+}
+
+func NewMemoryLoanRepository() *MemoryLoanRepository {
+	return &MemoryLoanRepository{
+		copies:     map[uint]models.Copies{},
+		loans:      map[uint]models.Loans{},
+		holds:      map[uint]models.Holds{},
+		lent:       map[uint]uint{},
+		held:       map[uint]uint{},
+		nextCopyID: 1,
+		nextLoanID: 1,
+		nextHoldID: 1,
+	}
+}
+
+// bookCopies returns the copies of a book that are not withdrawn, in the
+// order they were added.
+func (r *MemoryLoanRepository) bookCopies(bookID int) []models.Copies {
+	copies := []models.Copies{}
+	for _, c := range r.copies {
+		if c.BookID == uint(bookID) && !c.DeletedAt.Valid {
+			_, onLoan := r.lent[c.ID]
+			_, onHold := r.held[c.ID]
+			c.Available = !onLoan && !onHold
+			copies = append(copies, c)
+		}
+	}
+	sort.Slice(copies, func(i, j int) bool { return copies[i].ID < copies[j].ID })
+	return copies
+}
+
+func (r *MemoryLoanRepository) ListCopies(bookID int) ([]models.Copies, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.bookCopies(bookID), nil
+}
+
+func (r *MemoryLoanRepository) AddCopy(bookCopy *models.Copies, pickupBy time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	bookCopy.ID = r.nextCopyID
+	bookCopy.CreatedAt = now
+	bookCopy.UpdatedAt = now
+	bookCopy.Available = true
+	r.nextCopyID++
+
+	r.copies[bookCopy.ID] = *bookCopy
+	r.assignCopies(bookCopy.BookID, pickupBy)
+	_, onHold := r.held[bookCopy.ID]
+	bookCopy.Available = !onHold
+	return nil
+}
+
+func (r *MemoryLoanRepository) DeleteCopy(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.copies[uint(id)]
+	if !ok || stored.DeletedAt.Valid {
+		return notFound("copy", id)
+	}
+	_, onLoan := r.lent[stored.ID]
+	_, onHold := r.held[stored.ID]
+	if onLoan || onHold {
+		return ErrCopyOnLoan
+	}
+	stored.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.copies[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryLoanRepository) Checkout(bookID, userID int, due time.Time, limit int) (models.Loans, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	open := 0
+	for _, loan := range r.loans {
+		if loan.UserID != uint(userID) || loan.ReturnedAt != nil {
+			continue
+		}
+		if loan.BookID == uint(bookID) {
+			return models.Loans{}, ErrAlreadyBorrowed
+		}
+		open++
+	}
+	if open >= limit {
+		return models.Loans{}, ErrLoanLimit
+	}
+
+	now := time.Now()
+	copyID, ok := uint(0), false
+	if hold, found := r.activeHold(bookID, userID); found && hold.Status == models.HoldReady {
+		copyID, ok = *hold.ReservedCopyID, true
+		delete(r.held, copyID)
+		hold.Status = models.HoldFulfilled
+		hold.ReservedCopyID = nil
+		hold.UpdatedAt = now
+		r.holds[hold.ID] = hold
+	} else {
+		for _, c := range r.bookCopies(bookID) {
+			if c.Available {
+				copyID, ok = c.ID, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return models.Loans{}, ErrNoCopyAvailable
+	}
+	// a hold the user still waits with is fulfilled too, a copy must not be
+	// held later for someone who has the book
+	for id, hold := range r.holds {
+		if hold.BookID == uint(bookID) && hold.UserID == uint(userID) && hold.Status == models.HoldWaiting {
+			hold.Status = models.HoldFulfilled
+			hold.CopyID = &copyID
+			hold.UpdatedAt = now
+			r.holds[id] = hold
+		}
+	}
+
+	loan := models.Loans{
+		ID:         r.nextLoanID,
+		BookID:     uint(bookID),
+		CopyID:     copyID,
+		UserID:     uint(userID),
+		DueAt:      due,
+		OpenCopyID: &copyID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.nextLoanID++
+
+	r.loans[loan.ID] = loan
+	r.lent[copyID] = loan.ID
+	return loan, nil
+}
+
+func (r *MemoryLoanRepository) Return(bookID, userID int, pickupBy time.Time) (models.Loans, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, loan := range r.loans {
+		if loan.BookID != uint(bookID) || loan.UserID != uint(userID) || loan.ReturnedAt != nil {
+			continue
+		}
+
+		now := time.Now()
+		loan.ReturnedAt = &now
+		loan.OpenCopyID = nil
+		loan.UpdatedAt = now
+		r.loans[id] = loan
+		delete(r.lent, loan.CopyID)
+		r.assignCopies(loan.BookID, pickupBy)
+		return loan, nil
+	}
+	return models.Loans{}, ErrNoOpenLoan
+}
+
+func (r *MemoryLoanRepository) List(filter LoanFilter, query ListQuery) ([]models.Loans, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var loans []models.Loans
+	for _, loan := range r.loans {
+		switch {
+		case filter.UserID != 0 && loan.UserID != filter.UserID:
+		case filter.BookID != 0 && loan.BookID != filter.BookID:
+		case (filter.Open || filter.DueBefore != nil) && loan.ReturnedAt != nil:
+		case filter.DueBefore != nil && !loan.DueAt.Before(*filter.DueBefore):
+		case filter.ReturnedLateSince != nil && (loan.ReturnedAt == nil || loan.ReturnedAt.Before(*filter.ReturnedLateSince) || !loan.ReturnedAt.After(loan.DueAt)):
+		default:
+			loans = append(loans, loan)
+		}
+	}
+	return listMemory(loans, loanFields, query)
+}
+
+// activeHold returns the waiting or ready hold of the user on the book.
+func (r *MemoryLoanRepository) activeHold(bookID, userID int) (models.Holds, bool) {
+	for _, hold := range r.holds {
+		if hold.BookID == uint(bookID) && hold.UserID == uint(userID) && isActiveHold(hold) {
+			return hold, true
+		}
+	}
+	return models.Holds{}, false
+}
+
+func isActiveHold(hold models.Holds) bool {
+	return hold.Status == models.HoldWaiting || hold.Status == models.HoldReady
+}
+
+// queue returns the waiting holds on a book, first come first.
+func (r *MemoryLoanRepository) queue(bookID uint) []models.Holds {
+	var queue []models.Holds
+	for _, hold := range r.holds {
+		if hold.BookID == bookID && hold.Status == models.HoldWaiting {
+			queue = append(queue, hold)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].ID < queue[j].ID })
+	return queue
+}
+
+func (r *MemoryLoanRepository) PlaceHold(bookID, userID int) (models.Holds, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.activeHold(bookID, userID); found {
+		return models.Holds{}, ErrAlreadyHeld
+	}
+	for _, loan := range r.loans {
+		if loan.BookID == uint(bookID) && loan.UserID == uint(userID) && loan.ReturnedAt == nil {
+			return models.Holds{}, ErrAlreadyBorrowed
+		}
+	}
+	for _, c := range r.bookCopies(bookID) {
+		if c.Available {
+			return models.Holds{}, ErrCopyAvailable
+		}
+	}
+
+	now := time.Now()
+	hold := models.Holds{
+		ID:        r.nextHoldID,
+		BookID:    uint(bookID),
+		UserID:    uint(userID),
+		Status:    models.HoldWaiting,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.nextHoldID++
+	r.holds[hold.ID] = hold
+
+	hold.Position = len(r.queue(hold.BookID))
+	return hold, nil
+}
+
+func (r *MemoryLoanRepository) CancelHold(bookID, userID int, pickupBy time.Time) (models.Holds, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, found := r.activeHold(bookID, userID)
+	if !found {
+		return models.Holds{}, ErrNoHold
+	}
+	r.closeHold(hold, models.HoldCancelled)
+	r.assignCopies(hold.BookID, pickupBy)
+	return r.holds[hold.ID], nil
+}
+
+// closeHold ends a hold with status and frees the copy held for it.
+func (r *MemoryLoanRepository) closeHold(hold models.Holds, status string) {
+	if hold.ReservedCopyID != nil {
+		delete(r.held, *hold.ReservedCopyID)
+	}
+	hold.Status = status
+	hold.ReservedCopyID = nil
+	hold.UpdatedAt = time.Now()
+	r.holds[hold.ID] = hold
+}
+
+func (r *MemoryLoanRepository) ListHolds(filter HoldFilter, query ListQuery) ([]models.Holds, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var holds []models.Holds
+	for _, hold := range r.holds {
+		switch {
+		case filter.UserID != 0 && hold.UserID != filter.UserID:
+		case filter.BookID != 0 && hold.BookID != filter.BookID:
+		case filter.Active && !isActiveHold(hold):
+		default:
+			holds = append(holds, hold)
+		}
+	}
+
+	holds, page, err := listMemory(holds, holdFields, query)
+	if err != nil {
+		return nil, page, err
+	}
+	for i := range holds {
+		if holds[i].Status != models.HoldWaiting {
+			continue
+		}
+		for position, waiting := range r.queue(holds[i].BookID) {
+			if waiting.ID == holds[i].ID {
+				holds[i].Position = position + 1
+			}
+		}
+	}
+	return holds, page, nil
+}
+
+func (r *MemoryLoanRepository) ExpireHolds(now, pickupBy time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired int64
+	books := map[uint]bool{}
+	for _, hold := range r.holds {
+		if hold.Status == models.HoldReady && hold.ExpiresAt.Before(now) {
+			r.closeHold(hold, models.HoldExpired)
+			books[hold.BookID] = true
+			expired++
+		}
+	}
+	for bookID := range books {
+		r.assignCopies(bookID, pickupBy)
+	}
+	return expired, nil
+}
+
+// assignCopies holds the free copies of a book for its waiting holds, first
+// come first served, until pickupBy.
+func (r *MemoryLoanRepository) assignCopies(bookID uint, pickupBy time.Time) {
+	queue := r.queue(bookID)
+	for _, c := range r.bookCopies(int(bookID)) {
+		if len(queue) == 0 {
+			return
+		}
+		if !c.Available {
+			continue
+		}
+
+		hold := queue[0]
+		queue = queue[1:]
+		copyID := c.ID
+		hold.Status = models.HoldReady
+		hold.CopyID = &copyID
+		hold.ReservedCopyID = &copyID
+		hold.ExpiresAt = &pickupBy
+		hold.UpdatedAt = time.Now()
+		r.holds[hold.ID] = hold
+		r.held[copyID] = hold.ID
+	}
+}
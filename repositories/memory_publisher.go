@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"fmt"
+	"learn_testing/helpers"
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryPublisherRepository keeps publishers in a map, it is meant for tests and
+// running the service without a database. Books gets the new names of the
+// publishers and links its books to them by name, nil keeps them nowhere.
+type MemoryPublisherRepository struct {
+	Books *MemoryBookRepository
+
+	mu         sync.RWMutex
+	publishers map[uint]models.Publishers
+	nextID     uint
+}
+
+func NewMemoryPublisherRepository(books *MemoryBookRepository) *MemoryPublisherRepository {
+	r := &MemoryPublisherRepository{Books: books, publishers: map[uint]models.Publishers{}, nextID: 1}
+	if books != nil {
+		books.publishers = r
+	}
+	return r
+}
+
+func (r *MemoryPublisherRepository) List(query ListQuery) ([]models.Publishers, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	publishers := make([]models.Publishers, 0, len(r.publishers))
+	for _, publisher := range r.publishers {
+		publishers = append(publishers, publisher)
+	}
+	return listMemory(publishers, publisherFields, query)
+}
+
+func (r *MemoryPublisherRepository) FindByID(id int) (models.Publishers, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	publisher, ok := r.publishers[uint(id)]
+	if !ok {
+		return models.Publishers{}, notFound("publisher", id)
+	}
+	return publisher, nil
+}
+
+func (r *MemoryPublisherRepository) FindByName(name string) (models.Publishers, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	publisher, ok := r.findByKey(helpers.NameKey(name))
+	if !ok {
+		return models.Publishers{}, fmt.Errorf("publisher %q: %w", name, ErrNotFound)
+	}
+	return publisher, nil
+}
+
+// findByKey is FindByName for a helpers.NameKey, the caller holds the lock.
+func (r *MemoryPublisherRepository) findByKey(key string) (models.Publishers, bool) {
+	var found *models.Publishers
+	for _, publisher := range r.publishers {
+		if publisher.NameKey == key && (found == nil || publisher.ID < found.ID) {
+			publisher := publisher
+			found = &publisher
+		}
+	}
+	if found == nil {
+		return models.Publishers{}, false
+	}
+	return *found, true
+}
+
+func (r *MemoryPublisherRepository) FindByIDs(ids []uint) ([]models.Publishers, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wanted := map[uint]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	publishers := []models.Publishers{}
+	for _, publisher := range r.publishers {
+		if wanted[publisher.ID] {
+			publishers = append(publishers, publisher)
+		}
+	}
+	sort.Slice(publishers, func(i, j int) bool { return publishers[i].ID < publishers[j].ID })
+	return publishers, nil
+}
+
+func (r *MemoryPublisherRepository) Create(publisher *models.Publishers) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	publisher.NameKey = helpers.NameKey(publisher.Name)
+	publisher.ID = r.nextID
+	publisher.CreatedAt = now
+	publisher.UpdatedAt = now
+	r.nextID++
+
+	r.publishers[publisher.ID] = *publisher
+	return nil
+}
+
+func (r *MemoryPublisherRepository) Update(id int, publisher models.Publishers) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.publishers[uint(id)]
+	if !ok {
+		return notFound("publisher", id)
+	}
+	if publisher.Name != "" {
+		stored.Name = publisher.Name
+		stored.NameKey = helpers.NameKey(publisher.Name)
+	}
+	stored.UpdatedAt = time.Now()
+	r.publishers[stored.ID] = stored
+
+	if publisher.Name != "" && r.Books != nil {
+		r.Books.publish(stored.ID, stored.Name)
+	}
+	return nil
+}
+
+func (r *MemoryPublisherRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.publishers[uint(id)]; !ok {
+		return notFound("publisher", id)
+	}
+	delete(r.publishers, uint(id))
+	return nil
+}
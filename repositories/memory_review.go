@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"errors"
+	"learn_testing/models"
+	"sync"
+	"time"
+)
+
+// MemoryReviewRepository keeps reviews in a map, it is meant for tests and
+// running the service without a database. Books gets the ratings, nil
+// keeps them nowhere.
+type MemoryReviewRepository struct {
+	Books *MemoryBookRepository
+
+	mu      sync.RWMutex
+	reviews map[uint]models.Reviews
+	nextID  uint
+}
+
+func NewMemoryReviewRepository(books *MemoryBookRepository) *MemoryReviewRepository {
+	return &MemoryReviewRepository{Books: books, reviews: map[uint]models.Reviews{}, nextID: 1}
+}
+
+func (r *MemoryReviewRepository) List(bookID int, query ListQuery) ([]models.Reviews, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var reviews []models.Reviews
+	for _, review := range r.reviews {
+		if review.BookID == uint(bookID) {
+			reviews = append(reviews, review)
+		}
+	}
+	return listMemory(reviews, reviewFields, query)
+}
+
+func (r *MemoryReviewRepository) FindByID(id int) (models.Reviews, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	review, ok := r.reviews[uint(id)]
+	if !ok {
+		return models.Reviews{}, notFound("review", id)
+	}
+	return review, nil
+}
+
+func (r *MemoryReviewRepository) Create(review *models.Reviews) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.reviews {
+		if other.BookID == review.BookID && other.UserID == review.UserID {
+			return ErrAlreadyReviewed
+		}
+	}
+
+	now := time.Now()
+	review.ID = r.nextID
+	review.CreatedAt = now
+	review.UpdatedAt = now
+	r.nextID++
+
+	r.reviews[review.ID] = *review
+	return r.rate(review.BookID)
+}
+
+func (r *MemoryReviewRepository) Update(id int, review models.Reviews) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.reviews[uint(id)]
+	if !ok {
+		return notFound("review", id)
+	}
+	stored.Rating = review.Rating
+	stored.Body = review.Body
+	stored.UpdatedAt = time.Now()
+	r.reviews[stored.ID] = stored
+	return r.rate(stored.BookID)
+}
+
+func (r *MemoryReviewRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.reviews[uint(id)]
+	if !ok {
+		return notFound("review", id)
+	}
+	delete(r.reviews, uint(id))
+	return r.rate(stored.BookID)
+}
+
+func (r *MemoryReviewRepository) Summary(bookID int) (models.RatingSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.summary(bookID), nil
+}
+
+// rate writes the rating of the book while the reviews are locked, a book
+// that was purged has none to write.
+func (r *MemoryReviewRepository) rate(bookID uint) error {
+	if r.Books == nil {
+		return nil
+	}
+	summary := r.summary(int(bookID))
+	err := r.Books.rate(int(bookID), summary.Average, summary.Count)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *MemoryReviewRepository) summary(bookID int) models.RatingSummary {
+	histogram := map[uint]int64{}
+	for _, review := range r.reviews {
+		if review.BookID == uint(bookID) {
+			histogram[review.Rating]++
+		}
+	}
+	return models.NewRatingSummary(histogram)
+}
@@ -0,0 +1,188 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sync"
+	"time"
+)
+
+// MemoryShelfRepository keeps shelves in a map, it is meant for tests and
+// running the service without a database.
+type MemoryShelfRepository struct {
+	mu      sync.RWMutex
+	shelves map[uint]models.Shelves
+	nextID  uint
+}
+
+func NewMemoryShelfRepository() *MemoryShelfRepository {
+	return &MemoryShelfRepository{shelves: map[uint]models.Shelves{}, nextID: 1}
+}
+
+func (r *MemoryShelfRepository) List(userID int, query ListQuery) ([]models.Shelves, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var shelves []models.Shelves
+	for _, shelf := range r.shelves {
+		if shelf.UserID == uint(userID) {
+			shelves = append(shelves, copyShelf(shelf))
+		}
+	}
+	return listMemory(shelves, shelfFields, query)
+}
+
+func (r *MemoryShelfRepository) FindByID(id int) (models.Shelves, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	shelf, ok := r.shelves[uint(id)]
+	if !ok {
+		return models.Shelves{}, notFound("shelf", id)
+	}
+	return copyShelf(shelf), nil
+}
+
+func (r *MemoryShelfRepository) FindByToken(token string) (models.Shelves, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, shelf := range r.shelves {
+		if shelf.Public && shelf.ShareToken != "" && string(shelf.ShareToken) == token {
+			return copyShelf(shelf), nil
+		}
+	}
+	return models.Shelves{}, errNoSharedShelf
+}
+
+func (r *MemoryShelfRepository) Create(shelf *models.Shelves) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.taken(0, *shelf) {
+		return ErrShelfNameTaken
+	}
+
+	now := time.Now()
+	shelf.ID = r.nextID
+	shelf.BookIDs = []uint{}
+	shelf.CreatedAt = now
+	shelf.UpdatedAt = now
+	r.nextID++
+
+	r.shelves[shelf.ID] = copyShelf(*shelf)
+	return nil
+}
+
+func (r *MemoryShelfRepository) Update(id int, shelf models.Shelves) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.shelves[uint(id)]
+	if !ok {
+		return notFound("shelf", id)
+	}
+	shelf.UserID = stored.UserID
+	if r.taken(stored.ID, shelf) {
+		return ErrShelfNameTaken
+	}
+
+	stored.Name = shelf.Name
+	stored.Public = shelf.Public
+	stored.ShareToken = shelf.ShareToken
+	stored.UpdatedAt = time.Now()
+	r.shelves[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryShelfRepository) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.shelves[uint(id)]; !ok {
+		return notFound("shelf", id)
+	}
+	delete(r.shelves, uint(id))
+	return nil
+}
+
+func (r *MemoryShelfRepository) AddBook(id, bookID, position int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shelf, ok := r.shelves[uint(id)]
+	if !ok {
+		return notFound("shelf", id)
+	}
+	for _, other := range shelf.BookIDs {
+		if other == uint(bookID) {
+			return ErrAlreadyShelved
+		}
+	}
+	if position < 1 || position > len(shelf.BookIDs) {
+		position = len(shelf.BookIDs) + 1
+	}
+
+	bookIDs := make([]uint, 0, len(shelf.BookIDs)+1)
+	bookIDs = append(bookIDs, shelf.BookIDs[:position-1]...)
+	bookIDs = append(bookIDs, uint(bookID))
+	bookIDs = append(bookIDs, shelf.BookIDs[position-1:]...)
+	r.setBooks(shelf, bookIDs)
+	return nil
+}
+
+func (r *MemoryShelfRepository) RemoveBook(id, bookID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shelf, ok := r.shelves[uint(id)]
+	if !ok {
+		return notFound("shelf", id)
+	}
+	for i, other := range shelf.BookIDs {
+		if other == uint(bookID) {
+			bookIDs := append(append([]uint{}, shelf.BookIDs[:i]...), shelf.BookIDs[i+1:]...)
+			r.setBooks(shelf, bookIDs)
+			return nil
+		}
+	}
+	return ErrNotShelved
+}
+
+func (r *MemoryShelfRepository) Reorder(id int, bookIDs []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shelf, ok := r.shelves[uint(id)]
+	if !ok {
+		return notFound("shelf", id)
+	}
+	order, err := reorder(shelf.BookIDs, bookIDs)
+	if err != nil {
+		return err
+	}
+	r.setBooks(shelf, order)
+	return nil
+}
+
+// taken reports whether another shelf than id of the user of shelf has its
+// name.
+func (r *MemoryShelfRepository) taken(id uint, shelf models.Shelves) bool {
+	for _, other := range r.shelves {
+		if other.ID != id && other.UserID == shelf.UserID && other.Name == shelf.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryShelfRepository) setBooks(shelf models.Shelves, bookIDs []uint) {
+	shelf.BookIDs = bookIDs
+	shelf.UpdatedAt = time.Now()
+	r.shelves[shelf.ID] = shelf
+}
+
+// copyShelf keeps callers from sharing the BookIDs of the stored shelf.
+func copyShelf(shelf models.Shelves) models.Shelves {
+	shelf.BookIDs = append([]uint{}, shelf.BookIDs...)
+	return shelf
+}
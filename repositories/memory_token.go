@@ -0,0 +1,144 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sync"
+	"time"
+)
+
+// MemoryTokenRepository keeps refresh tokens and revoked token ids in memory,
+// it is meant for tests and running the service without a database.
+type MemoryTokenRepository struct {
+	mu      sync.Mutex
+	tokens  map[uint]models.RefreshTokens
+	revoked map[string]time.Time
+	nextID  uint
+}
+
+func NewMemoryTokenRepository() *MemoryTokenRepository {
+	return &MemoryTokenRepository{
+		tokens:  map[uint]models.RefreshTokens{},
+		revoked: map[string]time.Time{},
+		nextID:  1,
+	}
+}
+
+func (r *MemoryTokenRepository) CreateRefreshToken(token *models.RefreshTokens) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.create(token)
+	return nil
+}
+
+func (r *MemoryTokenRepository) create(token *models.RefreshTokens) {
+	now := time.Now()
+	token.ID = r.nextID
+	token.CreatedAt = now
+	token.UpdatedAt = now
+	r.nextID++
+
+	r.tokens[token.ID] = *token
+}
+
+func (r *MemoryTokenRepository) FindRefreshToken(hash string) (models.RefreshTokens, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return models.RefreshTokens{}, ErrNotFound
+}
+
+func (r *MemoryTokenRepository) RotateRefreshToken(id uint, next *models.RefreshTokens) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return ErrTokenConsumed
+	}
+
+	now := time.Now()
+	token.UsedAt = &now
+	r.tokens[id] = token
+
+	r.create(next)
+	return nil
+}
+
+func (r *MemoryTokenRepository) RevokeFamily(familyId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeWhere(func(token models.RefreshTokens) bool { return token.FamilyID == familyId })
+	return nil
+}
+
+func (r *MemoryTokenRepository) RevokeUserSessions(userId int, keepFamilyId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeWhere(func(token models.RefreshTokens) bool {
+		return token.UserID == uint(userId) && token.FamilyID != keepFamilyId
+	})
+	return nil
+}
+
+func (r *MemoryTokenRepository) revokeWhere(match func(models.RefreshTokens) bool) {
+	now := time.Now()
+	for id, token := range r.tokens {
+		if token.RevokedAt == nil && match(token) {
+			token.RevokedAt = &now
+			r.tokens[id] = token
+		}
+	}
+}
+
+func (r *MemoryTokenRepository) RevokeSession(jti string, expiresAt time.Time, familyId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range r.revoked {
+		if exp.Before(now) {
+			delete(r.revoked, id)
+		}
+	}
+	r.revoked[jti] = expiresAt
+
+	r.revokeWhere(func(token models.RefreshTokens) bool { return token.FamilyID == familyId })
+	return nil
+}
+
+func (r *MemoryTokenRepository) PruneRefreshTokens(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned int64
+	for id, token := range r.tokens {
+		if token.ExpiresAt.Before(before) || (token.RevokedAt != nil && token.RevokedAt.Before(before)) {
+			delete(r.tokens, id)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+func (r *MemoryTokenRepository) IsRevoked(jti string, familyId string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.revoked[jti]; ok {
+		return true, nil
+	}
+	for _, token := range r.tokens {
+		if token.FamilyID == familyId && token.RevokedAt != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryUserRepository keeps users in a map, it is meant for tests and
+// running the service without a database.
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[uint]models.Users
+	nextID uint
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{users: map[uint]models.Users{}, nextID: 1}
+}
+
+// rows returns the live or the trashed users.
+func (r *MemoryUserRepository) rows(trashed bool) []models.Users {
+	users := make([]models.Users, 0, len(r.users))
+	for _, user := range r.users {
+		if user.DeletedAt.Valid == trashed {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (r *MemoryUserRepository) FindAll() ([]models.Users, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := r.rows(false)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *MemoryUserRepository) List(query ListQuery) ([]models.Users, Page, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return listMemory(r.rows(query.Trashed), userFields, query)
+}
+
+func (r *MemoryUserRepository) FindByID(id int) (models.Users, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[uint(id)]
+	if !ok || user.DeletedAt.Valid {
+		return models.Users{}, notFound("user", id)
+	}
+	return user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(email string) (models.Users, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email && !user.DeletedAt.Valid {
+			return user, nil
+		}
+	}
+	return models.Users{}, ErrNotFound
+}
+
+// emailTaken is the unique index on email, trashed users keep theirs.
+func (r *MemoryUserRepository) emailTaken(email string, id uint) bool {
+	for _, user := range r.users {
+		if user.Email == email && user.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryUserRepository) Create(user *models.Users) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, 0) {
+		return ErrEmailTaken
+	}
+
+	now := time.Now()
+	user.ID = r.nextID
+	user.Version = 1
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.nextID++
+
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) Update(id int, user models.Users) error {
+	return r.modify(id, user.Version, func(stored *models.Users) error {
+		if user.Email != "" && r.emailTaken(user.Email, stored.ID) {
+			return ErrEmailTaken
+		}
+
+		if user.Name != "" {
+			stored.Name = user.Name
+		}
+		if user.Email != "" {
+			stored.Email = user.Email
+		}
+		if user.Password != "" {
+			stored.Password = user.Password
+		}
+		if user.Role != "" {
+			stored.Role = user.Role
+		}
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) UpdatePassword(id int, hash string) error {
+	return r.modify(id, 0, func(stored *models.Users) error {
+		stored.Password = hash
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) RehashPassword(id int, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[uint(id)]
+	if !ok || stored.DeletedAt.Valid {
+		return notFound("user", id)
+	}
+	stored.Password = hash
+	r.users[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdateRole(id int, role string) error {
+	return r.modify(id, 0, func(stored *models.Users) error {
+		stored.Role = role
+		return nil
+	})
+}
+
+func (r *MemoryUserRepository) modify(id int, version uint, fn func(*models.Users) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[uint(id)]
+	if !ok || stored.DeletedAt.Valid {
+		return notFound("user", id)
+	}
+	if version != 0 && stored.Version != version {
+		return ErrVersionMismatch
+	}
+
+	if err := fn(&stored); err != nil {
+		return err
+	}
+	stored.Version++
+	stored.UpdatedAt = time.Now()
+	r.users[stored.ID] = stored
+	return nil
+}
+
+// Delete moves the user to the trash.
+func (r *MemoryUserRepository) Delete(id int, version uint) error {
+	return r.setDeleted(id, false, version, gorm.DeletedAt{Time: time.Now(), Valid: true})
+}
+
+// Restore bumps the version, the user comes back changed.
+func (r *MemoryUserRepository) Restore(id int) error {
+	return r.setDeleted(id, true, 0, gorm.DeletedAt{})
+}
+
+func (r *MemoryUserRepository) setDeleted(id int, trashed bool, version uint, deletedAt gorm.DeletedAt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[uint(id)]
+	if !ok || stored.DeletedAt.Valid != trashed {
+		return notFound("user", id)
+	}
+	if version != 0 && stored.Version != version {
+		return ErrVersionMismatch
+	}
+	if trashed {
+		stored.Version++
+	}
+	stored.DeletedAt = deletedAt
+	r.users[stored.ID] = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) Purge(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[uint(id)]; !ok {
+		return notFound("user", id)
+	}
+	delete(r.users, uint(id))
+	return nil
+}
+
+func (r *MemoryUserRepository) PurgeTrash(before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.users {
+		if user.DeletedAt.Valid && user.DeletedAt.Time.Before(before) {
+			delete(r.users, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
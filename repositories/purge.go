@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// TrashPurger permanently deletes what has been in the trash for longer
+// than Retention, and the refresh tokens of Tokens that expired or were
+// revoked more than TokenGrace ago. Every instance of the service may run
+// one, purging is idempotent.
+type TrashPurger struct {
+	Trashes   map[string]Trash
+	Retention time.Duration
+	Interval  time.Duration
+	Logger    *log.Logger
+	// Tokens is left alone when nil
+	Tokens     TokenRepository
+	TokenGrace time.Duration
+}
+
+func NewTrashPurger(retention, interval time.Duration, logger *log.Logger, trashes map[string]Trash) *TrashPurger {
+	return &TrashPurger{Trashes: trashes, Retention: retention, Interval: interval, Logger: logger}
+}
+
+// Purge empties every trash of the rows deleted before now - Retention and
+// returns how many rows each lost. It goes on after an error and returns
+// the first one.
+func (p *TrashPurger) Purge(now time.Time) (map[string]int64, error) {
+	names := make([]string, 0, len(p.Trashes))
+	for name := range p.Trashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var first error
+	purged := map[string]int64{}
+	for _, name := range names {
+		n, err := p.Trashes[name].PurgeTrash(now.Add(-p.Retention))
+		if err != nil && first == nil {
+			first = err
+		}
+		purged[name] = n
+	}
+
+	if p.Tokens != nil {
+		n, err := p.Tokens.PruneRefreshTokens(now.Add(-p.TokenGrace))
+		if err != nil && first == nil {
+			first = err
+		}
+		purged["refresh tokens"] = n
+	}
+	return purged, first
+}
+
+// Run purges every Interval until ctx is done.
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			purged, err := p.Purge(now)
+			if err != nil {
+				p.Logger.Printf("purging trash: %v", err)
+			}
+			for name, n := range purged {
+				if n > 0 {
+					p.Logger.Printf("purged %d %s", n, name)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"learn_testing/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashPurger(t *testing.T) {
+	books := NewMemoryBookRepository()
+	users := NewMemoryUserRepository()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, books.Create(&models.Books{Title: "a"}))
+	}
+	assert.NoError(t, users.Create(&models.Users{Email: "ahmad@gmail.com"}))
+	assert.NoError(t, books.Delete(1, 0))
+	assert.NoError(t, users.Delete(1, 0))
+
+	purger := NewTrashPurger(time.Hour, time.Minute, nil, map[string]Trash{"books": books, "users": users})
+
+	purged, err := purger.Purge(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"books": 0, "users": 0}, purged)
+
+	purged, err = purger.Purge(time.Now().Add(2 * time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"books": 1, "users": 1}, purged)
+
+	// live rows are never purged
+	_, err = books.FindByID(2)
+	assert.NoError(t, err)
+}
+
+func TestTrashPurgerPrunesRefreshTokens(t *testing.T) {
+	tokens := NewMemoryTokenRepository()
+	now := time.Now()
+	assert.NoError(t, tokens.CreateRefreshToken(&models.RefreshTokens{FamilyID: "expired", TokenHash: "a", ExpiresAt: now.Add(-2 * time.Hour)}))
+	assert.NoError(t, tokens.CreateRefreshToken(&models.RefreshTokens{FamilyID: "revoked", TokenHash: "b", ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, tokens.CreateRefreshToken(&models.RefreshTokens{FamilyID: "live", TokenHash: "c", ExpiresAt: now.Add(time.Hour)}))
+	assert.NoError(t, tokens.RevokeFamily("revoked"))
+
+	purger := NewTrashPurger(time.Hour, time.Minute, nil, map[string]Trash{})
+	purger.Tokens, purger.TokenGrace = tokens, 15*time.Minute
+
+	// the access tokens of the revoked family may not have expired yet
+	purged, err := purger.Purge(now)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"refresh tokens": 1}, purged)
+	revoked, _ := tokens.IsRevoked("", "revoked")
+	assert.True(t, revoked)
+
+	purged, err = purger.Purge(now.Add(30 * time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"refresh tokens": 1}, purged)
+
+	_, err = tokens.FindRefreshToken("c")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,346 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"learn_testing/apperrors"
+	"learn_testing/models"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrNotFound      = apperrors.NotFound("record not found")
+	ErrTokenConsumed = errors.New("refresh token was already used or revoked")
+	ErrEmailTaken    = apperrors.Conflict("email is already taken")
+	ErrISBNTaken     = apperrors.Conflict("isbn is already taken")
+
+	ErrNoCopyAvailable = apperrors.New(http.StatusConflict, "no_copy_available", "every copy of the book is on loan")
+	ErrLoanLimit       = apperrors.New(http.StatusConflict, "loan_limit_reached", "loan limit reached, return a book first")
+	ErrAlreadyBorrowed = apperrors.New(http.StatusConflict, "already_borrowed", "a copy of the book is already on loan to the user")
+	ErrNoOpenLoan      = apperrors.NotFound("the user has no copy of the book on loan")
+	ErrCopyOnLoan      = apperrors.Conflict("the copy is on loan or held for a user")
+	ErrCopyAvailable   = apperrors.New(http.StatusConflict, "copy_available", "a copy of the book is available, check it out instead")
+	ErrAlreadyHeld     = apperrors.New(http.StatusConflict, "already_held", "the user already has a hold on the book")
+	ErrNoHold          = apperrors.NotFound("the user has no hold on the book")
+
+	ErrAlreadyReviewed = apperrors.New(http.StatusConflict, "already_reviewed", "the user already reviewed the book, edit the review instead")
+
+	ErrShelfNameTaken = apperrors.Conflict("the user has a shelf with the name already")
+	ErrAlreadyShelved = apperrors.New(http.StatusConflict, "already_shelved", "the book is on the shelf already")
+	ErrNotShelved     = apperrors.NotFound("the book is not on the shelf")
+
+	ErrStillLent = apperrors.New(http.StatusConflict, "still_lent", "a copy is on loan, a fine is left to pay or a copy is held, settle them first")
+
+	ErrLoanFined      = apperrors.Conflict("the loan was fined already")
+	ErrExceedsBalance = apperrors.New(http.StatusUnprocessableEntity, "exceeds_balance", "the amount exceeds the balance of the fine")
+)
+
+// notFound wraps ErrNotFound with what was looked for.
+func notFound(kind string, id int) error {
+	return fmt.Errorf("%s %d: %w", kind, id, ErrNotFound)
+}
+
+// Trash is implemented by repositories whose Delete is soft: deleted rows
+// are hidden from every other method until they are restored or purged.
+// Restore returns ErrNotFound unless the row is in the trash, Purge deletes
+// a row for good whether it is in the trash or not, along with the rows
+// that refer to it but the fines, which keep its id. Purge returns
+// ErrStillLent for a book or user with a copy on loan, a late return not
+// fined yet, a fine left to pay or, for a user, a copy held for them.
+type Trash interface {
+	Restore(id int) error
+	Purge(id int) error
+	// PurgeTrash permanently deletes the rows trashed before before, the
+	// ones Purge would refuse are left for a later run.
+	PurgeTrash(before time.Time) (int64, error)
+}
+
+// UserRepository stores accounts. FindByID, FindByEmail, Update* and Delete
+// return ErrNotFound when no row matches, Create and Update return
+// ErrEmailTaken when another account has the email, trashed accounts
+// included. Emails are expected to be normalized with helpers.NormalizeEmail.
+//
+// Every change bumps the version of the user. Update (with user.Version)
+// and Delete take the version the caller read, they return
+// ErrVersionMismatch if the user changed meanwhile; 0 skips the check.
+type UserRepository interface {
+	Trash
+
+	FindAll() ([]models.Users, error)
+	List(query ListQuery) ([]models.Users, Page, error)
+	FindByID(id int) (models.Users, error)
+	FindByEmail(email string) (models.Users, error)
+	Create(user *models.Users) error
+	Update(id int, user models.Users) error
+	UpdatePassword(id int, hash string) error
+	// RehashPassword stores a new hash of the password the user has, it
+	// changes nothing they can see and leaves the version alone.
+	RehashPassword(id int, hash string) error
+	UpdateRole(id int, role string) error
+	Delete(id int, version uint) error
+}
+
+// BookRepository stores books. FindByID, FindByISBN, Update, Replace and
+// Delete return ErrNotFound when no row matches, Create, Update and Replace
+// return ErrISBNTaken when another book has the ISBN, trashed books
+// included. ISBNs are expected to be normalized with helpers.NormalizeISBN.
+// The authors and tags of a book are written along with it, Update leaves
+// them as they are when book.AuthorIDs or book.Tags is nil and writes the
+// Author and Publisher names along with AuthorIDs and PublisherID. Tags are
+// expected to be normalized with helpers.NormalizeTag.
+//
+// Every change bumps the version of the book. Update and Replace (with
+// book.Version) and Delete take the version the caller read, they return
+// ErrVersionMismatch if the book changed meanwhile; 0 skips the check.
+type BookRepository interface {
+	Trash
+
+	FindAll() ([]models.Books, error)
+	List(query ListQuery) ([]models.Books, Page, error)
+	ListByAuthor(authorID int, query ListQuery) ([]models.Books, Page, error)
+	ListByPublisher(publisherID int, query ListQuery) ([]models.Books, Page, error)
+	// Filter lists the books of filter, Facets counts the books it lists
+	// on every page.
+	Filter(filter BookFilter, query ListQuery) ([]models.Books, Page, error)
+	Facets(filter BookFilter, query ListQuery) (models.BookFacets, error)
+	FindByID(id int) (models.Books, error)
+	// FindByIDs finds the books of ids in one go, sorted by id, the ones
+	// that do not exist or are in the trash are left out.
+	FindByIDs(ids []uint) ([]models.Books, error)
+	FindByISBN(isbn string) (models.Books, error)
+	Create(book *models.Books) error
+	// Update writes the non zero fields of book, Replace writes all of them.
+	Update(id int, book models.Books) error
+	Replace(id int, book models.Books) error
+	Delete(id int, version uint) error
+}
+
+// FacetLimit is how many values of each facet Facets counts. Categories and
+// publishers are counted by ID, naming them is up to the caller, with one
+// FindByIDs each.
+const FacetLimit = 20
+
+// BookFilter narrows a list of books to the ones in any of CategoryIDs that
+// have every one of Tags, an empty field does not narrow it.
+type BookFilter struct {
+	CategoryIDs []uint
+	Tags        []string
+}
+
+// AuthorRepository stores authors. FindByID, FindByName, Update and Delete
+// return ErrNotFound when no row matches.
+type AuthorRepository interface {
+	List(query ListQuery) ([]models.Authors, Page, error)
+	FindByID(id int) (models.Authors, error)
+	// FindByName finds the first author whose name has the helpers.NameKey
+	// of name.
+	FindByName(name string) (models.Authors, error)
+	Create(author *models.Authors) error
+	Update(id int, author models.Authors) error
+	Delete(id int) error
+}
+
+// PublisherRepository stores publishers. FindByID, FindByName, Update and Delete
+// return ErrNotFound when no row matches.
+type PublisherRepository interface {
+	List(query ListQuery) ([]models.Publishers, Page, error)
+	FindByID(id int) (models.Publishers, error)
+	// FindByIDs finds the publishers of ids in one go, sorted by id, the
+	// ones that do not exist are left out.
+	FindByIDs(ids []uint) ([]models.Publishers, error)
+	// FindByName finds the first publisher whose name has the helpers.NameKey
+	// of name.
+	FindByName(name string) (models.Publishers, error)
+	Create(publisher *models.Publishers) error
+	Update(id int, publisher models.Publishers) error
+	Delete(id int) error
+}
+
+// CategoryRepository stores the category tree. FindByID, Update and Delete
+// return ErrNotFound when no row matches.
+type CategoryRepository interface {
+	FindAll() ([]models.Categories, error)
+	FindByID(id int) (models.Categories, error)
+	// FindByIDs finds the categories of ids in one go, sorted by id, the
+	// ones that do not exist are left out.
+	FindByIDs(ids []uint) ([]models.Categories, error)
+	Create(category *models.Categories) error
+	// Update writes the name, the parent and the fine of category, a nil
+	// ParentID makes it a root and a nil rate or cap inherits it.
+	Update(id int, category models.Categories) error
+	Delete(id int) error
+}
+
+// LoanFilter narrows a list of loans, zero fields do not narrow it. Open
+// keeps the loans that are not returned yet, DueBefore the open loans due
+// before it, which are overdue, and ReturnedLateSince the loans returned
+// after they were due since it.
+type LoanFilter struct {
+	UserID            uint
+	BookID            uint
+	Open              bool
+	DueBefore         *time.Time
+	ReturnedLateSince *time.Time
+}
+
+// HoldFilter narrows a list of holds, zero fields do not narrow it. Active
+// keeps the holds that are waiting or ready.
+type HoldFilter struct {
+	UserID uint
+	BookID uint
+	Active bool
+}
+
+// LoanRepository stores the copies of books, their loans and the holds on
+// them. A copy is on at most one open loan or ready hold, and a user
+// borrows or holds at most one copy of a book, even when they check out
+// concurrently.
+//
+// A copy that becomes free, returned, added or no longer held, goes to the
+// first waiting hold on its book, which is ready until pickupBy.
+type LoanRepository interface {
+	// ListCopies lists the copies of a book with their availability.
+	ListCopies(bookID int) ([]models.Copies, error)
+	AddCopy(copy *models.Copies, pickupBy time.Time) error
+	// DeleteCopy withdraws a copy, it returns ErrCopyOnLoan while the copy
+	// is lent or held and ErrNotFound when no copy matches.
+	DeleteCopy(id int) error
+
+	// Checkout lends the user the copy held for them, or else an available
+	// copy of the book, until due, unless the user has limit open loans
+	// already (ErrLoanLimit) or has the book already (ErrAlreadyBorrowed).
+	// It returns ErrNoCopyAvailable when every copy is on loan or held.
+	Checkout(bookID, userID int, due time.Time, limit int) (models.Loans, error)
+	// Return closes the open loan of the book to the user, ErrNoOpenLoan
+	// when there is none.
+	Return(bookID, userID int, pickupBy time.Time) (models.Loans, error)
+	List(filter LoanFilter, query ListQuery) ([]models.Loans, Page, error)
+
+	// PlaceHold queues the user for the book. It returns ErrCopyAvailable
+	// when there is no need to wait, ErrAlreadyHeld or ErrAlreadyBorrowed
+	// when the user waits for or has the book already.
+	PlaceHold(bookID, userID int) (models.Holds, error)
+	// CancelHold cancels the waiting or ready hold of the user on the book,
+	// ErrNoHold when there is none.
+	CancelHold(bookID, userID int, pickupBy time.Time) (models.Holds, error)
+	ListHolds(filter HoldFilter, query ListQuery) ([]models.Holds, Page, error)
+	// ExpireHolds expires the ready holds not picked up before now and
+	// returns how many expired.
+	ExpireHolds(now, pickupBy time.Time) (int64, error)
+}
+
+// ReportLimit is how many debtors a fine report lists.
+const ReportLimit = 20
+
+// FineFilter narrows a list of fines, zero fields do not narrow it.
+// Outstanding keeps the fines with a balance left.
+type FineFilter struct {
+	UserID      uint
+	LoanID      uint
+	Outstanding bool
+}
+
+// FineRepository stores the fines ledger: the fines charged for late
+// returns and the payments and waivers taken off them. FindByID and Settle
+// return ErrNotFound when no fine matches.
+type FineRepository interface {
+	// Charge records fine, ErrLoanFined when its loan has one already.
+	Charge(fine *models.Fines) error
+	FindByID(id int) (models.Fines, error)
+	List(filter FineFilter, query ListQuery) ([]models.Fines, Page, error)
+	// Balance sums what the user owes on every fine.
+	Balance(userID int) (int64, error)
+	// Settle takes entry, a payment or a waiver, off the fine and returns
+	// the fine with it. It returns ErrExceedsBalance when entry is more
+	// than the balance, even under concurrent settlements.
+	Settle(fineID int, entry *models.FineEntries) (models.Fines, error)
+	// Entries lists the payments and waivers of a fine, oldest first.
+	Entries(fineID int) ([]models.FineEntries, error)
+	// Report sums the fines charged from from to to, nil is open ended,
+	// with the ReportLimit users who owe the most on them.
+	Report(from, to *time.Time) (models.FineReport, error)
+}
+
+// ReviewRepository stores the reviews of books. FindByID, Update and Delete
+// return ErrNotFound when no review matches. Create, Update and Delete write
+// the rating of the book along with the review, so concurrent reviews can
+// not leave a stale rating behind.
+type ReviewRepository interface {
+	List(bookID int, query ListQuery) ([]models.Reviews, Page, error)
+	FindByID(id int) (models.Reviews, error)
+	// Create returns ErrAlreadyReviewed when the user reviewed the book
+	// already.
+	Create(review *models.Reviews) error
+	// Update writes the rating and the body of review.
+	Update(id int, review models.Reviews) error
+	Delete(id int) error
+	// Summary aggregates the reviews of a book.
+	Summary(bookID int) (models.RatingSummary, error)
+}
+
+// ShelfRepository stores the reading lists of users with the books on them.
+// FindByID, FindByToken, Update, Delete and the book methods return
+// ErrNotFound when no shelf matches, Create and Update return
+// ErrShelfNameTaken when another shelf of the user has the name. The shelves
+// it returns carry their BookIDs in order.
+type ShelfRepository interface {
+	List(userID int, query ListQuery) ([]models.Shelves, Page, error)
+	FindByID(id int) (models.Shelves, error)
+	// FindByToken finds the public shelf shared with token.
+	FindByToken(token string) (models.Shelves, error)
+	Create(shelf *models.Shelves) error
+	// Update writes the name, the visibility and the share token of shelf.
+	Update(id int, shelf models.Shelves) error
+	Delete(id int) error
+	// AddBook puts the book on the shelf at position, from 1, or last when
+	// position is 0 or past the end. It returns ErrAlreadyShelved when the
+	// book is on the shelf already.
+	AddBook(id, bookID, position int) error
+	// RemoveBook returns ErrNotShelved when the book is not on the shelf.
+	RemoveBook(id, bookID int) error
+	// Reorder moves bookIDs to the front of the shelf in their order, the
+	// other books follow in the order they had. It returns ErrNotShelved
+	// when one of bookIDs is not on the shelf.
+	Reorder(id int, bookIDs []uint) error
+}
+
+// AuditRepository stores the audit trail of books and users. History lists
+// the events of one record, oldest first unless query sorts otherwise.
+// FindEvent returns ErrNotFound when no event matches.
+type AuditRepository interface {
+	Record(event *models.AuditEvents) error
+	History(entityType string, entityID uint, query ListQuery) ([]models.AuditEvents, Page, error)
+	FindEvent(id int) (models.AuditEvents, error)
+}
+
+// BookSearcher finds books by full-text search.
+type BookSearcher interface {
+	Search(query string, limit int) ([]models.BookSearchResult, error)
+}
+
+// BookIndexer re-reads into the search index the books of an author or a
+// publisher that was renamed.
+type BookIndexer interface {
+	ReindexAuthor(id int) error
+	ReindexPublisher(id int) error
+}
+
+// TokenRepository stores refresh tokens and the access token deny list.
+type TokenRepository interface {
+	CreateRefreshToken(token *models.RefreshTokens) error
+	FindRefreshToken(hash string) (models.RefreshTokens, error)
+	// RotateRefreshToken marks the token id as used and stores next in the
+	// same transaction, it returns ErrTokenConsumed if id was used meanwhile.
+	RotateRefreshToken(id uint, next *models.RefreshTokens) error
+	RevokeFamily(familyId string) error
+	RevokeUserSessions(userId int, keepFamilyId string) error
+	// RevokeSession denies the access token jti and revokes its token family.
+	RevokeSession(jti string, expiresAt time.Time, familyId string) error
+	IsRevoked(jti string, familyId string) (bool, error)
+	// PruneRefreshTokens deletes the refresh tokens that expired or were
+	// revoked before before and returns how many. IsRevoked goes by the
+	// revoked tokens of a family, so before has to leave the access tokens
+	// issued with them time to expire.
+	PruneRefreshTokens(before time.Time) (int64, error)
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"learn_testing/models"
+	"log"
+	"time"
+)
+
+// FineSweeper fines the late returns that were not fined when they were
+// returned, because the service stopped or charging failed in between.
+// Every instance of the service may run one, charging is idempotent per
+// loan.
+type FineSweeper struct {
+	Loans LoanRepository
+	// Charge fines a returned loan, ErrLoanFined when it was fined already
+	Charge   func(loan models.Loans) (*models.Fines, error)
+	Window   time.Duration
+	Interval time.Duration
+	Logger   *log.Logger
+}
+
+func NewFineSweeper(loans LoanRepository, charge func(models.Loans) (*models.Fines, error), window, interval time.Duration, logger *log.Logger) *FineSweeper {
+	return &FineSweeper{Loans: loans, Charge: charge, Window: window, Interval: interval, Logger: logger}
+}
+
+// Sweep charges the loans returned late in the Window before now that have
+// no fine yet and returns how many it fined.
+func (s *FineSweeper) Sweep(now time.Time) (int64, error) {
+	since := now.Add(-s.Window)
+	query := ListQuery{Limit: MaxLimit}
+
+	var charged int64
+	for {
+		loans, page, err := s.Loans.List(LoanFilter{ReturnedLateSince: &since}, query)
+		if err != nil {
+			return charged, err
+		}
+		for _, loan := range loans {
+			fine, err := s.Charge(loan)
+			if errors.Is(err, ErrLoanFined) {
+				continue
+			}
+			if err != nil {
+				return charged, err
+			}
+			if fine != nil {
+				charged++
+			}
+		}
+		if page.Next == "" {
+			return charged, nil
+		}
+		query.Cursor = page.Next
+	}
+}
+
+// Run sweeps every Interval until ctx is done.
+func (s *FineSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			charged, err := s.Sweep(now)
+			if err != nil {
+				s.Logger.Printf("sweeping fines: %v", err)
+			}
+			if charged > 0 {
+				s.Logger.Printf("fined %d late returns", charged)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"learn_testing/apperrors"
+
+	"gorm.io/gorm"
+)
+
+// ErrVersionMismatch is returned by conditional writes when the row was
+// changed since the caller read it.
+var ErrVersionMismatch = apperrors.PreconditionFailed("the record was changed since it was read")
+
+// whereVersion only matches the row if it still has version, 0 matches any.
+func whereVersion(db *gorm.DB, version uint) *gorm.DB {
+	if version == 0 {
+		return db
+	}
+	return db.Where("version = ?", version)
+}
+
+// versioned writes values to row id of model and bumps its version, see
+// whereVersion.
+func versioned(db *gorm.DB, model interface{}, kind string, id int, version uint, values map[string]interface{}) error {
+	values["version"] = gorm.Expr("version + 1")
+	res := whereVersion(db.Model(model).Where("id = ?", id), version).Updates(values)
+	return versionResult(db, res, model, kind, id, version)
+}
+
+// versionResult tells a stale version from a missing row when a
+// conditional write matched nothing.
+func versionResult(db *gorm.DB, res *gorm.DB, model interface{}, kind string, id int, version uint) error {
+	if res.Error != nil || res.RowsAffected > 0 || version == 0 {
+		return affected(res, kind, id)
+	}
+
+	var count int64
+	if err := db.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return notFound(kind, id)
+}
@@ -1,46 +1,193 @@
 package routes
 
 import (
+	"context"
+	"learn_testing/apperrors"
 	"learn_testing/config"
 	c "learn_testing/controllers"
+	"learn_testing/helpers"
 	m "learn_testing/middleware"
+	"learn_testing/models"
+	"learn_testing/repositories"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
 )
 
-func New() *echo.Echo {
+func New(cfg *config.AppConfig, db *gorm.DB) *echo.Echo {
 
 	e := echo.New()
+	e.HTTPErrorHandler = apperrors.HTTPErrorHandler
+	e.Validator = helpers.NewValidator()
+
+	// DEPENDENCIES
+	userRepository := repositories.NewGormUserRepository(db)
+	bookRepository, err := repositories.NewIndexedBookRepository(repositories.NewGormBookRepository(db))
+	if err != nil {
+		panic(err)
+	}
+	tokenRepository := repositories.NewGormTokenRepository(db)
+	auditRepository := repositories.NewGormAuditRepository(db)
+	authorRepository := repositories.NewGormAuthorRepository(db)
+	publisherRepository := repositories.NewGormPublisherRepository(db)
+	categoryRepository := repositories.NewGormCategoryRepository(db)
+	loanRepository := repositories.NewGormLoanRepository(db)
+	fineRepository := repositories.NewGormFineRepository(db)
+	reviewRepository := repositories.NewGormReviewRepository(db)
+	shelfRepository := repositories.NewGormShelfRepository(db)
+
+	tokenIssuer := m.NewTokenIssuer(cfg.JWT.Secret, cfg.JWT.AccessTokenTTL, cfg.JWT.RefreshTokenTTL)
+
+	userController := c.NewUserController(userRepository, tokenRepository, tokenIssuer, auditRepository)
+	bookController := c.NewBookController(bookRepository, bookRepository, auditRepository, authorRepository, publisherRepository, categoryRepository, reviewRepository)
+	authorController := c.NewAuthorController(authorRepository, bookRepository, bookRepository, auditRepository)
+	publisherController := c.NewPublisherController(publisherRepository, bookRepository, bookRepository, auditRepository)
+	categoryController := c.NewCategoryController(categoryRepository, bookRepository)
+	reviewController := c.NewReviewController(reviewRepository, bookRepository)
+	shelfController := c.NewShelfController(shelfRepository, bookRepository)
+	fineController := c.NewFineController(fineRepository, bookRepository, categoryRepository, c.FineRates{
+		DailyRate: cfg.Fines.DailyRate,
+		Cap:       cfg.Fines.Cap,
+		Currency:  cfg.Fines.Currency,
+	})
+	loanController := c.NewLoanController(loanRepository, bookRepository, cfg.Lending.LoanPeriod, cfg.Lending.MaxLoans, cfg.Lending.HoldPickupPeriod, fineController)
+	tokenController := c.NewTokenController(userRepository, tokenRepository, tokenIssuer)
+
+	// deleted books and users are purged once their retention ran out, the
+	// refresh tokens once the access tokens issued with them expired too
+	if cfg.Trash.PurgeInterval > 0 {
+		purger := repositories.NewTrashPurger(cfg.Trash.Retention, cfg.Trash.PurgeInterval, e.StdLogger, map[string]repositories.Trash{
+			"books": bookRepository,
+			"users": userRepository,
+		})
+		purger.Tokens, purger.TokenGrace = tokenRepository, cfg.JWT.AccessTokenTTL
+		go purger.Run(context.Background())
+	}
+
+	// copies not picked up in time go to the next hold on their book
+	if cfg.Lending.HoldExpiryInterval > 0 {
+		expirer := repositories.NewHoldExpirer(loanRepository, cfg.Lending.HoldPickupPeriod, cfg.Lending.HoldExpiryInterval, e.StdLogger)
+		go expirer.Run(context.Background())
+	}
+
+	// late returns whose fine was not charged on return are fined
+	if cfg.Fines.SweepInterval > 0 {
+		sweeper := repositories.NewFineSweeper(loanRepository, fineController.Charge, cfg.Fines.SweepWindow, cfg.Fines.SweepInterval, e.StdLogger)
+		go sweeper.Run(context.Background())
+	}
 
 	// ROUTING
 	// version
 	v1 := e.Group("/v1")
 	// Logging
-	m.LogMiddleware(e)
+	m.LogMiddleware(e, cfg.Log.Format)
 
 	// // routing /users to handler function
-	v1.POST("/users", c.CreateUserController)
-	v1.POST("/login", c.LoginUserController)
+	v1.POST("/users", userController.CreateUserController)
+	v1.POST("/login", userController.LoginUserController)
+	v1.POST("/token/refresh", tokenController.RefreshTokenController)
 
 	// // routing /book to handler function
-	v1.GET("/books", c.GetBooksController)
-	v1.GET("/books/:id", c.GetBookController)
+	v1.GET("/books", bookController.GetBooksController)
+	v1.GET("/books/search", bookController.SearchBooksController)
+	v1.GET("/books/isbn/:isbn", bookController.GetBookByISBNController)
+	v1.GET("/authors", authorController.GetAuthorsController)
+	v1.GET("/authors/:id", authorController.GetAuthorController)
+	v1.GET("/authors/:id/books", authorController.GetAuthorBooksController)
+	v1.GET("/publishers", publisherController.GetPublishersController)
+	v1.GET("/publishers/:id", publisherController.GetPublisherController)
+	v1.GET("/publishers/:id/books", publisherController.GetPublisherBooksController)
+	v1.GET("/categories", categoryController.GetCategoriesController)
+	v1.GET("/categories/:id", categoryController.GetCategoryController)
+	v1.GET("/books/:id", bookController.GetBookController)
+	v1.GET("/books/:id/copies", loanController.GetCopiesController)
+	v1.GET("/books/:id/reviews", reviewController.GetReviewsController)
+	v1.GET("/shelves/shared/:token", shelfController.GetSharedShelfController).Name = c.SharedShelfRoute
 
 	// JWT AUTH
 	jwtAuthV1 := v1.Group("")
-	jwtAuthV1.Use(middleware.JWT([]byte(config.ViperEnvVariable("SECRET_KEY"))))
+	jwtAuthV1.Use(middleware.JWT(tokenIssuer.Secret), m.RevocationCheck(tokenRepository))
+
+	jwtAuthV1.POST("/logout", tokenController.LogoutController)
+
+	// ROLES
+	adminOnly := m.RequireRoles(models.RoleAdmin)
+	staffOnly := m.RequireRoles(models.RoleAdmin, models.RoleLibrarian)
+	selfOrAdmin := m.RequireSelfOrRoles("id", models.RoleAdmin)
+
+	// routing /auth/me to handler function
+	jwtAuthV1.GET("/me", userController.GetMeController)
+	jwtAuthV1.PUT("/me", userController.UpdateMeController)
+	jwtAuthV1.DELETE("/me", userController.DeleteMeController)
+	jwtAuthV1.PUT("/me/password", userController.ChangeMyPasswordController)
+	jwtAuthV1.GET("/me/loans", loanController.GetMyLoansController)
+	jwtAuthV1.GET("/me/holds", loanController.GetMyHoldsController)
+	jwtAuthV1.GET("/me/fines", fineController.GetMyFinesController)
+
+	// routing /auth/me/shelves to handler function
+	jwtAuthV1.GET("/me/shelves", shelfController.GetMyShelvesController)
+	jwtAuthV1.POST("/me/shelves", shelfController.CreateShelfController)
+	jwtAuthV1.GET("/me/shelves/:id", shelfController.GetMyShelfController)
+	jwtAuthV1.PUT("/me/shelves/:id", shelfController.UpdateShelfController)
+	jwtAuthV1.DELETE("/me/shelves/:id", shelfController.DeleteShelfController)
+	jwtAuthV1.POST("/me/shelves/:id/books", shelfController.AddShelfBookController)
+	jwtAuthV1.PUT("/me/shelves/:id/books", shelfController.ReorderShelfController)
+	jwtAuthV1.DELETE("/me/shelves/:id/books/:book_id", shelfController.RemoveShelfBookController)
 
 	// // routing /auth/users to handler function
-	jwtAuthV1.GET("/users", c.GetUsersController)
-	jwtAuthV1.GET("/users/:id", c.GetUserController)
-	jwtAuthV1.DELETE("/users/:id", c.DeleteUserController)
-	jwtAuthV1.PUT("/users/:id", c.UpdateUserController)
+	jwtAuthV1.GET("/users", userController.GetUsersController, adminOnly)
+	jwtAuthV1.GET("/users/trash", userController.GetTrashedUsersController, adminOnly)
+	jwtAuthV1.POST("/users/:id/restore", userController.RestoreUserController, adminOnly)
+	jwtAuthV1.GET("/users/:id/history", userController.GetUserHistoryController, adminOnly)
+	jwtAuthV1.GET("/users/:id", userController.GetUserController, selfOrAdmin)
+	jwtAuthV1.DELETE("/users/:id", userController.DeleteUserController, selfOrAdmin)
+	jwtAuthV1.PUT("/users/:id", userController.UpdateUserController, selfOrAdmin)
+	jwtAuthV1.PATCH("/users/:id", userController.PatchUserController, selfOrAdmin)
+	jwtAuthV1.PUT("/users/:id/role", userController.UpdateUserRoleController, adminOnly)
 
 	// routing /auth//books to handler function
-	jwtAuthV1.POST("/books", c.CreateBookController)
-	jwtAuthV1.DELETE("/books/:id", c.DeleteBookController)
-	jwtAuthV1.PUT("/books/:id", c.UpdateBookController)
+	jwtAuthV1.POST("/books", bookController.CreateBookController, staffOnly)
+	jwtAuthV1.GET("/books/trash", bookController.GetTrashedBooksController, staffOnly)
+	jwtAuthV1.POST("/books/:id/restore", bookController.RestoreBookController, staffOnly)
+	jwtAuthV1.GET("/books/:id/history", bookController.GetBookHistoryController, staffOnly)
+	jwtAuthV1.POST("/books/:id/history/:revision/revert", bookController.RevertBookController, staffOnly)
+	jwtAuthV1.DELETE("/books/:id", bookController.DeleteBookController, staffOnly)
+	jwtAuthV1.PUT("/books/:id", bookController.UpdateBookController, staffOnly)
+	jwtAuthV1.PATCH("/books/:id", bookController.PatchBookController, staffOnly)
+
+	// routing /auth/books/:id/checkout, the holds and the copies to handler function
+	jwtAuthV1.POST("/books/:id/checkout", loanController.CheckoutController)
+	jwtAuthV1.POST("/books/:id/return", loanController.ReturnController)
+	jwtAuthV1.POST("/books/:id/holds", loanController.PlaceHoldController)
+	jwtAuthV1.DELETE("/books/:id/holds", loanController.CancelHoldController)
+	jwtAuthV1.GET("/books/:id/holds", loanController.GetBookHoldsController, staffOnly)
+	jwtAuthV1.POST("/books/:id/copies", loanController.AddCopyController, staffOnly)
+	jwtAuthV1.DELETE("/copies/:id", loanController.DeleteCopyController, staffOnly)
+	jwtAuthV1.GET("/loans/overdue", loanController.GetOverdueLoansController, staffOnly)
+
+	// routing /auth/reviews to handler function
+	jwtAuthV1.POST("/books/:id/reviews", reviewController.CreateReviewController)
+	jwtAuthV1.PUT("/reviews/:id", reviewController.UpdateReviewController)
+	jwtAuthV1.DELETE("/reviews/:id", reviewController.DeleteReviewController)
+
+	// routing /auth/fines to handler function
+	jwtAuthV1.GET("/fines", fineController.GetFinesController, staffOnly)
+	jwtAuthV1.GET("/fines/report", fineController.GetFineReportController, adminOnly)
+	jwtAuthV1.GET("/fines/:id", fineController.GetFineController, staffOnly)
+	jwtAuthV1.POST("/fines/:id/payments", fineController.PayFineController, staffOnly)
+	jwtAuthV1.POST("/fines/:id/waivers", fineController.WaiveFineController, staffOnly)
+
+	// routing /auth/authors, /auth/publishers and /auth/categories to handler function
+	jwtAuthV1.POST("/authors", authorController.CreateAuthorController, staffOnly)
+	jwtAuthV1.PUT("/authors/:id", authorController.UpdateAuthorController, staffOnly)
+	jwtAuthV1.DELETE("/authors/:id", authorController.DeleteAuthorController, staffOnly)
+	jwtAuthV1.POST("/publishers", publisherController.CreatePublisherController, staffOnly)
+	jwtAuthV1.PUT("/publishers/:id", publisherController.UpdatePublisherController, staffOnly)
+	jwtAuthV1.DELETE("/publishers/:id", publisherController.DeletePublisherController, staffOnly)
+	jwtAuthV1.POST("/categories", categoryController.CreateCategoryController, staffOnly)
+	jwtAuthV1.PUT("/categories/:id", categoryController.UpdateCategoryController, staffOnly)
+	jwtAuthV1.DELETE("/categories/:id", categoryController.DeleteCategoryController, staffOnly)
 
 	return e
 }
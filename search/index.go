@@ -0,0 +1,317 @@
+// Package search is a small in-process full-text index with prefix
+// matching, typo tolerance, ranking and highlighting.
+//
+// The index lives in memory and is rebuilt from the database at startup,
+// every running instance keeps its own copy.
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	exactScore  = 1.0
+	prefixScore = 0.7
+	typoScore   = 0.5
+)
+
+// Hit is a matching document. Highlights holds the matching fields with the
+// matched words wrapped in <mark>, the rest of the text is HTML escaped.
+type Hit struct {
+	ID         uint
+	Score      float64
+	Highlights map[string]string
+}
+
+// span is where a term occurs in a field, in bytes.
+type span struct {
+	field      string
+	start, end int
+}
+
+type Index struct {
+	mu       sync.RWMutex
+	weights  map[string]float64
+	postings map[string]map[uint][]span
+	docs     map[uint]map[string]string
+}
+
+// NewIndex returns an empty index, weights ranks a match in one field over
+// another, fields without a weight count 1.
+func NewIndex(weights map[string]float64) *Index {
+	return &Index{
+		weights:  weights,
+		postings: map[string]map[uint][]span{},
+		docs:     map[uint]map[string]string{},
+	}
+}
+
+// Len is the number of documents in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.docs)
+}
+
+// Put adds the document or replaces its previous version.
+func (ix *Index) Put(id uint, fields map[string]string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+
+	doc := map[string]string{}
+	for field, text := range fields {
+		doc[field] = text
+		for _, t := range tokenize(text) {
+			if ix.postings[t.term] == nil {
+				ix.postings[t.term] = map[uint][]span{}
+			}
+			ix.postings[t.term][id] = append(ix.postings[t.term][id], span{field, t.start, t.end})
+		}
+	}
+	ix.docs[id] = doc
+}
+
+func (ix *Index) Remove(id uint) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id uint) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, text := range doc {
+		for _, t := range tokenize(text) {
+			delete(ix.postings[t.term], id)
+			if len(ix.postings[t.term]) == 0 {
+				delete(ix.postings, t.term)
+			}
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// Search returns up to limit documents containing every word of query,
+// best first. Every word also matches longer words it is a prefix of and,
+// from four letters on, words one or two typos away.
+func (ix *Index) Search(query string, limit int) []Hit {
+	words := tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	scores := map[uint]float64{}
+	matched := map[uint][]span{}
+
+	for i, word := range words {
+		best := map[uint]float64{}
+		for term, docs := range ix.postings {
+			quality := match(word.term, term)
+			if quality == 0 {
+				continue
+			}
+			// rare terms say more about a document than common ones
+			idf := math.Log(1 + float64(len(ix.docs))/float64(len(docs)))
+
+			for id, spans := range docs {
+				if i > 0 {
+					if _, ok := scores[id]; !ok {
+						continue
+					}
+				}
+				for _, s := range spans {
+					if score := quality * idf * ix.weight(s.field); score > best[id] {
+						best[id] = score
+					}
+					matched[id] = append(matched[id], s)
+				}
+			}
+		}
+
+		// every word has to match
+		next := map[uint]float64{}
+		for id, score := range best {
+			next[id] = scores[id] + score
+		}
+		scores = next
+		if len(scores) == 0 {
+			return nil
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	for i := range hits {
+		hits[i].Highlights = highlight(ix.docs[hits[i].ID], matched[hits[i].ID])
+	}
+	return hits
+}
+
+func (ix *Index) weight(field string) float64 {
+	if w, ok := ix.weights[field]; ok {
+		return w
+	}
+	return 1
+}
+
+// match rates how well term in the index matches word of the query, 0 for
+// no match.
+func match(word, term string) float64 {
+	if word == term {
+		return exactScore
+	}
+	if strings.HasPrefix(term, word) {
+		// "har" is a better match for "harry" than for "harrowing"
+		return prefixScore * float64(len(word)) / float64(len(term))
+	}
+
+	allowed := maxTypos(word)
+	if allowed == 0 {
+		return 0
+	}
+	diff := utf8.RuneCountInString(term) - utf8.RuneCountInString(word)
+	if diff > allowed || -diff > allowed {
+		return 0
+	}
+	if typos := levenshtein(word, term, allowed); typos <= allowed {
+		return typoScore / float64(typos)
+	}
+	return 0
+}
+
+// short words get no typo tolerance, they would match almost anything
+func maxTypos(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein is the edit distance between a and b, it gives up and returns
+// max+1 as soon as the distance is known to exceed max.
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower case words of letters and digits,
+// keeping their byte offsets for highlighting.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		}
+		if !isWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func highlight(doc map[string]string, spans []span) map[string]string {
+	byField := map[string][]span{}
+	for _, s := range spans {
+		byField[s.field] = append(byField[s.field], s)
+	}
+
+	highlights := map[string]string{}
+	for field, spans := range byField {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+		text := doc[field]
+		var b strings.Builder
+		last := 0
+		for _, s := range spans {
+			if s.start < last {
+				continue
+			}
+			b.WriteString(html.EscapeString(text[last:s.start]))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(text[s.start:s.end]))
+			b.WriteString("</mark>")
+			last = s.end
+		}
+		b.WriteString(html.EscapeString(text[last:]))
+		highlights[field] = b.String()
+	}
+	return highlights
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIndex() *Index {
+	ix := NewIndex(map[string]float64{"title": 3, "author": 2, "publisher": 1})
+	ix.Put(1, map[string]string{"title": "Harry Potter and the Philosopher's Stone", "author": "J.K. Rowling", "publisher": "Bloomsbury"})
+	ix.Put(2, map[string]string{"title": "The Hobbit", "author": "J.R.R. Tolkien", "publisher": "Allen & Unwin"})
+	ix.Put(3, map[string]string{"title": "Laskar Pelangi", "author": "Andrea Hirata", "publisher": "Bentang Pustaka"})
+	ix.Put(4, map[string]string{"title": "Sang Pemimpi", "author": "Andrea Hirata", "publisher": "Bentang Pustaka"})
+	ix.Put(5, map[string]string{"title": "Stone Soup", "author": "Marcia Brown", "publisher": "Harry Abrams"})
+	return ix
+}
+
+func ids(hits []Hit) []uint {
+	var ids []uint
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestIndexSearch(t *testing.T) {
+	testCase := []struct {
+		Name      string
+		Query     string
+		ExpectIDs []uint
+	}{
+		{"exact", "hobbit", []uint{2}},
+		{"case and punctuation", "HOBBIT!", []uint{2}},
+		{"prefix", "pelan", []uint{3}},
+		{"typo", "hobit", []uint{2}},
+		{"two typos in a long word", "philosofer", []uint{1}},
+		{"no typos in short words", "sag", nil},
+		{"every word must match", "andrea pemimpi", []uint{4}},
+		{"title ranks above publisher", "harry", []uint{1, 5}},
+		{"no match", "dune", nil},
+		{"empty", "  ", nil},
+	}
+
+	ix := newTestIndex()
+	for _, val := range testCase {
+		t.Run(val.Name, func(t *testing.T) {
+			assert.Equal(t, val.ExpectIDs, ids(ix.Search(val.Query, 10)))
+		})
+	}
+}
+
+func TestIndexHighlight(t *testing.T) {
+	hits := newTestIndex().Search("stone harr", 10)
+
+	assert.Equal(t, []uint{1, 5}, ids(hits))
+	assert.Equal(t, "<mark>Harry</mark> Potter and the Philosopher&#39;s <mark>Stone</mark>", hits[0].Highlights["title"])
+	assert.Equal(t, "<mark>Stone</mark> Soup", hits[1].Highlights["title"])
+	assert.Equal(t, "<mark>Harry</mark> Abrams", hits[1].Highlights["publisher"])
+	assert.NotContains(t, hits[0].Highlights, "author")
+}
+
+func TestIndexPutAndRemove(t *testing.T) {
+	ix := newTestIndex()
+
+	ix.Put(2, map[string]string{"title": "The Lord of the Rings", "author": "J.R.R. Tolkien"})
+	assert.Empty(t, ix.Search("hobbit", 10))
+	assert.Equal(t, []uint{2}, ids(ix.Search("rings", 10)))
+
+	ix.Remove(2)
+	assert.Empty(t, ix.Search("tolkien", 10))
+	assert.Equal(t, 4, ix.Len())
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("buku", "buku", 2))
+	assert.Equal(t, 1, levenshtein("buku", "buka", 2))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting", 3))
+	// gives up past max
+	assert.Equal(t, 2, levenshtein("kitten", "sitting", 1))
+}